@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/node"
+	controllerSystem "github.com/rhosocial/go-rush-producer/controllers/server"
+	"github.com/rhosocial/go-rush-producer/models"
+	CronJob "github.com/rhosocial/go-rush-producer/models/cron_job"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	NodeInfoLegacy "github.com/rhosocial/go-rush-producer/models/node_info_legacy"
+	NodeLog "github.com/rhosocial/go-rush-producer/models/node_log"
+	Shard "github.com/rhosocial/go-rush-producer/models/shard"
+	Task "github.com/rhosocial/go-rush-producer/models/task"
+	WebhookDelivery "github.com/rhosocial/go-rush-producer/models/webhook_delivery"
+)
+
+// defaultConfigPath 默认配置文件路径。若使用默认路径且文件不存在，则仅使用默认值和环境变量。
+const defaultConfigPath = "default.yaml"
+
+var ErrCommandUnknown = errors.New("unknown command")
+
+const usage = `Usage: go-rush-producer <command> [flags]
+
+Commands:
+  serve           Start the node (default when no command is given).
+  status          Query the status of a running node.
+  nodes list      List the nodes in the registry.
+  handover        Ask a running master to hand over to a slave.
+  tasks submit    Submit a task to a running master.
+  migrate         Create or update the registry tables.
+  config print    Print the effective configuration.
+  config reload   Ask a running node to reload its configuration.
+  admin topology  Show the registry tree through a running node.
+  admin logs      Show node logs through a running node.
+  admin legacy    Show removed nodes through a running node.
+  admin webhooks  Show webhook deliveries through a running node.
+  admin tasks     Show tasks through a running node.
+  admin shards    Show shard ownership through a running node.
+  admin jobs      Show scheduled job runs through a running node.
+
+Run 'go-rush-producer <command> -h' for the flags of each command.
+`
+
+// runCommand 解析命令行参数并执行子命令。未指定子命令或首个参数为选项时，执行 serve，以兼容旧的启动方式。
+func runCommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return commandServe(args)
+	}
+	switch args[0] {
+	case "serve":
+		return commandServe(args[1:])
+	case "status":
+		return commandStatus(args[1:])
+	case "nodes":
+		if len(args) > 1 && args[1] == "list" {
+			return commandNodesList(args[2:])
+		}
+	case "handover":
+		return commandHandover(args[1:])
+	case "tasks":
+		if len(args) > 1 && args[1] == "submit" {
+			return commandTasksSubmit(args[2:])
+		}
+	case "migrate":
+		return commandMigrate(args[1:])
+	case "config":
+		if len(args) > 1 && args[1] == "print" {
+			return commandConfigPrint(args[2:])
+		}
+		if len(args) > 1 && args[1] == "reload" {
+			return commandConfigReload(args[2:])
+		}
+	case "admin":
+		if len(args) > 1 && args[1] == "topology" {
+			return commandAdminTopology(args[2:])
+		}
+		if len(args) > 1 && args[1] == "logs" {
+			return commandAdminLogs(args[2:])
+		}
+		if len(args) > 1 && args[1] == "legacy" {
+			return commandAdminLegacy(args[2:])
+		}
+		if len(args) > 1 && args[1] == "webhooks" {
+			return commandAdminWebhooks(args[2:])
+		}
+		if len(args) > 1 && args[1] == "tasks" {
+			return commandAdminTasks(args[2:])
+		}
+		if len(args) > 1 && args[1] == "shards" {
+			return commandAdminShards(args[2:])
+		}
+		if len(args) > 1 && args[1] == "jobs" {
+			return commandAdminJobs(args[2:])
+		}
+	case "help":
+		fmt.Print(usage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("%w: %s", ErrCommandUnknown, strings.Join(args, " "))
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	config := flags.String("config", defaultConfigPath, "path of the configuration file")
+	return flags, config
+}
+
+// ---- serve ---- //
+
+func commandServe(args []string) error {
+	flags, config := newFlagSet("serve")
+	identity := flags.Int("identity", -1, "override the identity: 0 standalone, 1 master, 2 slave, 3 either")
+	port := flags.Uint("port", 0, "override the listening port")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *port > 65535 {
+		return fmt.Errorf("invalid port: %d", *port)
+	}
+	return serve(*config, *identity, *port)
+}
+
+// ---- status ---- //
+
+func commandStatus(args []string) error {
+	flags, config := newFlagSet("status")
+	addr := flags.String("addr", "", "address of the node, defaults to 127.0.0.1 with the configured listening port")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(*config); err != nil {
+		return err
+	}
+	result := make(map[string]json.RawMessage)
+	for name, path := range map[string]string{"server": "/server", "master": "/server/master", "config": "/server/config"} {
+		body, err := requestNode(http.MethodGet, nodeAddress(*addr), path, nil, clusterSecret())
+		if err != nil {
+			return err
+		}
+		result[name] = body
+	}
+	return printJSON(result)
+}
+
+// ---- nodes list ---- //
+
+func commandNodesList(args []string) error {
+	flags, config := newFlagSet("nodes list")
+	zone := flags.String("zone", "", "only list nodes in this zone")
+	rack := flags.String("rack", "", "only list nodes in this rack")
+	label := flags.String("label", "", "only list nodes with these labels, formatted as k1=v1,k2=v2")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(*config); err != nil {
+		return err
+	}
+	labels, err := models.ParseNodeLabels(*label)
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	nodes, err := NodeInfo.GetNodesBySelector(db, &models.NodeSelector{Zone: *zone, Rack: *rack, Labels: labels})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSOCKET\tLEVEL\tSUPERIOR\tTURN\tZONE\tRACK\tWEIGHT\tLABELS\tUPDATED")
+	for _, n := range *nodes {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%d\t%s\t%s\n",
+			n.ID, n.Name, n.Socket(), n.Level, n.SuperiorID, n.Turn, n.Zone, n.Rack, n.Weight, n.Labels.String(), n.UpdatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
+
+// ---- handover ---- //
+
+func commandHandover(args []string) error {
+	flags, config := newFlagSet("handover")
+	addr := flags.String("addr", "", "address of the master, defaults to 127.0.0.1 with the configured listening port")
+	candidate := flags.Uint64("candidate", 0, "ID of the slave to hand over to, defaults to the first in succession")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(*config); err != nil {
+		return err
+	}
+	form := url.Values{}
+	if *candidate > 0 {
+		form.Set("candidate", strconv.FormatUint(*candidate, 10))
+	}
+	body, err := requestNode(http.MethodPost, nodeAddress(*addr), "/server/master/action/handover", []byte(form.Encode()), clusterSecret())
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+// ---- tasks submit ---- //
+
+func commandTasksSubmit(args []string) error {
+	flags, config := newFlagSet("tasks submit")
+	addr := flags.String("addr", "", "address of the master, defaults to 127.0.0.1 with the configured listening port")
+	name := flags.String("name", "", "name of the task, required")
+	payload := flags.String("payload", "", "payload of the task, as agreed with the task handler")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(*config); err != nil {
+		return err
+	}
+	form := url.Values{}
+	form.Set("name", *name)
+	form.Set("payload", *payload)
+	body, err := requestNode(http.MethodPost, nodeAddress(*addr), "/server/master/tasks", []byte(form.Encode()), clusterSecret())
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+// ---- migrate ---- //
+
+func commandMigrate(args []string) error {
+	flags, config := newFlagSet("migrate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(*config); err != nil {
+		return err
+	}
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&NodeInfo.NodeInfo{}, &NodeInfoLegacy.NodeInfoLegacy{}, &NodeLog.NodeLog{}, &WebhookDelivery.WebhookDelivery{}, &Task.Task{}, &Shard.Shard{}, &CronJob.CronJob{}); err != nil {
+		return err
+	}
+	fmt.Println("Migrated.")
+	return nil
+}
+
+// ---- config print ---- //
+
+func commandConfigPrint(args []string) error {
+	flags, config := newFlagSet("config print")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(*config); err != nil {
+		return err
+	}
+	effective, err := component.GlobalEnv.MaskedYaml()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(effective)
+	return err
+}
+
+// ---- config reload ---- //
+
+func commandConfigReload(args []string) error {
+	flags, config := newFlagSet("config reload")
+	addr := flags.String("addr", "", "address of the node, defaults to 127.0.0.1 with the configured listening port")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(*config); err != nil {
+		return err
+	}
+	body, err := requestNode(http.MethodPost, nodeAddress(*addr), "/server/config/reload", nil, clusterSecret())
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+// ---- admin ---- //
+
+// 管理命令经由运行中的节点读取节点登记数据库，只需管理密钥（component.EnvAdmin.Secret），无须数据库凭据和集群密钥，
+// 参见 controllerServer.ActionAdminTopology 等。
+
+// adminQuery 收集管理命令的查询参数。空值和零值不发送。
+type adminQuery struct {
+	flags  *flag.FlagSet
+	values map[string]*string
+}
+
+func newAdminQuery(flags *flag.FlagSet) *adminQuery {
+	return &adminQuery{flags: flags, values: make(map[string]*string)}
+}
+
+// String 定义字符串参数。flag 为命令行选项名，key 为查询参数名。
+func (q *adminQuery) String(flag string, key string, usage string) {
+	q.values[key] = q.flags.String(flag, "", usage)
+}
+
+// Encode 编码查询参数。type 以逗号分隔时拆分为多项。
+func (q *adminQuery) Encode() string {
+	params := make(url.Values)
+	for key, value := range q.values {
+		if len(*value) == 0 || *value == "0" {
+			continue
+		}
+		if key == "type" {
+			for _, item := range strings.Split(*value, ",") {
+				params.Add(key, strings.TrimSpace(item))
+			}
+			continue
+		}
+		params.Add(key, *value)
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "?" + params.Encode()
+}
+
+func (q *adminQuery) selector() {
+	q.String("zone", "zone", "only nodes in this zone")
+	q.String("rack", "rack", "only nodes in this rack")
+	q.String("label", "label", "only nodes with these labels, formatted as k1=v1,k2=v2")
+}
+
+func (q *adminQuery) pagination() {
+	q.String("since", "since", "only records updated at or after this time, in RFC 3339")
+	q.String("until", "until", "only records updated before this time, in RFC 3339")
+	q.String("page", "page", "page number, starting from 1")
+	q.String("page-size", "page_size", "records per page, at most 100")
+}
+
+func commandAdmin(name string, path string, args []string, define func(q *adminQuery)) error {
+	flags, config := newFlagSet(name)
+	addr := flags.String("addr", "", "address of the node, defaults to 127.0.0.1 with the configured listening port")
+	query := newAdminQuery(flags)
+	define(query)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(*config); err != nil {
+		return err
+	}
+	secret := (*(*component.GlobalEnv).Admin).Secret
+	if len(secret) == 0 {
+		return controllerSystem.ErrAdminSecretNotConfigured
+	}
+	body, err := requestNode(http.MethodGet, nodeAddress(*addr), path+query.Encode(), nil, []byte(secret))
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+func commandAdminTopology(args []string) error {
+	return commandAdmin("admin topology", "/server/admin/topology", args, func(q *adminQuery) {
+		q.selector()
+	})
+}
+
+func commandAdminLogs(args []string) error {
+	return commandAdmin("admin logs", "/server/admin/logs", args, func(q *adminQuery) {
+		q.String("node", "node_id", "only logs recorded by this node")
+		q.String("target", "target_node_id", "only logs concerning this node")
+		q.String("type", "type", "only logs of these types, separated by commas")
+		q.pagination()
+	})
+}
+
+func commandAdminLegacy(args []string) error {
+	return commandAdmin("admin legacy", "/server/admin/legacy", args, func(q *adminQuery) {
+		q.String("id", "id", "only the removed node with this ID")
+		q.String("name", "name", "only removed nodes with this name")
+		q.String("host", "host", "only removed nodes on this host")
+		q.String("port", "port", "only removed nodes on this port")
+		q.selector()
+		q.pagination()
+	})
+}
+
+func commandAdminWebhooks(args []string) error {
+	return commandAdmin("admin webhooks", "/server/admin/webhooks", args, func(q *adminQuery) {
+		q.String("delivery", "delivery_id", "only attempts of this delivery")
+		q.String("target", "target", "only deliveries to this webhook")
+		q.String("event", "event", "only deliveries of this event")
+		q.String("succeeded", "succeeded", "only successful (true) or failed (false) attempts")
+		q.pagination()
+	})
+}
+
+func commandAdminTasks(args []string) error {
+	return commandAdmin("admin tasks", "/server/admin/tasks", args, func(q *adminQuery) {
+		q.String("name", "name", "only tasks with this name")
+		q.String("state", "state", "only tasks in this state: pending, assigned, acknowledged, completed or failed")
+		q.String("assignee", "assignee_id", "only tasks assigned to this slave")
+		q.pagination()
+	})
+}
+
+func commandAdminShards(args []string) error {
+	return commandAdmin("admin shards", "/server/admin/shards", args, func(q *adminQuery) {})
+}
+
+func commandAdminJobs(args []string) error {
+	return commandAdmin("admin jobs", "/server/admin/jobs", args, func(q *adminQuery) {})
+}
+
+// ---- helpers ---- //
+
+// nodeAddress 若未指定地址，则使用本机回环地址和配置的监听端口。
+func nodeAddress(addr string) string {
+	if len(addr) > 0 {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(int(*(*component.GlobalEnv).Net.ListenPort)))
+}
+
+// clusterSecret 节点间请求的集群密钥。
+func clusterSecret() []byte {
+	return []byte((*(*component.GlobalEnv).Cluster).Secret)
+}
+
+// requestNode 以 secret 签名后向节点发送请求，返回响应体。body 非空时以表单形式发送。
+func requestNode(method string, addr string, path string, body []byte, secret []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, "http://"+addr+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	node.NewProtocol().Apply(req.Header)
+	if err := node.SignNodeRequest(req, body, 0, secret); err != nil {
+		return nil, err
+	}
+	client := http.Client{Timeout: component.GlobalEnv.GetTiming().GetRequestTimeout()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(content)))
+	}
+	return content, nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if raw, ok := v.([]byte); ok {
+		v = json.RawMessage(raw)
+	}
+	return encoder.Encode(v)
+}
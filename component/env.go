@@ -1,17 +1,48 @@
 package component
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"os/exec"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/rhosocial/go-rush-common/component/mysql"
+	"github.com/rhosocial/go-rush-producer/component/logging"
+	"github.com/rhosocial/go-rush-producer/component/tracing"
 	base "github.com/rhosocial/go-rush-producer/models"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	IPPreferenceIPv4 = "ipv4" // 优先选择 IPv4 地址，没有时选择 IPv6 地址。
+	IPPreferenceIPv6 = "ipv6" // 优先选择 IPv6 地址，没有时选择 IPv4 地址。
+)
+
+var ErrEnvNetIPPreferenceInvalid = errors.New("invalid ip preference")
+
+// EnvNet 网络配置。
+//
+// ListenHost 和 ListenPort 为本节点绑定的地址。AdvertisedHost 和 AdvertisedPort 为登记并供其它节点访问的地址，
+// 适用于 NAT、容器桥接网络或负载均衡之后的节点；未指定时分别取自动选择的地址和 ListenPort。
+//
+// Interface、CIDR 和 IPPreference 用于从多个网卡和地址中选择本节点对外的地址：
+// 指定 Interface 时只考虑该网卡；指定 CIDR 时只考虑该网段内的地址；最后按 IPPreference 选择。
+// 指定 AdvertisedHost 时不再自动选择。
 type EnvNet struct {
-	ListenPort *uint16 `yaml:"ListenPort,omitempty" default:"8080"`
+	ListenHost     string  `yaml:"ListenHost,omitempty"` // 绑定的地址。为空表示所有地址。
+	ListenPort     *uint16 `yaml:"ListenPort,omitempty" default:"8080"`
+	AdvertisedHost string  `yaml:"AdvertisedHost,omitempty"` // 对外登记的地址，可以是 IP 地址或主机名。
+	AdvertisedPort *uint16 `yaml:"AdvertisedPort,omitempty"` // 对外登记的端口。
+
+	Interface    string `yaml:"Interface,omitempty"`                   // 网卡名称，例如 eth0。
+	CIDR         string `yaml:"CIDR,omitempty"`                        // 地址须匹配的网段，例如 10.0.0.0/8 或 fd00::/8。
+	IPPreference string `yaml:"IPPreference,omitempty" default:"ipv4"` // 地址族偏好，参见 IPPreferenceIPv4 和 IPPreferenceIPv6。
 }
 
 func (e *EnvNet) GetListenPortDefault() *uint16 {
@@ -19,10 +50,523 @@ func (e *EnvNet) GetListenPortDefault() *uint16 {
 	return &port
 }
 
+// GetListenAddress 取得绑定的套接字。
+func (e *EnvNet) GetListenAddress() string {
+	return net.JoinHostPort(e.ListenHost, strconv.Itoa(int(*e.ListenPort)))
+}
+
+// GetAdvertisedPort 取得对外登记的端口。未指定时为 ListenPort。
+func (e *EnvNet) GetAdvertisedPort() uint16 {
+	if e.AdvertisedPort != nil && *e.AdvertisedPort > 0 {
+		return *e.AdvertisedPort
+	}
+	return *e.ListenPort
+}
+
 func (e *EnvNet) Validate() error {
 	if e.ListenPort == nil {
 		e.ListenPort = e.GetListenPortDefault()
 	}
+	if len(e.IPPreference) == 0 {
+		e.IPPreference = IPPreferenceIPv4
+	}
+	if e.IPPreference != IPPreferenceIPv4 && e.IPPreference != IPPreferenceIPv6 {
+		return ErrEnvNetIPPreferenceInvalid
+	}
+	if len(e.CIDR) > 0 {
+		if _, _, err := net.ParseCIDR(e.CIDR); err != nil {
+			return err
+		}
+	}
+	if len(e.AdvertisedHost) > 0 {
+		if err := base.ValidateHost(e.AdvertisedHost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnvCluster 集群配置。同一集群内所有节点必须使用相同的 Secret。
+type EnvCluster struct {
+	Secret       string  `yaml:"Secret,omitempty"`
+	ReplayWindow *uint16 `yaml:"ReplayWindow,omitempty" default:"30"` // 节点间请求签名有效时长（秒）。
+}
+
+func (e *EnvCluster) GetReplayWindowDefault() *uint16 {
+	window := uint16(30)
+	return &window
+}
+
+func (e *EnvCluster) Validate() error {
+	if e.ReplayWindow == nil || *e.ReplayWindow == 0 {
+		e.ReplayWindow = e.GetReplayWindowDefault()
+	}
+	return nil
+}
+
+var ErrEnvAdminInvalid = errors.New("invalid admin")
+
+// EnvAdmin 管理接口配置。管理接口只读，以 Secret 签名，与节点间请求的集群密钥分开，
+// 持有者只能查看集群，不能冒充节点。
+type EnvAdmin struct {
+	Secret string `yaml:"Secret,omitempty"` // 管理接口签名密钥。为空时不开放管理接口。须与 EnvCluster.Secret 不同。
+}
+
+func (e *EnvAdmin) Validate() error {
+	return nil
+}
+
+// EnvNode 当前节点元数据。加入集群时随节点信息一并登记，供调度方按可用区、机架或标签选择节点。
+type EnvNode struct {
+	Zone   string          `yaml:"Zone,omitempty"`
+	Rack   string          `yaml:"Rack,omitempty"`
+	Weight *uint32         `yaml:"Weight,omitempty" default:"1"` // 节点权重（容量）。
+	Labels base.NodeLabels `yaml:"Labels,omitempty"`
+}
+
+func (e *EnvNode) GetWeightDefault() *uint32 {
+	weight := uint32(1)
+	return &weight
+}
+
+func (e *EnvNode) Validate() error {
+	if e.Weight == nil {
+		e.Weight = e.GetWeightDefault()
+	}
+	return e.Labels.Validate()
+}
+
+const (
+	FailoverPolicyTurn = "turn" // 按加入顺序接替。
+	FailoverPolicyZone = "zone" // 优先由主节点所在可用区的从节点接替；该可用区失效节点过多时，优先由其它可用区接替。
+)
+
+var ErrEnvFailoverPolicyInvalid = errors.New("invalid failover policy")
+
+// EnvFailover 接替策略配置。
+type EnvFailover struct {
+	Policy        string  `yaml:"Policy,omitempty" default:"turn"`
+	LossWindow    *uint16 `yaml:"LossWindow,omitempty" default:"600"`     // 统计可用区失效节点的时间窗口（秒）。
+	LossThreshold *uint8  `yaml:"LossThreshold,omitempty" default:"2"`    // 时间窗口内失效节点数达到该值时，视该可用区为不健康。
+	SupersedeStep *uint16 `yaml:"SupersedeStep,omitempty" default:"1000"` // 从节点按接替次序依次推迟主动接替的间隔（毫秒）。
+}
+
+func (e *EnvFailover) GetLossWindowDefault() *uint16 {
+	window := uint16(600)
+	return &window
+}
+
+func (e *EnvFailover) GetLossThresholdDefault() *uint8 {
+	threshold := uint8(2)
+	return &threshold
+}
+
+func (e *EnvFailover) GetSupersedeStepDefault() *uint16 {
+	step := uint16(1000)
+	return &step
+}
+
+func (e *EnvFailover) Validate() error {
+	if len(e.Policy) == 0 {
+		e.Policy = FailoverPolicyTurn
+	}
+	if e.Policy != FailoverPolicyTurn && e.Policy != FailoverPolicyZone {
+		return ErrEnvFailoverPolicyInvalid
+	}
+	if e.LossWindow == nil || *e.LossWindow == 0 {
+		e.LossWindow = e.GetLossWindowDefault()
+	}
+	if e.LossThreshold == nil || *e.LossThreshold == 0 {
+		e.LossThreshold = e.GetLossThresholdDefault()
+	}
+	if e.SupersedeStep == nil {
+		e.SupersedeStep = e.GetSupersedeStepDefault()
+	}
+	return nil
+}
+
+var ErrEnvTimingInvalid = errors.New("invalid timing")
+
+// EnvTiming 工作协程的间隔、重试阈值和请求超时。间隔和超时的单位均为毫秒。
+//
+// 各项须满足以下关系，否则报 ErrEnvTimingInvalid：
+//
+// 1. SlaveInactiveLimit 小于 SlaveRemoveLimit。
+//
+// 2. 从节点判定主节点失效的时长（SlaveInterval * SlaveRetryMax）大于主节点工作间隔（MasterInterval），以免误判后抢先接替。
+//
+// 3. 主节点移除从节点的时长（MasterInterval * SlaveRemoveLimit）大于从节点工作间隔（SlaveInterval），以免误删正常的从节点。
+//
+// 4. 请求超时（RequestTimeout）不大于从节点判定主节点失效的时长。
+type EnvTiming struct {
+	MasterInterval     *uint16 `yaml:"MasterInterval,omitempty" default:"1200"`  // 主节点工作协程间隔。
+	SlaveInterval      *uint16 `yaml:"SlaveInterval,omitempty" default:"1000"`   // 从节点工作协程间隔。
+	SlaveRetryMax      *uint8  `yaml:"SlaveRetryMax,omitempty" default:"3"`      // 从节点检查主节点的最大重试次数。超过后尝试主动接替。
+	SlaveInactiveLimit *uint8  `yaml:"SlaveInactiveLimit,omitempty" default:"3"` // 主节点判定从节点不活跃的重试次数。
+	SlaveRemoveLimit   *uint8  `yaml:"SlaveRemoveLimit,omitempty" default:"4"`   // 主节点移除从节点的重试次数。
+	ActiveReportTicks  *uint8  `yaml:"ActiveReportTicks,omitempty" default:"10"` // 主节点每隔多少次工作报告一次活跃。
+	CheckSelfTicks     *uint8  `yaml:"CheckSelfTicks,omitempty" default:"10"`    // 主节点每隔多少次工作检查一次自身记录。
+	RequestTimeout     *uint16 `yaml:"RequestTimeout,omitempty" default:"3000"`  // 节点间请求超时。
+}
+
+func (e *EnvTiming) GetMasterIntervalDefault() *uint16 {
+	interval := uint16(1200)
+	return &interval
+}
+
+func (e *EnvTiming) GetSlaveIntervalDefault() *uint16 {
+	interval := uint16(1000)
+	return &interval
+}
+
+func (e *EnvTiming) GetSlaveRetryMaxDefault() *uint8 {
+	retry := uint8(3)
+	return &retry
+}
+
+func (e *EnvTiming) GetSlaveInactiveLimitDefault() *uint8 {
+	limit := uint8(3)
+	return &limit
+}
+
+func (e *EnvTiming) GetSlaveRemoveLimitDefault() *uint8 {
+	limit := uint8(4)
+	return &limit
+}
+
+func (e *EnvTiming) GetActiveReportTicksDefault() *uint8 {
+	ticks := uint8(10)
+	return &ticks
+}
+
+func (e *EnvTiming) GetCheckSelfTicksDefault() *uint8 {
+	ticks := uint8(10)
+	return &ticks
+}
+
+func (e *EnvTiming) GetRequestTimeoutDefault() *uint16 {
+	timeout := uint16(3000)
+	return &timeout
+}
+
+// GetMasterInterval 取得主节点工作协程间隔。
+func (e *EnvTiming) GetMasterInterval() time.Duration {
+	return time.Duration(*e.MasterInterval) * time.Millisecond
+}
+
+// GetSlaveInterval 取得从节点工作协程间隔。
+func (e *EnvTiming) GetSlaveInterval() time.Duration {
+	return time.Duration(*e.SlaveInterval) * time.Millisecond
+}
+
+// GetRequestTimeout 取得节点间请求超时。
+func (e *EnvTiming) GetRequestTimeout() time.Duration {
+	return time.Duration(*e.RequestTimeout) * time.Millisecond
+}
+
+// Validate 为未指定或为零的项加载默认值，然后校验各项之间的关系。
+func (e *EnvTiming) Validate() error {
+	if e.MasterInterval == nil || *e.MasterInterval == 0 {
+		e.MasterInterval = e.GetMasterIntervalDefault()
+	}
+	if e.SlaveInterval == nil || *e.SlaveInterval == 0 {
+		e.SlaveInterval = e.GetSlaveIntervalDefault()
+	}
+	if e.SlaveRetryMax == nil || *e.SlaveRetryMax == 0 {
+		e.SlaveRetryMax = e.GetSlaveRetryMaxDefault()
+	}
+	if e.SlaveInactiveLimit == nil || *e.SlaveInactiveLimit == 0 {
+		e.SlaveInactiveLimit = e.GetSlaveInactiveLimitDefault()
+	}
+	if e.SlaveRemoveLimit == nil || *e.SlaveRemoveLimit == 0 {
+		e.SlaveRemoveLimit = e.GetSlaveRemoveLimitDefault()
+	}
+	if e.ActiveReportTicks == nil || *e.ActiveReportTicks == 0 {
+		e.ActiveReportTicks = e.GetActiveReportTicksDefault()
+	}
+	if e.CheckSelfTicks == nil || *e.CheckSelfTicks == 0 {
+		e.CheckSelfTicks = e.GetCheckSelfTicksDefault()
+	}
+	if e.RequestTimeout == nil || *e.RequestTimeout == 0 {
+		e.RequestTimeout = e.GetRequestTimeoutDefault()
+	}
+	if *e.SlaveInactiveLimit >= *e.SlaveRemoveLimit {
+		return fmt.Errorf("%w: SlaveInactiveLimit(%d) must be less than SlaveRemoveLimit(%d)", ErrEnvTimingInvalid, *e.SlaveInactiveLimit, *e.SlaveRemoveLimit)
+	}
+	slaveTimeout := e.GetSlaveInterval() * time.Duration(*e.SlaveRetryMax)
+	if slaveTimeout <= e.GetMasterInterval() {
+		return fmt.Errorf("%w: SlaveInterval * SlaveRetryMax(%s) must be greater than MasterInterval(%s)", ErrEnvTimingInvalid, slaveTimeout, e.GetMasterInterval())
+	}
+	masterTimeout := e.GetMasterInterval() * time.Duration(*e.SlaveRemoveLimit)
+	if masterTimeout <= e.GetSlaveInterval() {
+		return fmt.Errorf("%w: MasterInterval * SlaveRemoveLimit(%s) must be greater than SlaveInterval(%s)", ErrEnvTimingInvalid, masterTimeout, e.GetSlaveInterval())
+	}
+	if e.GetRequestTimeout() > slaveTimeout {
+		return fmt.Errorf("%w: RequestTimeout(%s) must not be greater than SlaveInterval * SlaveRetryMax(%s)", ErrEnvTimingInvalid, e.GetRequestTimeout(), slaveTimeout)
+	}
+	return nil
+}
+
+// EnvLog 日志配置。日志详细程度取自 Env.RunningModeVerboseLevel，参见 logging.LevelError 至 logging.LevelDebug。
+type EnvLog struct {
+	Format string `yaml:"Format,omitempty" default:"text"` // 输出格式，参见 logging.FormatText 和 logging.FormatJSON。
+}
+
+func (e *EnvLog) Validate() error {
+	if len(e.Format) == 0 {
+		e.Format = logging.FormatText
+	}
+	return logging.ValidateFormat(e.Format)
+}
+
+var ErrEnvTracingSampleRatioInvalid = errors.New("invalid trace sample ratio")
+
+// EnvTracing 分布式追踪配置，参见 tracing.Setup。
+type EnvTracing struct {
+	Exporter    string   `yaml:"Exporter,omitempty" default:"none"`           // 导出方式，参见 tracing.ExporterNone、tracing.ExporterOTLP 和 tracing.ExporterFile。
+	Endpoint    string   `yaml:"Endpoint,omitempty" default:"localhost:4318"` // OTLP/HTTP 收集器地址。
+	TLS         bool     `yaml:"TLS,omitempty" default:"false"`               // 是否以 HTTPS 连接收集器。
+	File        string   `yaml:"File,omitempty" default:"traces.jsonl"`       // 导出文件路径。
+	SampleRatio *float64 `yaml:"SampleRatio,omitempty" default:"1"`           // 根 span 的采样比例，取值 0 至 1。
+}
+
+// GetSampleRatioDefault 取得采样比例的默认值，即全部采样。
+func (e *EnvTracing) GetSampleRatioDefault() *float64 {
+	ratio := float64(1)
+	return &ratio
+}
+
+func (e *EnvTracing) Validate() error {
+	if len(e.Exporter) == 0 {
+		e.Exporter = tracing.ExporterNone
+	}
+	if err := tracing.ValidateExporter(e.Exporter); err != nil {
+		return err
+	}
+	if e.SampleRatio == nil {
+		e.SampleRatio = e.GetSampleRatioDefault()
+	}
+	if *e.SampleRatio < 0 || *e.SampleRatio > 1 {
+		return fmt.Errorf("%w: %v", ErrEnvTracingSampleRatioInvalid, *e.SampleRatio)
+	}
+	return nil
+}
+
+// 事件通知类型。
+const (
+	WebhookEventMasterChanged  = "master_changed"  // 主节点变化。由接替为主节点的节点发送。
+	WebhookEventSlaveInactive  = "slave_inactive"  // 主节点发现从节点不活跃。
+	WebhookEventSlaveRemoved   = "slave_removed"   // 主节点因重试次数超限移除从节点。
+	WebhookEventHandoverFailed = "handover_failed" // 主节点交接失败。
+)
+
+// WebhookEvents 所有事件通知类型。
+var WebhookEvents = []string{WebhookEventMasterChanged, WebhookEventSlaveInactive, WebhookEventSlaveRemoved, WebhookEventHandoverFailed}
+
+var ErrEnvWebhookInvalid = errors.New("invalid webhook")
+
+// EnvWebhook 事件通知目标。
+type EnvWebhook struct {
+	Name   string   `yaml:"Name"`             // 名称，用于记录投递结果，须唯一。
+	URL    string   `yaml:"URL"`              // 接收地址，须为 http 或 https。
+	Secret string   `yaml:"Secret"`           // 签名密钥，须配置。不得与 EnvCluster.Secret 相同，以免接收方可伪造节点间请求。
+	Events []string `yaml:"Events,omitempty"` // 订阅的事件类型，参见 WebhookEvents。为空表示全部。
+}
+
+func (e *EnvWebhook) Validate() error {
+	if len(e.Name) == 0 {
+		return fmt.Errorf("%w: Name must not be empty", ErrEnvWebhookInvalid)
+	}
+	target, err := url.Parse(e.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || len(target.Host) == 0 {
+		return fmt.Errorf("%w: %s: URL must be an absolute http or https URL", ErrEnvWebhookInvalid, e.Name)
+	}
+	if len(e.Secret) == 0 {
+		return fmt.Errorf("%w: %s: Secret must not be empty", ErrEnvWebhookInvalid, e.Name)
+	}
+	for _, event := range e.Events {
+		valid := false
+		for _, known := range WebhookEvents {
+			valid = valid || event == known
+		}
+		if !valid {
+			return fmt.Errorf("%w: %s: unknown event %s", ErrEnvWebhookInvalid, e.Name, event)
+		}
+	}
+	return nil
+}
+
+// Subscribes 判断是否订阅了指定事件类型。
+func (e *EnvWebhook) Subscribes(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range e.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvWebhooks 事件通知配置。每个事件以签名的 JSON 发送到订阅了该事件的所有目标，失败时按指数退避重试。
+type EnvWebhooks struct {
+	Targets      []EnvWebhook `yaml:"Targets,omitempty"`
+	Timeout      *uint16      `yaml:"Timeout,omitempty" default:"5000"`      // 每次投递的超时（毫秒）。
+	RetryMax     *uint8       `yaml:"RetryMax,omitempty" default:"5"`        // 首次投递失败后的最大重试次数。
+	RetryBackoff *uint16      `yaml:"RetryBackoff,omitempty" default:"1000"` // 首次重试前的等待（毫秒），此后每次加倍。
+}
+
+func (e *EnvWebhooks) GetTimeoutDefault() *uint16 {
+	timeout := uint16(5000)
+	return &timeout
+}
+
+func (e *EnvWebhooks) GetRetryMaxDefault() *uint8 {
+	retry := uint8(5)
+	return &retry
+}
+
+func (e *EnvWebhooks) GetRetryBackoffDefault() *uint16 {
+	backoff := uint16(1000)
+	return &backoff
+}
+
+// GetTimeout 每次投递的超时。
+func (e *EnvWebhooks) GetTimeout() time.Duration {
+	return time.Duration(*e.Timeout) * time.Millisecond
+}
+
+// GetRetryBackoff 首次重试前的等待。
+func (e *EnvWebhooks) GetRetryBackoff() time.Duration {
+	return time.Duration(*e.RetryBackoff) * time.Millisecond
+}
+
+func (e *EnvWebhooks) Validate() error {
+	if e.Timeout == nil || *e.Timeout == 0 {
+		e.Timeout = e.GetTimeoutDefault()
+	}
+	if e.RetryMax == nil {
+		e.RetryMax = e.GetRetryMaxDefault()
+	}
+	if e.RetryBackoff == nil {
+		e.RetryBackoff = e.GetRetryBackoffDefault()
+	}
+	names := make(map[string]bool, len(e.Targets))
+	for i := range e.Targets {
+		if err := e.Targets[i].Validate(); err != nil {
+			return err
+		}
+		if names[e.Targets[i].Name] {
+			return fmt.Errorf("%w: duplicate name %s", ErrEnvWebhookInvalid, e.Targets[i].Name)
+		}
+		names[e.Targets[i].Name] = true
+	}
+	return nil
+}
+
+var ErrEnvHookInvalid = errors.New("invalid hook")
+
+// EnvHooks 生命周期脚本配置。身份变化和退出时执行对应的可执行文件，参见 hook.Runner。
+//
+// 各项为可执行文件路径，不经过 shell 解析；为空表示不执行。不含路径分隔符时在 PATH 中查找。
+type EnvHooks struct {
+	Master        string  `yaml:"Master,omitempty"`                  // 成为主节点时执行。
+	Slave         string  `yaml:"Slave,omitempty"`                   // 成为从节点时执行。
+	NotDetermined string  `yaml:"NotDetermined,omitempty"`           // 身份变为未定时执行，例如接替或切换主节点期间。
+	Shutdown      string  `yaml:"Shutdown,omitempty"`                // 退出前执行。
+	Timeout       *uint16 `yaml:"Timeout,omitempty" default:"10000"` // 每次执行的超时（毫秒）。超时后终止进程。
+}
+
+func (e *EnvHooks) GetTimeoutDefault() *uint16 {
+	timeout := uint16(10000)
+	return &timeout
+}
+
+// GetTimeout 每次执行的超时。
+func (e *EnvHooks) GetTimeout() time.Duration {
+	return time.Duration(*e.Timeout) * time.Millisecond
+}
+
+func (e *EnvHooks) Validate() error {
+	if e.Timeout == nil || *e.Timeout == 0 {
+		e.Timeout = e.GetTimeoutDefault()
+	}
+	hooks := []struct{ key, path string }{{"Master", e.Master}, {"Slave", e.Slave}, {"NotDetermined", e.NotDetermined}, {"Shutdown", e.Shutdown}}
+	for _, hook := range hooks {
+		if len(hook.path) == 0 {
+			continue
+		}
+		if _, err := exec.LookPath(hook.path); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrEnvHookInvalid, hook.key, err)
+		}
+	}
+	return nil
+}
+
+// EnvTasks 任务分配配置，参见 node.Pool.SubmitTask。
+type EnvTasks struct {
+	AttemptsMax *uint8  `yaml:"AttemptsMax,omitempty" default:"3"` // 每个任务最多分配的次数。从节点失效后收回的任务将重新分配，达到该次数后标记为失败。
+	BatchSize   *uint16 `yaml:"BatchSize,omitempty" default:"16"`  // 主节点每轮最多分配的任务数。
+}
+
+func (e *EnvTasks) GetAttemptsMaxDefault() *uint8 {
+	attempts := uint8(3)
+	return &attempts
+}
+
+func (e *EnvTasks) GetBatchSizeDefault() *uint16 {
+	size := uint16(16)
+	return &size
+}
+
+func (e *EnvTasks) Validate() error {
+	if e.AttemptsMax == nil || *e.AttemptsMax == 0 {
+		e.AttemptsMax = e.GetAttemptsMaxDefault()
+	}
+	if e.BatchSize == nil || *e.BatchSize == 0 {
+		e.BatchSize = e.GetBatchSizeDefault()
+	}
+	return nil
+}
+
+// EnvShards 分片配置，参见 node.Pool.Owns。
+type EnvShards struct {
+	Count    *uint32 `yaml:"Count,omitempty" default:"0"`     // 分片数。为 0 表示不分片。
+	Replicas *uint16 `yaml:"Replicas,omitempty" default:"64"` // 一致性哈希环上每个节点的虚拟节点数。越大分布越均匀。
+	Lease    *uint16 `yaml:"Lease,omitempty" default:"10"`    // 分片租约时长（秒）。所有者每轮续约，逾期未续约即不再所有。须大于 Timing 中的工作间隔和节点间的时钟偏差。
+}
+
+func (e *EnvShards) GetCountDefault() *uint32 {
+	count := uint32(0)
+	return &count
+}
+
+func (e *EnvShards) GetReplicasDefault() *uint16 {
+	replicas := uint16(64)
+	return &replicas
+}
+
+func (e *EnvShards) GetLeaseDefault() *uint16 {
+	lease := uint16(10)
+	return &lease
+}
+
+// GetLease 分片租约时长。
+func (e *EnvShards) GetLease() time.Duration {
+	return time.Duration(*e.Lease) * time.Second
+}
+
+func (e *EnvShards) Validate() error {
+	if e.Count == nil {
+		e.Count = e.GetCountDefault()
+	}
+	if e.Replicas == nil || *e.Replicas == 0 {
+		e.Replicas = e.GetReplicasDefault()
+	}
+	if e.Lease == nil || *e.Lease == 0 {
+		e.Lease = e.GetLeaseDefault()
+	}
 	return nil
 }
 
@@ -31,30 +575,125 @@ const RunningModeRelease = 1
 
 type Env struct {
 	Net                     *EnvNet                 `yaml:"Net,omitempty"`
+	Cluster                 *EnvCluster             `yaml:"Cluster,omitempty"`
+	Admin                   *EnvAdmin               `yaml:"Admin,omitempty"`
+	Node                    *EnvNode                `yaml:"Node,omitempty"`
+	Failover                *EnvFailover            `yaml:"Failover,omitempty"`
+	Timing                  *EnvTiming              `yaml:"Timing,omitempty"`
+	Log                     *EnvLog                 `yaml:"Log,omitempty"`
+	Tracing                 *EnvTracing             `yaml:"Tracing,omitempty"`
+	Webhooks                *EnvWebhooks            `yaml:"Webhooks,omitempty"`
+	Hooks                   *EnvHooks               `yaml:"Hooks,omitempty"`
+	Tasks                   *EnvTasks               `yaml:"Tasks,omitempty"`
+	Shards                  *EnvShards              `yaml:"Shards,omitempty"`
 	MySQLServers            *[]mysql.EnvMySQLServer `yaml:"MySQLServers,omitempty"`
 	Identity                int                     `yaml:"Identity,omitempty" default:"0"`
 	Localhost               bool                    `yaml:"Localhost,omitempty" default:"false"`
 	Master                  *base.FreshNodeInfo     `yaml:"Master,omitempty"`
 	RunningMode             uint8                   `yaml:"RunningMode,omitempty" default:"0"`
-	RunningModeVerboseLevel uint8                   `yaml:"RunningModeVerboseLevel,omitempty" default:"3"`
+	RunningModeVerboseLevel uint8                   `yaml:"RunningModeVerboseLevel,omitempty" default:"3"` // 日志详细程度，参见 logging.LevelInfo。
+
+	reloadLock sync.RWMutex // 保护可在运行时生效的配置项，参见 Reload。
+	source     envSource    // 配置的来源和加载后的修改，参见 Reload。
 }
 
 // GetNetDefault 取得 EnvNet 的默认值。
-// EnvNet.ListenPort 默认值为 8080。
+// EnvNet.ListenPort 默认值为 8080，EnvNet.IPPreference 默认值为 IPPreferenceIPv4。
 func (e *Env) GetNetDefault() *EnvNet {
-	net := EnvNet{}
-	net.ListenPort = net.GetListenPortDefault()
-	return &net
+	envNet := EnvNet{IPPreference: IPPreferenceIPv4}
+	envNet.ListenPort = envNet.GetListenPortDefault()
+	return &envNet
+}
+
+// GetClusterDefault 取得 EnvCluster 的默认值。
+// EnvCluster.Secret 没有默认值，必须显式配置。
+func (e *Env) GetClusterDefault() *EnvCluster {
+	cluster := EnvCluster{}
+	cluster.ReplayWindow = cluster.GetReplayWindowDefault()
+	return &cluster
+}
+
+// GetAdminDefault 取得 EnvAdmin 的默认值。
+// EnvAdmin.Secret 没有默认值，未配置时不开放管理接口。
+func (e *Env) GetAdminDefault() *EnvAdmin {
+	return &EnvAdmin{}
+}
+
+// GetNodeDefault 取得 EnvNode 的默认值。
+// EnvNode.Weight 默认值为 1，其余项默认为空。
+func (e *Env) GetNodeDefault() *EnvNode {
+	node := EnvNode{}
+	node.Weight = node.GetWeightDefault()
+	return &node
+}
+
+// GetFailoverDefault 取得 EnvFailover 的默认值。
+// EnvFailover.Policy 默认为 FailoverPolicyTurn，即按加入顺序接替。
+func (e *Env) GetFailoverDefault() *EnvFailover {
+	failover := EnvFailover{Policy: FailoverPolicyTurn}
+	failover.LossWindow = failover.GetLossWindowDefault()
+	failover.LossThreshold = failover.GetLossThresholdDefault()
+	failover.SupersedeStep = failover.GetSupersedeStepDefault()
+	return &failover
+}
+
+// GetLogDefault 取得 EnvLog 的默认值。
+// EnvLog.Format 默认为 logging.FormatText。
+func (e *Env) GetLogDefault() *EnvLog {
+	return &EnvLog{Format: logging.FormatText}
+}
+
+// GetTracingDefault 取得 EnvTracing 的默认值。
+// EnvTracing.Exporter 默认为 tracing.ExporterNone，即不导出。
+func (e *Env) GetTracingDefault() *EnvTracing {
+	envTracing := EnvTracing{Exporter: tracing.ExporterNone, Endpoint: "localhost:4318", File: "traces.jsonl"}
+	envTracing.SampleRatio = envTracing.GetSampleRatioDefault()
+	return &envTracing
+}
+
+// GetWebhooksDefault 取得 EnvWebhooks 的默认值。默认没有通知目标。
+func (e *Env) GetWebhooksDefault() *EnvWebhooks {
+	webhooks := EnvWebhooks{}
+	_ = webhooks.Validate()
+	return &webhooks
+}
+
+// GetHooksDefault 取得 EnvHooks 的默认值。默认不执行任何脚本。
+func (e *Env) GetHooksDefault() *EnvHooks {
+	hooks := EnvHooks{}
+	hooks.Timeout = hooks.GetTimeoutDefault()
+	return &hooks
+}
+
+// GetTasksDefault 取得 EnvTasks 的默认值。
+func (e *Env) GetTasksDefault() *EnvTasks {
+	tasks := EnvTasks{}
+	_ = tasks.Validate()
+	return &tasks
+}
+
+// GetShardsDefault 取得 EnvShards 的默认值。
+func (e *Env) GetShardsDefault() *EnvShards {
+	shards := EnvShards{}
+	_ = shards.Validate()
+	return &shards
+}
+
+// GetTimingDefault 取得 EnvTiming 的默认值。
+func (e *Env) GetTimingDefault() *EnvTiming {
+	timing := EnvTiming{}
+	_ = timing.Validate()
+	return &timing
 }
 
 var GlobalEnv *Env
 
-// LoadEnvDefault 加载配置参数默认值。
+// LoadEnvDefault 加载配置参数默认值。默认值取自各项的 default 标签，参见 ApplyEnvDefaults。
 func LoadEnvDefault() error {
 	if GlobalEnv == nil {
-		var env = Env{
-			RunningMode:             RunningModeDebug,
-			RunningModeVerboseLevel: 3,
+		var env Env
+		if err := ApplyEnvDefaults(&env); err != nil {
+			return err
 		}
 		err := env.Validate()
 		if err != nil {
@@ -67,21 +706,81 @@ func LoadEnvDefault() error {
 
 // Validate 验证并加载默认值。
 // Env 的默认值包括：
-// EnvNet
+// EnvNet, EnvCluster, EnvNode, EnvFailover, EnvTiming, EnvLog, EnvTracing, EnvWebhooks, EnvHooks, EnvTasks, EnvShards
 func (e *Env) Validate() error {
 	if e.Net == nil {
 		e.Net = e.GetNetDefault()
 	} else if err := e.Net.Validate(); err != nil {
 		return err
 	}
+	if e.Cluster == nil {
+		e.Cluster = e.GetClusterDefault()
+	} else if err := e.Cluster.Validate(); err != nil {
+		return err
+	}
+	if e.Admin == nil {
+		e.Admin = e.GetAdminDefault()
+	} else if err := e.Admin.Validate(); err != nil {
+		return err
+	}
+	if len(e.Admin.Secret) > 0 && e.Admin.Secret == e.Cluster.Secret {
+		return fmt.Errorf("%w: Secret must differ from Cluster.Secret", ErrEnvAdminInvalid)
+	}
+	if e.Node == nil {
+		e.Node = e.GetNodeDefault()
+	} else if err := e.Node.Validate(); err != nil {
+		return err
+	}
+	if e.Failover == nil {
+		e.Failover = e.GetFailoverDefault()
+	} else if err := e.Failover.Validate(); err != nil {
+		return err
+	}
+	if e.Timing == nil {
+		e.Timing = e.GetTimingDefault()
+	} else if err := e.Timing.Validate(); err != nil {
+		return err
+	}
+	if e.Log == nil {
+		e.Log = e.GetLogDefault()
+	} else if err := e.Log.Validate(); err != nil {
+		return err
+	}
+	if e.Tracing == nil {
+		e.Tracing = e.GetTracingDefault()
+	} else if err := e.Tracing.Validate(); err != nil {
+		return err
+	}
+	if e.Webhooks == nil {
+		e.Webhooks = e.GetWebhooksDefault()
+	} else if err := e.Webhooks.Validate(); err != nil {
+		return err
+	}
+	for _, target := range e.Webhooks.Targets {
+		// 接收方持有集群密钥即可伪造节点间请求。
+		if target.Secret == e.Cluster.Secret {
+			return fmt.Errorf("%w: %s: Secret must differ from Cluster.Secret", ErrEnvWebhookInvalid, target.Name)
+		}
+	}
+	if e.Hooks == nil {
+		e.Hooks = e.GetHooksDefault()
+	} else if err := e.Hooks.Validate(); err != nil {
+		return err
+	}
+	if e.Tasks == nil {
+		e.Tasks = e.GetTasksDefault()
+	} else if err := e.Tasks.Validate(); err != nil {
+		return err
+	}
+	if e.Shards == nil {
+		e.Shards = e.GetShardsDefault()
+	} else if err := e.Shards.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
 func LoadEnvFromYaml(filepath string) error {
-	file, err := os.ReadFile(filepath)
-	if err != nil {
-		return err
-	}
 	if GlobalEnv == nil {
 		var env Env
 		err := env.Validate()
@@ -90,15 +789,23 @@ func LoadEnvFromYaml(filepath string) error {
 		}
 		GlobalEnv = &env
 	}
-	if err := yaml.Unmarshal(file, GlobalEnv); err != nil {
+	return GlobalEnv.LoadYaml(filepath)
+}
+
+// LoadYaml 从 YAML 文件中加载配置，并验证。
+func (e *Env) LoadYaml(filepath string) error {
+	file, err := os.ReadFile(filepath)
+	if err != nil {
 		return err
 	}
-	if err := GlobalEnv.Validate(); err != nil {
+	if err := yaml.Unmarshal(file, e); err != nil {
 		return err
 	}
-	return nil
+	return e.Validate()
 }
 
+// LoadEnvFromSystemEnvVar 从环境变量中加载配置，参见 LoadEnvVars。环境变量名前缀为 EnvVarPrefix。
+// 已加载的环境变量会被输出，敏感项以 EnvSecretMask 代替。若值无法转换，则报错并指明环境变量名。
 func LoadEnvFromSystemEnvVar() error {
 	if GlobalEnv == nil {
 		var env Env
@@ -108,15 +815,28 @@ func LoadEnvFromSystemEnvVar() error {
 		}
 		GlobalEnv = &env
 	}
-	if value, exist := os.LookupEnv("Producer_Net_ListenPort"); exist {
-		log.Println("Producer_Net_ListenPort: ", value)
-		port, _ := strconv.ParseUint(value, 10, 16)
-		*(*GlobalEnv.Net).ListenPort = uint16(port)
+	return GlobalEnv.LoadSystemEnvVar()
+}
+
+// LoadSystemEnvVar 从环境变量中加载配置，并验证。参见 LoadEnvFromSystemEnvVar。
+func (e *Env) LoadSystemEnvVar() error {
+	environ := make(map[string]string)
+	for _, pair := range os.Environ() {
+		if key, value, found := strings.Cut(pair, "="); found && strings.HasPrefix(key, EnvVarPrefix+"_") {
+			environ[key] = value
+		}
+	}
+	loaded, err := LoadEnvVars(e, EnvVarPrefix, environ)
+	for _, key := range loaded {
+		logging.Default.Info("environment variable loaded", "key", key, "value", maskEnvValue(key, environ[key]))
 	}
-	if value, exist := os.LookupEnv("Producer_Identity"); exist {
-		log.Println("Producer_Identity: ", value)
-		identity, _ := strconv.ParseInt(value, 10, 32)
-		GlobalEnv.Identity = int(identity)
+	if err != nil {
+		return err
 	}
-	return nil
+	return e.Validate()
+}
+
+// MaskedYaml 输出当前生效的配置，敏感项以 EnvSecretMask 代替。
+func (e *Env) MaskedYaml() ([]byte, error) {
+	return MarshalEnvMasked(e)
 }
@@ -0,0 +1,334 @@
+package component
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvVarPrefix 环境变量名前缀。
+const EnvVarPrefix = "Producer"
+
+// EnvSecretMask 输出配置时代替敏感项的内容。
+const EnvSecretMask = "******"
+
+var ErrEnvVarInvalid = errors.New("invalid environment variable")
+
+// envSecretKeys 名称以这些词结尾的配置项视为敏感项，输出时以 EnvSecretMask 代替。
+var envSecretKeys = []string{"secret", "password", "token"}
+
+// IsEnvSecretKey 判断配置项是否为敏感项。
+func IsEnvSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, suffix := range envSecretKeys {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// envFieldName 取得字段的配置项名称。优先使用 yaml 标签，否则使用字段名。yaml 标签为 "-" 的字段返回空。
+func envFieldName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if tag == "-" {
+		return ""
+	}
+	if len(tag) > 0 {
+		return tag
+	}
+	return field.Name
+}
+
+// ApplyEnvDefaults 按 default 标签为结构体中的空指针和零值字段加载默认值。v 必须为结构体指针。
+//
+// 嵌套的结构体、非空的结构体指针和切片中的结构体元素会被递归处理；空的结构体指针保持为空，以区分"未配置"。
+func ApplyEnvDefaults(v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T is not a pointer to struct", ErrEnvVarInvalid, v)
+	}
+	return applyEnvDefaults(value.Elem(), "")
+}
+
+func applyEnvDefaults(value reflect.Value, path string) error {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := envFieldName(field)
+		if len(name) == 0 {
+			continue
+		}
+		key := joinEnvKey(path, name)
+		fieldValue := value.Field(i)
+		if def, exist := field.Tag.Lookup("default"); exist {
+			if fieldValue.Kind() == reflect.Pointer && fieldValue.IsNil() && fieldValue.Type().Elem().Kind() != reflect.Struct {
+				fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+				if err := setEnvValue(fieldValue.Elem(), def); err != nil {
+					return fmt.Errorf("%w: default of %s: %v", ErrEnvVarInvalid, key, err)
+				}
+				continue
+			}
+			if fieldValue.Kind() != reflect.Pointer && fieldValue.IsZero() {
+				if err := setEnvValue(fieldValue, def); err != nil {
+					return fmt.Errorf("%w: default of %s: %v", ErrEnvVarInvalid, key, err)
+				}
+				continue
+			}
+		}
+		if err := applyEnvDefaultsNested(fieldValue, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyEnvDefaultsNested(value reflect.Value, path string) error {
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			return nil
+		}
+		return applyEnvDefaultsNested(value.Elem(), path)
+	case reflect.Struct:
+		return applyEnvDefaults(value, path)
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := applyEnvDefaultsNested(value.Index(i), joinEnvKey(path, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadEnvVars 从环境变量中加载配置。v 必须为结构体指针，environ 为环境变量名到值的映射。返回已加载的环境变量名。
+//
+// 环境变量名为 prefix 与各级配置项名称以下划线连接，例如 Producer_Net_ListenPort。
+// 切片元素以下标为名称，例如 Producer_MySQLServers_0_Host；为切片新增的元素和为空指针新建的结构体会先加载默认值。
+// 字符串映射（例如标签）的格式为 k1=v1,k2=v2，标量切片以逗号分隔。
+//
+// 若值无法转换为字段类型，则报 ErrEnvVarInvalid，并指明环境变量名。
+func LoadEnvVars(v interface{}, prefix string, environ map[string]string) ([]string, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %T is not a pointer to struct", ErrEnvVarInvalid, v)
+	}
+	loaded := make([]string, 0)
+	if err := loadEnvVars(value.Elem(), prefix, environ, &loaded); err != nil {
+		return loaded, err
+	}
+	sort.Strings(loaded)
+	return loaded, nil
+}
+
+func loadEnvVars(value reflect.Value, path string, environ map[string]string, loaded *[]string) error {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := envFieldName(field)
+		if len(name) == 0 {
+			continue
+		}
+		if err := loadEnvVarsInto(value.Field(i), joinEnvKey(path, name), environ, loaded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadEnvVarsInto(value reflect.Value, key string, environ map[string]string, loaded *[]string) error {
+	valueType := value.Type()
+	switch {
+	case valueType.Kind() == reflect.Pointer:
+		if value.IsNil() {
+			if !hasEnvVar(environ, key) {
+				return nil
+			}
+			created := reflect.New(valueType.Elem())
+			if created.Elem().Kind() == reflect.Struct {
+				if err := applyEnvDefaults(created.Elem(), key); err != nil {
+					return err
+				}
+			}
+			if err := loadEnvVarsInto(created.Elem(), key, environ, loaded); err != nil {
+				return err
+			}
+			value.Set(created)
+			return nil
+		}
+		return loadEnvVarsInto(value.Elem(), key, environ, loaded)
+	case valueType.Kind() == reflect.Struct:
+		return loadEnvVars(value, key, environ, loaded)
+	case valueType.Kind() == reflect.Slice && isEnvStructElem(valueType.Elem()):
+		for i := 0; hasEnvVar(environ, joinEnvKey(key, strconv.Itoa(i))); i++ {
+			if i >= value.Len() {
+				elem := reflect.New(valueType.Elem()).Elem()
+				if err := applyEnvDefaultsNested(ensureEnvElem(elem), key); err != nil {
+					return err
+				}
+				value.Set(reflect.Append(value, elem))
+			}
+			if err := loadEnvVarsInto(value.Index(i), joinEnvKey(key, strconv.Itoa(i)), environ, loaded); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	raw, exist := environ[key]
+	if !exist {
+		return nil
+	}
+	if err := setEnvValue(value, raw); err != nil {
+		return fmt.Errorf("%w: %s=%q: %v", ErrEnvVarInvalid, key, maskEnvValue(key, raw), err)
+	}
+	*loaded = append(*loaded, key)
+	return nil
+}
+
+// isEnvStructElem 判断切片元素是否为结构体或结构体指针。
+func isEnvStructElem(elemType reflect.Type) bool {
+	return elemType.Kind() == reflect.Struct || elemType.Kind() == reflect.Pointer && elemType.Elem().Kind() == reflect.Struct
+}
+
+// ensureEnvElem 若切片元素为空指针，则为其新建结构体。
+func ensureEnvElem(elem reflect.Value) reflect.Value {
+	if elem.Kind() == reflect.Pointer && elem.IsNil() {
+		elem.Set(reflect.New(elem.Type().Elem()))
+	}
+	return elem
+}
+
+// hasEnvVar 判断是否存在名为 key 或以 key_ 开头的环境变量。
+func hasEnvVar(environ map[string]string, key string) bool {
+	if _, exist := environ[key]; exist {
+		return true
+	}
+	for name := range environ {
+		if strings.HasPrefix(name, key+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+func joinEnvKey(path string, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "_" + name
+}
+
+func maskEnvValue(key string, value string) string {
+	if IsEnvSecretKey(key) {
+		return EnvSecretMask
+	}
+	return value
+}
+
+// setEnvValue 将字符串转换为字段类型后赋值。
+func setEnvValue(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.Pointer:
+		created := reflect.New(value.Type().Elem())
+		if err := setEnvValue(created.Elem(), raw); err != nil {
+			return err
+		}
+		value.Set(created)
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String || value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", value.Type())
+		}
+		result := reflect.MakeMap(value.Type())
+		for _, pair := range strings.Split(raw, ",") {
+			pair = strings.TrimSpace(pair)
+			if len(pair) == 0 {
+				continue
+			}
+			k, v, found := strings.Cut(pair, "=")
+			if !found || len(strings.TrimSpace(k)) == 0 {
+				return fmt.Errorf("invalid pair %q, expected key=value", pair)
+			}
+			result.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)).Convert(value.Type().Key()), reflect.ValueOf(strings.TrimSpace(v)).Convert(value.Type().Elem()))
+		}
+		value.Set(result)
+	case reflect.Slice:
+		items := strings.Split(raw, ",")
+		result := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setEnvValue(result.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		value.Set(result)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// MarshalEnvMasked 将配置输出为 YAML，敏感项（参见 IsEnvSecretKey）以 EnvSecretMask 代替。
+func MarshalEnvMasked(v interface{}) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(v); err != nil {
+		return nil, err
+	}
+	maskEnvNode(&node)
+	return yaml.Marshal(&node)
+}
+
+func maskEnvNode(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && IsEnvSecretKey(key.Value) && len(value.Value) > 0 {
+				value.Value = EnvSecretMask
+				value.Tag = "!!str"
+				value.Style = 0
+				continue
+			}
+			maskEnvNode(value)
+		}
+		return
+	}
+	for _, child := range node.Content {
+		maskEnvNode(child)
+	}
+}
@@ -0,0 +1,97 @@
+package component
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rhosocial/go-rush-common/component/mysql"
+	base "github.com/rhosocial/go-rush-producer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyEnvDefaults(t *testing.T) {
+	var env Env
+	assert.Nil(t, ApplyEnvDefaults(&env))
+	assert.Equal(t, uint8(3), env.RunningModeVerboseLevel)
+	assert.Nil(t, env.Net)
+	assert.Nil(t, env.Master)
+
+	env.Net = &EnvNet{}
+	assert.Nil(t, ApplyEnvDefaults(&env))
+	assert.Equal(t, uint16(8080), *env.Net.ListenPort)
+	assert.Equal(t, IPPreferenceIPv4, env.Net.IPPreference)
+
+	assert.NotNil(t, ApplyEnvDefaults(*env.Net))
+}
+
+func TestLoadEnvVars(t *testing.T) {
+	newEnv := func() *Env {
+		var env Env
+		assert.Nil(t, ApplyEnvDefaults(&env))
+		assert.Nil(t, env.Validate())
+		return &env
+	}
+	t.Run("nested, slice and map", func(t *testing.T) {
+		env := newEnv()
+		loaded, err := LoadEnvVars(env, EnvVarPrefix, map[string]string{
+			"Producer_Net_ListenPort":        "18080",
+			"Producer_Identity":              "3",
+			"Producer_Cluster_Secret":        "s3cr3t",
+			"Producer_Node_Labels":           "tier=gold, disk=ssd",
+			"Producer_MySQLServers_0_Host":   "db-0",
+			"Producer_MySQLServers_1_Port":   "3307",
+			"Producer_Master_Host":           "10.0.0.1",
+			"Producer_Master_Port":           "8080",
+			"Producer_Timing_SlaveRetryMax":  "5",
+			"Producer_Unknown_Field_Is_Fine": "ignored",
+		})
+		assert.Nil(t, err)
+		assert.Len(t, loaded, 9)
+		assert.Equal(t, uint16(18080), *env.Net.ListenPort)
+		assert.Equal(t, 3, env.Identity)
+		assert.Equal(t, "s3cr3t", env.Cluster.Secret)
+		assert.Equal(t, base.NodeLabels{"tier": "gold", "disk": "ssd"}, env.Node.Labels)
+		assert.Equal(t, uint8(5), *env.Timing.SlaveRetryMax)
+		assert.Len(t, *env.MySQLServers, 2)
+		assert.Equal(t, "db-0", (*env.MySQLServers)[0].Host)
+		assert.Equal(t, uint16(3306), (*env.MySQLServers)[0].Port)
+		assert.Equal(t, "localhost", (*env.MySQLServers)[1].Host)
+		assert.Equal(t, uint16(3307), (*env.MySQLServers)[1].Port)
+		assert.Equal(t, &base.FreshNodeInfo{Host: "10.0.0.1", Port: 8080}, env.Master)
+	})
+	t.Run("existing slice element", func(t *testing.T) {
+		env := newEnv()
+		env.MySQLServers = &[]mysql.EnvMySQLServer{{Host: "db-0", Port: 3306}}
+		_, err := LoadEnvVars(env, EnvVarPrefix, map[string]string{"Producer_MySQLServers_0_DB": "producer"})
+		assert.Nil(t, err)
+		assert.Equal(t, mysql.EnvMySQLServer{Host: "db-0", Port: 3306, DB: "producer"}, (*env.MySQLServers)[0])
+	})
+	t.Run("type error reports the key", func(t *testing.T) {
+		env := newEnv()
+		_, err := LoadEnvVars(env, EnvVarPrefix, map[string]string{"Producer_Net_ListenPort": "eighty"})
+		assert.ErrorIs(t, err, ErrEnvVarInvalid)
+		assert.Contains(t, err.Error(), "Producer_Net_ListenPort")
+		_, err = LoadEnvVars(env, EnvVarPrefix, map[string]string{"Producer_Timing_SlaveRetryMax": "300"})
+		assert.Contains(t, err.Error(), "Producer_Timing_SlaveRetryMax")
+	})
+	t.Run("invalid labels", func(t *testing.T) {
+		env := newEnv()
+		_, err := LoadEnvVars(env, EnvVarPrefix, map[string]string{"Producer_Node_Labels": "oops"})
+		assert.ErrorIs(t, err, ErrEnvVarInvalid)
+	})
+}
+
+func TestMarshalEnvMasked(t *testing.T) {
+	var env Env
+	assert.Nil(t, ApplyEnvDefaults(&env))
+	assert.Nil(t, env.Validate())
+	env.Cluster.Secret = "s3cr3t"
+	env.MySQLServers = &[]mysql.EnvMySQLServer{{Host: "db-0", Password: "p@ss"}}
+	content, err := env.MaskedYaml()
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(content), "s3cr3t"))
+	assert.False(t, strings.Contains(string(content), "p@ss"))
+	assert.Contains(t, string(content), "Secret: '"+EnvSecretMask+"'")
+	assert.Contains(t, string(content), "Host: db-0")
+	assert.Equal(t, "s3cr3t", env.Cluster.Secret)
+}
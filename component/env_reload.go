@@ -0,0 +1,228 @@
+package component
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"sync"
+
+	"github.com/rhosocial/go-rush-producer/component/logging"
+)
+
+// EnvReloadResult 重新加载配置的结果。各项名称为配置项路径，例如 Timing、Node.Labels。
+type EnvReloadResult struct {
+	Applied         []string `json:"applied"`          // 已在运行时生效的变更。
+	RestartRequired []string `json:"restart_required"` // 已忽略、须重启才能生效的变更。
+}
+
+// IsApplied 判断指定配置项的变更是否已生效。
+func (r *EnvReloadResult) IsApplied(key string) bool {
+	for _, applied := range r.Applied {
+		if applied == key {
+			return true
+		}
+	}
+	return false
+}
+
+// envReloadableKeys 可在运行时生效的配置项。其余配置项的变更须重启才能生效。
+var envReloadableKeys = map[string]bool{
+	"Timing":                  true,
+	"Failover":                true,
+	"Tasks":                   true,
+	"Shards":                  true,
+	"RunningMode":             true,
+	"RunningModeVerboseLevel": true,
+	"Log":                     true,
+	"Node.Labels":             true,
+}
+
+// EnvLoader 加载一份新的配置，供重新加载使用，参见 Env.Reload。
+type EnvLoader func() (*Env, error)
+
+// envSource 配置的来源和加载后的修改，由各 Env 分别持有，供重新加载使用。
+type envSource struct {
+	load      EnvLoader        // 为空表示来源未知，参见 NewEnv。
+	overrides []func(env *Env) // 加载后的修改，参见 Env.Override。
+	lock      sync.Mutex
+}
+
+var ErrEnvSourceUnknown = errors.New("configuration source unknown")
+
+// NewEnv 依次加载默认值、配置文件和环境变量，返回新的配置，不影响 GlobalEnv。
+// 若 optional 为真且配置文件不存在，则仅使用默认值和环境变量。
+//
+// 返回的配置记录了其来源，Env.Reload 未指定加载方式时从同一来源重新加载。
+func NewEnv(path string, optional bool) (*Env, error) {
+	var env Env
+	if err := ApplyEnvDefaults(&env); err != nil {
+		return nil, err
+	}
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	if err := env.LoadYaml(path); err != nil {
+		if !optional || !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		logging.Default.Warn("configuration file ignored", "path", path, "error", err)
+	}
+	if err := env.LoadSystemEnvVar(); err != nil {
+		return nil, err
+	}
+	env.source.load = func() (*Env, error) {
+		return NewEnv(path, optional)
+	}
+	return &env, nil
+}
+
+// LoadEnv 加载配置并设为 GlobalEnv，参见 NewEnv。
+func LoadEnv(path string, optional bool) error {
+	env, err := NewEnv(path, optional)
+	if err != nil {
+		return err
+	}
+	GlobalEnv = env
+	GlobalEnv.ApplyLogging(logging.Default)
+	return nil
+}
+
+// Override 修改配置，并记录该修改，重新加载后再次应用，例如命令行参数指定的身份和端口。须在启动之前调用。
+func (e *Env) Override(override func(env *Env)) {
+	e.source.lock.Lock()
+	defer e.source.lock.Unlock()
+	e.source.overrides = append(e.source.overrides, override)
+	override(e)
+}
+
+// ApplyLogging 使日志格式和详细程度生效，参见 EnvLog 和 Env.RunningModeVerboseLevel。
+func (e *Env) ApplyLogging(logger *logging.Logger) {
+	e.reloadLock.RLock()
+	defer e.reloadLock.RUnlock()
+	logger.SetFormat(e.Log.Format)
+	logger.SetLevel(e.RunningModeVerboseLevel)
+}
+
+// ---- Reloadable ---- //
+
+// 可在运行时生效的配置项可能被 Env.Reload 替换，运行中应通过以下方法读取。替换时整体替换，不修改原有内容。
+
+// GetTiming 当前的时间间隔与重试阈值。
+func (e *Env) GetTiming() *EnvTiming {
+	e.reloadLock.RLock()
+	defer e.reloadLock.RUnlock()
+	return e.Timing
+}
+
+// GetFailover 当前的接替策略。
+func (e *Env) GetFailover() *EnvFailover {
+	e.reloadLock.RLock()
+	defer e.reloadLock.RUnlock()
+	return e.Failover
+}
+
+// GetTasks 当前的任务分配配置。
+func (e *Env) GetTasks() *EnvTasks {
+	e.reloadLock.RLock()
+	defer e.reloadLock.RUnlock()
+	return e.Tasks
+}
+
+// GetShards 当前的分片配置。
+func (e *Env) GetShards() *EnvShards {
+	e.reloadLock.RLock()
+	defer e.reloadLock.RUnlock()
+	return e.Shards
+}
+
+// GetNodeLabels 当前的节点标签。未配置节点元数据时为空。
+func (e *Env) GetNodeLabels() map[string]string {
+	e.reloadLock.RLock()
+	defer e.reloadLock.RUnlock()
+	if e.Node == nil {
+		return nil
+	}
+	return e.Node.Labels
+}
+
+// ---- Reloadable ---- //
+
+// Reload 以 load 加载新的配置，再次应用 Override 记录的修改，仅应用可在运行时生效的变更，参见 DiffEnv。
+// load 为空时从 NewEnv 记录的来源重新加载；若来源未知，则报 ErrEnvSourceUnknown。
+// 日志格式和详细程度须由调用方再次生效，参见 ApplyLogging。
+//
+// 若新配置无效，则报错，当前配置保持不变。
+func (e *Env) Reload(load EnvLoader) (*EnvReloadResult, error) {
+	e.source.lock.Lock()
+	defer e.source.lock.Unlock()
+	if load == nil {
+		load = e.source.load
+	}
+	if load == nil {
+		return nil, ErrEnvSourceUnknown
+	}
+	next, err := load()
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range e.source.overrides {
+		override(next)
+	}
+	e.reloadLock.Lock()
+	defer e.reloadLock.Unlock()
+	result := DiffEnv(e, next)
+	for _, key := range result.Applied {
+		switch key {
+		case "Timing":
+			e.Timing = next.Timing
+		case "Failover":
+			e.Failover = next.Failover
+		case "Tasks":
+			e.Tasks = next.Tasks
+		case "Shards":
+			e.Shards = next.Shards
+		case "RunningMode":
+			e.RunningMode = next.RunningMode
+		case "RunningModeVerboseLevel":
+			e.RunningModeVerboseLevel = next.RunningModeVerboseLevel
+		case "Log":
+			e.Log = next.Log
+		case "Node.Labels":
+			e.Node.Labels = next.Node.Labels
+		}
+	}
+	return result, nil
+}
+
+// DiffEnv 比较两份配置，按是否可在运行时生效分别列出变更的配置项。
+// Node 按其下各项分别比较，其余按顶层配置项整体比较。
+func DiffEnv(current *Env, next *Env) *EnvReloadResult {
+	result := EnvReloadResult{Applied: make([]string, 0), RestartRequired: make([]string, 0)}
+	record := func(key string, a reflect.Value, b reflect.Value) {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return
+		}
+		if envReloadableKeys[key] {
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, key)
+		}
+	}
+	currentValue, nextValue := reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem()
+	envType := currentValue.Type()
+	for i := 0; i < envType.NumField(); i++ {
+		if !envType.Field(i).IsExported() {
+			continue
+		}
+		name := envType.Field(i).Name
+		if name == "Node" && current.Node != nil && next.Node != nil {
+			nodeType := reflect.TypeOf(*current.Node)
+			for j := 0; j < nodeType.NumField(); j++ {
+				record("Node."+nodeType.Field(j).Name, reflect.ValueOf(current.Node).Elem().Field(j), reflect.ValueOf(next.Node).Elem().Field(j))
+			}
+			continue
+		}
+		record(name, currentValue.Field(i), nextValue.Field(i))
+	}
+	return &result
+}
@@ -0,0 +1,115 @@
+package component
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffEnv(t *testing.T) {
+	current, err := NewEnv(filepath.Join(t.TempDir(), "absent.yaml"), true)
+	assert.Nil(t, err)
+	next, err := NewEnv(filepath.Join(t.TempDir(), "absent.yaml"), true)
+	assert.Nil(t, err)
+	t.Run("unchanged", func(t *testing.T) {
+		result := DiffEnv(current, next)
+		assert.Empty(t, result.Applied)
+		assert.Empty(t, result.RestartRequired)
+	})
+	t.Run("changed", func(t *testing.T) {
+		threshold := uint8(5)
+		next.Failover.LossThreshold = &threshold
+		next.Node.Labels = map[string]string{"tier": "gold"}
+		next.Node.Zone = "zone-b"
+		next.Identity = 1
+		result := DiffEnv(current, next)
+		assert.Equal(t, []string{"Node.Labels", "Failover"}, result.Applied)
+		assert.Equal(t, []string{"Node.Zone", "Identity"}, result.RestartRequired)
+		assert.True(t, result.IsApplied("Failover"))
+		assert.False(t, result.IsApplied("Node.Zone"))
+	})
+}
+
+func TestEnv_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("Identity: 1\nFailover:\n  LossThreshold: 2\n"), 0600))
+	env, err := NewEnv(path, false)
+	assert.Nil(t, err)
+
+	t.Run("apply safe changes only", func(t *testing.T) {
+		assert.Nil(t, os.WriteFile(path, []byte("Identity: 2\nFailover:\n  LossThreshold: 4\n"), 0600))
+		result, err := env.Reload(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Failover"}, result.Applied)
+		assert.Equal(t, []string{"Identity"}, result.RestartRequired)
+		assert.Equal(t, uint8(4), *env.Failover.LossThreshold)
+		assert.Equal(t, 1, env.Identity)
+	})
+	t.Run("invalid configuration is rejected", func(t *testing.T) {
+		assert.Nil(t, os.WriteFile(path, []byte("Failover:\n  Policy: random\n"), 0600))
+		_, err := env.Reload(nil)
+		assert.ErrorIs(t, err, ErrEnvFailoverPolicyInvalid)
+		assert.Equal(t, uint8(4), *env.Failover.LossThreshold)
+	})
+	t.Run("overrides are kept", func(t *testing.T) {
+		assert.Nil(t, os.WriteFile(path, []byte("Identity: 1\nFailover:\n  LossThreshold: 4\n"), 0600))
+		env, err := NewEnv(path, false)
+		assert.Nil(t, err)
+		port := uint16(9090)
+		env.Override(func(env *Env) { env.Identity = 3 })
+		env.Override(func(env *Env) { env.Net.ListenPort = &port })
+		assert.Nil(t, os.WriteFile(path, []byte("Identity: 1\nFailover:\n  LossThreshold: 5\n"), 0600))
+		result, err := env.Reload(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Failover"}, result.Applied)
+		assert.Empty(t, result.RestartRequired)
+		assert.Equal(t, 3, env.Identity)
+		assert.Equal(t, uint16(9090), *env.Net.ListenPort)
+	})
+	t.Run("separate sources", func(t *testing.T) {
+		other := filepath.Join(t.TempDir(), "other.yaml")
+		assert.Nil(t, os.WriteFile(other, []byte("Failover:\n  LossThreshold: 7\n"), 0600))
+		another, err := NewEnv(other, false)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(other, []byte("Failover:\n  LossThreshold: 8\n"), 0600))
+		_, err = another.Reload(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, uint8(8), *another.Failover.LossThreshold)
+		assert.NotEqual(t, uint8(8), *env.Failover.LossThreshold)
+	})
+	t.Run("loader", func(t *testing.T) {
+		var unknown Env
+		assert.Nil(t, unknown.Validate())
+		_, err := unknown.Reload(nil)
+		assert.ErrorIs(t, err, ErrEnvSourceUnknown)
+		result, err := unknown.Reload(func() (*Env, error) {
+			next := Env{}
+			if err := next.Validate(); err != nil {
+				return nil, err
+			}
+			threshold := uint8(9)
+			next.Failover.LossThreshold = &threshold
+			return &next, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Failover"}, result.Applied)
+		assert.Equal(t, uint8(9), *unknown.Failover.LossThreshold)
+	})
+	t.Run("concurrent reads", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				_ = *env.GetFailover().LossThreshold
+				_ = env.GetTiming().GetMasterInterval()
+			}
+		}()
+		assert.Nil(t, os.WriteFile(path, []byte("Identity: 1\nFailover:\n  LossThreshold: 5\n"), 0600))
+		_, err := env.Reload(nil)
+		assert.Nil(t, err)
+		<-done
+		assert.Equal(t, uint8(5), *env.GetFailover().LossThreshold)
+	})
+}
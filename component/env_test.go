@@ -0,0 +1,149 @@
+package component
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component/tracing"
+	base "github.com/rhosocial/go-rush-producer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvTiming_Validate(t *testing.T) {
+	uint8Of := func(v uint8) *uint8 { return &v }
+	uint16Of := func(v uint16) *uint16 { return &v }
+	t.Run("defaults", func(t *testing.T) {
+		timing := EnvTiming{}
+		assert.Nil(t, timing.Validate())
+		assert.Equal(t, uint16(1200), *timing.MasterInterval)
+		assert.Equal(t, uint16(1000), *timing.SlaveInterval)
+		assert.Equal(t, uint8(3), *timing.SlaveRetryMax)
+		assert.Equal(t, uint8(3), *timing.SlaveInactiveLimit)
+		assert.Equal(t, uint8(4), *timing.SlaveRemoveLimit)
+		assert.Equal(t, uint16(3000), *timing.RequestTimeout)
+	})
+	t.Run("inactive not less than removed", func(t *testing.T) {
+		timing := EnvTiming{SlaveInactiveLimit: uint8Of(4), SlaveRemoveLimit: uint8Of(4)}
+		assert.ErrorIs(t, timing.Validate(), ErrEnvTimingInvalid)
+	})
+	t.Run("slave timeout too short", func(t *testing.T) {
+		timing := EnvTiming{MasterInterval: uint16Of(5000), SlaveInterval: uint16Of(1000), SlaveRetryMax: uint8Of(3)}
+		assert.ErrorIs(t, timing.Validate(), ErrEnvTimingInvalid)
+	})
+	t.Run("master removes slaves too early", func(t *testing.T) {
+		timing := EnvTiming{MasterInterval: uint16Of(200), SlaveInterval: uint16Of(1000), SlaveRetryMax: uint8Of(3)}
+		assert.ErrorIs(t, timing.Validate(), ErrEnvTimingInvalid)
+	})
+	t.Run("request timeout too long", func(t *testing.T) {
+		timing := EnvTiming{RequestTimeout: uint16Of(5000)}
+		assert.ErrorIs(t, timing.Validate(), ErrEnvTimingInvalid)
+	})
+}
+
+func TestEnvTracing_Validate(t *testing.T) {
+	float64Of := func(v float64) *float64 { return &v }
+	t.Run("defaults", func(t *testing.T) {
+		envTracing := EnvTracing{}
+		assert.Nil(t, envTracing.Validate())
+		assert.Equal(t, tracing.ExporterNone, envTracing.Exporter)
+		assert.Equal(t, float64(1), *envTracing.SampleRatio)
+	})
+	t.Run("invalid exporter", func(t *testing.T) {
+		envTracing := EnvTracing{Exporter: "zipkin"}
+		assert.ErrorIs(t, envTracing.Validate(), tracing.ErrExporterInvalid)
+	})
+	t.Run("invalid sample ratio", func(t *testing.T) {
+		envTracing := EnvTracing{Exporter: tracing.ExporterOTLP, SampleRatio: float64Of(1.5)}
+		assert.ErrorIs(t, envTracing.Validate(), ErrEnvTracingSampleRatioInvalid)
+	})
+}
+
+func TestEnvHooks_Validate(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		hooks := EnvHooks{}
+		assert.Nil(t, hooks.Validate())
+		assert.Equal(t, 10*time.Second, hooks.GetTimeout())
+	})
+	t.Run("executable", func(t *testing.T) {
+		hooks := EnvHooks{Master: "true", Shutdown: "/bin/sh"}
+		assert.Nil(t, hooks.Validate())
+	})
+	t.Run("not found", func(t *testing.T) {
+		hooks := EnvHooks{Slave: filepath.Join(t.TempDir(), "missing.sh")}
+		err := hooks.Validate()
+		assert.ErrorIs(t, err, ErrEnvHookInvalid)
+		assert.Contains(t, err.Error(), "Slave")
+	})
+}
+
+func TestEnvAdmin_Validate(t *testing.T) {
+	env := Env{Cluster: &EnvCluster{Secret: "s3cret"}}
+	assert.Nil(t, env.Validate())
+	assert.Empty(t, env.Admin.Secret)
+	env.Admin.Secret = "s3cret"
+	assert.ErrorIs(t, env.Validate(), ErrEnvAdminInvalid)
+	env.Admin.Secret = "an0ther"
+	assert.Nil(t, env.Validate())
+}
+
+func TestEnvNode_Validate(t *testing.T) {
+	node := EnvNode{Labels: base.NodeLabels{"tier": "gold", "example.com/disk": "ssd"}}
+	assert.Nil(t, node.Validate())
+	assert.Equal(t, uint32(1), *node.Weight)
+	node.Labels[`a"] OR 1=1`] = "x"
+	assert.ErrorIs(t, node.Validate(), base.ErrLabelKeyInvalid)
+}
+
+func TestEnvWebhooks_Validate(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		webhooks := EnvWebhooks{Targets: []EnvWebhook{{Name: "pager", URL: "https://pager.example.com/hook", Secret: "s3cret"}}}
+		assert.Nil(t, webhooks.Validate())
+		assert.Equal(t, uint8(5), *webhooks.RetryMax)
+		assert.Equal(t, time.Second, webhooks.GetRetryBackoff())
+		assert.True(t, webhooks.Targets[0].Subscribes(WebhookEventHandoverFailed))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, target := range []EnvWebhook{
+			{URL: "https://pager.example.com/hook", Secret: "s3cret"},
+			{Name: "pager", URL: "pager.example.com/hook", Secret: "s3cret"},
+			{Name: "pager", URL: "ftp://pager.example.com/hook", Secret: "s3cret"},
+			{Name: "pager", URL: "https://pager.example.com/hook"},
+			{Name: "pager", URL: "https://pager.example.com/hook", Secret: "s3cret", Events: []string{"slave_joined"}},
+		} {
+			webhooks := EnvWebhooks{Targets: []EnvWebhook{target}}
+			assert.ErrorIs(t, webhooks.Validate(), ErrEnvWebhookInvalid)
+		}
+	})
+	t.Run("duplicate name", func(t *testing.T) {
+		target := EnvWebhook{Name: "pager", URL: "https://pager.example.com/hook", Secret: "s3cret"}
+		webhooks := EnvWebhooks{Targets: []EnvWebhook{target, target}}
+		assert.ErrorIs(t, webhooks.Validate(), ErrEnvWebhookInvalid)
+	})
+	t.Run("cluster secret", func(t *testing.T) {
+		env := Env{
+			Cluster:  &EnvCluster{Secret: "s3cret"},
+			Webhooks: &EnvWebhooks{Targets: []EnvWebhook{{Name: "pager", URL: "https://pager.example.com/hook", Secret: "s3cret"}}},
+		}
+		assert.ErrorIs(t, env.Validate(), ErrEnvWebhookInvalid)
+		env.Webhooks.Targets[0].Secret = "an0ther"
+		assert.Nil(t, env.Validate())
+	})
+	t.Run("environment variables", func(t *testing.T) {
+		env := &Env{}
+		assert.Nil(t, ApplyEnvDefaults(env))
+		_, err := LoadEnvVars(env, EnvVarPrefix, map[string]string{
+			"Producer_Webhooks_Targets_0_Name":   "chatops",
+			"Producer_Webhooks_Targets_0_URL":    "https://chat.example.com/hook",
+			"Producer_Webhooks_Targets_0_Secret": "s3cret",
+			"Producer_Webhooks_Targets_0_Events": "master_changed,handover_failed",
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, env.Validate())
+		assert.Equal(t, []string{WebhookEventMasterChanged, WebhookEventHandoverFailed}, env.Webhooks.Targets[0].Events)
+		assert.False(t, env.Webhooks.Targets[0].Subscribes(WebhookEventSlaveInactive))
+		masked, err := env.MaskedYaml()
+		assert.Nil(t, err)
+		assert.NotContains(t, string(masked), "s3cret")
+	})
+}
@@ -0,0 +1,229 @@
+// Package hook 生命周期脚本。身份变化和退出时执行配置的可执行文件，以便移动浮动 IP、重新配置本地代理等，参见 component.EnvHooks。
+//
+// 脚本依次收到参数：状态、本节点ID、主节点套接字、原因；同样的内容也以 RUSH_* 环境变量提供，参见 EnvState 等。
+// 脚本按身份变化的顺序逐个执行，超时后终止。输出（标准输出与标准错误）与执行结果一并记录到日志。
+package hook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/logging"
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+	"github.com/rhosocial/go-rush-producer/component/node"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+)
+
+// 状态，即脚本的第一个参数。
+const (
+	StateMaster        = "master"         // 成为主节点。
+	StateSlave         = "slave"          // 成为从节点。
+	StateNotDetermined = "not_determined" // 身份变为未定。
+	StateShutdown      = "shutdown"       // 即将退出。
+)
+
+// 传给脚本的环境变量名。
+const (
+	EnvState         = "RUSH_STATE"          // 状态，参见 StateMaster 等。
+	EnvPreviousState = "RUSH_PREVIOUS_STATE" // 变化前的状态。
+	EnvNodeID        = "RUSH_NODE_ID"        // 本节点ID。
+	EnvNodeSocket    = "RUSH_NODE_SOCKET"    // 本节点套接字。
+	EnvMasterSocket  = "RUSH_MASTER_SOCKET"  // 主节点套接字。成为主节点时为本节点套接字；没有主节点时为空。
+	EnvCause         = "RUSH_CAUSE"          // 原因，可能为空。
+)
+
+// outputLimit 记录到日志的输出上限（字节）。超出部分丢弃。
+const outputLimit = 4096
+
+// waitDelay 脚本退出或被终止后，等待其子进程释放输出的最长时间。
+const waitDelay = time.Second
+
+// State 身份对应的状态。同时具有主、从节点身份时视为主节点。
+func State(identity uint8) string {
+	if identity&node.IdentityMaster > 0 {
+		return StateMaster
+	}
+	if identity&node.IdentitySlave > 0 {
+		return StateSlave
+	}
+	return StateNotDetermined
+}
+
+// Invocation 一次脚本执行的内容。
+type Invocation struct {
+	State         string
+	PreviousState string
+	NodeID        uint64
+	NodeSocket    string
+	MasterSocket  string
+	Cause         string
+}
+
+// Args 脚本参数：状态、本节点ID、主节点套接字、原因。
+func (i *Invocation) Args() []string {
+	return []string{i.State, strconv.FormatUint(i.NodeID, 10), i.MasterSocket, i.Cause}
+}
+
+// Environ 在当前进程的环境变量之后追加的 RUSH_* 环境变量。
+func (i *Invocation) Environ() []string {
+	return append(os.Environ(),
+		EnvState+"="+i.State,
+		EnvPreviousState+"="+i.PreviousState,
+		EnvNodeID+"="+strconv.FormatUint(i.NodeID, 10),
+		EnvNodeSocket+"="+i.NodeSocket,
+		EnvMasterSocket+"="+i.MasterSocket,
+		EnvCause+"="+i.Cause,
+	)
+}
+
+// limitedBuffer 只保留前 outputLimit 字节的输出。
+type limitedBuffer struct {
+	buffer    bytes.Buffer
+	truncated bool
+	lock      sync.Mutex
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if remain := outputLimit - b.buffer.Len(); len(p) > remain {
+		b.buffer.Write(p[:remain])
+		b.truncated = true
+	} else {
+		b.buffer.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buffer.String()
+}
+
+// Runner 生命周期脚本执行者。
+type Runner struct {
+	env  *component.EnvHooks
+	self func() *NodeInfo.NodeInfo
+
+	// 以下各项仅由处理事件的协程修改，Shutdown 在该协程结束后读取。
+	state  string
+	master string
+
+	subscription *node.EventSubscription
+	done         chan struct{}
+}
+
+// NewRunner 创建脚本执行者。self 返回当前节点，执行脚本时调用。
+func NewRunner(env *component.EnvHooks, self func() *NodeInfo.NodeInfo) *Runner {
+	return &Runner{env: env, self: self, state: StateNotDetermined}
+}
+
+// path 状态对应的脚本路径。为空表示不执行。
+func (r *Runner) path(state string) string {
+	switch state {
+	case StateMaster:
+		return r.env.Master
+	case StateSlave:
+		return r.env.Slave
+	case StateNotDetermined:
+		return r.env.NotDetermined
+	case StateShutdown:
+		return r.env.Shutdown
+	}
+	return ""
+}
+
+// Start 订阅 events 中的身份变化，在独立协程中执行对应的脚本。应在节点池启动前调用，以免错过启动时的身份变化。
+//
+// 脚本执行期间发生的多次身份变化合并为最新的一次，因此最终状态的脚本总会执行，中间状态的脚本可能被跳过。
+func (r *Runner) Start(events *node.EventBus) {
+	r.subscription = events.SubscribeLatest(node.EventIdentityChanged)
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		for event := range r.subscription.Events() {
+			r.handle(event.(*node.IdentityChangedEvent))
+		}
+	}()
+}
+
+// handle 处理身份变化。状态与上次执行脚本时相同时（例如主节点增加从节点身份）不执行脚本。
+//
+// 之前的身份变化可能已被合并，因此原状态取上次执行脚本时的状态，而不是 event.Previous。
+func (r *Runner) handle(event *node.IdentityChangedEvent) {
+	previous, state := r.state, State(event.Current)
+	r.master = ""
+	if event.Master != nil {
+		r.master = event.Master.Socket()
+	}
+	if previous == state {
+		return
+	}
+	r.state = state
+	invocation := r.invocation(state, previous, event.Cause)
+	_ = r.Run(context.Background(), invocation)
+}
+
+func (r *Runner) invocation(state string, previous string, cause error) *Invocation {
+	invocation := Invocation{State: state, PreviousState: previous, MasterSocket: r.master}
+	if self := r.self(); self != nil {
+		invocation.NodeID, invocation.NodeSocket = self.ID, self.Socket()
+	}
+	if cause != nil {
+		invocation.Cause = cause.Error()
+	}
+	return &invocation
+}
+
+// Run 执行 invocation 的状态对应的脚本，超时后终止。未配置脚本时什么也不做。
+//
+// 脚本以非零状态退出、超时或无法启动时报错。输出与结果均记录到日志。
+func (r *Runner) Run(ctx context.Context, invocation *Invocation) error {
+	path := r.path(invocation.State)
+	if len(path) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.env.GetTimeout())
+	defer cancel()
+	var output limitedBuffer
+	cmd := exec.CommandContext(ctx, path, invocation.Args()...)
+	cmd.Env = invocation.Environ()
+	cmd.Stdout, cmd.Stderr = &output, &output
+	cmd.WaitDelay = waitDelay
+	started := time.Now()
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = ctx.Err()
+	}
+	keyvals := []any{"hook", invocation.State, "path", path, "duration_ms", time.Since(started).Milliseconds(), "output", output.String()}
+	if output.truncated {
+		keyvals = append(keyvals, "output_truncated", true)
+	}
+	if err != nil {
+		metrics.HookRuns.WithLabelValues(invocation.State, "failure").Inc()
+		logging.Default.Error("hook failed", append(keyvals, "error", err)...)
+		return err
+	}
+	metrics.HookRuns.WithLabelValues(invocation.State, "success").Inc()
+	logging.Default.Info("hook finished", keyvals...)
+	return nil
+}
+
+// Shutdown 取消订阅，等待已收到的身份变化对应的脚本执行完毕，再执行退出脚本。cause 为退出原因。
+//
+// 应在节点池停止之后、进程退出之前调用。
+func (r *Runner) Shutdown(ctx context.Context, cause error) error {
+	if r.subscription != nil {
+		r.subscription.Unsubscribe()
+		<-r.done
+	}
+	return r.Run(ctx, r.invocation(StateShutdown, r.state, cause))
+}
@@ -0,0 +1,165 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/node"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeScript 在临时目录中写入可执行的 shell 脚本，返回其路径。
+func writeScript(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	assert.Nil(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755))
+	return path
+}
+
+// waitLines 等待 path 中至少有 n 行。
+func waitLines(t *testing.T, path string, n int) {
+	assert.Eventually(t, func() bool {
+		content, _ := os.ReadFile(path)
+		return strings.Count(string(content), "\n") >= n
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func newEnvHooks(timeout uint16) *component.EnvHooks {
+	return &component.EnvHooks{Timeout: &timeout}
+}
+
+func TestState(t *testing.T) {
+	assert.Equal(t, StateNotDetermined, State(node.IdentityNotDetermined))
+	assert.Equal(t, StateMaster, State(node.IdentityMaster))
+	assert.Equal(t, StateSlave, State(node.IdentitySlave))
+	assert.Equal(t, StateMaster, State(node.IdentityAll))
+}
+
+func TestRunner_Run(t *testing.T) {
+	self := &NodeInfo.NodeInfo{ID: 3, Host: "10.0.0.3", Port: 8080}
+	invocation := &Invocation{State: StateMaster, PreviousState: StateSlave, NodeID: 3, NodeSocket: "10.0.0.3:8080", MasterSocket: "10.0.0.3:8080", Cause: "superseded"}
+
+	t.Run("arguments and environment", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		env := newEnvHooks(5000)
+		env.Master = writeScript(t, `echo "$@" > `+out+`; env | grep '^RUSH_' | sort >> `+out)
+		runner := NewRunner(env, func() *NodeInfo.NodeInfo { return self })
+		assert.Nil(t, runner.Run(context.Background(), invocation))
+		content, err := os.ReadFile(out)
+		assert.Nil(t, err)
+		assert.Equal(t, strings.Join([]string{
+			"master 3 10.0.0.3:8080 superseded",
+			"RUSH_CAUSE=superseded",
+			"RUSH_MASTER_SOCKET=10.0.0.3:8080",
+			"RUSH_NODE_ID=3",
+			"RUSH_NODE_SOCKET=10.0.0.3:8080",
+			"RUSH_PREVIOUS_STATE=slave",
+			"RUSH_STATE=master",
+		}, "\n")+"\n", string(content))
+	})
+	t.Run("not configured", func(t *testing.T) {
+		runner := NewRunner(newEnvHooks(5000), func() *NodeInfo.NodeInfo { return self })
+		assert.Nil(t, runner.Run(context.Background(), invocation))
+	})
+	t.Run("non-zero exit", func(t *testing.T) {
+		env := newEnvHooks(5000)
+		env.Master = writeScript(t, "echo failed >&2; exit 3")
+		runner := NewRunner(env, func() *NodeInfo.NodeInfo { return self })
+		assert.NotNil(t, runner.Run(context.Background(), invocation))
+	})
+	t.Run("timeout", func(t *testing.T) {
+		env := newEnvHooks(100)
+		env.Master = writeScript(t, "sleep 10")
+		runner := NewRunner(env, func() *NodeInfo.NodeInfo { return self })
+		started := time.Now()
+		assert.ErrorIs(t, runner.Run(context.Background(), invocation), context.DeadlineExceeded)
+		assert.Less(t, time.Since(started), 5*time.Second)
+	})
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	var buffer limitedBuffer
+	n, err := buffer.Write(make([]byte, outputLimit+10))
+	assert.Nil(t, err)
+	assert.Equal(t, outputLimit+10, n)
+	assert.Len(t, buffer.String(), outputLimit)
+	assert.True(t, buffer.truncated)
+}
+
+func TestRunner_Start(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	script := writeScript(t, `echo "$RUSH_PREVIOUS_STATE>$1 $3 $4" >> `+out)
+	env := newEnvHooks(5000)
+	env.Master, env.Slave, env.NotDetermined, env.Shutdown = script, script, script, script
+	self := &NodeInfo.NodeInfo{ID: 2, Host: "10.0.0.2", Port: 8080}
+	master := &NodeInfo.NodeInfo{ID: 1, Host: "10.0.0.1", Port: 8080}
+	events := node.NewEventBus()
+	runner := NewRunner(env, func() *NodeInfo.NodeInfo { return self })
+	runner.Start(events)
+
+	takeover := errors.New("takeover")
+	// 逐个等待脚本执行完毕，以免身份变化被合并。
+	events.Publish(&node.IdentityChangedEvent{Previous: node.IdentityNotDetermined, Current: node.IdentitySlave, Master: master})
+	waitLines(t, out, 1)
+	events.Publish(&node.IdentityChangedEvent{Previous: node.IdentitySlave, Current: node.IdentityNotDetermined, Cause: takeover, Master: master})
+	waitLines(t, out, 2)
+	events.Publish(&node.IdentityChangedEvent{Previous: node.IdentityNotDetermined, Current: node.IdentityMaster, Master: self})
+	waitLines(t, out, 3)
+	// 状态不变，不执行。
+	events.Publish(&node.IdentityChangedEvent{Previous: node.IdentityMaster, Current: node.IdentityAll, Master: self})
+	assert.Nil(t, runner.Shutdown(context.Background(), errors.New("signal")))
+
+	content, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"not_determined>slave 10.0.0.1:8080 ",
+		"slave>not_determined 10.0.0.1:8080 takeover",
+		"not_determined>master 10.0.0.2:8080 ",
+		"master>shutdown 10.0.0.2:8080 signal",
+	}, "\n")+"\n", string(content))
+}
+
+func TestRunner_Coalesce(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	env := newEnvHooks(5000)
+	env.Master = writeScript(t, `sleep 0.2; echo "$RUSH_PREVIOUS_STATE>$1" >> `+out)
+	env.Slave, env.NotDetermined = env.Master, env.Master
+	env.Shutdown = writeScript(t, `echo "$RUSH_PREVIOUS_STATE>$1" >> `+out)
+	self := &NodeInfo.NodeInfo{ID: 2, Host: "10.0.0.2", Port: 8080}
+	events := node.NewEventBus()
+	runner := NewRunner(env, func() *NodeInfo.NodeInfo { return self })
+	runner.Start(events)
+
+	// 脚本执行期间的身份变化远多于订阅缓冲，最终状态的脚本仍须执行。
+	identities := []uint8{node.IdentitySlave, node.IdentityNotDetermined}
+	previous := uint8(node.IdentityNotDetermined)
+	for i := 0; i < 2*node.EventSubscriberBufferDefault; i++ {
+		current := identities[i%2]
+		events.Publish(&node.IdentityChangedEvent{Previous: previous, Current: current})
+		previous = current
+	}
+	events.Publish(&node.IdentityChangedEvent{Previous: previous, Current: node.IdentityMaster, Master: self})
+	assert.Nil(t, runner.Shutdown(context.Background(), errors.New("signal")))
+
+	content, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	assert.Less(t, len(lines), 2*node.EventSubscriberBufferDefault)
+	if assert.GreaterOrEqual(t, len(lines), 2) {
+		assert.True(t, strings.HasSuffix(lines[len(lines)-2], ">master"), lines[len(lines)-2])
+		assert.Equal(t, "master>shutdown", lines[len(lines)-1])
+	}
+	// 每次执行的原状态为上次执行时的状态。
+	state := StateNotDetermined
+	for _, line := range lines {
+		states := strings.SplitN(line, ">", 2)
+		assert.Equal(t, state, states[0])
+		state = states[1]
+	}
+}
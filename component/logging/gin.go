@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLog 以 LevelInfo 输出每个请求的访问日志。请求ID取自上下文中的 requestIDKey。
+func AccessLog(l *Logger, requestIDKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		keyvals := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		}
+		if id, exist := c.Get(requestIDKey); exist {
+			keyvals = append(keyvals, "request_id", id)
+		}
+		if len(c.Errors) > 0 {
+			keyvals = append(keyvals, "error", c.Errors.String())
+		}
+		l.Info("request", keyvals...)
+	}
+}
@@ -0,0 +1,205 @@
+// Package logging 分级结构化日志。
+//
+// 每条日志包括时间、级别、消息和若干键值对字段，可输出为 logfmt 风格的文本或逐行 JSON，参见 FormatText 和 FormatJSON。
+// 级别数值越大越详细，仅输出级别不大于当前详细程度的日志，参见 Logger.SetLevel。
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LevelError uint8 = 1 // 错误。
+	LevelWarn  uint8 = 2 // 警告。
+	LevelInfo  uint8 = 3 // 一般信息。
+	LevelDebug uint8 = 4 // 调试信息。
+)
+
+const (
+	FormatText = "text" // logfmt 风格的文本，形如 time=... level=info msg="..." node_id=1。
+	FormatJSON = "json" // 逐行 JSON 对象。
+)
+
+var ErrFormatInvalid = errors.New("invalid log format")
+
+// ValidateFormat 校验输出格式。
+func ValidateFormat(format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("%w: %s", ErrFormatInvalid, format)
+	}
+	return nil
+}
+
+// LevelName 级别名称。
+func LevelName(level uint8) string {
+	switch level {
+	case LevelError:
+		return "error"
+	case LevelWarn:
+		return "warn"
+	case LevelInfo:
+		return "info"
+	case LevelDebug:
+		return "debug"
+	}
+	return "level" + strconv.Itoa(int(level))
+}
+
+// output 同一日志及其派生日志共享的输出设置。
+type output struct {
+	writer io.Writer
+	format string
+	level  uint8
+	lock   sync.RWMutex
+}
+
+// Logger 结构化日志。由 With 派生的日志共享输出设置，并附带各自的字段。可并发使用。
+type Logger struct {
+	output *output
+	fields []any
+}
+
+// New 创建日志。format 参见 FormatText 和 FormatJSON，level 为详细程度。
+func New(writer io.Writer, format string, level uint8) *Logger {
+	return &Logger{output: &output{writer: writer, format: format, level: level}}
+}
+
+// Default 默认日志。输出到标准错误，格式为文本，详细程度为 LevelInfo。
+var Default = New(os.Stderr, FormatText, LevelInfo)
+
+// SetLevel 修改详细程度。对所有派生日志生效。为 0 时不输出任何日志，Fatal 除外。
+func (l *Logger) SetLevel(level uint8) {
+	l.output.lock.Lock()
+	defer l.output.lock.Unlock()
+	l.output.level = level
+}
+
+// SetFormat 修改输出格式。对所有派生日志生效。
+func (l *Logger) SetFormat(format string) {
+	l.output.lock.Lock()
+	defer l.output.lock.Unlock()
+	l.output.format = format
+}
+
+// Enabled 判断是否输出指定级别的日志。
+func (l *Logger) Enabled(level uint8) bool {
+	l.output.lock.RLock()
+	defer l.output.lock.RUnlock()
+	return level <= l.output.level
+}
+
+// With 派生附带字段的日志。keyvals 为交替的键和值，键须为字符串。
+func (l *Logger) With(keyvals ...any) *Logger {
+	fields := make([]any, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{output: l.output, fields: fields}
+}
+
+func (l *Logger) Error(msg string, keyvals ...any) {
+	l.log(LevelError, msg, keyvals)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...any) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+func (l *Logger) Info(msg string, keyvals ...any) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+func (l *Logger) Debug(msg string, keyvals ...any) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Fatal 无论详细程度如何，均以 LevelError 输出，然后退出进程。
+func (l *Logger) Fatal(msg string, keyvals ...any) {
+	l.write(LevelError, msg, keyvals)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level uint8, msg string, keyvals []any) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, msg, keyvals)
+}
+
+func (l *Logger) write(level uint8, msg string, keyvals []any) {
+	fields := make([]any, 0, 6+len(l.fields)+len(keyvals))
+	fields = append(fields, "time", time.Now().Format(time.RFC3339Nano), "level", LevelName(level), "msg", msg)
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	if len(fields)%2 == 1 {
+		fields = append(fields[:len(fields)-1], "!BADKEY", fields[len(fields)-1])
+	}
+	l.output.lock.Lock()
+	defer l.output.lock.Unlock()
+	var line []byte
+	if l.output.format == FormatJSON {
+		line = encodeJSON(fields)
+	} else {
+		line = encodeText(fields)
+	}
+	_, _ = l.output.writer.Write(line)
+}
+
+// fieldValue 将字段值转换为可输出的形式。错误和 fmt.Stringer 取其字符串。
+func fieldValue(value any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+func encodeText(fields []any) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(fields[i]))
+		buf.WriteByte('=')
+		value := fmt.Sprint(fieldValue(fields[i+1]))
+		if len(value) == 0 || strings.ContainsAny(value, " =\"\t\r\n") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func encodeJSON(fields []any) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(fields[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(fieldValue(fields[i+1]))
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(fields[i+1]))
+		}
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
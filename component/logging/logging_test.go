@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		l := New(&buf, FormatText, LevelInfo)
+		l.Info("node started", "node_id", 1, "peer", "127.0.0.1:8080", "error", errors.New("lost master"))
+		line := buf.String()
+		assert.True(t, strings.HasPrefix(line, "time="))
+		assert.True(t, strings.HasSuffix(line, "\n"))
+		assert.Contains(t, line, ` level=info msg="node started" node_id=1 peer=127.0.0.1:8080 error="lost master"`)
+	})
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		l := New(&buf, FormatJSON, LevelInfo)
+		l.Warn("slave inactive", "peer_id", uint64(2))
+		var record map[string]any
+		assert.Nil(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Equal(t, "warn", record["level"])
+		assert.Equal(t, "slave inactive", record["msg"])
+		assert.Equal(t, float64(2), record["peer_id"])
+		assert.NotEmpty(t, record["time"])
+	})
+	t.Run("level", func(t *testing.T) {
+		var buf bytes.Buffer
+		l := New(&buf, FormatText, LevelWarn)
+		l.Info("dropped")
+		l.Debug("dropped")
+		assert.Empty(t, buf.String())
+		l.Error("kept")
+		assert.Contains(t, buf.String(), "level=error")
+		buf.Reset()
+		l.SetLevel(LevelDebug)
+		l.Debug("kept")
+		assert.Contains(t, buf.String(), "level=debug")
+		buf.Reset()
+		l.SetLevel(0)
+		l.Error("dropped")
+		assert.Empty(t, buf.String())
+	})
+	t.Run("with", func(t *testing.T) {
+		var buf bytes.Buffer
+		l := New(&buf, FormatText, LevelInfo)
+		derived := l.With("node_id", 3, "identity", "master")
+		derived.Info("hello", "turn", 1)
+		assert.Contains(t, buf.String(), "msg=hello node_id=3 identity=master turn=1")
+		buf.Reset()
+		l.SetFormat(FormatJSON)
+		derived.Info("hello")
+		assert.True(t, strings.HasPrefix(buf.String(), "{"))
+		buf.Reset()
+		l.Info("plain")
+		assert.NotContains(t, buf.String(), "node_id")
+	})
+	t.Run("odd fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		New(&buf, FormatText, LevelInfo).Info("odd", "dangling")
+		assert.Contains(t, buf.String(), "!BADKEY=dangling")
+	})
+}
+
+func TestValidateFormat(t *testing.T) {
+	assert.Nil(t, ValidateFormat(FormatText))
+	assert.Nil(t, ValidateFormat(FormatJSON))
+	assert.ErrorIs(t, ValidateFormat("xml"), ErrFormatInvalid)
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const gormStartedAtKey = "metrics:started_at"
+
+// GormPlugin 记录数据库操作的耗时，参见 RegistryQueryDuration。用法：db.Use(&metrics.GormPlugin{})。
+type GormPlugin struct{}
+
+// Name 实现 gorm.Plugin。
+func (p *GormPlugin) Name() string {
+	return "metrics"
+}
+
+// Initialize 实现 gorm.Plugin。为增、删、改、查和原生语句注册前后回调。
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("metrics:before_create", gormBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("metrics:after_create", gormAfter("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("metrics:before_query", gormBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("metrics:after_query", gormAfter("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("metrics:before_update", gormBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("metrics:after_update", gormAfter("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", gormBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", gormAfter("delete")); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("metrics:before_row", gormBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("metrics:after_row", gormAfter("row")); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", gormBefore); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", gormAfter("raw"))
+}
+
+func gormBefore(db *gorm.DB) {
+	db.InstanceSet(gormStartedAtKey, time.Now())
+}
+
+func gormAfter(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(gormStartedAtKey)
+		if !ok {
+			return
+		}
+		startedAt, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+		RegistryQueryDuration.WithLabelValues(operation, db.Statement.Table).Observe(time.Since(startedAt).Seconds())
+	}
+}
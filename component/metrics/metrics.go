@@ -0,0 +1,155 @@
+// Package metrics 运行指标。以 Prometheus 格式输出，参见 Handler。
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace 指标名前缀。
+const Namespace = "rush_producer"
+
+// Registry 本服务的指标注册表。除下列指标外，还包括 Go 运行时和进程指标。
+var Registry = prometheus.NewRegistry()
+
+var (
+	SlaveJoins = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "slave_joins_total",
+		Help:      "Number of slaves joined this master.",
+	})
+	SlaveWithdrawals = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "slave_withdrawals_total",
+		Help:      "Number of slaves withdrawn from this master on their own.",
+	})
+	SlaveRemovals = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "slave_removals_total",
+		Help:      "Number of slaves removed by this master after retrying out.",
+	})
+	SlaveInactiveDetections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "slave_inactive_detections_total",
+		Help:      "Number of times this master detected an inactive slave.",
+	})
+	Handovers = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "handovers_total",
+		Help:      "Number of handovers started by this node as master.",
+	})
+	Supersedes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "supersedes_total",
+		Help:      "Number of times this node superseded the master.",
+	})
+	EventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_dropped_total",
+		Help:      "Number of pool events dropped because a subscriber's buffer was full.",
+	}, []string{"type"})
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of webhook delivery attempts by target and result (success or failure).",
+	}, []string{"target", "result"})
+	HookRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "hook_runs_total",
+		Help:      "Number of lifecycle hook runs by hook (state) and result (success or failure).",
+	}, []string{"hook", "result"})
+	TasksAssigned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "tasks_assigned_total",
+		Help:      "Number of tasks assigned to slaves and acknowledged by them.",
+	})
+	TasksFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "tasks_finished_total",
+		Help:      "Number of tasks finished by result (success or failure).",
+	}, []string{"result"})
+	TasksReleased = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "tasks_released_total",
+		Help:      "Number of unfinished tasks taken back from departed nodes for reassignment.",
+	})
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "job_runs_total",
+		Help:      "Number of scheduled job runs by job and result (success or failure).",
+	}, []string{"job", "result"})
+	PeerRequestFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "peer_request_failures_total",
+		Help:      "Number of requests to other nodes failed with a transport error or a 5xx status.",
+	}, []string{"method", "path"})
+	PeerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "peer_request_duration_seconds",
+		Help:      "Latency of requests to other nodes.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "path", "code"})
+	RegistryQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "registry_query_duration_seconds",
+		Help:      "Latency of queries to the node registry database.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		SlaveJoins,
+		SlaveWithdrawals,
+		SlaveRemovals,
+		SlaveInactiveDetections,
+		Handovers,
+		Supersedes,
+		EventsDropped,
+		WebhookDeliveries,
+		HookRuns,
+		TasksAssigned,
+		TasksFinished,
+		TasksReleased,
+		JobRuns,
+		PeerRequestFailures,
+		PeerRequestDuration,
+		RegistryQueryDuration,
+	)
+}
+
+// Handler 输出 Registry 中所有指标。
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RoundTripper 记录节点间请求的耗时和失败次数，参见 PeerRequestDuration 和 PeerRequestFailures。
+type RoundTripper struct {
+	Next http.RoundTripper // 实际发送请求的 RoundTripper。为空时使用 http.DefaultTransport。
+}
+
+// RoundTrip 实现 http.RoundTripper。
+func (t *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	PeerRequestDuration.WithLabelValues(req.Method, req.URL.Path, code).Observe(time.Since(start).Seconds())
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		PeerRequestFailures.WithLabelValues(req.Method, req.URL.Path).Inc()
+	}
+	return resp, err
+}
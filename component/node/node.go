@@ -4,30 +4,214 @@ import (
 	"context"
 	"errors"
 	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/logging"
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+	"github.com/rhosocial/go-rush-producer/component/tracing"
 	"github.com/rhosocial/go-rush-producer/models"
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
 	"gorm.io/gorm"
 )
 
 type Pool struct {
-	Self    PoolSelf
-	Master  PoolMaster
-	Slaves  PoolSlaves
-	Context context.Context
+	Self       PoolSelf
+	Master     PoolMaster
+	Slaves     PoolSlaves
+	Topology   *TopologyJournal
+	Events     *EventBus        // 事件总线。订阅身份变化、从节点加入等事件，参见 Event。
+	ZoneLosses *ZoneLossTracker // 各可用区失效节点统计，供接替策略参考。
+	Logger     *logging.Logger  // 日志。为空时使用 logging.Default。
+	Context    context.Context
+
+	env       *component.Env
+	timing    *component.EnvTiming
+	registry  *gorm.DB
+	transport http.RoundTripper
+	name      string
+	version   string
+
+	checkSelfCounter int
+	checkSelfLock    sync.Mutex
+
+	taskHandler   TaskHandler
+	tasks         map[uint64]bool // 当前节点（从节点）正在执行的任务。
+	tasksLock     sync.Mutex
+	taskAssigning sync.Mutex
+
+	shards        map[uint32]time.Time // 当前节点所有的分片及其租约到期时间。
+	shardsLock    sync.RWMutex
+	shardsWorking sync.Mutex
+
+	jobs        map[string]*scheduledJob // 已注册的定时任务。
+	jobsLock    sync.Mutex
+	jobsWorking sync.Mutex
+}
+
+// NodeName 默认节点名称。
+const NodeName = "GO-RUSH-PRODUCER"
+
+// NodeVersion 当前节点版本。
+const NodeVersion = "0.0.1"
+
+// Options 创建节点池的选项，参见 NewPool。
+type Options struct {
+	Env       *component.Env       // 配置。必填。由 Pool.Reload 重新加载，Timing、Failover、Tasks 和 Node.Labels 重新加载后，节点池在下一轮读取新值。
+	Registry  *gorm.DB             // 节点登记数据库。必填。
+	Transport http.RoundTripper    // 节点间请求使用的传输层。为空时使用带追踪和指标的默认传输层。
+	Logger    *logging.Logger      // 日志。为空时使用 logging.Default。
+	Timing    *component.EnvTiming // 时间间隔与重试阈值。为空时使用 Env.Timing。
+	Name      string               // 节点名称。为空时使用 NodeName。
+	Version   string               // 节点版本。为空时使用 NodeVersion。
+
+	// TaskHandler 作为从节点时执行主节点分配的任务。为空时不接受任务，主节点也不会向本节点分配任务。
+	TaskHandler TaskHandler
+}
+
+var ErrPoolOptionsInvalid = errors.New("invalid pool options")
+
+// NewPool 根据选项创建节点池。节点池身份未定，须调用 Start 启动。
+//
+// 若缺少配置或登记数据库，则报 ErrPoolOptionsInvalid；若无法确定本节点对外地址，则据实报错，参见 RefreshSelfSocket。
+func NewPool(options Options) (*Pool, error) {
+	if options.Env == nil || options.Registry == nil {
+		return nil, ErrPoolOptionsInvalid
+	}
+	nodes := Pool{
+		Topology:  NewTopologyJournal(),
+		Events:    NewEventBus(),
+		Logger:    options.Logger,
+		Context:   context.Background(),
+		env:       options.Env,
+		timing:    options.Timing,
+		registry:  options.Registry,
+		transport: options.Transport,
+		name:      options.Name,
+		version:   options.Version,
+
+		taskHandler: options.TaskHandler,
+	}
+	if nodes.Logger == nil {
+		nodes.Logger = logging.Default
+	}
+	if nodes.transport == nil {
+		nodes.transport = &tracing.RoundTripper{Next: &metrics.RoundTripper{}}
+	}
+	if len(nodes.name) == 0 {
+		nodes.name = NodeName
+	}
+	if len(nodes.version) == 0 {
+		nodes.version = NodeVersion
+	}
+	nodes.ZoneLosses = NewZoneLossTracker(time.Duration(*nodes.env.GetFailover().LossWindow) * time.Second)
+	nodes.Slaves.DetectInactiveCallback = nodes.DetectSlaveNodeInactiveCallback
+	nodes.Slaves.RemoveRetriedOutCallback = nodes.RemoveRetriedOutSlaveNodeCallback
+	if err := nodes.reset(); err != nil {
+		return nil, err
+	}
+	return &nodes, nil
+}
+
+// Env 节点池使用的配置。
+func (n *Pool) Env() *component.Env {
+	return n.env
+}
+
+// Registry 节点登记数据库。
+func (n *Pool) Registry() *gorm.DB {
+	return n.registry
 }
 
-var Nodes *Pool
+// Timing 当前的时间间隔与重试阈值。未单独指定时取自配置，重新加载后即时生效。
+func (n *Pool) Timing() *component.EnvTiming {
+	if n.timing != nil {
+		return n.timing
+	}
+	return n.env.GetTiming()
+}
+
+// reset 重置为身份未定的初始状态：重新生成本节点信息，清空主、从节点。保留事件总线、拓扑日志和可用区失效统计。
+//
+// 其它协程（例如请求处理和工作协程）可能同时访问主、从节点，因此持有各自的锁原地清空，而不替换锁本身。
+// 若无法确定本节点对外地址，则据实报错，且不做任何修改。
+func (n *Pool) reset() error {
+	self := n.newSelf()
+	if err := n.refreshSocket(self); err != nil {
+		return err
+	}
+	n.Self.Reset(self)
+	n.Master.Reset()
+	n.Slaves.Reset()
+	return nil
+}
+
+// Restart 重置节点池后以指定身份重新启动，参见 Start。调用前应先停止，参见 Stop。
+// 可以在工作协程中调用，调用后该工作协程应尽快退出。
+func (n *Pool) Restart(ctx context.Context, identity int) error {
+	if err := n.reset(); err != nil {
+		return err
+	}
+	return n.Start(ctx, identity)
+}
 
 var ErrNetworkUnavailable = errors.New("cannot find available network interface(s)")
 
-func ExternalIP() (net.IP, error) {
+// AddressSelector 本节点对外地址的选择条件。
+type AddressSelector struct {
+	Interface    string     // 网卡名称。为空时考虑所有已启用的非回环网卡。
+	CIDR         *net.IPNet // 地址须匹配的网段。为空时不限制。
+	IPPreference string     // 地址族偏好，参见 component.IPPreferenceIPv4 和 component.IPPreferenceIPv6。
+}
+
+// NewAddressSelector 根据网络配置生成地址选择条件。
+func NewAddressSelector(env *component.EnvNet) (*AddressSelector, error) {
+	selector := AddressSelector{
+		Interface:    env.Interface,
+		IPPreference: env.IPPreference,
+	}
+	if len(env.CIDR) > 0 {
+		_, cidr, err := net.ParseCIDR(env.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		selector.CIDR = cidr
+	}
+	return &selector, nil
+}
+
+// Select 从候选地址中选择一个。先按网段过滤，再按地址族偏好选择；偏好的地址族没有可用地址时，选择另一地址族的首个地址。
+func (s *AddressSelector) Select(candidates []net.IP) net.IP {
+	var fallback net.IP
+	for _, ip := range candidates {
+		if s.CIDR != nil && !s.CIDR.Contains(ip) {
+			continue
+		}
+		isIPv4 := ip.To4() != nil
+		if isIPv4 == (s.IPPreference != component.IPPreferenceIPv6) {
+			return ip
+		}
+		if fallback == nil {
+			fallback = ip
+		}
+	}
+	return fallback
+}
+
+// ExternalIP 按选择条件获取本节点对外的地址。找不到满足条件的地址时报 ErrNetworkUnavailable。
+func ExternalIP(selector *AddressSelector) (net.IP, error) {
 	interfaces, err := net.Interfaces()
 	if err != nil {
 		return nil, err
 	}
+	candidates := make([]net.IP, 0)
 	for _, infa := range interfaces {
+		if len(selector.Interface) > 0 && infa.Name != selector.Interface {
+			continue // not the specified interface
+		}
 		if infa.Flags&net.FlagUp == 0 {
 			continue // interface down
 		}
@@ -43,13 +227,16 @@ func ExternalIP() (net.IP, error) {
 			if ip == nil {
 				continue
 			}
-			return ip, nil
+			candidates = append(candidates, ip)
 		}
 	}
+	if ip := selector.Select(candidates); ip != nil {
+		return ip, nil
+	}
 	return nil, ErrNetworkUnavailable
 }
 
-// 获取ip
+// 获取ip。回环地址和链路本地地址不可供其它主机访问，将被忽略。
 func getIPFromAddr(addr net.Addr) net.IP {
 	var ip net.IP
 	switch v := addr.(type) {
@@ -61,113 +248,163 @@ func getIPFromAddr(addr net.Addr) net.IP {
 	if ip == nil || ip.IsLoopback() {
 		return nil
 	}
-	if ip.IsLoopback() {
-		logPrintln("loopback address found: ", ip)
+	if ip.IsLinkLocalUnicast() {
 		return nil
 	}
-	ipv4 := ip.To4()
-	//ipv6 := ip.To16()
-	if ipv4 == nil {
-		return nil // not an ipv4 address
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4
+	}
+	return ip.To16()
+}
+
+// AdvertisedHostLookupTimeout 解析对外登记的主机名的超时时长。
+const AdvertisedHostLookupTimeout = time.Second
+
+// IsAdvertisedHostObserved 判断节点对外登记的地址是否与实际观察到的请求来源地址一致。
+// 主机名将被解析，只要任一解析结果与观察到的地址一致即视为一致。
+//
+// 不一致并不一定是错误，例如节点位于 NAT 或负载均衡之后。不一致时输出诊断信息，供排查地址配置。
+func IsAdvertisedHostObserved(advertised string, observed string) bool {
+	if models.IsHostEqual(advertised, observed) {
+		return true
+	}
+	if net.ParseIP(models.NormalizeHost(advertised)) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), AdvertisedHostLookupTimeout)
+		defer cancel()
+		if addrs, err := net.DefaultResolver.LookupHost(ctx, advertised); err == nil {
+			for _, addr := range addrs {
+				if models.IsHostEqual(addr, observed) {
+					return true
+				}
+			}
+		}
 	}
-	return ipv4
+	logging.Default.Warn("advertised host differs from observed address, check Net.AdvertisedHost if peers cannot reach it", "advertised", advertised, "observed", observed)
+	return false
 }
 
+// RefreshSelfSocket 刷新本节点对外登记的地址。若指定了 EnvNet.AdvertisedHost，则直接使用；否则按选择条件自动选择。
 func (n *Pool) RefreshSelfSocket() error {
-	host, err := ExternalIP()
-	if err != nil && (*component.GlobalEnv).Localhost == false {
+	return n.refreshSocket(n.Self.Node)
+}
+
+// refreshSocket 按配置设置 node 对外登记的地址，参见 RefreshSelfSocket。
+func (n *Pool) refreshSocket(node *NodeInfo.NodeInfo) error {
+	if advertised := n.env.Net.AdvertisedHost; len(advertised) > 0 {
+		node.Host = models.NormalizeHost(advertised)
+		return nil
+	}
+	selector, err := NewAddressSelector(n.env.Net)
+	if err != nil {
+		return err
+	}
+	host, err := ExternalIP(selector)
+	if err != nil && n.env.Localhost == false {
 		return err
 	}
 	if host != nil {
-		n.Self.Node.Host = host.String()
+		node.Host = host.String()
+	} else if selector.IPPreference == component.IPPreferenceIPv6 {
+		node.Host = "::1"
 	} else {
-		n.Self.Node.Host = "127.0.0.1"
+		node.Host = "127.0.0.1"
 	}
 	return nil
 }
 
-func NewNodePool(self *NodeInfo.NodeInfo) *Pool {
-	var nodes = Pool{
-		// Identity: IdentityNotDetermined,
-		// Master:   &NodeInfo.NodeInfo{},
-		// Self: self,
-		// Slaves:   make(map[uint64]NodeInfo.NodeInfo),
-		Self: PoolSelf{
-			Identity: IdentityNotDetermined,
-			Node:     self,
-		},
-		Master:  PoolMaster{},
-		Slaves:  PoolSlaves{NodesRetry: make(map[uint64]uint8)},
-		Context: context.Background(),
-	}
-	nodes.Slaves.DetectInactiveCallback = nodes.DetectSlaveNodeInactiveCallback
-	err := nodes.RefreshSelfSocket()
-	if err != nil {
-		logFatalln(err)
-		return nil
+// newSelf 根据配置生成当前节点信息，包括对外登记的端口和节点元数据。
+func (n *Pool) newSelf() *NodeInfo.NodeInfo {
+	self := NodeInfo.NewNodeInfo(n.name, n.version, n.env.Net.GetAdvertisedPort(), 1)
+	if meta := n.env.Node; meta != nil {
+		self.Zone = meta.Zone
+		self.Rack = meta.Rack
+		if meta.Weight != nil {
+			self.Weight = *meta.Weight
+		}
+		self.Labels = n.env.GetNodeLabels()
 	}
-	return &nodes
+	return self
 }
 
 var ErrNodeSlaveFreshNodeInfoInvalid = errors.New("invalid slave fresh node info")
 
 func (n *Pool) CommitSelfAsMasterNode() bool {
 	n.Self.Upgrade()
-	_, err := n.Self.Node.CommitSelfAsMasterNode()
+	_, err := n.Self.Node.CommitSelfAsMasterNode(n.registry)
 	if err == nil {
 		return true
 	}
-	logPrintln(err)
+	n.logger().Error("failed to commit self as master", "error", err)
 	return false
 }
 
-// AcceptSlave 接受从节点。
-func (n *Pool) AcceptSlave(node *models.FreshNodeInfo) (*NodeInfo.NodeInfo, error) {
-	logPrintln(node.Log())
+// AcceptSlave 接受从节点。protocol 为从节点报告的协议版本和能力集。
+//
+// 若从节点协议版本低于 ProtocolVersionMinimum，则拒绝接入，报 ErrNodeProtocolIncompatible。
+func (n *Pool) AcceptSlave(ctx context.Context, node *models.FreshNodeInfo, protocol *Protocol) (_ *NodeInfo.NodeInfo, err error) {
+	ctx, span := n.startSpan(ctx, "AcceptSlave")
+	defer func() { tracing.End(span, err) }()
+	fields := []any{"peer", net.JoinHostPort(node.Host, strconv.Itoa(int(node.Port))), "name", node.Name, "node_version", node.NodeVersion, "zone", node.Zone, "rack", node.Rack}
+	n.logger().Info("slave joining", fields...)
+	if err := protocol.IsCompatible(); err != nil {
+		n.logger().Warn("slave refused", append(fields, "error", err)...)
+		return nil, err
+	}
 	n.Slaves.NodesRWLock.Lock()
 	defer n.Slaves.NodesRWLock.Unlock()
 	// 检查 n.Slaves 是否存在该节点。
 	// 如果存在，则直接返回。
-	n.RefreshSlavesNodeInfo()
-	if slave := n.Slaves.CheckIfExists(node); slave != nil {
-		logPrintln("The specified slave node record already exists.")
+	n.refreshSlavesNodeInfo()
+	if slave := n.Slaves.checkIfExists(node); slave != nil {
+		n.logger().Info("slave already joined", peer(slave)...)
+		n.Slaves.SetProtocol(slave.ID, protocol)
 		return slave, nil
 	}
 	// 如果不存在，则加入该节点为从节点。
 	slave := NodeInfo.NodeInfo{
 		Name:        node.Name,
 		NodeVersion: node.NodeVersion,
-		Host:        node.Host,
+		Host:        models.NormalizeHost(node.Host),
 		Port:        node.Port,
 		Turn:        n.Slaves.GetTurn(),
+		Zone:        node.Zone,
+		Rack:        node.Rack,
+		Weight:      node.Weight,
+		Labels:      node.Labels,
 	}
 	// 需要判断数据库中是否存在相同套接字的条目。
-	existed, err := slave.GetNodeBySocket()
+	existed, err := slave.GetNodeBySocket(n.registry)
 	if !errors.Is(err, gorm.ErrRecordNotFound) {
 		// 如有，则要尝试与其通信。若通信成功，则拒绝接入。
-		err = n.CheckNodeStatus(existed)
+		err = n.CheckNodeStatus(ctx, existed)
 		if errors.Is(err, ErrNodeExisted) {
 			return nil, err
 		}
 	}
 
 	// 需要判断数据库中是否存在该条目。
-	_, err = n.Self.Node.AddSlaveNode(&slave)
+	_, err = n.Self.Node.AddSlaveNode(n.registry, &slave)
 	if err != nil {
 		return nil, err
 	}
 	n.Slaves.Nodes[slave.ID] = slave
-	if _, err := n.Self.Node.LogReportFreshSlaveJoined(&slave); err != nil {
-		logPrintln(err)
+	n.Slaves.RevisionUp()
+	n.Slaves.SetProtocol(slave.ID, protocol)
+	n.Topology.Append(TopologyEventJoined, &slave)
+	n.Events.Publish(&SlaveJoinedEvent{Slave: slave})
+	if _, err := n.Self.Node.LogReportFreshSlaveJoined(n.registry, &slave); err != nil {
+		n.logger().Error("failed to log slave joined", append(peer(&slave), "error", err)...)
 	}
 	return &slave, nil
 }
 
 // AcceptMaster 接受主节点。
 func (n *Pool) AcceptMaster(master *NodeInfo.NodeInfo) {
+	previous := copyNodeInfo(n.Master.Node)
 	n.Master.Accept(master)
-	if err := n.Self.Node.Refresh(); err != nil {
-		logPrintln(err)
+	n.Events.Publish(&MasterChangedEvent{Previous: previous, Current: copyNodeInfo(master)})
+	if err := n.Self.Node.Refresh(n.registry); err != nil {
+		n.logger().Error("failed to refresh self", "error", err)
 	}
 	n.RefreshSlavesNodeInfo()
 }
@@ -178,35 +415,92 @@ func (n *Pool) AcceptMaster(master *NodeInfo.NodeInfo) {
 //
 // 2. 调用 Self 模型的删除从节点信息。删除成功后，将其从 Slaves 删除。
 func (n *Pool) RemoveSlave(id uint64, fresh *models.FreshNodeInfo) (bool, error) {
-	logPrintf("Remove Slave: %d\n", id)
+	n.logger().Info("removing slave", "peer_id", id)
 	n.Slaves.NodesRWLock.Lock()
 	defer n.Slaves.NodesRWLock.Unlock()
-	slave, err := n.Slaves.Check(id, fresh)
+	slave, err := n.Slaves.check(id, fresh)
 	if err != nil {
 		return false, err
 	}
-	if _, err := n.Self.Node.RemoveSlaveNode(slave); err != nil {
+	if _, err := n.Self.Node.RemoveSlaveNode(n.registry, slave); err != nil {
 		return false, err
 	}
-	delete(n.Slaves.Nodes, id)
-	if _, err := n.Self.Node.LogReportExistedSlaveWithdrawn(slave); err != nil {
-		logPrintln(err)
+	n.Slaves.remove(id)
+	n.Topology.Append(TopologyEventWithdrawn, slave)
+	n.Events.Publish(&SlaveRemovedEvent{Slave: *slave, Cause: ErrNodeSlaveWithdrawn})
+	n.releaseTasks(context.Background(), id)
+	if _, err := n.Self.Node.LogReportExistedSlaveWithdrawn(n.registry, slave); err != nil {
+		n.logger().Error("failed to log slave withdrawn", append(peer(slave), "error", err)...)
 	}
 	return true, nil
 }
 
-// RefreshSlavesStatus 刷新从节点状态。
-func (n *Pool) RefreshSlavesStatus() ([]uint64, []uint64) {
-	remaining := make([]uint64, 0)
-	removed := make([]uint64, 0)
+var ErrNodeSlaveModificationEmpty = errors.New("nothing to modify")
+
+// ModifySlave 修改指定从节点信息。修改前要校验客户端提供的信息，参见 Slaves.Check。接替顺序保持不变。
+//
+// 1. 若没有任何修改项，则报 ErrNodeSlaveModificationEmpty。
+//
+// 2. 若修改了套接字，且数据库中存在其它相同套接字的节点，则报 ErrNodeExisted。
+//
+// 3. 调用 Self 模型的修改从节点信息。修改成功后，更新 Slaves 中的节点信息，并记录日志。
+func (n *Pool) ModifySlave(id uint64, fresh *models.FreshNodeInfo, modified *models.ModifiableNodeInfo) (*NodeInfo.NodeInfo, error) {
+	n.logger().Info("modifying slave", "peer_id", id)
+	if modified.IsEmpty() {
+		return nil, ErrNodeSlaveModificationEmpty
+	}
 	n.Slaves.NodesRWLock.Lock()
 	defer n.Slaves.NodesRWLock.Unlock()
+	slave, err := n.Slaves.check(id, fresh)
+	if err != nil {
+		return nil, err
+	}
+	target := modified.Apply(fresh)
+	if target.Host != fresh.Host || target.Port != fresh.Port {
+		probe := NodeInfo.NodeInfo{Host: target.Host, Port: target.Port}
+		if existed, err := probe.GetNodeBySocket(n.registry); err == nil && existed.ID != id {
+			return nil, ErrNodeExisted
+		}
+	}
+	if _, err := n.Self.Node.ModifySlaveNode(n.registry, slave, modified); err != nil {
+		return nil, err
+	}
+	n.Slaves.Nodes[id] = *slave
+	n.Slaves.RevisionUp()
+	n.Topology.Append(TopologyEventModified, slave)
+	if _, err := n.Self.Node.LogReportExistedSlaveModified(n.registry, slave); err != nil {
+		n.logger().Error("failed to log slave modified", append(peer(slave), "error", err)...)
+	}
+	return slave, nil
+}
+
+// RefreshSlavesStatus 刷新从节点状态。请求各从节点状态期间不持有 NodesRWLock。
+func (n *Pool) RefreshSlavesStatus(ctx context.Context) ([]uint64, []uint64) {
+	remaining := make([]uint64, 0)
+	removed := make([]uint64, 0)
+	n.Slaves.NodesRWLock.RLock()
+	slaves := make(map[uint64]NodeInfo.NodeInfo, len(n.Slaves.Nodes))
 	for i, slave := range n.Slaves.Nodes {
-		if _, err := n.GetSlaveStatus(i); err != nil {
-			if _, err := n.Self.Node.RemoveSlaveNode(&slave); err != nil {
-				logPrintln(err)
+		slaves[i] = slave
+	}
+	n.Slaves.NodesRWLock.RUnlock()
+	for i, slave := range slaves {
+		if _, err := n.GetSlaveStatus(ctx, i); err != nil {
+			n.Slaves.NodesRWLock.Lock()
+			_, exist := n.Slaves.Nodes[i]
+			if exist {
+				n.Slaves.remove(i)
+			}
+			n.Slaves.NodesRWLock.Unlock()
+			if !exist { // 期间已被移除。
+				continue
 			}
-			delete(n.Slaves.Nodes, i)
+			if _, err := n.Self.Node.RemoveSlaveNode(n.registry, &slave); err != nil {
+				n.logger().Error("failed to remove unreachable slave", append(peer(&slave), "error", err)...)
+			}
+			n.Topology.Append(TopologyEventRemoved, &slave)
+			n.Events.Publish(&SlaveRemovedEvent{Slave: slave, Cause: ErrNodeSlaveUnreachable})
+			n.releaseTasks(ctx, i)
 			removed = append(removed, i)
 		} else {
 			remaining = append(remaining, i)
@@ -217,11 +511,18 @@ func (n *Pool) RefreshSlavesStatus() ([]uint64, []uint64) {
 
 // RefreshSlavesNodeInfo 刷新从节点信息。
 func (n *Pool) RefreshSlavesNodeInfo() {
-	nodes, err := n.Self.Node.GetAllSlaveNodes()
+	n.Slaves.NodesRWLock.Lock()
+	defer n.Slaves.NodesRWLock.Unlock()
+	n.refreshSlavesNodeInfo()
+}
+
+// refreshSlavesNodeInfo 同 RefreshSlavesNodeInfo。调用前须持有 Slaves.NodesRWLock。
+func (n *Pool) refreshSlavesNodeInfo() {
+	nodes, err := n.Self.Node.GetAllSlaveNodes(n.registry)
 	if err != nil {
 		return
 	}
-	n.Slaves.Refresh(nodes)
+	n.Slaves.refresh(nodes)
 }
 
 // ---- Worker ---- //
@@ -235,9 +536,8 @@ func (n *Pool) StartMasterWorker(ctx context.Context) {
 	}
 	ctxChild, cancel := context.WithCancelCause(ctx)
 	n.Master.WorkerCancelFunc = cancel
-	go n.Master.worker(ctxChild, WorkerMasterIntervals{
-		Base: 1200,
-	}, n)
+	n.Master.Tick(time.Now())
+	go n.Master.worker(ctxChild, n)
 }
 
 var ErrNodeSystemSignalStopped = errors.New("received a system signal to stop")
@@ -261,14 +561,13 @@ func (n *Pool) StartSlaveWorker(ctx context.Context) {
 	}
 	ctxChild, cancel := context.WithCancelCause(ctx)
 	n.Slaves.WorkerCancelFunc = cancel
+	n.Slaves.Tick(time.Now())
 	//offset := math.Pow(2.0, float64(n.Self.Node.Turn)) * 100
 	//if offset > 60000 {
 	//	offset = 60000
 	//}
 	//log.Printf("worker interval:%f\n", offset)
-	go n.Slaves.worker(ctxChild, WorkerSlaveIntervals{
-		Base: 1000,
-	}, n)
+	go n.Slaves.worker(ctxChild, n)
 }
 
 // StopSlaveWorker 停止从节点身份工作协程。
@@ -283,10 +582,21 @@ func (n *Pool) StopSlaveWorker(cause error) {
 
 // ---- Callback ---- //
 
-func (n *Pool) DetectSlaveNodeInactiveCallback(id uint64, retry uint8) {
-	if _, err := n.Self.Node.LogReportExistedNodeMasterDetectedSlaveInactive(id, retry); err != nil {
-		logPrintln(err)
+func (n *Pool) DetectSlaveNodeInactiveCallback(slave NodeInfo.NodeInfo, retry uint8) {
+	n.Topology.Append(TopologyEventInactive, &slave)
+	n.Events.Publish(&SlaveInactiveEvent{Slave: slave, Retry: retry})
+	n.logger().Warn("slave inactive", append(peer(&slave), "retry", retry)...)
+	if _, err := n.Self.Node.LogReportExistedNodeMasterDetectedSlaveInactive(n.registry, slave.ID, retry); err != nil {
+		n.logger().Error("failed to log slave inactive", append(peer(&slave), "error", err)...)
 	}
 }
 
+func (n *Pool) RemoveRetriedOutSlaveNodeCallback(slave NodeInfo.NodeInfo) {
+	n.logger().Warn("slave removed after retrying out", peer(&slave)...)
+	n.ZoneLosses.Record(slave.Zone, time.Now())
+	n.Topology.Append(TopologyEventRemoved, &slave)
+	n.Events.Publish(&SlaveRemovedEvent{Slave: slave, Cause: ErrNodeSlaveRetriedOut})
+	n.releaseTasks(context.Background(), slave.ID)
+}
+
 // ---- Callback ---- //
@@ -1,6 +1,8 @@
 package node
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,44 +10,55 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/rhosocial/go-rush-common/component/response"
-	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+	"github.com/rhosocial/go-rush-producer/component/tracing"
 	"github.com/rhosocial/go-rush-producer/models"
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
 )
 
 const (
 	RequestStatus             = 0x00000001
+	RequestWatch              = 0x00000002
 	RequestMasterStatus       = 0x00010001
+	RequestMasterHeartbeat    = 0x00010002
 	RequestMasterNotifyAdd    = 0x00010011
 	RequestMasterNotifyModify = 0x00010012
 	RequestMasterNotifyDelete = 0x00010013
+	RequestMasterTaskReport   = 0x00010021
 	RequestSlaveStatus        = 0x00020001
 	RequestSlaveNotify        = 0x00020011
+	RequestSlaveTask          = 0x00020021
 
 	RequestMethodStatus                    = http.MethodGet
+	RequestMethodWatch                     = http.MethodGet
 	RequestMethodMasterStatus              = http.MethodGet
+	RequestMethodMasterHeartbeat           = http.MethodPost
 	RequestMethodMasterNotifyAdd           = http.MethodPut
+	RequestMethodMasterNotifyModify        = http.MethodPatch
 	RequestMethodMasterNotifyDelete        = http.MethodDelete
+	RequestMethodMasterTaskReport          = http.MethodPost
 	RequestMethodSlaveStatus               = http.MethodGet
 	RequestMethodSlaveNotifyTakeover       = http.MethodPost
 	RequestMethodSlaveNotifySwitchSuperior = http.MethodPost
+	RequestMethodSlaveTask                 = http.MethodPost
 
 	RequestURLFormatStatus                    = "http://%s/server"
+	RequestURLFormatWatch                     = "http://%s/server/watch"
 	RequestURLFormatMasterStatus              = "http://%s/server/master"
+	RequestURLFormatMasterHeartbeat           = "http://%s/server/master/heartbeat"
 	RequestURLFormatMasterNotifyAdd           = "http://%s/server/master/notify"
 	RequestURLFormatMasterNotifyModify        = "http://%s/server/master/notify"
 	RequestURLFormatMasterNotifyDelete        = "http://%s/server/master/notify"
+	RequestURLFormatMasterTaskReport          = "http://%s/server/master/tasks/report"
 	RequestURLFormatSlaveStatus               = "http://%s/server/slave"
 	RequestURLFormatSlaveNotifyTakeover       = "http://%s/server/slave/notify/takeover"
 	RequestURLFormatSlaveNotifySwitchSuperior = "http://%s/server/slave/notify/switch_superior"
+	RequestURLFormatSlaveTask                 = "http://%s/server/slave/tasks"
 
-	RequestHeaderXAuthorizationTokenKey   = "X-Authorization-Token"
-	RequestHeaderXAuthorizationTokenValue = "$2a$04$jajGD06BJd.KmTM7pgCRzeFSIMWLAUbTCOQPNJRDMnMltPZp3tK1y"
-	RequestHeaderXNodeIDKey               = "X-Node-ID"
-	RequestHeaderXNodePortKey             = "X-Node-Port"
+	RequestHeaderXNodeIDKey   = "X-Node-ID"
+	RequestHeaderXNodePortKey = "X-Node-Port"
 )
 
 // ------ MasterStatus ------ //
@@ -54,34 +67,37 @@ const (
 // 如果已经是最高级，则报 ErrNodeLevelAlreadyHighest。
 // 如果构建请求出错，则据实返回，此时第一个返回值为空。
 // 请求构建成功，则发送请求，超时固定设为 1 秒。并返回响应和对应的错误。
-func (n *Pool) SendRequestMasterStatus(master *NodeInfo.NodeInfo) (*http.Response, error) {
+func (n *Pool) SendRequestMasterStatus(ctx context.Context, master *NodeInfo.NodeInfo) (*http.Response, error) {
 	if master == nil {
 		return nil, ErrNodeLevelAlreadyHighest
 	}
-	req, err := n.PrepareNodeRequest(RequestMethodMasterStatus, RequestURLFormatMasterStatus, master.Socket(), nil, "")
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodMasterStatus, RequestURLFormatMasterStatus, master.Socket(), nil, "")
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to prepare request", "error", err)
 		return nil, ErrNodeRequestInvalid
 	}
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := n.httpClient()
 	resp, err := client.Do(req)
 	return resp, err
 }
 
 // RequestMasterStatusResponseData 从节点请求主节点状态响应体的数据部分。
 type RequestMasterStatusResponseData struct {
-	Host            string `json:"host,omitempty"`        // 主节点自己的套接字。
-	ClientIP        string `json:"client_ip,omitempty"`   // 请求从节点的客户端IP地址。
-	RemoteAddr      string `json:"remote_addr,omitempty"` // 请求从节点的远程地址（套接字）。
-	Attended        bool   `json:"attended"`              // 请求从节点是否已加入。
-	IsMasterWorking bool   `json:"is_master_working"`     // 当前节点主节点身份是否正在工作
-	IsSlaveWorking  bool   `json:"is_slave_working"`      // 当前节点从节点身份是否正在工作
+	Host            string    `json:"host,omitempty"`        // 主节点自己的套接字。
+	ClientIP        string    `json:"client_ip,omitempty"`   // 请求从节点的客户端IP地址。
+	RemoteAddr      string    `json:"remote_addr,omitempty"` // 请求从节点的远程地址（套接字）。
+	Attended        bool      `json:"attended"`              // 请求从节点是否已加入。
+	IsMasterWorking bool      `json:"is_master_working"`     // 当前节点主节点身份是否正在工作
+	IsSlaveWorking  bool      `json:"is_slave_working"`      // 当前节点从节点身份是否正在工作
+	Protocol        *Protocol `json:"protocol,omitempty"`    // 主节点的协议版本和能力集。
+	Revision        uint64    `json:"revision"`              // 主节点的从节点集合版本。
 }
 
 // RequestMasterStatusResponseExtension 从节点请求主节点状态响应体的扩展部分。
 type RequestMasterStatusResponseExtension struct {
-	Master *models.RegisteredNodeInfo             `json:"master,omitempty"` // 已登记主节点信息。
-	Slaves *map[uint64]*models.RegisteredNodeInfo `json:"slaves,omitempty"` // 已登记从节点信息。
+	Master     *models.RegisteredNodeInfo             `json:"master,omitempty"`     // 已登记主节点信息。
+	Slaves     *map[uint64]*models.RegisteredNodeInfo `json:"slaves,omitempty"`     // 已登记从节点信息。
+	Succession []uint64                               `json:"succession,omitempty"` // 按接替策略排列的接替次序，参见 Pool.Succession。
 }
 
 // RequestMasterStatusResponse 从节点请求主节点状态响应体。
@@ -92,23 +108,18 @@ type RequestMasterStatusResponse = response.Generic[RequestMasterStatusResponseD
 // ------ MasterNotifyAdd ------ //
 
 // SendRequestMasterToAddSelfAsSlave 发送请求通知主节点添加自己为从节点。
-func (n *Pool) SendRequestMasterToAddSelfAsSlave() (*http.Response, error) {
+func (n *Pool) SendRequestMasterToAddSelfAsSlave(ctx context.Context) (*http.Response, error) {
 	if n.Master.Node == nil {
 		return nil, ErrNodeLevelAlreadyHighest
 	}
-	self := models.FreshNodeInfo{
-		Host:        n.Self.Node.Host,
-		Port:        n.Self.Node.Port,
-		Name:        n.Self.Node.Name,
-		NodeVersion: n.Self.Node.NodeVersion,
-	}
+	self := n.Self.Node.ToFreshNodeInfo()
 	var body = strings.NewReader(self.Encode())
-	req, err := n.PrepareNodeRequest(RequestMethodMasterNotifyAdd, RequestURLFormatMasterNotifyAdd, n.Master.Node.Socket(), body, "application/x-www-form-urlencoded")
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodMasterNotifyAdd, RequestURLFormatMasterNotifyAdd, n.Master.Node.Socket(), body, "application/x-www-form-urlencoded")
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to prepare request", "error", err)
 		return nil, ErrNodeRequestInvalid
 	}
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := n.httpClient()
 	resp, err := client.Do(req)
 	return resp, err
 }
@@ -119,9 +130,35 @@ func (n *Pool) CheckResponseMasterNotifyAdd(response *http.Response, err error)
 
 // ------ MasterNotifyAdd ------ //
 
+// ------ MasterNotifyModify ------ //
+
+// SendRequestMasterToModifySelf 发送请求通知主节点修改自己的信息。
+func (n *Pool) SendRequestMasterToModifySelf(ctx context.Context, modified *models.ModifiableNodeInfo) (*http.Response, error) {
+	if n.Master.Node == nil {
+		return nil, ErrNodeLevelAlreadyHighest
+	}
+	fresh := models.FreshNodeInfo{
+		Host:        n.Self.Node.Host,
+		Port:        n.Self.Node.Port,
+		Name:        n.Self.Node.Name,
+		NodeVersion: n.Self.Node.NodeVersion,
+	}
+	var body = strings.NewReader(fmt.Sprintf("id=%d&%s&%s", n.Self.Node.ID, fresh.Encode(), modified.Encode()))
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodMasterNotifyModify, RequestURLFormatMasterNotifyModify, n.Master.Node.Socket(), body, "application/x-www-form-urlencoded")
+	if err != nil {
+		n.logger().Error("failed to prepare request", "error", err)
+		return nil, ErrNodeRequestInvalid
+	}
+	client := n.httpClient()
+	resp, err := client.Do(req)
+	return resp, err
+}
+
+// ------ MasterNotifyModify ------ //
+
 // ------ MasterNotifyRemove ------ //
 
-func (n *Pool) SendRequestMasterToRemoveSelf() (*http.Response, error) {
+func (n *Pool) SendRequestMasterToRemoveSelf(ctx context.Context) (*http.Response, error) {
 	if n.Master.Node == nil {
 		return nil, ErrNodeLevelAlreadyHighest
 	}
@@ -132,13 +169,12 @@ func (n *Pool) SendRequestMasterToRemoveSelf() (*http.Response, error) {
 		NodeVersion: n.Self.Node.NodeVersion,
 	}
 	query := fmt.Sprintf("?id=%d&%s", n.Self.Node.ID, fresh.Encode())
-	req, err := n.PrepareNodeRequest(RequestMethodMasterNotifyDelete, RequestURLFormatMasterNotifyDelete+query, n.Master.Node.Socket(), nil, "")
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodMasterNotifyDelete, RequestURLFormatMasterNotifyDelete+query, n.Master.Node.Socket(), nil, "")
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to prepare request", "error", err)
 		return nil, ErrNodeRequestInvalid
 	}
-	req.Header.Add(RequestHeaderXAuthorizationTokenKey, RequestHeaderXAuthorizationTokenValue)
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := n.httpClient()
 	resp, err := client.Do(req)
 	return resp, err
 }
@@ -158,17 +194,17 @@ var ErrNodeTakeoverMaster = errors.New("takeover master")
 // ------ SlaveGetStatus ------ //
 
 // SendRequestSlaveStatus 发送请求：获取指定ID从节点状态。
-func (n *Pool) SendRequestSlaveStatus(id uint64) (*http.Response, error) {
+func (n *Pool) SendRequestSlaveStatus(ctx context.Context, id uint64) (*http.Response, error) {
 	slave := n.Slaves.Get(id)
 	if slave == nil {
 		return nil, ErrNodeMasterDoesNotHaveSpecifiedSlave
 	}
-	req, err := n.PrepareNodeRequest(RequestMethodSlaveStatus, RequestURLFormatSlaveStatus, slave.Socket(), nil, "")
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodSlaveStatus, RequestURLFormatSlaveStatus, slave.Socket(), nil, "")
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to prepare request", "error", err)
 		return nil, ErrNodeRequestInvalid
 	}
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := n.httpClient()
 	resp, err := client.Do(req)
 	return resp, err
 }
@@ -177,27 +213,38 @@ func (n *Pool) SendRequestSlaveStatus(id uint64) (*http.Response, error) {
 
 // ------ GetStatus ------ //
 
-func (n *Pool) CheckNodeStatus(node *NodeInfo.NodeInfo) error {
-	resp, err := n.SendRequestStatus(node)
-	logPrintln(node, err)
+// RequestStatusResponseData 获取节点状态响应体的数据部分。
+type RequestStatusResponseData struct {
+	Protocol               *Protocol `json:"protocol"`                 // 节点的协议版本和能力集。
+	ProtocolVersionMinimum uint32    `json:"protocol_version_minimum"` // 节点可兼容的最低协议版本。
+}
+
+// RequestStatusResponse 获取节点状态响应体。
+type RequestStatusResponse = response.Generic[RequestStatusResponseData, any]
+
+func (n *Pool) CheckNodeStatus(ctx context.Context, node *NodeInfo.NodeInfo) (err error) {
+	ctx, span := n.startSpan(ctx, "CheckNodeStatus")
+	defer func() { tracing.End(span, err) }()
+	resp, err := n.SendRequestStatus(ctx, node)
+	n.logger().Debug("checked node status", append(peer(node), "error", err)...)
 	if resp != nil && resp.StatusCode == http.StatusOK {
 		// 请求正常，应当退出。
 		return ErrNodeExisted
 	}
-	inactive, err := n.Self.Node.LogReportExistedNodeMasterReportSlaveInactive(node)
-	logPrintln(inactive, err)
-	self, err := node.RemoveSelf()
-	logPrintln(self, err)
+	inactive, err := n.Self.Node.LogReportExistedNodeMasterReportSlaveInactive(n.registry, node)
+	n.logger().Debug("reported node inactive", append(peer(node), "affected", inactive, "error", err)...)
+	self, err := node.RemoveSelf(n.registry)
+	n.logger().Debug("removed node record", append(peer(node), "removed", self, "error", err)...)
 	return err
 }
 
-func (n *Pool) SendRequestStatus(node *NodeInfo.NodeInfo) (*http.Response, error) {
-	req, err := n.PrepareNodeRequest(RequestMethodSlaveStatus, RequestURLFormatStatus, node.Socket(), nil, "")
+func (n *Pool) SendRequestStatus(ctx context.Context, node *NodeInfo.NodeInfo) (*http.Response, error) {
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodSlaveStatus, RequestURLFormatStatus, node.Socket(), nil, "")
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to prepare request", "error", err)
 		return nil, ErrNodeRequestInvalid
 	}
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := n.httpClient()
 	resp, err := client.Do(req)
 	return resp, err
 }
@@ -206,21 +253,21 @@ func (n *Pool) SendRequestStatus(node *NodeInfo.NodeInfo) (*http.Response, error
 
 // ------ SlaveNotifyMasterToSwitchSuperior ------ //
 
-func (n *Pool) SendRequestSlaveNotifyMasterToSwitchSuperior(node *NodeInfo.NodeInfo, master *NodeInfo.NodeInfo) (*http.Response, error) {
+func (n *Pool) SendRequestSlaveNotifyMasterToSwitchSuperior(ctx context.Context, node *NodeInfo.NodeInfo, master *NodeInfo.NodeInfo) (*http.Response, error) {
 	if master == nil {
 		return nil, ErrNodeMasterInvalid
 	}
 	var body = strings.NewReader(master.ToRegisteredNodeInfo().Encode())
-	req, err := n.PrepareNodeRequest(
+	req, err := n.PrepareNodeRequest(ctx,
 		RequestMethodSlaveNotifySwitchSuperior,
 		RequestURLFormatSlaveNotifySwitchSuperior,
 		node.Socket(), body, "application/x-www-form-urlencoded",
 	)
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to prepare request", "error", err)
 		return nil, ErrNodeRequestInvalid
 	}
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := n.httpClient()
 	resp, err := client.Do(req)
 	return resp, err
 }
@@ -231,52 +278,82 @@ var ErrNodeSlaveInvalid = errors.New("the specified slave node is invalid")
 
 // ------ SlaveNotifyMasterToTakeover ------ //
 
-func (n *Pool) SendRequestSlaveNotifyMasterToTakeover(node *NodeInfo.NodeInfo) (*http.Response, error) {
+func (n *Pool) SendRequestSlaveNotifyMasterToTakeover(ctx context.Context, node *NodeInfo.NodeInfo) (*http.Response, error) {
 	if node == nil {
 		return nil, ErrNodeSlaveInvalid
 	}
 	var body = strings.NewReader(n.Self.Node.ToRegisteredNodeInfo().Encode())
-	req, err := n.PrepareNodeRequest(
+	req, err := n.PrepareNodeRequest(ctx,
 		RequestMethodSlaveNotifyTakeover,
 		RequestURLFormatSlaveNotifyTakeover,
 		node.Socket(), body, "application/x-www-form-urlencoded",
 	)
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to prepare request", "error", err)
 		return nil, ErrNodeRequestResponseError
 	}
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := n.httpClient()
 	resp, err := client.Do(req)
 	return resp, err
 }
 
 // ------ SlaveNotifyMasterToTakeover ------ //
 
+// httpClient 创建节点间请求使用的客户端。超时参见 component.EnvTiming.RequestTimeout，传输层参见 Options.Transport。
+// 默认传输层将请求耗时和失败次数计入运行指标，参见 metrics.RoundTripper；每个请求创建客户端 span，参见 tracing.RoundTripper。
+func (n *Pool) httpClient() *http.Client {
+	transport := n.transport
+	if transport == nil {
+		transport = &tracing.RoundTripper{Next: &metrics.RoundTripper{}}
+	}
+	return &http.Client{
+		Timeout:   n.Timing().GetRequestTimeout(),
+		Transport: transport,
+	}
+}
+
 // PrepareNodeRequest 准备节点间通信请求。
+// 请求会附加当前节点ID，并使用集群密钥签名，参见 SignNodeRequest。
+// ctx 中的追踪上下文会随请求头传递给对方节点；请求不随 ctx 取消，参见 tracing.Detach。
 // 准备请求过程中产生错误将如实返回。
 // 建议用法：调用该函数获取到错误时，不向上继续反馈，而统一报 ErrNodeRequestInvalid 错误。并出错原因记录到日志。
-func (n *Pool) PrepareNodeRequest(method string, urlFormat string, socket string, body io.Reader, contentType string) (*http.Request, error) {
+func (n *Pool) PrepareNodeRequest(ctx context.Context, method string, urlFormat string, socket string, body io.Reader, contentType string) (*http.Request, error) {
 	URL := fmt.Sprintf(urlFormat, socket)
-	req, err := http.NewRequest(method, URL, body)
-	req.Header.Add(RequestHeaderXAuthorizationTokenKey, RequestHeaderXAuthorizationTokenValue)
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			n.logger().Error("failed to read request body", "method", method, "url", URL, "error", err)
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(tracing.Detach(ctx), method, URL, bytes.NewReader(payload))
+	if err != nil {
+		n.logger().Error("failed to create request", "method", method, "url", URL, "error", err)
+		return nil, err
+	}
+	nodeID := uint64(0)
 	if n != nil && n.Self.Node.ID != 0 {
+		nodeID = n.Self.Node.ID
 		req.Header.Add(RequestHeaderXNodeIDKey, strconv.FormatUint(n.Self.Node.ID, 10))
 		req.Header.Add(RequestHeaderXNodePortKey, strconv.FormatUint(uint64(n.Self.Node.Port), 10))
 	}
 	if len(contentType) > 0 {
 		req.Header.Add("Content-Type", contentType)
 	}
-	if err != nil {
-		logPrintf("[Prepare Request][method:%s][url%s][error:%s]\n", method, URL, err.Error())
+	n.Protocol().Apply(req.Header)
+	if err := SignNodeRequest(req, payload, nodeID, []byte(n.env.Cluster.Secret)); err != nil {
+		n.logger().Error("failed to sign request", "method", method, "url", URL, "error", err)
+		return nil, err
 	}
-	return req, err
+	return req, nil
 }
 
 // ---- TODO 待确认下述代码用途 ---- //
 
 // GetSlaveStatus 当前节点（主节点）获取其从节点状态。
-func (n *Pool) GetSlaveStatus(id uint64) (bool, error) {
-	resp, err := n.SendRequestSlaveStatus(id)
+func (n *Pool) GetSlaveStatus(ctx context.Context, id uint64) (bool, error) {
+	resp, err := n.SendRequestSlaveStatus(ctx, id)
 	if err != nil {
 		return false, err
 	}
@@ -304,38 +381,78 @@ type NotifyMasterToAddSelfAsSlaveResponseData struct {
 type NotifyMasterToAddSelfAsSlaveResponse = response.Generic[NotifyMasterToAddSelfAsSlaveResponseData, any]
 
 // NotifyMasterToAddSelfAsSlave 当前节点（从节点）通知主节点添加自己为其从节点。
-func (n *Pool) NotifyMasterToAddSelfAsSlave() (bool, error) {
-	resp, err := n.SendRequestMasterToAddSelfAsSlave()
+func (n *Pool) NotifyMasterToAddSelfAsSlave(ctx context.Context) (_ bool, err error) {
+	ctx, span := n.startSpan(ctx, "NotifyMasterToAddSelfAsSlave")
+	defer func() { tracing.End(span, err) }()
+	resp, err := n.SendRequestMasterToAddSelfAsSlave(ctx)
 	if err != nil {
-		logPrintln("[Send Request]Notify master to add self as slave:", err)
+		n.logger().Error("failed to notify master to add self as slave", append(peer(n.Master.Node), "error", err)...)
 		return false, err
 	}
 	var body = make([]byte, resp.ContentLength)
 	_, err = resp.Body.Read(body)
 	if err != io.EOF && err != nil {
-		logPrintln("[Send Request]Notify master to add self as slave:", err)
+		n.logger().Error("failed to notify master to add self as slave", append(peer(n.Master.Node), "error", err)...)
 		return false, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		err = errors.New(string(body))
-		logPrintln("[Send Request]Notify master to add self as slave:", err)
+		n.logger().Error("failed to notify master to add self as slave", append(peer(n.Master.Node), "error", err)...)
 		return false, err
 	}
 	respData := NotifyMasterToAddSelfAsSlaveResponse{}
 	err = json.Unmarshal(body, &respData)
 	if err != nil {
-		logPrintln("[Send Request]Notify master to add self as slave:", err)
+		n.logger().Error("failed to notify master to add self as slave", append(peer(n.Master.Node), "error", err)...)
 		return false, err
 	}
 	// 校验成功，将返回的ID作为自己的ID。
-	self, err := NodeInfo.GetNodeInfo(respData.Data.ID)
+	self, err := NodeInfo.GetNodeInfo(n.registry, respData.Data.ID)
 	n.Self.Node = self
 	return true, nil
 }
 
+// NotifyMasterToModifySelfResponse 通知主节点修改自己的信息 HTTP 响应体格式。数据部分为修改后的节点信息。
+type NotifyMasterToModifySelfResponse = response.Generic[NotifyMasterToAddSelfAsSlaveResponseData, any]
+
+// NotifyMasterToModifySelf 当前节点（从节点）通知主节点修改自己的信息。
+//
+// 若已知主节点不支持修改（RequestMasterNotifyModify），则报 ErrNodeProtocolIncompatible。
+// 修改成功后，从数据库刷新自己。
+func (n *Pool) NotifyMasterToModifySelf(ctx context.Context, modified *models.ModifiableNodeInfo) (_ bool, err error) {
+	ctx, span := n.startSpan(ctx, "NotifyMasterToModifySelf")
+	defer func() { tracing.End(span, err) }()
+	if protocol := n.Master.GetProtocol(); protocol != nil && !protocol.Supports(RequestMasterNotifyModify) {
+		return false, ErrNodeProtocolIncompatible
+	}
+	resp, err := n.SendRequestMasterToModifySelf(ctx, modified)
+	if err != nil {
+		n.logger().Error("failed to notify master to modify self", append(peer(n.Master.Node), "error", err)...)
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		n.logger().Error("failed to notify master to modify self", append(peer(n.Master.Node), "error", err)...)
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = errors.New(string(body))
+		n.logger().Error("failed to notify master to modify self", append(peer(n.Master.Node), "error", err)...)
+		return false, err
+	}
+	if err := n.Self.Node.Refresh(n.registry); err != nil {
+		n.logger().Error("failed to notify master to modify self", append(peer(n.Master.Node), "error", err)...)
+		return false, err
+	}
+	return true, nil
+}
+
 // NotifyMasterToRemoveSelf 当前节点（从节点）通知主节点删除自己。
-func (n *Pool) NotifyMasterToRemoveSelf() (bool, error) {
-	resp, err := n.SendRequestMasterToRemoveSelf()
+func (n *Pool) NotifyMasterToRemoveSelf(ctx context.Context) (_ bool, err error) {
+	ctx, span := n.startSpan(ctx, "NotifyMasterToRemoveSelf")
+	defer func() { tracing.End(span, err) }()
+	resp, err := n.SendRequestMasterToRemoveSelf(ctx)
 	if err != nil {
 		return false, ErrNodeRequestInvalid
 	}
@@ -351,12 +468,14 @@ func (n *Pool) NotifyMasterToRemoveSelf() (bool, error) {
 }
 
 // NotifySlaveToTakeoverSelf 当前节点（主节点）通知从节点接替自己。
-func (n *Pool) NotifySlaveToTakeoverSelf(candidateID uint64) (bool, error) {
+func (n *Pool) NotifySlaveToTakeoverSelf(ctx context.Context, candidateID uint64) (_ bool, err error) {
+	ctx, span := n.startSpan(ctx, "NotifySlaveToTakeoverSelf", attributePeerID.Int64(int64(candidateID)))
+	defer func() { tracing.End(span, err) }()
 	if n.Slaves.Count() == 0 {
-		logPrintln("no slave nodes")
+		n.logger().Info("no slave to take over")
 		return true, nil
 	} // 如果没有从节点，则不必通知。
-	logPrintf("Notify slave[%d] to take over\n", candidateID)
+	n.logger().Info("notify slave to take over", "peer_id", candidateID)
 	n.Slaves.NodesRWLock.Lock()
 	defer n.Slaves.NodesRWLock.Unlock()
 	var candidate NodeInfo.NodeInfo
@@ -368,29 +487,29 @@ func (n *Pool) NotifySlaveToTakeoverSelf(candidateID uint64) (bool, error) {
 	}
 
 	// 需要确保此时已删除当前节点信息，同时更新好目标接替节点信息和其他节点信息。
-	resp, err := n.SendRequestSlaveNotifyMasterToTakeover(&candidate)
+	resp, err := n.SendRequestSlaveNotifyMasterToTakeover(ctx, &candidate)
 	if err != nil {
-		logPrintln("[Send Request]Master notify slave to takeover:", err)
+		n.logger().Error("failed to notify slave to take over", "peer_id", candidateID, "error", err)
 		return false, err
 	}
 	if resp != nil {
 		var body = make([]byte, resp.ContentLength)
 		if _, err := resp.Body.Read(body); err != nil && !errors.Is(err, io.EOF) {
-			logPrintln("[Send Request]Master notify slave to takeover:", err)
-		}
-		if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-			logPrintln(resp.StatusCode, string(body))
+			n.logger().Error("failed to read response of take over", "peer_id", candidateID, "error", err)
 		}
+		n.logger().Debug("slave responded to take over", "peer_id", candidateID, "status", resp.StatusCode, "body", string(body))
 	}
 	return true, nil
 }
 
 // NotifyAllSlavesToSwitchSuperior 通知其它从节点切换节点ID为 candidateID 的主节点。
-func (n *Pool) NotifyAllSlavesToSwitchSuperior(candidateID uint64) (bool, error) {
+func (n *Pool) NotifyAllSlavesToSwitchSuperior(ctx context.Context, candidateID uint64) (_ bool, err error) {
+	ctx, span := n.startSpan(ctx, "NotifyAllSlavesToSwitchSuperior", attributePeerID.Int64(int64(candidateID)))
+	defer func() { tracing.End(span, err) }()
 	n.Slaves.NodesRWLock.Lock()
 	defer n.Slaves.NodesRWLock.Unlock()
-	if n.Slaves.Count() <= 1 {
-		logPrintln("no other slaves to be notified to switch superior")
+	if len(n.Slaves.Nodes) <= 1 {
+		n.logger().Info("no other slave to switch superior")
 		return true, nil
 	}
 	// 挑出候选节点。
@@ -404,42 +523,46 @@ func (n *Pool) NotifyAllSlavesToSwitchSuperior(candidateID uint64) (bool, error)
 	// 通知其它节点切换。并行发起切换通知请求。
 	// logPrintln(n.Slaves.Nodes)
 	for i := range n.Slaves.Nodes {
+		if i != candidateID && !n.Slaves.Supports(i, RequestSlaveNotify) {
+			n.logger().Warn("slave does not support switching superior, skipped", "peer_id", i)
+			continue
+		}
 		if i != candidateID {
 			// 这里不可以直接传递 v，因为这可能会导致访问到同一个map元素，而非按顺序遍历。
-			// go n.NotifySlaveToSwitchSuperior(&v, &candidate)
+			// go n.NotifySlaveToSwitchSuperior(ctx, &v, &candidate)
 			go func(slave *NodeInfo.NodeInfo, candidate *NodeInfo.NodeInfo) {
-				_, err := n.NotifySlaveToSwitchSuperior(slave, candidate)
+				_, err := n.NotifySlaveToSwitchSuperior(ctx, slave, candidate)
 				if err != nil {
-					logPrintln(err)
+					n.logger().Error("failed to notify slave to switch superior", append(peer(slave), "error", err)...)
 				}
-			}(n.Slaves.Get(i), &candidate)
+			}(n.Slaves.get(i), &candidate)
 		}
 	}
 	return true, nil
 }
 
 // NotifySlaveToSwitchSuperior 通知某个从节点切换主节点为 candidate。
-func (n *Pool) NotifySlaveToSwitchSuperior(slave *NodeInfo.NodeInfo, candidate *NodeInfo.NodeInfo) (bool, error) {
+func (n *Pool) NotifySlaveToSwitchSuperior(ctx context.Context, slave *NodeInfo.NodeInfo, candidate *NodeInfo.NodeInfo) (_ bool, err error) {
 	if slave == nil {
 		return false, ErrNodeSlaveInvalid
 	}
 	if candidate == nil {
 		return false, ErrNodeMasterInvalid
 	}
-	logPrintf("Notify slave[%d] to switch superior[%d]\n", slave.ID, candidate.ID)
-	resp, err := n.SendRequestSlaveNotifyMasterToSwitchSuperior(slave, candidate) // 不关心响应。
+	ctx, span := n.startSpan(ctx, "NotifySlaveToSwitchSuperior", attributePeerID.Int64(int64(slave.ID)))
+	defer func() { tracing.End(span, err) }()
+	n.logger().Info("notify slave to switch superior", append(peer(slave), "superior_id", candidate.ID)...)
+	resp, err := n.SendRequestSlaveNotifyMasterToSwitchSuperior(ctx, slave, candidate) // 不关心响应。
 	if err != nil {
-		logPrintln("[Send Request]Master notify slave to switch superior:", err)
+		n.logger().Error("failed to notify slave to switch superior", append(peer(slave), "error", err)...)
 		return false, err
 	}
 	if resp != nil {
 		var body = make([]byte, resp.ContentLength)
 		if _, err := resp.Body.Read(body); err != nil && !errors.Is(err, io.EOF) {
-			logPrintln("[Send Request]Master notify slave to switch superior:", err)
-		}
-		if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-			logPrintln(resp.StatusCode, string(body))
+			n.logger().Error("failed to read response of switching superior", append(peer(slave), "error", err)...)
 		}
+		n.logger().Debug("slave responded to switch superior", append(peer(slave), "status", resp.StatusCode, "body", string(body))...)
 	}
 	return true, nil
 }
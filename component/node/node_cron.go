@@ -0,0 +1,242 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+	"github.com/rhosocial/go-rush-producer/component/tracing"
+	CronJob "github.com/rhosocial/go-rush-producer/models/cron_job"
+	"github.com/robfig/cron/v3"
+)
+
+// 定时任务：只在当前主节点按 cron 表达式执行，参见 Schedule。
+//
+// 调度进度（下次执行时间）和执行锁记录在节点登记数据库中，参见 CronJob.CronJob。主节点每轮检查到期的任务，
+// 认领成功后才执行，因此接替或交接后新的主节点既不会重复执行已执行的任务，也不会跳过交接期间到期的任务；
+// 错过多次的任务只补执行一次。执行期间持续续期执行锁，上一次执行结束或锁定过期之前，任何节点都不会再次执行同一任务。
+//
+// 各节点应注册相同的定时任务，以便任一节点成为主节点后都能继续调度。
+
+// JobTimeoutDefault 定时任务默认的执行时限，也是执行锁每次续期的时长。
+const JobTimeoutDefault = time.Minute
+
+// JobFunc 定时任务的执行函数。ctx 在执行时限到达、当前节点不再是主节点或执行锁已丢失时取消。
+//
+// 执行锁在执行函数返回前持续续期，即使 ctx 已取消；但当前节点与节点登记数据库失联时无法续期，锁定过期后其它节点可能再次执行。
+// 因此执行函数须在 ctx 取消后尽快返回，才能保证同一任务不会同时在两个节点上执行。
+type JobFunc func(ctx context.Context) error
+
+// Job 定时任务。
+type Job struct {
+	Name    string        // 名称，不超过 64 个字符。在集群中唯一标识任务。
+	Spec    string        // 标准 cron 表达式（分 时 日 月 周），也可以是 @hourly、@every 10m 等，可用 CRON_TZ= 指定时区。
+	Timeout time.Duration // 执行时限，超时后取消 ctx。执行锁每过一半时限续期一次，每次续期 Timeout。为 0 时使用 JobTimeoutDefault。
+	Run     JobFunc
+}
+
+var ErrNodeJobInvalid = errors.New("invalid job")
+var ErrNodeJobDuplicated = errors.New("job already scheduled")
+var ErrNodeJobPanicked = errors.New("job panicked")
+var ErrNodeJobLockLost = errors.New("job lock lost")
+
+// scheduledJob 已注册的定时任务。
+type scheduledJob struct {
+	Job
+	schedule cron.Schedule
+	running  bool // 当前节点是否正在执行。由 jobsLock 保护。
+}
+
+// jobParser 解析定时任务的 cron 表达式。
+var jobParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Schedule 注册定时任务。可在启动前或运行时调用；任务只在当前节点是主节点时执行。
+//
+// 若名称为空或超过 64 个字符、未提供执行函数或无法解析 cron 表达式，则报 ErrNodeJobInvalid；若同名任务已注册，则报 ErrNodeJobDuplicated。
+func (n *Pool) Schedule(job Job) error {
+	if len(job.Name) == 0 || len(job.Name) > 64 || job.Run == nil {
+		return ErrNodeJobInvalid
+	}
+	schedule, err := jobParser.Parse(job.Spec)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNodeJobInvalid, err)
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = JobTimeoutDefault
+	}
+	n.jobsLock.Lock()
+	defer n.jobsLock.Unlock()
+	if n.jobs == nil {
+		n.jobs = make(map[string]*scheduledJob)
+	}
+	if _, ok := n.jobs[job.Name]; ok {
+		return ErrNodeJobDuplicated
+	}
+	n.jobs[job.Name] = &scheduledJob{Job: job, schedule: schedule}
+	return nil
+}
+
+// Jobs 已注册的定时任务名称，按名称排列。
+func (n *Pool) Jobs() []string {
+	n.jobsLock.Lock()
+	defer n.jobsLock.Unlock()
+	names := make([]string, 0, len(n.jobs))
+	for name := range n.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tryStartJob 标记当前节点开始执行 name。若当前节点已在执行，则返回 false。
+func (n *Pool) tryStartJob(name string) (*scheduledJob, bool) {
+	n.jobsLock.Lock()
+	defer n.jobsLock.Unlock()
+	job, ok := n.jobs[name]
+	if !ok || job.running {
+		return nil, false
+	}
+	job.running = true
+	return job, true
+}
+
+func (n *Pool) finishJob(job *scheduledJob) {
+	n.jobsLock.Lock()
+	defer n.jobsLock.Unlock()
+	job.running = false
+}
+
+// runJobs 当前节点（主节点）执行到期的定时任务。上一轮尚未结束时跳过本轮。
+//
+// 1. 登记尚无调度记录的任务；cron 表达式已变更的任务，按新的表达式重新计算下次执行时间。
+//
+// 2. 认领到期的任务，并在独立协程中执行，参见 runJob。ctx 取消（例如不再是主节点）时，执行中的任务随之取消。
+func (n *Pool) runJobs(ctx context.Context) {
+	if !n.jobsWorking.TryLock() {
+		return
+	}
+	defer n.jobsWorking.Unlock()
+	names := n.Jobs()
+	if n.registry == nil || len(names) == 0 {
+		return
+	}
+	records, err := CronJob.GetCronJobs(ctx, n.registry)
+	if err != nil {
+		n.logger().Error("failed to get jobs", "error", err)
+		return
+	}
+	recorded := make(map[string]*CronJob.CronJob, len(records))
+	for i := range records {
+		recorded[records[i].Name] = &records[i]
+	}
+	// 数据库时间精度为毫秒，截断后才能以开始时间作为条件，参见 CronJob.Finish。
+	now := time.Now().Truncate(time.Millisecond)
+	for _, name := range names {
+		job, running := n.tryStartJob(name)
+		if !running {
+			continue
+		}
+		record := recorded[name]
+		if !n.claimJob(ctx, job, record, now) {
+			n.finishJob(job)
+			continue
+		}
+		go n.runJob(ctx, job, record)
+	}
+}
+
+// claimJob 认领到期的任务。首次调度或 cron 表达式变更时只记录下次执行时间，不执行。
+func (n *Pool) claimJob(ctx context.Context, job *scheduledJob, record *CronJob.CronJob, now time.Time) bool {
+	if record == nil {
+		record = &CronJob.CronJob{Name: job.Name, Spec: job.Spec, NextRunAt: job.schedule.Next(now)}
+		if err := record.Create(ctx, n.registry); err != nil {
+			n.logger().Error("failed to create job", "job", job.Name, "error", err)
+		}
+		return false
+	}
+	if record.Spec != job.Spec {
+		if _, err := record.Reschedule(ctx, n.registry, job.Spec, job.schedule.Next(now)); err != nil {
+			n.logger().Error("failed to reschedule job", "job", job.Name, "error", err)
+		}
+		return false
+	}
+	if record.NextRunAt.After(now) || record.IsLocked(now) {
+		return false
+	}
+	ok, err := record.Claim(ctx, n.registry, n.Self.Node.ID, now, job.schedule.Next(now), now.Add(job.Timeout))
+	if err != nil {
+		n.logger().Error("failed to claim job", "job", job.Name, "error", err)
+	}
+	return ok
+}
+
+// runJob 执行已认领的任务，执行期间续期执行锁，结束后记录结果、解除锁定。执行函数 panic 时视为失败。
+func (n *Pool) runJob(ctx context.Context, job *scheduledJob, record *CronJob.CronJob) {
+	defer n.finishJob(job)
+	started := *record.LastStartedAt
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, job.Timeout)
+	defer cancelTimeout()
+	runCtx, cancel := context.WithCancelCause(timeoutCtx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	defer close(done)
+	go n.holdJobLock(tracing.Detach(ctx), job, *record, done, cancel)
+	n.logger().Info("job started", "job", job.Name, "started_at", started, "next_run_at", record.NextRunAt)
+	err := func() (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = ErrNodeJobPanicked
+				n.logger().Error("job panicked", "job", job.Name, "panic", recovered)
+			}
+		}()
+		return job.Run(runCtx)
+	}()
+	duration := time.Since(started)
+	cause, result := "", "success"
+	if err != nil {
+		cause, result = err.Error(), "failure"
+	}
+	metrics.JobRuns.WithLabelValues(job.Name, result).Inc()
+	if ok, ferr := record.Finish(tracing.Detach(ctx), n.registry, n.Self.Node.ID, time.Now(), duration, cause); ferr != nil {
+		n.logger().Error("failed to record job", "job", job.Name, "error", ferr)
+	} else if !ok {
+		n.logger().Warn("job lock expired before finishing", "job", job.Name, "timeout_ms", job.Timeout.Milliseconds())
+	}
+	if err != nil {
+		n.logger().Error("job failed", "job", job.Name, "duration_ms", duration.Milliseconds(), "error", err)
+	} else {
+		n.logger().Info("job finished", "job", job.Name, "duration_ms", duration.Milliseconds())
+	}
+	n.Events.Publish(&JobFinishedEvent{Name: job.Name, StartedAt: started, Duration: duration, Err: err})
+}
+
+// holdJobLock 每过一半执行时限续期一次执行锁，直至 done 关闭。ctx 取消后仍继续续期，以免执行函数尚未返回时其它节点再次执行。
+//
+// 若执行锁已被其它节点认领，或续期失败直至锁定过期，则以 ErrNodeJobLockLost 取消执行函数的 ctx。
+func (n *Pool) holdJobLock(ctx context.Context, job *scheduledJob, record CronJob.CronJob, done <-chan struct{}, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(job.Timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		lockedUntil := *record.LockedUntil
+		ok, err := record.Extend(ctx, n.registry, n.Self.Node.ID, time.Now().Add(job.Timeout))
+		if err != nil {
+			n.logger().Warn("failed to extend job lock", "job", job.Name, "error", err)
+			if time.Now().Before(lockedUntil) {
+				continue
+			}
+		} else if ok {
+			continue
+		}
+		n.logger().Error("job lock lost", "job", job.Name)
+		cancel(ErrNodeJobLockLost)
+		return
+	}
+}
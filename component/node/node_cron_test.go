@@ -0,0 +1,68 @@
+package node
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	CronJob "github.com/rhosocial/go-rush-producer/models/cron_job"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool_Schedule(t *testing.T) {
+	run := func(ctx context.Context) error { return nil }
+	t.Run("invalid", func(t *testing.T) {
+		pool := Pool{}
+		assert.ErrorIs(t, pool.Schedule(Job{Spec: "@hourly", Run: run}), ErrNodeJobInvalid)
+		assert.ErrorIs(t, pool.Schedule(Job{Name: strings.Repeat("a", 65), Spec: "@hourly", Run: run}), ErrNodeJobInvalid)
+		assert.ErrorIs(t, pool.Schedule(Job{Name: "a", Spec: "@hourly"}), ErrNodeJobInvalid)
+		assert.ErrorIs(t, pool.Schedule(Job{Name: "a", Spec: "* * *", Run: run}), ErrNodeJobInvalid)
+		assert.Empty(t, pool.Jobs())
+	})
+	t.Run("duplicated", func(t *testing.T) {
+		pool := Pool{}
+		assert.NoError(t, pool.Schedule(Job{Name: "a", Spec: "*/5 * * * *", Run: run}))
+		assert.ErrorIs(t, pool.Schedule(Job{Name: "a", Spec: "@hourly", Run: run}), ErrNodeJobDuplicated)
+	})
+	t.Run("default timeout", func(t *testing.T) {
+		pool := Pool{}
+		assert.NoError(t, pool.Schedule(Job{Name: "a", Spec: "@every 10m", Run: run}))
+		assert.NoError(t, pool.Schedule(Job{Name: "b", Spec: "@every 10m", Timeout: time.Second, Run: run}))
+		assert.Equal(t, JobTimeoutDefault, pool.jobs["a"].Timeout)
+		assert.Equal(t, time.Second, pool.jobs["b"].Timeout)
+	})
+	t.Run("sorted", func(t *testing.T) {
+		pool := Pool{}
+		for _, name := range []string{"c", "a", "b"} {
+			assert.NoError(t, pool.Schedule(Job{Name: name, Spec: "@daily", Run: run}))
+		}
+		assert.Equal(t, []string{"a", "b", "c"}, pool.Jobs())
+	})
+}
+
+func TestPool_tryStartJob(t *testing.T) {
+	pool := Pool{}
+	assert.NoError(t, pool.Schedule(Job{Name: "a", Spec: "@daily", Run: func(ctx context.Context) error { return nil }}))
+	t.Run("unknown", func(t *testing.T) {
+		_, ok := pool.tryStartJob("b")
+		assert.False(t, ok)
+	})
+	t.Run("no overlap", func(t *testing.T) {
+		job, ok := pool.tryStartJob("a")
+		assert.True(t, ok)
+		_, ok = pool.tryStartJob("a")
+		assert.False(t, ok)
+		pool.finishJob(job)
+		_, ok = pool.tryStartJob("a")
+		assert.True(t, ok)
+	})
+}
+
+func TestCronJob_IsLocked(t *testing.T) {
+	now := time.Now()
+	until := now.Add(time.Minute)
+	assert.False(t, (&CronJob.CronJob{}).IsLocked(now))
+	assert.True(t, (&CronJob.CronJob{RunnerID: 1, LockedUntil: &until}).IsLocked(now))
+	assert.False(t, (&CronJob.CronJob{RunnerID: 1, LockedUntil: &until}).IsLocked(until.Add(time.Second)))
+}
@@ -0,0 +1,316 @@
+package node
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+	base "github.com/rhosocial/go-rush-producer/models"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	Task "github.com/rhosocial/go-rush-producer/models/task"
+)
+
+// 事件类型。
+const (
+	EventIdentityChanged  = "identity_changed"  // 身份变化，参见 IdentityChangedEvent。
+	EventSlaveJoined      = "slave_joined"      // 从节点加入，参见 SlaveJoinedEvent。
+	EventSlaveRemoved     = "slave_removed"     // 从节点退出或被移除，参见 SlaveRemovedEvent。
+	EventSlaveInactive    = "slave_inactive"    // 从节点不活跃，参见 SlaveInactiveEvent。
+	EventMasterChanged    = "master_changed"    // 接受的主节点变化，参见 MasterChangedEvent。
+	EventHandoverStarted  = "handover_started"  // 开始向候选节点交接，参见 HandoverStartedEvent。
+	EventHandoverFinished = "handover_finished" // 交接结束，参见 HandoverFinishedEvent。
+	EventSuperseded       = "superseded"        // 当前节点接替了主节点，参见 SupersededEvent。
+	EventWorkerTicked     = "worker_ticked"     // 工作协程开始新一轮，参见 WorkerTickedEvent。
+	EventTaskFinished     = "task_finished"     // 任务结束，参见 TaskFinishedEvent。
+	EventShardAcquired    = "shard_acquired"    // 当前节点取得分片，参见 ShardAcquiredEvent。
+	EventShardReleased    = "shard_released"    // 当前节点释放分片，参见 ShardReleasedEvent。
+	EventJobFinished      = "job_finished"      // 定时任务执行结束，参见 JobFinishedEvent。
+)
+
+// EventSubscriberBufferDefault 每个订阅者默认可积压的事件数。
+const EventSubscriberBufferDefault = 64
+
+// 从节点被移除的原因，参见 SlaveRemovedEvent。
+var ErrNodeSlaveWithdrawn = errors.New("slave withdrew itself")
+var ErrNodeSlaveRetriedOut = errors.New("slave retried out")
+var ErrNodeSlaveUnreachable = errors.New("slave is unreachable")
+
+// Event 节点池事件。可按 Type 或类型断言区分具体事件，例如 *IdentityChangedEvent。
+//
+// 事件在发布后异步送达，其中的节点信息均为发布时的副本。
+type Event interface {
+	Type() string          // 事件类型，参见 EventIdentityChanged 等。
+	OccurredAt() time.Time // 发布时间。
+	stamp(at time.Time)
+}
+
+// EventBase 各事件的公共部分。
+type EventBase struct {
+	At time.Time `json:"at"`
+}
+
+// OccurredAt 发布时间。
+func (e *EventBase) OccurredAt() time.Time {
+	return e.At
+}
+
+func (e *EventBase) stamp(at time.Time) {
+	e.At = at
+}
+
+// IdentityChangedEvent 身份变化。Cause 为导致变化的原因，例如停止主节点的原因；主动启动时可能为空。
+//
+// Master 为变化后的主节点：成为主节点时为自己，否则为当前接受的主节点，没有时为空。
+type IdentityChangedEvent struct {
+	EventBase
+	Previous uint8              `json:"previous"`
+	Current  uint8              `json:"current"`
+	Cause    error              `json:"-"`
+	Master   *NodeInfo.NodeInfo `json:"master,omitempty"`
+}
+
+func (e *IdentityChangedEvent) Type() string { return EventIdentityChanged }
+
+// SlaveJoinedEvent 从节点加入当前节点（主节点）。
+type SlaveJoinedEvent struct {
+	EventBase
+	Slave NodeInfo.NodeInfo `json:"slave"`
+}
+
+func (e *SlaveJoinedEvent) Type() string { return EventSlaveJoined }
+
+// SlaveRemovedEvent 从节点退出或被当前节点（主节点）移除。
+// Cause 为 ErrNodeSlaveWithdrawn、ErrNodeSlaveRetriedOut 或 ErrNodeSlaveUnreachable。
+type SlaveRemovedEvent struct {
+	EventBase
+	Slave NodeInfo.NodeInfo `json:"slave"`
+	Cause error             `json:"-"`
+}
+
+func (e *SlaveRemovedEvent) Type() string { return EventSlaveRemoved }
+
+// SlaveInactiveEvent 当前节点（主节点）发现从节点不活跃。Retry 为当前重试次数。
+type SlaveInactiveEvent struct {
+	EventBase
+	Slave NodeInfo.NodeInfo `json:"slave"`
+	Retry uint8             `json:"retry"`
+}
+
+func (e *SlaveInactiveEvent) Type() string { return EventSlaveInactive }
+
+// MasterChangedEvent 当前节点接受的主节点变化。没有主节点时对应项为空，例如自己接替为主节点后 Current 为空。
+type MasterChangedEvent struct {
+	EventBase
+	Previous *NodeInfo.NodeInfo `json:"previous"`
+	Current  *NodeInfo.NodeInfo `json:"current"`
+}
+
+func (e *MasterChangedEvent) Type() string { return EventMasterChanged }
+
+// HandoverStartedEvent 当前节点（主节点）开始向候选节点交接。Cause 为停止主节点的原因。
+type HandoverStartedEvent struct {
+	EventBase
+	CandidateID uint64 `json:"candidate_id"`
+	Cause       error  `json:"-"`
+}
+
+func (e *HandoverStartedEvent) Type() string { return EventHandoverStarted }
+
+// HandoverFinishedEvent 交接结束。Err 为空表示节点登记数据库已完成交接。
+type HandoverFinishedEvent struct {
+	EventBase
+	CandidateID uint64 `json:"candidate_id"`
+	Err         error  `json:"-"`
+}
+
+func (e *HandoverFinishedEvent) Type() string { return EventHandoverFinished }
+
+// SupersededEvent 当前节点接替了主节点。Previous 为原主节点，Master 为新的主节点，即自己。
+//
+// 从节点随后按通知切换主节点时不发布此事件，只发布 MasterChangedEvent。
+type SupersededEvent struct {
+	EventBase
+	Previous *base.RegisteredNodeInfo `json:"previous"`
+	Master   NodeInfo.NodeInfo        `json:"master"`
+}
+
+func (e *SupersededEvent) Type() string { return EventSuperseded }
+
+// WorkerTickedEvent 工作协程开始新一轮。Identity 为工作协程对应的身份。
+type WorkerTickedEvent struct {
+	EventBase
+	Identity uint8 `json:"identity"`
+}
+
+func (e *WorkerTickedEvent) Type() string { return EventWorkerTicked }
+
+// TaskFinishedEvent 当前节点（主节点）记录任务结束：从节点报告了执行结果，或分配次数已达上限。
+type TaskFinishedEvent struct {
+	EventBase
+	Task Task.Task `json:"task"`
+}
+
+func (e *TaskFinishedEvent) Type() string { return EventTaskFinished }
+
+// ShardAcquiredEvent 当前节点取得分片。此后 Pool.Owns 对该分片返回 true。
+type ShardAcquiredEvent struct {
+	EventBase
+	Shard uint32 `json:"shard"`
+}
+
+func (e *ShardAcquiredEvent) Type() string { return EventShardAcquired }
+
+// ShardReleasedEvent 当前节点释放分片。发布时 Pool.Owns 对该分片已返回 false，但其它节点须待释放记录到节点登记数据库后才能取得。
+// Cause 为 ErrNodeShardMoved、ErrNodeShardRevoked、ErrNodeShardsDisabled 或停止的原因。
+type ShardReleasedEvent struct {
+	EventBase
+	Shard uint32 `json:"shard"`
+	Cause error  `json:"-"`
+}
+
+func (e *ShardReleasedEvent) Type() string { return EventShardReleased }
+
+// JobFinishedEvent 当前节点（主节点）执行定时任务结束。Err 为空表示执行成功。
+type JobFinishedEvent struct {
+	EventBase
+	Name      string        `json:"name"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Err       error         `json:"-"`
+}
+
+func (e *JobFinishedEvent) Type() string { return EventJobFinished }
+
+// EventBus 节点池事件总线。
+//
+// 发布不会阻塞：每个订阅者有独立的缓冲，积压已满时丢弃该订阅者的新事件并计数，参见 EventSubscription.Dropped。
+// 因此处理缓慢的订阅者不会拖慢工作协程，也不影响其它订阅者。只关心最新状态的订阅者可使用 SubscribeLatest。
+type EventBus struct {
+	subscribers map[*EventSubscription]struct{}
+	lock        sync.RWMutex
+}
+
+// NewEventBus 创建事件总线。
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[*EventSubscription]struct{})}
+}
+
+// EventSubscription 事件订阅。
+type EventSubscription struct {
+	bus     *EventBus
+	types   map[string]struct{}
+	events  chan Event
+	latest  bool // 积压已满时以新事件替换尚未取走的事件，参见 SubscribeLatest。
+	dropped uint64
+}
+
+// Subscribe 订阅事件。types 为空表示订阅所有类型。buffer 为可积压的事件数，小于 1 时取 EventSubscriberBufferDefault。
+//
+// 订阅者须持续读取 Events，不再需要时调用 Unsubscribe。
+func (b *EventBus) Subscribe(buffer int, types ...string) *EventSubscription {
+	if buffer < 1 {
+		buffer = EventSubscriberBufferDefault
+	}
+	s := EventSubscription{bus: b, events: make(chan Event, buffer)}
+	if len(types) > 0 {
+		s.types = make(map[string]struct{}, len(types))
+		for _, t := range types {
+			s.types[t] = struct{}{}
+		}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.subscribers[&s] = struct{}{}
+	return &s
+}
+
+// SubscribeLatest 订阅事件，只保留最新一个尚未取走的事件。types 的含义参见 Subscribe。
+//
+// 订阅者处理缓慢时，新事件替换尚未取走的事件而不是被丢弃，因此最后发布的事件总能送达，中间的事件可能被跳过。
+// 适用于只关心最新状态的订阅者，例如按身份变化执行脚本。被替换的事件不计入 EventSubscription.Dropped。
+func (b *EventBus) SubscribeLatest(types ...string) *EventSubscription {
+	s := b.Subscribe(1, types...)
+	s.latest = true
+	return s
+}
+
+// SubscribeFunc 订阅事件，并在独立协程中逐个以 fn 处理。返回取消订阅函数。types 的含义参见 Subscribe。
+func (b *EventBus) SubscribeFunc(fn func(Event), types ...string) func() {
+	s := b.Subscribe(EventSubscriberBufferDefault, types...)
+	go func() {
+		for event := range s.Events() {
+			fn(event)
+		}
+	}()
+	return s.Unsubscribe
+}
+
+// Publish 发布事件。发布时间由总线记录。
+func (b *EventBus) Publish(event Event) {
+	event.stamp(time.Now())
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for s := range b.subscribers {
+		if s.types != nil {
+			if _, exist := s.types[event.Type()]; !exist {
+				continue
+			}
+		}
+		if s.latest {
+			s.replace(event)
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			metrics.EventsDropped.WithLabelValues(event.Type()).Inc()
+		}
+	}
+}
+
+// replace 送达 event，积压已满时先取走尚未取走的事件。调用前须持有总线的锁，以免通道被关闭。
+func (s *EventSubscription) replace(event Event) {
+	for {
+		select {
+		case s.events <- event:
+			return
+		default:
+		}
+		select {
+		case <-s.events:
+		default:
+		}
+	}
+}
+
+// Events 事件通道。取消订阅后关闭。
+func (s *EventSubscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped 因积压已满而丢弃的事件数。
+func (s *EventSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe 取消订阅，并关闭事件通道。可重复调用。
+func (s *EventSubscription) Unsubscribe() {
+	s.bus.lock.Lock()
+	defer s.bus.lock.Unlock()
+	if _, exist := s.bus.subscribers[s]; exist {
+		delete(s.bus.subscribers, s)
+		close(s.events)
+	}
+}
+
+// copyNodeInfo 复制节点信息，供异步送达的事件使用。node 为空时返回空。
+func copyNodeInfo(node *NodeInfo.NodeInfo) *NodeInfo.NodeInfo {
+	if node == nil {
+		return nil
+	}
+	result := *node
+	return &result
+}
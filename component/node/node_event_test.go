@@ -0,0 +1,117 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	slave := NodeInfo.NodeInfo{ID: 2, Port: 8081, Level: 1, SuperiorID: 1, Turn: 1}
+
+	t.Run("filter by type", func(t *testing.T) {
+		bus := NewEventBus()
+		subscription := bus.Subscribe(0, EventSlaveJoined)
+		defer subscription.Unsubscribe()
+		bus.Publish(&WorkerTickedEvent{Identity: IdentityMaster})
+		bus.Publish(&SlaveJoinedEvent{Slave: slave})
+		event := <-subscription.Events()
+		joined, ok := event.(*SlaveJoinedEvent)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(2), joined.Slave.ID)
+		assert.False(t, joined.OccurredAt().IsZero())
+		assert.Len(t, subscription.Events(), 0)
+	})
+	t.Run("slow subscriber does not block", func(t *testing.T) {
+		bus := NewEventBus()
+		slow := bus.Subscribe(1)
+		defer slow.Unsubscribe()
+		fast := bus.Subscribe(4)
+		defer fast.Unsubscribe()
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 3; i++ {
+				bus.Publish(&WorkerTickedEvent{Identity: IdentityMaster})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("publish blocked")
+		}
+		assert.Equal(t, uint64(2), slow.Dropped())
+		assert.Equal(t, uint64(0), fast.Dropped())
+		assert.Len(t, fast.Events(), 3)
+	})
+	t.Run("unsubscribe", func(t *testing.T) {
+		bus := NewEventBus()
+		subscription := bus.Subscribe(0)
+		subscription.Unsubscribe()
+		subscription.Unsubscribe()
+		_, ok := <-subscription.Events()
+		assert.False(t, ok)
+		bus.Publish(&SlaveJoinedEvent{Slave: slave})
+	})
+	t.Run("subscribe func", func(t *testing.T) {
+		bus := NewEventBus()
+		received := make(chan Event, 1)
+		unsubscribe := bus.SubscribeFunc(func(event Event) { received <- event })
+		defer unsubscribe()
+		bus.Publish(&HandoverStartedEvent{CandidateID: 2})
+		select {
+		case event := <-received:
+			assert.Equal(t, EventHandoverStarted, event.Type())
+		case <-time.After(time.Second):
+			t.Fatal("event not delivered")
+		}
+	})
+}
+
+func TestEventBus_SubscribeLatest(t *testing.T) {
+	bus := NewEventBus()
+	subscription := bus.SubscribeLatest(EventHandoverStarted)
+	defer subscription.Unsubscribe()
+	for i := uint64(1); i <= 3; i++ {
+		bus.Publish(&HandoverStartedEvent{CandidateID: i})
+	}
+	bus.Publish(&SlaveInactiveEvent{})
+	event := (<-subscription.Events()).(*HandoverStartedEvent)
+	assert.Equal(t, uint64(3), event.CandidateID)
+	assert.Equal(t, uint64(0), subscription.Dropped())
+	select {
+	case event := <-subscription.Events():
+		t.Fatalf("unexpected event: %v", event)
+	default:
+	}
+}
+
+func TestPool_SwitchIdentity(t *testing.T) {
+	self := &NodeInfo.NodeInfo{Host: "127.0.0.1", Port: 8081}
+	pool := Pool{Self: PoolSelf{Identity: IdentityNotDetermined, Node: self}, Events: NewEventBus()}
+	pool.Master.Node = &NodeInfo.NodeInfo{Host: "127.0.0.1", Port: 8080}
+	subscription := pool.Events.Subscribe(0, EventIdentityChanged)
+	defer subscription.Unsubscribe()
+
+	pool.SwitchIdentitySlaveOn(nil)
+	pool.SwitchIdentitySlaveOff(ErrNodeTakeoverMaster)
+	pool.SwitchIdentityMasterOn(ErrNodeExistedMasterWithdrawn)
+
+	expected := []struct {
+		IdentityChangedEvent
+		socket string
+	}{
+		{IdentityChangedEvent{Previous: IdentityNotDetermined, Current: IdentitySlave}, "127.0.0.1:8080"},
+		{IdentityChangedEvent{Previous: IdentitySlave, Current: IdentityNotDetermined, Cause: ErrNodeTakeoverMaster}, "127.0.0.1:8080"},
+		{IdentityChangedEvent{Previous: IdentityNotDetermined, Current: IdentityMaster, Cause: ErrNodeExistedMasterWithdrawn}, "127.0.0.1:8081"},
+	}
+	for _, e := range expected {
+		changed := (<-subscription.Events()).(*IdentityChangedEvent)
+		assert.Equal(t, e.Previous, changed.Previous)
+		assert.Equal(t, e.Current, changed.Current)
+		assert.ErrorIs(t, changed.Cause, e.Cause)
+		assert.Equal(t, e.socket, changed.Master.Socket())
+	}
+}
@@ -0,0 +1,145 @@
+package node
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+)
+
+// ZoneLossTracker 统计各可用区在时间窗口内失效的节点数。
+type ZoneLossTracker struct {
+	window time.Duration
+	losses map[string][]time.Time
+	lock   sync.Mutex
+}
+
+// NewZoneLossTracker 创建可用区失效统计。window 为统计的时间窗口。
+func NewZoneLossTracker(window time.Duration) *ZoneLossTracker {
+	return &ZoneLossTracker{
+		window: window,
+		losses: make(map[string][]time.Time),
+	}
+}
+
+// SetWindow 修改统计的时间窗口。已记录的失效在下次统计时按新窗口清理。
+func (t *ZoneLossTracker) SetWindow(window time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.window = window
+}
+
+// Record 记录指定可用区在 at 时刻失效了一个节点。未指定可用区的节点不计入。
+func (t *ZoneLossTracker) Record(zone string, at time.Time) {
+	if len(zone) == 0 {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.losses[zone] = append(t.losses[zone], at)
+}
+
+// Snapshot 获取截至 now 时间窗口内各可用区失效的节点数，同时清理窗口外的记录。
+func (t *ZoneLossTracker) Snapshot(now time.Time) map[string]uint32 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	result := make(map[string]uint32)
+	for zone, losses := range t.losses {
+		kept := losses[:0]
+		for _, at := range losses {
+			if now.Sub(at) <= t.window {
+				kept = append(kept, at)
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.losses, zone)
+			continue
+		}
+		t.losses[zone] = kept
+		result[zone] = uint32(len(kept))
+	}
+	return result
+}
+
+// OrderSuccessors 按接替策略排列候选从节点，返回排列后的节点ID。排在首位的即为首选接替者。
+//
+// 1. component.FailoverPolicyTurn：按接替顺序（Turn）排列。
+//
+// 2. component.FailoverPolicyZone：若主节点所在可用区失效节点数低于 threshold，则该可用区的从节点优先；
+// 否则该可用区的从节点排在最后，其余按所在可用区失效节点数从少到多排列。
+//
+// 同等条件下按接替顺序排列。未知策略按 component.FailoverPolicyTurn 处理。
+func OrderSuccessors(policy string, masterZone string, slaves []NodeInfo.NodeInfo, losses map[string]uint32, threshold uint32) []uint64 {
+	candidates := make([]NodeInfo.NodeInfo, len(slaves))
+	copy(candidates, slaves)
+	degraded := losses[masterZone] >= threshold
+	rank := func(slave *NodeInfo.NodeInfo) (uint8, uint32) {
+		if policy != component.FailoverPolicyZone {
+			return 0, 0
+		}
+		if slave.Zone == masterZone && len(masterZone) > 0 {
+			if degraded {
+				return 2, 0
+			}
+			return 0, 0
+		}
+		return 1, losses[slave.Zone]
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		groupI, lossI := rank(&candidates[i])
+		groupJ, lossJ := rank(&candidates[j])
+		if groupI != groupJ {
+			return groupI < groupJ
+		}
+		if lossI != lossJ {
+			return lossI < lossJ
+		}
+		if candidates[i].Turn != candidates[j].Turn {
+			return candidates[i].Turn < candidates[j].Turn
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	result := make([]uint64, len(candidates))
+	for i, candidate := range candidates {
+		result[i] = candidate.ID
+	}
+	return result
+}
+
+// Succession 当前节点（主节点）按接替策略排列的接替次序。不支持接替通知（RequestSlaveNotify）的从节点不参与排列。
+func (n *Pool) Succession() []uint64 {
+	n.Slaves.NodesRWLock.RLock()
+	slaves := make([]NodeInfo.NodeInfo, 0, len(n.Slaves.Nodes))
+	for i, v := range n.Slaves.Nodes {
+		if n.Slaves.Supports(i, RequestSlaveNotify) {
+			slaves = append(slaves, v)
+		}
+	}
+	n.Slaves.NodesRWLock.RUnlock()
+	failover := n.env.GetFailover()
+	return OrderSuccessors(failover.Policy, n.Self.Node.Zone, slaves, n.ZoneLosses.Snapshot(time.Now()), uint32(*failover.LossThreshold))
+}
+
+// GetSuccessionCandidate 获取首选接替者的节点ID。如果没有候选，则返回0。
+func (n *Pool) GetSuccessionCandidate() uint64 {
+	if succession := n.Succession(); len(succession) > 0 {
+		return succession[0]
+	}
+	return 0
+}
+
+// SupersedeDelay 当前节点（从节点）主动接替前应等待的时长。
+//
+// 按主节点最近报告的接替次序，排在第 i 位的从节点等待 i 个 step。未出现在接替次序中的从节点排在最后。
+// 这样首选接替者最先尝试接替，其余从节点仅在其失败时才会接替成功。
+func (n *Pool) SupersedeDelay(step time.Duration) time.Duration {
+	succession := n.Master.GetSuccession()
+	for i, id := range succession {
+		if id == n.Self.Node.ID {
+			return time.Duration(i) * step
+		}
+	}
+	return time.Duration(len(succession)) * step
+}
@@ -0,0 +1,57 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderSuccessors(t *testing.T) {
+	slaves := []NodeInfo.NodeInfo{
+		{ID: 2, Turn: 1, Zone: "b"},
+		{ID: 3, Turn: 2, Zone: "a"},
+		{ID: 4, Turn: 3, Zone: "c"},
+		{ID: 5, Turn: 4, Zone: "a"},
+	}
+	t.Run("turn", func(t *testing.T) {
+		assert.Equal(t, []uint64{2, 3, 4, 5}, OrderSuccessors(component.FailoverPolicyTurn, "a", slaves, nil, 2))
+	})
+	t.Run("zone healthy", func(t *testing.T) {
+		assert.Equal(t, []uint64{3, 5, 2, 4}, OrderSuccessors(component.FailoverPolicyZone, "a", slaves, map[string]uint32{"a": 1}, 2))
+	})
+	t.Run("zone degraded", func(t *testing.T) {
+		losses := map[string]uint32{"a": 2, "b": 1}
+		assert.Equal(t, []uint64{4, 2, 3, 5}, OrderSuccessors(component.FailoverPolicyZone, "a", slaves, losses, 2))
+	})
+	t.Run("master without zone", func(t *testing.T) {
+		assert.Equal(t, []uint64{2, 3, 4, 5}, OrderSuccessors(component.FailoverPolicyZone, "", slaves, nil, 2))
+	})
+	t.Run("empty", func(t *testing.T) {
+		assert.Empty(t, OrderSuccessors(component.FailoverPolicyZone, "a", nil, nil, 2))
+	})
+}
+
+func TestZoneLossTracker(t *testing.T) {
+	tracker := NewZoneLossTracker(time.Minute)
+	now := time.Now()
+	tracker.Record("a", now.Add(-2*time.Minute))
+	tracker.Record("a", now.Add(-time.Second))
+	tracker.Record("b", now)
+	tracker.Record("", now)
+	assert.Equal(t, map[string]uint32{"a": 1, "b": 1}, tracker.Snapshot(now))
+	assert.Equal(t, map[string]uint32{}, tracker.Snapshot(now.Add(2*time.Minute)))
+}
+
+func TestPool_SupersedeDelay(t *testing.T) {
+	pool := newHeartbeatTestPool()
+	pool.Self.Node.ID = 3
+	step := time.Second
+	assert.Equal(t, time.Duration(0), pool.SupersedeDelay(step))
+	pool.Master.Report(1, &RequestMasterStatusResponseExtension{Succession: []uint64{2, 3}})
+	assert.Equal(t, step, pool.SupersedeDelay(step))
+	pool.Self.Node.ID = 9
+	assert.Equal(t, 2*step, pool.SupersedeDelay(step))
+}
@@ -0,0 +1,152 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 健康检查项名称。
+const (
+	HealthCheckWorker   = "worker"   // 工作协程。
+	HealthCheckIdentity = "identity" // 身份。
+	HealthCheckRegistry = "registry" // 节点登记数据库。
+	HealthCheckMaster   = "master"   // 主节点（仅从节点）。
+)
+
+// 健康检查不通过的原因。
+const (
+	HealthReasonWorkerStalled         = "worker_stalled"          // 工作协程超时未开始新一轮。
+	HealthReasonWorkerStopped         = "worker_stopped"          // 当前身份的工作协程未运行。
+	HealthReasonIdentityNotDetermined = "identity_not_determined" // 身份未定，例如正在接替或切换主节点。
+	HealthReasonRegistryUnreachable   = "registry_unreachable"    // 无法连接节点登记数据库。
+	HealthReasonMasterUnknown         = "master_unknown"          // 尚未接受主节点。
+	HealthReasonMasterUnreachable     = "master_unreachable"      // 最近一次检查主节点失败。
+)
+
+// healthRegistryTimeout 检查节点登记数据库的超时。
+const healthRegistryTimeout = time.Second
+
+var ErrNodeRegistryUnavailable = errors.New("registry is not available")
+
+// HealthCheck 单项健康检查结果。
+type HealthCheck struct {
+	Name    string `json:"name"`             // 检查项名称，参见 HealthCheckWorker 等。
+	Healthy bool   `json:"healthy"`          // 是否通过。
+	Reason  string `json:"reason,omitempty"` // 未通过的原因，参见 HealthReasonWorkerStalled 等。
+	Detail  string `json:"detail,omitempty"` // 补充说明，例如错误信息。
+}
+
+// HealthReport 健康检查报告。所有检查项均通过时 Healthy 为真。
+type HealthReport struct {
+	Healthy  bool          `json:"healthy"`
+	Identity string        `json:"identity"` // 当前身份，参见 IdentityName。
+	Checks   []HealthCheck `json:"checks"`
+}
+
+func (r *HealthReport) add(check HealthCheck) {
+	r.Checks = append(r.Checks, check)
+	r.Healthy = r.Healthy && check.Healthy
+}
+
+// pingRegistry 检查节点登记数据库是否可用。
+var pingRegistry = func(ctx context.Context, registry *gorm.DB) error {
+	if registry == nil {
+		return ErrNodeRegistryUnavailable
+	}
+	db, err := registry.DB()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
+
+// workerStallLimit 工作协程两轮之间允许的最长间隔。超过即视为停滞。
+//
+// 每轮包括一次间隔等待和若干节点间请求；从节点在主动接替前还会等待接替次序对应的时长，参见 SupersedeDelay。
+// 因此上限为三倍间隔、三倍请求超时与接替等待之和。
+func (n *Pool) workerStallLimit(interval time.Duration) time.Duration {
+	timing := n.Timing()
+	limit := 3*interval + 3*timing.GetRequestTimeout()
+	if n.IsIdentitySlave() {
+		limit += n.SupersedeDelay(time.Duration(*n.env.GetFailover().SupersedeStep) * time.Millisecond)
+	}
+	return limit
+}
+
+// checkWorker 检查当前身份的工作协程是否停滞。身份未定时没有工作协程，视为通过。
+func (n *Pool) checkWorker(now time.Time) HealthCheck {
+	check := HealthCheck{Name: HealthCheckWorker, Healthy: true}
+	var tickedAt time.Time
+	var interval time.Duration
+	if n.IsIdentityMaster() && n.Master.IsWorking() {
+		tickedAt, interval = n.Master.TickedAt(), n.Timing().GetMasterInterval()
+	} else if n.IsIdentitySlave() && n.Slaves.IsWorking() {
+		tickedAt, interval = n.Slaves.TickedAt(), n.Timing().GetSlaveInterval()
+	} else {
+		return check
+	}
+	if elapsed := now.Sub(tickedAt); elapsed > n.workerStallLimit(interval) {
+		check.Healthy = false
+		check.Reason = HealthReasonWorkerStalled
+		check.Detail = "last tick " + elapsed.Round(time.Millisecond).String() + " ago"
+	}
+	return check
+}
+
+// Liveness 存活检查：工作协程未停滞，参见 checkWorker。未通过时应重启进程。
+//
+// 身份未定或工作协程已停止并不影响存活，只影响就绪，参见 Readiness。
+func (n *Pool) Liveness(now time.Time) *HealthReport {
+	report := HealthReport{Healthy: true, Identity: IdentityName(n.Self.Identity), Checks: make([]HealthCheck, 0, 1)}
+	report.add(n.checkWorker(now))
+	return &report
+}
+
+// Readiness 就绪检查。未通过时不应向该节点分发业务流量。
+//
+// 1. 身份已定。接替或切换主节点期间身份可能暂时未定。
+//
+// 2. 节点登记数据库可用。
+//
+// 3. 主节点的工作协程正在运行；从节点的工作协程正在运行，已接受主节点，且最近一次检查主节点成功（重试次数为 0）。
+//
+// 4. 工作协程未停滞，参见 Liveness。
+func (n *Pool) Readiness(ctx context.Context, now time.Time) *HealthReport {
+	report := HealthReport{Healthy: true, Identity: IdentityName(n.Self.Identity), Checks: make([]HealthCheck, 0, 4)}
+	if n.IsIdentityNotDetermined() {
+		report.add(HealthCheck{Name: HealthCheckIdentity, Reason: HealthReasonIdentityNotDetermined})
+	} else {
+		report.add(HealthCheck{Name: HealthCheckIdentity, Healthy: true})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthRegistryTimeout)
+	defer cancel()
+	if err := pingRegistry(ctx, n.registry); err != nil {
+		report.add(HealthCheck{Name: HealthCheckRegistry, Reason: HealthReasonRegistryUnreachable, Detail: err.Error()})
+	} else {
+		report.add(HealthCheck{Name: HealthCheckRegistry, Healthy: true})
+	}
+
+	if n.IsIdentityMaster() && !n.Master.IsWorking() || n.IsIdentitySlave() && !n.Slaves.IsWorking() {
+		report.add(HealthCheck{Name: HealthCheckWorker, Reason: HealthReasonWorkerStopped})
+	} else {
+		report.add(n.checkWorker(now))
+	}
+
+	if n.IsIdentitySlave() {
+		n.Master.RetryRWLock.RLock()
+		retry := n.Master.Retry
+		n.Master.RetryRWLock.RUnlock()
+		if n.Master.Node == nil {
+			report.add(HealthCheck{Name: HealthCheckMaster, Reason: HealthReasonMasterUnknown})
+		} else if retry > 0 {
+			report.add(HealthCheck{Name: HealthCheckMaster, Reason: HealthReasonMasterUnreachable, Detail: n.Master.Node.Socket()})
+		} else {
+			report.add(HealthCheck{Name: HealthCheckMaster, Healthy: true})
+		}
+	}
+	return &report
+}
@@ -0,0 +1,91 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func reasonsOf(report *HealthReport) map[string]string {
+	reasons := make(map[string]string)
+	for _, check := range report.Checks {
+		if !check.Healthy {
+			reasons[check.Name] = check.Reason
+		}
+	}
+	return reasons
+}
+
+func TestPool_Health(t *testing.T) {
+	env := newTestEnv()
+	registryErr := error(nil)
+	previous := pingRegistry
+	pingRegistry = func(ctx context.Context, registry *gorm.DB) error { return registryErr }
+	t.Cleanup(func() { pingRegistry = previous })
+	now := time.Now()
+	running := func(cause error) {}
+
+	newMaster := func() *Pool {
+		pool := Pool{Self: PoolSelf{Identity: IdentityMaster, Node: &NodeInfo.NodeInfo{}}, env: env}
+		pool.Master.WorkerCancelFunc = running
+		pool.Master.Tick(now.Add(-time.Second))
+		return &pool
+	}
+	newSlave := func() *Pool {
+		pool := Pool{Self: PoolSelf{Identity: IdentitySlave, Node: &NodeInfo.NodeInfo{}}, env: env}
+		pool.Master.Node = &NodeInfo.NodeInfo{Host: "127.0.0.1", Port: 8080}
+		pool.Slaves.WorkerCancelFunc = running
+		pool.Slaves.Tick(now.Add(-time.Second))
+		return &pool
+	}
+
+	t.Run("master ready", func(t *testing.T) {
+		pool := newMaster()
+		assert.True(t, pool.Liveness(now).Healthy)
+		report := pool.Readiness(context.Background(), now)
+		assert.True(t, report.Healthy)
+		assert.Equal(t, "master", report.Identity)
+	})
+	t.Run("slave ready", func(t *testing.T) {
+		report := newSlave().Readiness(context.Background(), now)
+		assert.True(t, report.Healthy)
+		assert.Len(t, report.Checks, 4)
+	})
+	t.Run("worker stalled", func(t *testing.T) {
+		pool := newMaster()
+		pool.Master.Tick(now.Add(-time.Hour))
+		liveness := pool.Liveness(now)
+		assert.False(t, liveness.Healthy)
+		assert.Equal(t, map[string]string{HealthCheckWorker: HealthReasonWorkerStalled}, reasonsOf(liveness))
+		assert.False(t, pool.Readiness(context.Background(), now).Healthy)
+	})
+	t.Run("worker stopped", func(t *testing.T) {
+		pool := newMaster()
+		pool.Master.WorkerCancelFunc = nil
+		assert.True(t, pool.Liveness(now).Healthy)
+		assert.Equal(t, map[string]string{HealthCheckWorker: HealthReasonWorkerStopped}, reasonsOf(pool.Readiness(context.Background(), now)))
+	})
+	t.Run("identity not determined", func(t *testing.T) {
+		pool := Pool{Self: PoolSelf{Identity: IdentityNotDetermined}, env: env}
+		assert.True(t, pool.Liveness(now).Healthy)
+		assert.Equal(t, map[string]string{HealthCheckIdentity: HealthReasonIdentityNotDetermined}, reasonsOf(pool.Readiness(context.Background(), now)))
+	})
+	t.Run("registry unreachable", func(t *testing.T) {
+		registryErr = errors.New("connection refused")
+		defer func() { registryErr = nil }()
+		report := newMaster().Readiness(context.Background(), now)
+		assert.Equal(t, map[string]string{HealthCheckRegistry: HealthReasonRegistryUnreachable}, reasonsOf(report))
+	})
+	t.Run("master unreachable", func(t *testing.T) {
+		pool := newSlave()
+		pool.Master.RetryUp()
+		assert.Equal(t, map[string]string{HealthCheckMaster: HealthReasonMasterUnreachable}, reasonsOf(pool.Readiness(context.Background(), now)))
+		pool.Master.Node = nil
+		assert.Equal(t, map[string]string{HealthCheckMaster: HealthReasonMasterUnknown}, reasonsOf(pool.Readiness(context.Background(), now)))
+	})
+}
@@ -0,0 +1,136 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rhosocial/go-rush-common/component/response"
+)
+
+// Heartbeat 从节点向主节点推送的心跳。
+type Heartbeat struct {
+	ID        uint64 `json:"id"`        // 从节点ID。
+	State     uint8  `json:"state"`     // 从节点身份，参见 IdentityNotDetermined、IdentityMaster 和 IdentitySlave。
+	Timestamp int64  `json:"timestamp"` // 从节点发送心跳的时间（毫秒）。
+	MasterID  uint64 `json:"master_id"` // 从节点已知的主节点ID。
+	Revision  uint64 `json:"revision"`  // 从节点已知的从节点集合版本。
+}
+
+// HeartbeatResponseData 心跳响应体的数据部分。
+type HeartbeatResponseData struct {
+	Attended        bool   `json:"attended"`          // 发送心跳的从节点是否已加入。
+	IsMasterWorking bool   `json:"is_master_working"` // 当前节点主节点身份是否正在工作。
+	MasterID        uint64 `json:"master_id"`         // 主节点ID。
+	Revision        uint64 `json:"revision"`          // 主节点的从节点集合版本。
+	Changed         bool   `json:"changed"`           // 从节点已知的主节点或从节点集合是否已过时。若过时，则扩展部分包含完整的主从节点信息。
+	Timestamp       int64  `json:"timestamp"`         // 主节点收到心跳的时间（毫秒）。
+}
+
+// HeartbeatResponse 心跳响应体。扩展部分仅在 HeartbeatResponseData.Changed 为真时出现。
+type HeartbeatResponse = response.Generic[HeartbeatResponseData, *RequestMasterStatusResponseExtension]
+
+var ErrNodeHeartbeatInvalid = errors.New("invalid heartbeat")
+
+// ------ MasterHeartbeat ------ //
+
+// NewHeartbeat 根据当前节点状态生成心跳。
+func (n *Pool) NewHeartbeat() *Heartbeat {
+	heartbeat := Heartbeat{
+		ID:        n.Self.Node.ID,
+		State:     n.Self.Identity,
+		Timestamp: time.Now().UnixMilli(),
+		Revision:  n.Master.Revision,
+	}
+	if n.Master.Node != nil {
+		heartbeat.MasterID = n.Master.Node.ID
+	}
+	return &heartbeat
+}
+
+// SendRequestMasterHeartbeat 向"主节点-心跳"发送请求。
+func (n *Pool) SendRequestMasterHeartbeat(ctx context.Context, heartbeat *Heartbeat) (*http.Response, error) {
+	if n.Master.Node == nil {
+		return nil, ErrNodeLevelAlreadyHighest
+	}
+	body, err := json.Marshal(heartbeat)
+	if err != nil {
+		return nil, ErrNodeRequestInvalid
+	}
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodMasterHeartbeat, RequestURLFormatMasterHeartbeat, n.Master.Node.Socket(), bytes.NewReader(body), "application/json")
+	if err != nil {
+		n.logger().Error("failed to prepare request", "error", err)
+		return nil, ErrNodeRequestInvalid
+	}
+	client := n.httpClient()
+	resp, err := client.Do(req)
+	return resp, err
+}
+
+// NotifyMasterHeartbeat 当前节点（从节点）向主节点推送心跳。
+//
+// 1. 如果请求构造出错，则报 ErrNodeRequestInvalid。
+//
+// 2. 如果请求发送失败、响应无法解析或状态码不是 200 OK，则报 ErrNodeRequestResponseError。
+//
+// 成功后，记录主节点报告的从节点集合版本，以及有变化时的主从节点信息。
+func (n *Pool) NotifyMasterHeartbeat(ctx context.Context) (*HeartbeatResponseData, error) {
+	resp, err := n.SendRequestMasterHeartbeat(ctx, n.NewHeartbeat())
+	if errors.Is(err, ErrNodeRequestInvalid) {
+		return nil, err
+	}
+	if err != nil {
+		n.logger().Warn("failed to send heartbeat", append(peer(n.Master.Node), "error", err)...)
+		return nil, ErrNodeRequestResponseError
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		n.logger().Warn("failed to send heartbeat", append(peer(n.Master.Node), "error", err)...)
+		return nil, ErrNodeRequestResponseError
+	}
+	if resp.StatusCode != http.StatusOK {
+		n.logger().Warn("heartbeat refused", append(peer(n.Master.Node), "status", resp.StatusCode, "body", string(body))...)
+		return nil, ErrNodeRequestResponseError
+	}
+	var respContent HeartbeatResponse
+	if err := json.Unmarshal(body, &respContent); err != nil {
+		n.logger().Warn("failed to send heartbeat", append(peer(n.Master.Node), "error", err)...)
+		return nil, ErrNodeRequestResponseError
+	}
+	n.Master.Report(respContent.Data.Revision, respContent.Extension)
+	return &respContent.Data, nil
+}
+
+// ReceiveHeartbeat 当前节点（主节点）处理从节点心跳。protocol 为从节点报告的协议版本和能力集。
+//
+// 若心跳来自已登记从节点，则清空其重试次数，并记录其协议。
+// 若从节点已知的主节点ID或从节点集合版本与当前不一致，则同时返回完整的主从节点信息，否则扩展部分为空。
+func (n *Pool) ReceiveHeartbeat(heartbeat *Heartbeat, protocol *Protocol) (*HeartbeatResponseData, *RequestMasterStatusResponseExtension) {
+	data := HeartbeatResponseData{
+		IsMasterWorking: n.Master.IsWorking(),
+		MasterID:        n.Self.Node.ID,
+		Revision:        n.Slaves.GetRevision(),
+		Timestamp:       time.Now().UnixMilli(),
+	}
+	if n.Slaves.Get(heartbeat.ID) != nil {
+		data.Attended = true
+		n.Slaves.RetryClear(heartbeat.ID)
+		n.Slaves.SetProtocol(heartbeat.ID, protocol)
+	}
+	if heartbeat.MasterID == data.MasterID && heartbeat.Revision == data.Revision {
+		return &data, nil
+	}
+	data.Changed = true
+	return &data, &RequestMasterStatusResponseExtension{
+		Master:     n.Master.Node.ToRegisteredNodeInfo(),
+		Slaves:     n.Slaves.GetRegisteredNodeInfos(),
+		Succession: n.Succession(),
+	}
+}
+
+// ------ MasterHeartbeat ------ //
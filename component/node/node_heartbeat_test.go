@@ -0,0 +1,76 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHeartbeatTestPool() *Pool {
+	master := NodeInfo.NewNodeInfo("GO-RUSH-PRODUCER", "0.0.1", 8080, 0)
+	master.ID = 1
+	pool := Pool{
+		Self: PoolSelf{Identity: IdentityMaster, Node: master},
+		Slaves: PoolSlaves{
+			Nodes:         make(map[uint64]NodeInfo.NodeInfo),
+			NodesRetry:    make(map[uint64]uint8),
+			NodesProtocol: make(map[uint64]*Protocol),
+		},
+		ZoneLosses: NewZoneLossTracker(time.Minute),
+		env:        newTestEnv(),
+	}
+	pool.Slaves.AddSlaveNode(NodeInfo.NodeInfo{ID: 2, Port: 8081, Level: 1, SuperiorID: 1, Turn: 1})
+	return &pool
+}
+
+func TestPool_ReceiveHeartbeat(t *testing.T) {
+	t.Run("stale revision", func(t *testing.T) {
+		pool := newHeartbeatTestPool()
+		pool.Slaves.RetryUp(2)
+		data, ext := pool.ReceiveHeartbeat(&Heartbeat{ID: 2, State: IdentitySlave, MasterID: 1}, NewProtocol())
+		assert.True(t, data.Attended)
+		assert.True(t, data.Changed)
+		assert.Equal(t, uint64(1), data.Revision)
+		assert.NotNil(t, ext)
+		assert.Len(t, *ext.Slaves, 1)
+		assert.Equal(t, uint8(0), pool.Slaves.GetRetry(2))
+		assert.NotNil(t, pool.Slaves.GetProtocol(2))
+	})
+	t.Run("up to date", func(t *testing.T) {
+		pool := newHeartbeatTestPool()
+		data, ext := pool.ReceiveHeartbeat(&Heartbeat{ID: 2, State: IdentitySlave, MasterID: 1, Revision: 1}, NewProtocol())
+		assert.True(t, data.Attended)
+		assert.False(t, data.Changed)
+		assert.Nil(t, ext)
+	})
+	t.Run("master changed", func(t *testing.T) {
+		pool := newHeartbeatTestPool()
+		data, ext := pool.ReceiveHeartbeat(&Heartbeat{ID: 2, State: IdentitySlave, MasterID: 3, Revision: 1}, NewProtocol())
+		assert.True(t, data.Changed)
+		assert.NotNil(t, ext)
+	})
+	t.Run("not attended", func(t *testing.T) {
+		pool := newHeartbeatTestPool()
+		data, _ := pool.ReceiveHeartbeat(&Heartbeat{ID: 4, State: IdentitySlave, MasterID: 1, Revision: 1}, NewProtocol())
+		assert.False(t, data.Attended)
+		assert.Nil(t, pool.Slaves.GetProtocol(4))
+	})
+	t.Run("concurrent joins", func(t *testing.T) {
+		pool := newHeartbeatTestPool()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := uint64(3); i < 103; i++ {
+				pool.Slaves.AddSlaveNode(NodeInfo.NodeInfo{ID: i, Port: uint16(8080 + i), Level: 1, SuperiorID: 1})
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			data, _ := pool.ReceiveHeartbeat(&Heartbeat{ID: 2, State: IdentitySlave, MasterID: 1}, NewProtocol())
+			assert.True(t, data.Attended)
+		}
+		<-done
+		assert.Equal(t, 101, pool.Slaves.Count())
+	})
+}
@@ -3,8 +3,9 @@ package node
 import (
 	"context"
 	"errors"
+	"time"
 
-	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/tracing"
 	base "github.com/rhosocial/go-rush-producer/models"
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
 	"gorm.io/gorm"
@@ -19,64 +20,36 @@ const (
 
 var ErrNodeLevelAlreadyHighest = errors.New("it is already the highest level")
 
-func (n *Pool) AttachIdentitySwitchedMasterOnCallbacks(fn func()) {
-	n.Self.identitySwitchedMasterOnCallbacksRWLock.Lock()
-	defer n.Self.identitySwitchedMasterOnCallbacksRWLock.Unlock()
-	n.Self.identitySwitchedMasterOnCallbacks = append(n.Self.identitySwitchedMasterOnCallbacks, fn)
-}
-
-func (n *Pool) AttachIdentitySwitchedMasterOffCallbacks(fn func()) {
-	n.Self.identitySwitchedMasterOffCallbacksRWLock.Lock()
-	defer n.Self.identitySwitchedMasterOffCallbacksRWLock.Unlock()
-	n.Self.identitySwitchedMasterOffCallbacks = append(n.Self.identitySwitchedMasterOffCallbacks, fn)
-}
-
-func (n *Pool) AttachIdentitySwitchedSlaveOnCallbacks(fn func()) {
-	n.Self.identitySwitchedSlaveOnCallbacksRWLock.Lock()
-	defer n.Self.identitySwitchedSlaveOnCallbacksRWLock.Unlock()
-	n.Self.identitySwitchedSlaveOnCallbacks = append(n.Self.identitySwitchedSlaveOnCallbacks, fn)
+// switchIdentity 设置身份，并发布 IdentityChangedEvent。
+func (n *Pool) switchIdentity(identity uint8, cause error) {
+	previous := n.Self.Identity
+	n.Self.Identity = identity
+	n.logger().Info("identity switched", "previous", IdentityName(previous), "cause", cause)
+	master := n.Master.Node
+	if identity&IdentityMaster > 0 {
+		master = n.Self.Node
+	}
+	n.Events.Publish(&IdentityChangedEvent{Previous: previous, Current: identity, Cause: cause, Master: copyNodeInfo(master)})
 }
 
-func (n *Pool) AttachIdentitySwitchedSlaveOffCallbacks(fn func()) {
-	n.Self.identitySwitchedSlaveOffCallbacksRWLock.Lock()
-	defer n.Self.identitySwitchedSlaveOffCallbacksRWLock.Unlock()
-	n.Self.identitySwitchedSlaveOffCallbacks = append(n.Self.identitySwitchedSlaveOffCallbacks, fn)
+// SwitchIdentityMasterOn 增加主节点身份。cause 为启动主节点的原因，参见 startMaster。
+func (n *Pool) SwitchIdentityMasterOn(cause error) {
+	n.switchIdentity(n.Self.Identity|IdentityMaster, cause)
 }
 
-func (n *Pool) SwitchIdentityMasterOn() {
-	logPrintln("Identity switched MASTER: ON")
-	n.Self.Identity = n.Self.Identity | IdentityMaster
-	fns := n.Self.identitySwitchedMasterOnCallbacks
-	for _, fn := range fns {
-		fn()
-	}
+// SwitchIdentityMasterOff 去掉主节点身份。cause 为停止主节点的原因。
+func (n *Pool) SwitchIdentityMasterOff(cause error) {
+	n.switchIdentity(n.Self.Identity&^IdentityMaster, cause)
 }
 
-func (n *Pool) SwitchIdentityMasterOff() {
-	logPrintln("Identity switched MASTER: OFF")
-	n.Self.Identity = n.Self.Identity &^ IdentityMaster
-	fns := n.Self.identitySwitchedMasterOffCallbacks
-	for _, fn := range fns {
-		fn()
-	}
+// SwitchIdentitySlaveOn 增加从节点身份。
+func (n *Pool) SwitchIdentitySlaveOn(cause error) {
+	n.switchIdentity(n.Self.Identity|IdentitySlave, cause)
 }
 
-func (n *Pool) SwitchIdentitySlaveOn() {
-	logPrintln("Identity switched SLAVE: ON")
-	n.Self.Identity = n.Self.Identity | IdentitySlave
-	fns := n.Self.identitySwitchedSlaveOnCallbacks
-	for _, fn := range fns {
-		fn()
-	}
-}
-
-func (n *Pool) SwitchIdentitySlaveOff() {
-	logPrintln("Identity switched SLAVE: OFF")
-	n.Self.Identity = n.Self.Identity &^ IdentitySlave
-	fns := n.Self.identitySwitchedSlaveOffCallbacks
-	for _, fn := range fns {
-		fn()
-	}
+// SwitchIdentitySlaveOff 去掉从节点身份。cause 为停止从节点的原因。
+func (n *Pool) SwitchIdentitySlaveOff(cause error) {
+	n.switchIdentity(n.Self.Identity&^IdentitySlave, cause)
 }
 
 func (n *Pool) IsIdentityMaster() bool {
@@ -100,18 +73,18 @@ func (n *Pool) IsIdentityNotDetermined() bool {
 // 2. 查阅数据库。如果查找不到记录，则报 models.ErrNodeSuperiorNotExist。如果数据库出错，则据实报错。
 //
 // 3. 如果存在主节点数据，则尝试检查主节点。参见 CheckMaster。
-func (n *Pool) DiscoverMasterNode(specifySuperior bool) (*NodeInfo.NodeInfo, error) {
-	logPrintln("Discover master...")
+func (n *Pool) DiscoverMasterNode(ctx context.Context, specifySuperior bool) (*NodeInfo.NodeInfo, error) {
+	n.logger().Debug("discovering master")
 	if n.Self.Node.Level == 0 {
 		return nil, ErrNodeLevelAlreadyHighest
 	}
-	node, err := n.Self.Node.GetSuperiorNode(specifySuperior)
+	node, err := n.Self.Node.GetSuperiorNode(n.registry, specifySuperior)
 	if err == nil {
-		logPrint("Discovered master: ", node.Log())
-		_, err = n.CheckMaster(node)
+		n.logger().Info("discovered master", append(peer(node), "turn", node.Turn)...)
+		_, err = n.CheckMaster(ctx, node)
 		return node, err
 	}
-	logPrintln("Error(s) reported when discovering master record: ", err)
+	n.logger().Warn("failed to discover master", "error", err)
 	return nil, err
 }
 
@@ -129,13 +102,13 @@ func (n *Pool) startMaster(ctx context.Context, master *NodeInfo.NodeInfo, cause
 		if master == nil {
 			master = n.Self.Node
 		} else {
-			node, err := master.GetNodeBySocket()
+			node, err := master.GetNodeBySocket(n.registry)
 			// logPrintln(node, err)
 			if err != gorm.ErrRecordNotFound {
 				// 若发现其它相同套接字节点，则应尝试通信。如果能获取节点状态，则应退出。
-				err := n.CheckNodeStatus(node)
+				err := n.CheckNodeStatus(ctx, node)
 				if err != nil {
-					logPrintln(err)
+					n.logger().Warn("node with the same socket exists", append(peer(node), "error", err)...)
 					return ErrNodeMasterExisted
 				}
 			}
@@ -163,13 +136,13 @@ func (n *Pool) startMaster(ctx context.Context, master *NodeInfo.NodeInfo, cause
 		return cause
 	} else if errors.Is(cause, ErrNodeExistedMasterWithdrawn) {
 		// TODO: 刷新已存在节点，排除自己。
-		nodes, err := master.GetAllSlaveNodes()
+		nodes, err := master.GetAllSlaveNodes(n.registry)
 		if err != nil {
 			return err
 		}
 		n.Slaves.Refresh(nodes)
 	} else if cause != nil { // 此判断必须放在最后作为兜底。
-		logPrintln(cause)
+		n.logger().Error("failed to start master", "error", cause)
 		return cause
 	}
 	if master == nil {
@@ -186,10 +159,11 @@ func (n *Pool) startMaster(ctx context.Context, master *NodeInfo.NodeInfo, cause
 	}
 	// 主节点身份不变。
 	// n.Master.Node = nil
-	n.SwitchIdentityMasterOn()
+	n.SwitchIdentityMasterOn(cause)
+	n.recoverTasks(ctx)
 	if isMasterFresh {
-		if _, err := n.Self.Node.LogReportFreshMasterJoined(); err != nil {
-			logPrintln(err)
+		if _, err := n.Self.Node.LogReportFreshMasterJoined(n.registry); err != nil {
+			n.logger().Error("failed to log master joined", "error", err)
 		}
 	}
 	n.StartMasterWorker(ctx)
@@ -220,15 +194,15 @@ func (n *Pool) startSlave(ctx context.Context, master *NodeInfo.NodeInfo, cause
 		// 主节点已存在，直接退出。
 		return cause
 	} else if cause != nil {
-		logPrintln(cause)
+		n.logger().Error("failed to start slave", "error", cause)
 		return cause
 	}
-	// 未出错，则接受主节点，并通知其将自己加入。
-	n.SwitchIdentitySlaveOn()
+	// 未出错，则接受主节点，并通知其将自己加入。先接受主节点，身份变化事件才能带上主节点。
 	n.AcceptMaster(master)
-	_, cause = n.NotifyMasterToAddSelfAsSlave()
+	n.SwitchIdentitySlaveOn(cause)
+	_, cause = n.NotifyMasterToAddSelfAsSlave(ctx)
 	if cause != nil {
-		logFatalln(cause)
+		n.logger().Fatal("failed to join master", append(peer(master), "error", cause)...)
 	}
 
 	n.StartSlaveWorker(ctx)
@@ -236,51 +210,62 @@ func (n *Pool) startSlave(ctx context.Context, master *NodeInfo.NodeInfo, cause
 	return nil
 }
 
-// stopMaster 停止主节点。
-func (n *Pool) stopMaster(cause error) error {
-	logPrintln("Worker Master stopping, due to", cause)
+// stopMaster 停止主节点。按接替策略选择接替者，参见 GetSuccessionCandidate。
+func (n *Pool) stopMaster(ctx context.Context, cause error) error {
+	return n.stopMasterTo(ctx, cause, n.GetSuccessionCandidate())
+}
+
+// stopMasterTo 停止主节点，并向 candidateID 交接。candidateID 为 0 表示没有候选接替节点。
+func (n *Pool) stopMasterTo(ctx context.Context, cause error, candidateID uint64) (err error) {
+	ctx, span := n.startSpan(ctx, "StopMaster", causeAttribute(cause), attributePeerID.Int64(int64(candidateID)))
+	defer func() { tracing.End(span, err) }()
+	n.logger().Info("master worker stopping", "cause", cause, "candidate_id", candidateID)
 	n.StopMasterWorker(cause)
-	n.SwitchIdentityMasterOff()
+	n.SwitchIdentityMasterOff(cause)
 	// 通知所有从节点停机或选择一个从节点并通知其接替自己。
 	// 通知从节点接替以及其它从节点切换主节点
-	candidateID := n.Slaves.GetTurnCandidate()
 	if errors.Is(cause, ErrNodeMasterRecordIsNotValid) {
 		// 数据不一致直接停机，不通知交接和切换。
 		// n.Master.Clear()
 	} else if candidateID == 0 { // 没有候选接替节点，删除自己。
-		_, err := n.Self.Node.RemoveSelf()
+		_, err := n.Self.Node.RemoveSelf(n.registry)
 		if err != nil {
-			logPrintln("Failed to stop self:", err)
+			n.logger().Error("failed to remove self", "error", err)
 		}
 	} else {
-		err := n.Handover(candidateID)
+		n.Events.Publish(&HandoverStartedEvent{CandidateID: candidateID, Cause: cause})
+		err := n.Handover(ctx, candidateID)
+		n.Events.Publish(&HandoverFinishedEvent{CandidateID: candidateID, Err: err})
 		if err != nil {
-			logPrintln(err)
+			n.logger().Error("failed to hand over", "peer_id", candidateID, "error", err)
 			return err
 		}
-		if _, err := n.NotifyAllSlavesToSwitchSuperior(candidateID); err != nil {
-			logPrintln(err)
+		n.Topology.Append(TopologyEventHandover, n.Slaves.Get(candidateID))
+		if _, err := n.NotifyAllSlavesToSwitchSuperior(ctx, candidateID); err != nil {
+			n.logger().Error("failed to notify slaves to switch superior", "error", err)
 		}
-		if _, err := n.NotifySlaveToTakeoverSelf(candidateID); err != nil {
-			logPrintln(err)
+		if _, err := n.NotifySlaveToTakeoverSelf(ctx, candidateID); err != nil {
+			n.logger().Error("failed to notify slave to take over", "peer_id", candidateID, "error", err)
 		}
 	}
-	if _, err := n.Self.Node.LogReportExistedMasterWithdrawn(); err != nil {
-		logPrintln(err)
+	if _, err := n.Self.Node.LogReportExistedMasterWithdrawn(n.registry); err != nil {
+		n.logger().Error("failed to log master withdrawn", "error", err)
 	}
 	return nil
 }
 
 // stopSlave 停止从节点。
-func (n *Pool) stopSlave(cause error) error {
-	logPrintln("Worker Slave stopping, due to", cause)
+func (n *Pool) stopSlave(ctx context.Context, cause error) (err error) {
+	ctx, span := n.startSpan(ctx, "StopSlave", causeAttribute(cause))
+	defer func() { tracing.End(span, err) }()
+	n.logger().Info("slave worker stopping", "cause", cause)
 	n.StopSlaveWorker(cause)
-	n.SwitchIdentitySlaveOff()
+	n.SwitchIdentitySlaveOff(cause)
 	// 通知主节点自己停机。
 	if errors.Is(cause, ErrNodeTakeoverMaster) { // 什么也不做。
 	} else { // 其它原因停机需要通知主节点删除自己。忽略错误。
-		if _, err := n.NotifyMasterToRemoveSelf(); err != nil {
-			logPrintln(err)
+		if _, err := n.NotifyMasterToRemoveSelf(ctx); err != nil {
+			n.logger().Error("failed to notify master to remove self", append(peer(n.Master.Node), "error", err)...)
 		}
 	}
 	return nil
@@ -296,16 +281,14 @@ func (n *Pool) stopSlave(cause error) error {
 // 1. 端口能够成功绑定，否则会产生不可预知的后果。
 // 2. n.Self 已准备好。
 func (n *Pool) Start(ctx context.Context, identity int) error {
-	master, err := n.DiscoverMasterNode(false)
+	master, err := n.DiscoverMasterNode(ctx, false)
 	if identity == IdentityMaster { // 指定为 Master。
 		// 发现主节点。
 		// 如果主节点已存在，则尝试连接。
 		// 如果能正常连接，则报异常并退出。
 		// 如果不能正常连接，则检查数据库存活。
 		// 如果存活，则退出。如果并不存活。则尝试接替。
-		if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-			logPrintln(master, err)
-		}
+		n.logger().Debug("discovered master for start", append(peer(master), "identity_expected", identity, "error", err)...)
 		if err == nil {
 			// 发现主节点，并工作正常。直接退出。
 			return ErrNodeMasterExisted
@@ -313,9 +296,7 @@ func (n *Pool) Start(ctx context.Context, identity int) error {
 		return n.startMaster(ctx, master, err)
 	} else if identity == IdentitySlave {
 		// 指定为 Slave，失败则退出。
-		if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-			logPrintln(master, err)
-		}
+		n.logger().Debug("discovered master for start", append(peer(master), "identity_expected", identity, "error", err)...)
 		// 未出错时启动从节点模式。
 		return n.startSlave(ctx, master, err)
 	} else if identity == IdentityAll {
@@ -325,9 +306,7 @@ func (n *Pool) Start(ctx context.Context, identity int) error {
 		//        接替流程：删除之前的异常记录，并将其移入 node_info_legacy；再转入条件2.
 		//   1.2. 若网络成功，但返回错误或拒绝，报告主节点问题后退出。
 		// 2. 若未发现主节点，则自己设为主。
-		if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-			logPrintln(master, err)
-		}
+		n.logger().Debug("discovered master for start", append(peer(master), "identity_expected", identity, "error", err)...)
 
 		if errors.Is(err, ErrNodeLevelAlreadyHighest) {
 			// 已经是最高级，不存在上级主节点。认为自己是主节点。
@@ -349,15 +328,15 @@ func (n *Pool) Start(ctx context.Context, identity int) error {
 			return err
 		} else if errors.Is(err, ErrNodeRequestResponseError) || errors.Is(err, ErrNodeMasterValidButRefused) {
 			// 请求响应失败，将自己作为主。将异常节点删除。
-			if _, err := master.RemoveSelf(); err != nil {
-				logPrintln(err)
+			if _, err := master.RemoveSelf(n.registry); err != nil {
+				n.logger().Error("failed to remove unreachable master", append(peer(master), "error", err)...)
 			}
 			return n.startMaster(ctx, n.Self.Node, ErrNodeRequestResponseError)
 		} else if errors.Is(err, ErrNodeMasterExisted) {
 			// 主节点已存在，设置自己为从节点。
 			return n.startSlave(ctx, master, nil)
 		} else if err != nil {
-			logPrintln(err)
+			n.logger().Error("failed to start", "error", err)
 			return err
 		}
 		// 未出错时启动主节点模式。
@@ -366,6 +345,31 @@ func (n *Pool) Start(ctx context.Context, identity int) error {
 	return nil
 }
 
+var ErrNodeIsNotMaster = errors.New("current node is not master")
+var ErrNodeSteppedDown = errors.New("master stepped down")
+
+// StepDown 当前节点（主节点）主动交出主节点身份。
+//
+// candidateID 为指定的接替者，必须为支持接替通知（RequestSlaveNotify）的从节点；为 0 时按接替策略选择，参见 GetSuccessionCandidate。
+//
+// 1. 若当前节点不是主节点，则报 ErrNodeIsNotMaster。
+//
+// 2. 若指定的接替者无效或没有候选接替节点，则报 ErrNodeSlaveInvalid，且不停止主节点。
+func (n *Pool) StepDown(ctx context.Context, candidateID uint64) (err error) {
+	ctx, span := n.startSpan(ctx, "StepDown")
+	defer func() { tracing.End(span, err) }()
+	if !n.IsIdentityMaster() {
+		return ErrNodeIsNotMaster
+	}
+	if candidateID == 0 {
+		candidateID = n.GetSuccessionCandidate()
+	}
+	if candidateID == 0 || n.Slaves.Get(candidateID) == nil || !n.Slaves.Supports(candidateID, RequestSlaveNotify) {
+		return ErrNodeSlaveInvalid
+	}
+	return n.stopMasterTo(ctx, ErrNodeSteppedDown, candidateID)
+}
+
 // Stop 退出流程。
 //
 // ctx 启动时的上下文。
@@ -375,27 +379,34 @@ func (n *Pool) Start(ctx context.Context, identity int) error {
 // 1. 若自己是 Master，则通知所有从节点停机或选择一个从节点并通知其接替自己。
 // 2. 若自己是 Slave，则通知主节点自己停机。
 // 3. 若身份未定，不做任何动作。
-func (n *Pool) Stop(cause error) {
+//
+// 停止后释放当前节点所有的分片，参见 Owns。
+func (n *Pool) Stop(ctx context.Context, cause error) {
 	if n.IsIdentityNotDetermined() {
 		return
 	}
 	if n.IsIdentityMaster() {
-		err := n.stopMaster(cause)
+		err := n.stopMaster(ctx, cause)
 		if err != nil {
-			logPrintln(err)
+			n.logger().Error("failed to stop master", "error", err)
 		}
 	}
 	if n.IsIdentitySlave() {
-		err := n.stopSlave(cause)
+		err := n.stopSlave(ctx, cause)
 		if err != nil {
-			logPrintln(err)
+			n.logger().Error("failed to stop slave", "error", err)
 		}
 	}
+	n.shardsWorking.Lock()
+	defer n.shardsWorking.Unlock()
+	n.releaseShards(ctx, cause)
 }
 
 // TrySupersede 尝试数据库更新。若更新成功，则表示自己已经成功抢占为主节点。若报任何异常，均表示没有抢占成功，需要重新查找主节点。
-func (n *Pool) TrySupersede() error {
-	err := n.Self.Node.SupersedeMasterNode(n.Master.Node)
+func (n *Pool) TrySupersede(ctx context.Context) (err error) {
+	ctx, span := n.startSpan(ctx, "TrySupersede")
+	defer func() { tracing.End(span, err) }()
+	err = n.Self.Node.SupersedeMasterNode(ctx, n.registry, n.Master.Node)
 	if err != nil {
 		return err
 	}
@@ -403,41 +414,57 @@ func (n *Pool) TrySupersede() error {
 }
 
 // Supersede 从节点接替主节点。
-func (n *Pool) Supersede(master *base.RegisteredNodeInfo) {
+func (n *Pool) Supersede(ctx context.Context, master *base.RegisteredNodeInfo) {
 	if master == nil {
 		return
 	}
+	ctx, span := n.startSpan(ctx, "Supersede", attributePeerID.Int64(int64(master.ID)))
+	var err error
+	defer func() { tracing.End(span, err) }()
 	// 此时已删除，无法返回节点，只能相信传入的 master。
-	real, err := NodeInfo.GetNodeInfo(master.ID)
+	real, err := NodeInfo.GetNodeInfo(n.registry, master.ID)
 	if err != gorm.ErrRecordNotFound {
 		// 如果还存在，则不能取代。
-		logPrintln(real.Log())
+		n.logger().Warn("master still registered, not superseding", peer(real)...)
+		if err == nil {
+			err = ErrNodeMasterExisted
+		}
 		return
 	}
 	// 刷新自己，已经是 master 。
-	if err := n.Self.Node.Refresh(); err != nil {
-		logPrintln(err)
+	if err = n.Self.Node.Refresh(n.registry); err != nil {
+		n.logger().Error("failed to refresh self", "error", err)
 		return
 	}
 	// 刷新成功，停止从节点身份；清除主节点信息。
-	err = n.stopSlave(ErrNodeTakeoverMaster)
+	err = n.stopSlave(ctx, ErrNodeTakeoverMaster)
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to stop slave", "error", err)
 		return
 	}
+	previous := copyNodeInfo(n.Master.Node)
 	n.Master.Clear()
+	n.Events.Publish(&MasterChangedEvent{Previous: previous})
+	// 原主节点失效，计入其所在可用区。
+	n.ZoneLosses.Record(master.Zone, time.Now())
 	// 启动主节点身份。
 	err = n.startMaster(context.Background(), n.Self.Node, ErrNodeExistedMasterWithdrawn)
 	if err != nil {
-		logPrintln(err)
+		n.logger().Error("failed to start master", "error", err)
 		return
 	}
+	n.Topology.Append(TopologyEventSuperseded, n.Self.Node)
+	n.Events.Publish(&SupersededEvent{Previous: master, Master: *n.Self.Node})
+	// 原主节点不会再报告其名下尚未结束的任务，收回后重新分配。
+	n.releaseTasks(ctx, master.ID)
 	// 此时从节点为空，需要刷新。
 	n.RefreshSlavesNodeInfo()
 }
 
 // Handover 向 candidate 交接主节点身份。
-func (n *Pool) Handover(candidate uint64) error {
+func (n *Pool) Handover(ctx context.Context, candidate uint64) (err error) {
+	ctx, span := n.startSpan(ctx, "Handover", attributePeerID.Int64(int64(candidate)))
+	defer func() { tracing.End(span, err) }()
 	//if n.Master.Node == nil {
 	//	return ErrNodeMasterInvalid
 	//}
@@ -448,9 +475,9 @@ func (n *Pool) Handover(candidate uint64) error {
 	}
 	//logPrintln("Handover: database preparing...")
 	// 若交接主节点报错，则认为已有其它节点。
-	err := n.Self.Node.HandoverMasterNode(node)
+	err = n.Self.Node.HandoverMasterNode(ctx, n.registry, node)
 	if err != nil {
-		logPrintln("Handover error(s) reported:", err)
+		n.logger().Error("failed to hand over in registry", "peer_id", candidate, "error", err)
 		return err
 	}
 	//info, err := NodeInfo.GetNodeInfo(candidate)
@@ -465,15 +492,19 @@ func (n *Pool) Handover(candidate uint64) error {
 }
 
 // SwitchSuperior 切换主节点。master 为新的主节点登记信息。
-func (n *Pool) SwitchSuperior(master *base.RegisteredNodeInfo) error {
+func (n *Pool) SwitchSuperior(ctx context.Context, master *base.RegisteredNodeInfo) (err error) {
+	ctx, span := n.startSpan(ctx, "SwitchSuperior", attributePeerID.Int64(int64(master.ID)))
+	defer func() { tracing.End(span, err) }()
 	// 更新 master 节点：
-	node, err := NodeInfo.GetNodeInfo(master.ID)
+	node, err := NodeInfo.GetNodeInfo(n.registry, master.ID)
 	if err != nil {
 		return ErrNodeMasterInvalid
 	}
+	// 接替由新的主节点自己记录，此处只记录切换，参见 AcceptMaster 发布的 MasterChangedEvent。
 	n.AcceptMaster(node)
+	n.Topology.Append(TopologyEventSwitched, node)
 	// 检查 master 节点。
-	if _, err := n.CheckMaster(n.Master.Node); err != nil {
+	if _, err := n.CheckMaster(ctx, n.Master.Node); err != nil {
 		return err
 	}
 	return nil
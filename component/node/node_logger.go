@@ -1,19 +1,41 @@
 package node
 
-import "log"
+import (
+	"github.com/rhosocial/go-rush-producer/component/logging"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+)
 
-var logPrintln = func(v ...any) {
-	log.Println(v...)
+// IdentityName 身份名称，用于日志字段。
+func IdentityName(identity uint8) string {
+	switch identity {
+	case IdentityNotDetermined:
+		return "not_determined"
+	case IdentityMaster:
+		return "master"
+	case IdentitySlave:
+		return "slave"
+	case IdentityAll:
+		return "master_slave"
+	}
+	return "unknown"
 }
 
-var logPrintf = func(format string, v ...any) {
-	log.Printf(format, v...)
+// logger 当前节点池的日志，附带本节点ID（node_id）和身份（identity）字段。未注入日志时使用 logging.Default。
+func (n *Pool) logger() *logging.Logger {
+	logger := n.Logger
+	if logger == nil {
+		logger = logging.Default
+	}
+	if n.Self.Node == nil {
+		return logger.With("identity", IdentityName(n.Self.Identity))
+	}
+	return logger.With("node_id", n.Self.Node.ID, "identity", IdentityName(n.Self.Identity))
 }
 
-var logPrint = func(v ...any) {
-	log.Print(v...)
-}
-
-var logFatalln = func(v ...any) {
-	log.Fatalln(v...)
+// peer 对端节点字段：peer_id 和 peer。
+func peer(node *NodeInfo.NodeInfo) []any {
+	if node == nil {
+		return []any{"peer_id", 0}
+	}
+	return []any{"peer_id", node.ID, "peer", node.Socket()}
 }
@@ -4,17 +4,25 @@ import (
 	"context"
 	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
 )
 
 // PoolMaster 节点池主节点身份。
 type PoolMaster struct {
-	Node                   *NodeInfo.NodeInfo      // 节点
-	WorkerCancelFunc       context.CancelCauseFunc // 主节点身份协程取消句柄。
-	WorkerCancelFuncRWLock sync.RWMutex            // 操作主节点身份协程取消句柄锁
-	Retry                  uint8                   // 重试次数
-	RetryRWLock            sync.RWMutex            // 操作重试次数锁。
+	Node                   *NodeInfo.NodeInfo                    // 节点
+	WorkerCancelFunc       context.CancelCauseFunc               // 主节点身份协程取消句柄。
+	WorkerCancelFuncRWLock sync.RWMutex                          // 操作主节点身份协程取消句柄锁
+	Retry                  uint8                                 // 重试次数
+	RetryRWLock            sync.RWMutex                          // 操作重试次数锁。
+	Protocol               *Protocol                             // 主节点报告的协议版本和能力集。须通过 SetProtocol 和 GetProtocol 访问。
+	ProtocolRWLock         sync.RWMutex                          // 操作协议锁。
+	Revision               uint64                                // 主节点报告的从节点集合版本。
+	Topology               *RequestMasterStatusResponseExtension // 主节点最近一次报告的主从节点信息。
+
+	workerTickedAt int64 // 主节点身份协程最近一轮开始的时间（UnixNano）。原子操作。
 }
 
 // IsWorking 主节点身份协程是否在工作中。
@@ -22,16 +30,68 @@ func (pm *PoolMaster) IsWorking() bool {
 	return pm.WorkerCancelFunc != nil
 }
 
+// Tick 记录主节点身份协程开始新一轮的时间，参见 Pool.Liveness。
+func (pm *PoolMaster) Tick(at time.Time) {
+	atomic.StoreInt64(&pm.workerTickedAt, at.UnixNano())
+}
+
+// TickedAt 主节点身份协程最近一轮开始的时间。从未记录时为零值。
+func (pm *PoolMaster) TickedAt() time.Time {
+	if at := atomic.LoadInt64(&pm.workerTickedAt); at > 0 {
+		return time.Unix(0, at)
+	}
+	return time.Time{}
+}
+
 // Accept 接受新的主节点。
 func (pm *PoolMaster) Accept(master *NodeInfo.NodeInfo) {
 	pm.Clear()
 	pm.Node = master
 }
 
-// Clear 清空节点和重试次数。
+// Clear 清空节点、重试次数和协议。
 func (pm *PoolMaster) Clear() {
 	pm.Node = nil
-	pm.Retry = 0
+	pm.RetryClear()
+	pm.SetProtocol(nil)
+	pm.Revision = 0
+	pm.Topology = nil
+}
+
+// SetProtocol 记录主节点报告的协议版本和能力集。
+func (pm *PoolMaster) SetProtocol(protocol *Protocol) {
+	pm.ProtocolRWLock.Lock()
+	defer pm.ProtocolRWLock.Unlock()
+	pm.Protocol = protocol
+}
+
+// GetProtocol 获取主节点报告的协议版本和能力集。若尚未报告，则返回 nil。
+func (pm *PoolMaster) GetProtocol() *Protocol {
+	pm.ProtocolRWLock.RLock()
+	defer pm.ProtocolRWLock.RUnlock()
+	return pm.Protocol
+}
+
+// Reset 清空主节点信息和身份协程最近一轮开始的时间。身份协程须已停止，取消句柄保持不变。
+func (pm *PoolMaster) Reset() {
+	pm.Clear()
+	atomic.StoreInt64(&pm.workerTickedAt, 0)
+}
+
+// Report 记录主节点报告的从节点集合版本和主从节点信息。topology 为空表示自上次报告以来没有变化。
+func (pm *PoolMaster) Report(revision uint64, topology *RequestMasterStatusResponseExtension) {
+	pm.Revision = revision
+	if topology != nil {
+		pm.Topology = topology
+	}
+}
+
+// GetSuccession 获取主节点最近一次报告的接替次序。尚未报告时为空。
+func (pm *PoolMaster) GetSuccession() []uint64 {
+	if pm.Topology == nil {
+		return nil
+	}
+	return pm.Topology.Succession
 }
 
 // RetryUp 尝试次数递增。
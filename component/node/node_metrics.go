@@ -0,0 +1,81 @@
+package node
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+)
+
+var (
+	metricIdentityDesc = prometheus.NewDesc(metrics.Namespace+"_identity",
+		"Current identity of this node: 0 not determined, 1 master, 2 slave.", nil, nil)
+	metricSlavesDesc = prometheus.NewDesc(metrics.Namespace+"_slaves",
+		"Number of slaves known to this node as master.", nil, nil)
+	metricSlaveRetriesDesc = prometheus.NewDesc(metrics.Namespace+"_slave_retries",
+		"Retry count of each slave known to this node as master.", []string{"slave_id"}, nil)
+	metricMasterRetriesDesc = prometheus.NewDesc(metrics.Namespace+"_master_retries",
+		"Retry count of the master known to this node as slave.", nil, nil)
+	metricShardsOwnedDesc = prometheus.NewDesc(metrics.Namespace+"_shards_owned",
+		"Number of shards owned by this node.", nil, nil)
+)
+
+// poolCollector 在采集时读取节点池的当前状态，输出身份、从节点数、重试次数和所有的分片数。
+type poolCollector struct {
+	nodes *Pool
+}
+
+// Collector 当前节点池的运行指标采集器，须注册后才会输出，例如 metrics.Registry.MustRegister(pool.Collector())。
+// 同一注册表只能注册一个节点池的采集器。
+func (n *Pool) Collector() prometheus.Collector {
+	return poolCollector{nodes: n}
+}
+
+// Describe 实现 prometheus.Collector。
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricIdentityDesc
+	ch <- metricSlavesDesc
+	ch <- metricSlaveRetriesDesc
+	ch <- metricMasterRetriesDesc
+	ch <- metricShardsOwnedDesc
+}
+
+// Collect 实现 prometheus.Collector。节点池为空时不输出。
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	nodes := c.nodes
+	if nodes == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(metricIdentityDesc, prometheus.GaugeValue, float64(nodes.Self.Identity))
+
+	nodes.Slaves.NodesRWLock.RLock()
+	ch <- prometheus.MustNewConstMetric(metricSlavesDesc, prometheus.GaugeValue, float64(len(nodes.Slaves.Nodes)))
+	for id, retry := range nodes.Slaves.NodesRetry {
+		ch <- prometheus.MustNewConstMetric(metricSlaveRetriesDesc, prometheus.GaugeValue, float64(retry), strconv.FormatUint(id, 10))
+	}
+	nodes.Slaves.NodesRWLock.RUnlock()
+
+	nodes.Master.RetryRWLock.RLock()
+	ch <- prometheus.MustNewConstMetric(metricMasterRetriesDesc, prometheus.GaugeValue, float64(nodes.Master.Retry))
+	nodes.Master.RetryRWLock.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(metricShardsOwnedDesc, prometheus.GaugeValue, float64(len(nodes.OwnedShards())))
+}
+
+// observeTopologyEvent 按拓扑事件类型递增对应的计数器。
+func observeTopologyEvent(eventType string) {
+	switch eventType {
+	case TopologyEventJoined:
+		metrics.SlaveJoins.Inc()
+	case TopologyEventWithdrawn:
+		metrics.SlaveWithdrawals.Inc()
+	case TopologyEventRemoved:
+		metrics.SlaveRemovals.Inc()
+	case TopologyEventInactive:
+		metrics.SlaveInactiveDetections.Inc()
+	case TopologyEventHandover:
+		metrics.Handovers.Inc()
+	case TopologyEventSuperseded:
+		metrics.Supersedes.Inc()
+	}
+}
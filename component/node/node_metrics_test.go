@@ -0,0 +1,45 @@
+package node
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveTopologyEvent(t *testing.T) {
+	journal := NewTopologyJournal()
+	joins := testutil.ToFloat64(metrics.SlaveJoins)
+	supersedes := testutil.ToFloat64(metrics.Supersedes)
+	journal.Append(TopologyEventJoined, &NodeInfo.NodeInfo{ID: 2})
+	journal.Append(TopologyEventSuperseded, &NodeInfo.NodeInfo{ID: 2})
+	// 从节点切换主节点不计为接替。
+	journal.Append(TopologyEventSwitched, &NodeInfo.NodeInfo{ID: 3})
+	journal.Append(TopologyEventModified, &NodeInfo.NodeInfo{ID: 2})
+	assert.Equal(t, joins+1, testutil.ToFloat64(metrics.SlaveJoins))
+	assert.Equal(t, supersedes+1, testutil.ToFloat64(metrics.Supersedes))
+}
+
+func TestPoolCollector(t *testing.T) {
+	t.Run("no pool", func(t *testing.T) {
+		assert.Equal(t, 0, testutil.CollectAndCount(poolCollector{}))
+	})
+	t.Run("master with slave", func(t *testing.T) {
+		pool := newHeartbeatTestPool()
+		pool.Slaves.RetryUp(2)
+		expected := `
+# HELP rush_producer_slave_retries Retry count of each slave known to this node as master.
+# TYPE rush_producer_slave_retries gauge
+rush_producer_slave_retries{slave_id="2"} 1
+# HELP rush_producer_slaves Number of slaves known to this node as master.
+# TYPE rush_producer_slaves gauge
+rush_producer_slaves 1
+`
+		assert.Nil(t, testutil.CollectAndCompare(pool.Collector(), strings.NewReader(expected),
+			"rush_producer_slaves", "rush_producer_slave_retries"))
+		assert.Equal(t, 5, testutil.CollectAndCount(pool.Collector()))
+	})
+}
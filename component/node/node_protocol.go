@@ -0,0 +1,108 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ProtocolVersion        = 1 // 当前节点间通信协议版本。
+	ProtocolVersionMinimum = 1 // 可兼容的最低协议版本。低于此版本的节点将被拒绝。
+
+	RequestHeaderXNodeProtocolVersionKey = "X-Node-Protocol-Version"
+	RequestHeaderXNodeCapabilitiesKey    = "X-Node-Capabilities"
+)
+
+// CapabilityShardSync 同步分片归属的能力。分片经由节点登记数据库同步，不对应请求；不支持的从节点不会成为分片的目标节点。
+const CapabilityShardSync = 0x00030001
+
+// Capabilities 当前节点支持的请求和能力。每一项均为 Request* 或 Capability* 常量。
+var Capabilities = []uint32{
+	RequestStatus,
+	RequestWatch,
+	RequestMasterStatus,
+	RequestMasterHeartbeat,
+	RequestMasterNotifyAdd,
+	RequestMasterNotifyModify,
+	RequestMasterNotifyDelete,
+	RequestMasterTaskReport,
+	RequestSlaveStatus,
+	RequestSlaveNotify,
+	CapabilityShardSync,
+}
+
+var ErrNodeProtocolIncompatible = errors.New("node protocol version incompatible")
+
+// Protocol 节点间通信协议版本和能力集。
+type Protocol struct {
+	Version      uint32   `json:"version"`      // 协议版本。未携带版本信息的节点视为 0。
+	Capabilities []uint32 `json:"capabilities"` // 支持的请求，参见 Capabilities。
+}
+
+// NewProtocol 取得当前节点的协议版本和能力集。
+func NewProtocol() *Protocol {
+	capabilities := make([]uint32, len(Capabilities))
+	copy(capabilities, Capabilities)
+	return &Protocol{
+		Version:      ProtocolVersion,
+		Capabilities: capabilities,
+	}
+}
+
+// Protocol 取得节点池的协议版本和能力集。设置了任务执行者时，另支持执行任务（RequestSlaveTask）。
+func (n *Pool) Protocol() *Protocol {
+	protocol := NewProtocol()
+	if n.taskHandler != nil {
+		protocol.Capabilities = append(protocol.Capabilities, RequestSlaveTask)
+	}
+	return protocol
+}
+
+// ParseProtocol 从请求头解析对方的协议版本和能力集。
+// 未携带或无法解析的版本视为 0；无法解析的能力项将被忽略。
+func ParseProtocol(header http.Header) *Protocol {
+	protocol := Protocol{}
+	if version, err := strconv.ParseUint(header.Get(RequestHeaderXNodeProtocolVersionKey), 10, 32); err == nil {
+		protocol.Version = uint32(version)
+	}
+	for _, value := range strings.Split(header.Get(RequestHeaderXNodeCapabilitiesKey), ",") {
+		if capability, err := strconv.ParseUint(strings.TrimSpace(value), 0, 32); err == nil {
+			protocol.Capabilities = append(protocol.Capabilities, uint32(capability))
+		}
+	}
+	return &protocol
+}
+
+// Apply 将协议版本和能力集写入请求头。
+func (p *Protocol) Apply(header http.Header) {
+	capabilities := make([]string, len(p.Capabilities))
+	for i, capability := range p.Capabilities {
+		capabilities[i] = fmt.Sprintf("0x%08x", capability)
+	}
+	header.Set(RequestHeaderXNodeProtocolVersionKey, strconv.FormatUint(uint64(p.Version), 10))
+	header.Set(RequestHeaderXNodeCapabilitiesKey, strings.Join(capabilities, ","))
+}
+
+// Supports 判断是否支持指定请求。未知协议（nil）视为支持，以免误伤尚未报告协议的节点。
+func (p *Protocol) Supports(request uint32) bool {
+	if p == nil {
+		return true
+	}
+	for _, capability := range p.Capabilities {
+		if capability == request {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCompatible 判断对方协议版本是否可与当前节点兼容。若不兼容，则报 ErrNodeProtocolIncompatible。
+func (p *Protocol) IsCompatible() error {
+	if p == nil || p.Version < ProtocolVersionMinimum {
+		return ErrNodeProtocolIncompatible
+	}
+	return nil
+}
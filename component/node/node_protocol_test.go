@@ -0,0 +1,69 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	Task "github.com/rhosocial/go-rush-producer/models/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocol_Apply(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		header := make(http.Header)
+		NewProtocol().Apply(header)
+		protocol := ParseProtocol(header)
+		assert.Equal(t, uint32(ProtocolVersion), protocol.Version)
+		assert.Equal(t, Capabilities, protocol.Capabilities)
+	})
+	t.Run("missing headers", func(t *testing.T) {
+		protocol := ParseProtocol(make(http.Header))
+		assert.Equal(t, uint32(0), protocol.Version)
+		assert.Empty(t, protocol.Capabilities)
+		assert.ErrorIs(t, protocol.IsCompatible(), ErrNodeProtocolIncompatible)
+	})
+	t.Run("malformed capabilities", func(t *testing.T) {
+		header := make(http.Header)
+		header.Set(RequestHeaderXNodeProtocolVersionKey, "1")
+		header.Set(RequestHeaderXNodeCapabilitiesKey, "0x00010001, foo,0x00020011")
+		protocol := ParseProtocol(header)
+		assert.Nil(t, protocol.IsCompatible())
+		assert.Equal(t, []uint32{RequestMasterStatus, RequestSlaveNotify}, protocol.Capabilities)
+	})
+}
+
+func TestProtocol_Supports(t *testing.T) {
+	t.Run("nil protocol", func(t *testing.T) {
+		var protocol *Protocol
+		assert.True(t, protocol.Supports(RequestSlaveNotify))
+	})
+	t.Run("supported and unsupported", func(t *testing.T) {
+		protocol := Protocol{Version: 1, Capabilities: []uint32{RequestStatus}}
+		assert.True(t, protocol.Supports(RequestStatus))
+		assert.False(t, protocol.Supports(RequestSlaveNotify))
+	})
+}
+
+func TestPoolMaster_Protocol(t *testing.T) {
+	master := PoolMaster{}
+	assert.Nil(t, master.GetProtocol())
+	master.SetProtocol(NewProtocol())
+	assert.True(t, master.GetProtocol().Supports(RequestMasterStatus))
+	master.Clear()
+	assert.Nil(t, master.GetProtocol())
+}
+
+func TestPool_Protocol(t *testing.T) {
+	t.Run("without task handler", func(t *testing.T) {
+		pool := Pool{}
+		assert.False(t, pool.Protocol().Supports(RequestSlaveTask))
+		assert.True(t, pool.Protocol().Supports(RequestMasterTaskReport))
+	})
+	t.Run("with task handler", func(t *testing.T) {
+		pool := Pool{taskHandler: TaskHandlerFunc(func(ctx context.Context, task *Task.Task) (string, error) { return "", nil })}
+		assert.True(t, pool.Protocol().Supports(RequestSlaveTask))
+		// 不影响全局能力集。
+		assert.False(t, NewProtocol().Supports(RequestSlaveTask))
+	})
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/models"
+)
+
+// Reload 重新加载节点池的配置，并使其生效，参见 component.Env.Reload 和 ApplyEnvReload。
+// load 为空时从配置记录的来源重新加载，参见 component.NewEnv。各节点池只重新加载自己的配置。
+//
+// 若新配置无效，则报错，当前配置保持不变。须重启才能生效的变更会被输出。
+func (n *Pool) Reload(ctx context.Context, load component.EnvLoader) (*component.EnvReloadResult, error) {
+	result, err := n.env.Reload(load)
+	if err != nil {
+		return nil, err
+	}
+	n.env.ApplyLogging(n.logger())
+	if err := n.ApplyEnvReload(ctx, result); err != nil {
+		n.logger().Error("failed to apply reloaded configuration", "error", err)
+	}
+	n.logger().Info("configuration reloaded", "applied", strings.Join(result.Applied, ","), "restart_required", strings.Join(result.RestartRequired, ","))
+	return result, nil
+}
+
+// ApplyEnvReload 使重新加载的配置在当前节点池生效，参见 component.Env.Reload。
+//
+// 1. 时间间隔、重试阈值和任务分配配置由工作协程在下一轮读取，无需处理；可用区失效统计的时间窗口立即更新。
+//
+// 2. 若标签已变更，主节点直接修改自己的记录；从节点通知主节点修改自己，参见 NotifyMasterToModifySelf。
+// 通知无法清空标签，此时该项移入 RestartRequired，待重新加入时生效。
+//
+// 若修改记录失败，则报错，本地配置已生效。
+func (n *Pool) ApplyEnvReload(ctx context.Context, result *component.EnvReloadResult) error {
+	if result.IsApplied("Failover") {
+		n.ZoneLosses.SetWindow(time.Duration(*n.env.GetFailover().LossWindow) * time.Second)
+	}
+	if !result.IsApplied("Node.Labels") {
+		return nil
+	}
+	labels := n.env.GetNodeLabels()
+	if n.IsIdentityMaster() {
+		_, err := n.Self.Node.ModifySelfLabels(n.registry, labels)
+		return err
+	}
+	if n.IsIdentitySlave() {
+		if len(labels) == 0 {
+			result.Applied = removeEnvReloadKey(result.Applied, "Node.Labels")
+			result.RestartRequired = append(result.RestartRequired, "Node.Labels")
+			return nil
+		}
+		_, err := n.NotifyMasterToModifySelf(ctx, &models.ModifiableNodeInfo{Labels: labels})
+		return err
+	}
+	n.Self.Node.Labels = labels
+	return nil
+}
+
+func removeEnvReloadKey(keys []string, key string) []string {
+	result := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k != key {
+			result = append(result, k)
+		}
+	}
+	return result
+}
@@ -8,27 +8,25 @@ import (
 	"net/http"
 	"sync"
 
-	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/logging"
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"gorm.io/gorm"
 )
 
 type PoolSelf struct {
-	Identity                                 uint8
-	identitySwitchedMasterOnCallbacksRWLock  sync.RWMutex
-	identitySwitchedMasterOnCallbacks        []func()
-	identitySwitchedMasterOffCallbacksRWLock sync.RWMutex
-	identitySwitchedMasterOffCallbacks       []func()
-	identitySwitchedSlaveOnCallbacksRWLock   sync.RWMutex
-	identitySwitchedSlaveOnCallbacks         []func()
-	identitySwitchedSlaveOffCallbacksRWLock  sync.RWMutex
-	identitySwitchedSlaveOffCallbacks        []func()
-	workerMasterCallbacksRWLock              sync.RWMutex
-	workerMasterCallbacks                    []func(ctx context.Context, nodes *Pool)
-	workerSlaveCallbacksRWLock               sync.RWMutex
-	workerSlaveCallbacks                     []func(ctx context.Context, nodes *Pool)
-	Node                                     *NodeInfo.NodeInfo
-	Alive                                    uint8
-	AliveRWLock                              sync.RWMutex
+	Identity    uint8
+	Node        *NodeInfo.NodeInfo
+	Alive       uint8
+	AliveRWLock sync.RWMutex
+}
+
+// Reset 以 node 为本节点信息，重置为身份未定，活跃次数清零。
+func (ps *PoolSelf) Reset(node *NodeInfo.NodeInfo) {
+	ps.AliveRWLock.Lock()
+	defer ps.AliveRWLock.Unlock()
+	ps.Identity = IdentityNotDetermined
+	ps.Node = node
+	ps.Alive = 0
 }
 
 func (ps *PoolSelf) SetLevel(level uint8) {
@@ -59,15 +57,15 @@ var ErrNodeExisted = errors.New(" a valid node with same socket already exists")
 // 1. 如果相同，则认为是自己，报 ErrNodeMasterIsSelf。
 //
 // 2. 如果不同，则认为主节点是另一个进程。尝试与其沟通，参见 CheckMasterWithRequest。
-func (n *Pool) CheckMaster(master *NodeInfo.NodeInfo) (*http.Response, error) {
+func (n *Pool) CheckMaster(ctx context.Context, master *NodeInfo.NodeInfo) (*http.Response, error) {
 	if master == nil {
-		logPrintln("Master not specified")
+		n.logger().Warn("master not specified")
 		return nil, ErrNodeMasterInvalid
 	}
 	if n.Self.Node.IsSocketEqual(master) {
 		return nil, ErrNodeMasterIsSelf
 	}
-	return n.CheckMasterWithRequest(master)
+	return n.CheckMasterWithRequest(ctx, master)
 }
 
 // CheckMasterWithRequest 发送请求查询主节点状态。
@@ -83,21 +81,19 @@ func (n *Pool) CheckMaster(master *NodeInfo.NodeInfo) (*http.Response, error) {
 // 4. 如果状态码不是 200 OK，则认为主节点有效，但拒绝。
 //
 // 其它情况没有任何错误。
-func (n *Pool) CheckMasterWithRequest(master *NodeInfo.NodeInfo) (*http.Response, error) {
+func (n *Pool) CheckMasterWithRequest(ctx context.Context, master *NodeInfo.NodeInfo) (*http.Response, error) {
 	if master == nil {
-		logPrintln("Master not specified")
+		n.logger().Warn("master not specified")
 		return nil, ErrNodeMasterInvalid
 	}
-	if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-		logPrintf("Checking Master [ID: %d - %s]...\n", master.ID, master.Socket())
-	}
-	resp, err := n.SendRequestMasterStatus(master)
+	n.logger().Debug("checking master", peer(master)...)
+	resp, err := n.SendRequestMasterStatus(ctx, master)
 	if errors.Is(err, ErrNodeRequestInvalid) {
-		logPrintln("[Send Request]Master Status:", err)
+		n.logger().Error("failed to request master status", append(peer(master), "error", err)...)
 		return resp, ErrNodeRequestInvalid
 	}
 	if err != nil {
-		logPrintln("[Send Request]Master Status:", err)
+		n.logger().Warn("failed to request master status", append(peer(master), "error", err)...)
 		return resp, ErrNodeRequestResponseError
 	}
 	// 此时目标主节点网络正常。
@@ -110,7 +106,7 @@ func (n *Pool) CheckMasterWithRequest(master *NodeInfo.NodeInfo) (*http.Response
 		if _, err := resp.Body.Read(body); err != nil && err != io.EOF {
 			return resp, ErrNodeRequestResponseError
 		}
-		logPrintln(string(body))
+		n.logger().Warn("master refused", append(peer(master), "status", resp.StatusCode, "body", string(body))...)
 		return resp, ErrNodeMasterValidButRefused
 	}
 	return resp, nil
@@ -131,18 +127,16 @@ func (ps *PoolSelf) AliveUpAndClearIf(threshold uint8) uint8 {
 }
 
 // CheckSelf check that the current node is consistent with the contents of the database.
-func (ps *PoolSelf) CheckSelf() bool {
-	node, err := NodeInfo.GetNodeInfo(ps.Node.ID)
+func (ps *PoolSelf) CheckSelf(db *gorm.DB) bool {
+	node, err := NodeInfo.GetNodeInfo(db, ps.Node.ID)
 	if err != nil {
 		return false
 	}
 	err = ps.Node.IsEqual(node)
 	if err == nil {
-		if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-			logPrintln("Check self: valid")
-		}
+		logging.Default.Debug("checked self: valid", "node_id", ps.Node.ID)
 	} else {
-		logPrintln("Check self:", err)
+		logging.Default.Warn("checked self: invalid", "node_id", ps.Node.ID, "error", err)
 	}
 	return err == nil
 }
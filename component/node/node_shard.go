@@ -0,0 +1,349 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"time"
+
+	Shard "github.com/rhosocial/go-rush-producer/models/shard"
+)
+
+// 分片归属：每个分片至多由一个节点所有，参见 component.EnvShards。
+//
+// 主节点以一致性哈希按当前成员（自己和所有从节点）计算每个分片应当所有的节点，记录在节点登记数据库中，参见 rebalanceShards；
+// 成员不变时新的主节点得到相同的结果，成员变化时只有少量分片移动。
+// 各节点每轮同步自己的分片：先由原所有者释放，目标节点再取得，参见 syncShards。交接期间该分片无人所有。
+//
+// 所有权以租约为限，参见 component.EnvShards.Lease。所有者每轮续约；目标已不是自己时不能续约。
+// 已被移除或与节点登记数据库失联的节点不再续约，租约到期后不再认为自己所有，主节点此后才收回并交给其它节点。
+
+// 分片被释放的原因，参见 ShardReleasedEvent。
+var ErrNodeShardMoved = errors.New("shard moved to another node")
+var ErrNodeShardRevoked = errors.New("shard revoked")
+var ErrNodeShardsDisabled = errors.New("shards disabled")
+var ErrNodeShardLeaseExpired = errors.New("shard lease expired")
+
+// ShardRing 一致性哈希环。每个成员在环上有若干虚拟节点，分片归属于其哈希值顺时针方向的第一个虚拟节点。
+type ShardRing struct {
+	hashes  []uint32
+	members map[uint32]uint64
+}
+
+// NewShardRing 以 members 创建一致性哈希环，每个成员 replicas 个虚拟节点。结果只取决于成员ID和 replicas，与顺序无关。
+func NewShardRing(members []uint64, replicas int) *ShardRing {
+	ring := ShardRing{hashes: make([]uint32, 0, len(members)*replicas), members: make(map[uint32]uint64, len(members)*replicas)}
+	for _, member := range members {
+		for i := 0; i < replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.FormatUint(member, 10) + "#" + strconv.Itoa(i)))
+			// 哈希冲突时取ID较小者，以免结果取决于成员顺序。
+			if existed, ok := ring.members[hash]; ok {
+				if existed < member {
+					continue
+				}
+			} else {
+				ring.hashes = append(ring.hashes, hash)
+			}
+			ring.members[hash] = member
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+	return &ring
+}
+
+// Owner 分片应当所有的成员。环为空时返回 0。
+func (r *ShardRing) Owner(shard uint32) uint64 {
+	if len(r.hashes) == 0 {
+		return 0
+	}
+	hash := crc32.ChecksumIEEE([]byte("shard#" + strconv.FormatUint(uint64(shard), 10)))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.members[r.hashes[i]]
+}
+
+// ShardOf key 所在的分片。未启用分片时返回 0。
+func (n *Pool) ShardOf(key string) uint32 {
+	count := *n.env.GetShards().Count
+	if count == 0 {
+		return 0
+	}
+	return crc32.ChecksumIEEE([]byte(key)) % count
+}
+
+// Owns 当前节点是否所有 shard，即最近一次取得或续约的租约尚未到期。
+//
+// 租约到期前，即使主节点已将该分片交给其它节点，当前节点仍认为自己所有：交接时原所有者先释放，目标节点再取得；
+// 原所有者被移除或失联时，主节点等其租约到期后才收回。因此只要节点间时钟偏差小于租约时长，同一分片至多有一个节点认为自己所有。
+func (n *Pool) Owns(shard uint32) bool {
+	n.shardsLock.RLock()
+	defer n.shardsLock.RUnlock()
+	until, ok := n.shards[shard]
+	return ok && time.Now().Before(until)
+}
+
+// OwnedShards 当前节点所有且租约尚未到期的分片，按编号排列。
+func (n *Pool) OwnedShards() []uint32 {
+	now := time.Now()
+	n.shardsLock.RLock()
+	defer n.shardsLock.RUnlock()
+	shards := make([]uint32, 0, len(n.shards))
+	for shard, until := range n.shards {
+		if now.Before(until) {
+			shards = append(shards, shard)
+		}
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i] < shards[j] })
+	return shards
+}
+
+// recordedShards 当前节点记录的所有分片，包括租约已到期、尚未释放的分片，按编号排列。
+func (n *Pool) recordedShards() []uint32 {
+	n.shardsLock.RLock()
+	defer n.shardsLock.RUnlock()
+	shards := make([]uint32, 0, len(n.shards))
+	for shard := range n.shards {
+		shards = append(shards, shard)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i] < shards[j] })
+	return shards
+}
+
+// own 记录当前节点所有 shard，租约至 until。新取得时发布 ShardAcquiredEvent。
+func (n *Pool) own(shard uint32, until time.Time) {
+	n.shardsLock.Lock()
+	if n.shards == nil {
+		n.shards = make(map[uint32]time.Time)
+	}
+	_, renewed := n.shards[shard]
+	n.shards[shard] = until
+	n.shardsLock.Unlock()
+	if renewed {
+		return
+	}
+	n.logger().Info("shard acquired", "shard", shard)
+	n.Events.Publish(&ShardAcquiredEvent{Shard: shard})
+}
+
+// disown 记录当前节点不再所有 shard，并发布 ShardReleasedEvent。
+func (n *Pool) disown(shard uint32, cause error) {
+	n.shardsLock.Lock()
+	delete(n.shards, shard)
+	n.shardsLock.Unlock()
+	n.logger().Info("shard released", "shard", shard, "cause", cause)
+	n.Events.Publish(&ShardReleasedEvent{Shard: shard, Cause: cause})
+}
+
+// expireShards 释放租约在 at 时已到期的分片。
+func (n *Pool) expireShards(at time.Time) {
+	expired := make([]uint32, 0)
+	n.shardsLock.RLock()
+	for shard, until := range n.shards {
+		if !at.Before(until) {
+			expired = append(expired, shard)
+		}
+	}
+	n.shardsLock.RUnlock()
+	sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+	for _, shard := range expired {
+		n.disown(shard, ErrNodeShardLeaseExpired)
+	}
+}
+
+// shardMembers 当前节点（主节点）已知的成员：自己和所有支持同步分片（CapabilityShardSync）的从节点。
+func (n *Pool) shardMembers() []uint64 {
+	n.Slaves.NodesRWLock.RLock()
+	defer n.Slaves.NodesRWLock.RUnlock()
+	members := make([]uint64, 0, len(n.Slaves.Nodes)+1)
+	members = append(members, n.Self.Node.ID)
+	for id := range n.Slaves.Nodes {
+		// 未报告协议的从节点不能确定会同步分片，不作为目标，以免分片无人取得。
+		if protocol := n.Slaves.GetProtocol(id); protocol == nil || !protocol.Supports(CapabilityShardSync) {
+			continue
+		}
+		members = append(members, id)
+	}
+	return members
+}
+
+// tickShards 每轮由工作协程调用：先释放租约已到期的分片，主节点再重新计算分片归属，各节点再同步自己的分片。
+// 上一轮尚未结束时跳过本轮。
+//
+// 若未启用分片，则释放当前节点所有的分片。
+func (n *Pool) tickShards(ctx context.Context) {
+	if !n.shardsWorking.TryLock() {
+		return
+	}
+	defer n.shardsWorking.Unlock()
+	n.expireShards(time.Now())
+	if n.registry == nil || n.Self.Node == nil || n.IsIdentityNotDetermined() {
+		return
+	}
+	if *n.env.GetShards().Count == 0 {
+		n.releaseShards(ctx, ErrNodeShardsDisabled)
+		return
+	}
+	if n.IsIdentityMaster() {
+		if err := n.rebalanceShards(ctx); err != nil {
+			n.logger().Error("failed to rebalance shards", "error", err)
+		}
+	}
+	if err := n.syncShards(ctx); err != nil {
+		n.logger().Error("failed to sync shards", "error", err)
+	}
+}
+
+// rebalanceShards 当前节点（主节点）按当前成员重新计算各分片的目标节点。
+//
+// 1. 登记尚不存在的分片。
+//
+// 2. 收回不在当前成员中的节点所有且租约已到期的分片，例如已被移除的从节点或已被接替的主节点。
+//
+// 3. 目标节点有变化的分片，记录新的目标节点，由原所有者释放。编号超出分片数的分片目标为 0，不再有所有者。
+func (n *Pool) rebalanceShards(ctx context.Context) error {
+	count := *n.env.GetShards().Count
+	shards, err := Shard.GetShards(ctx, n.registry)
+	if err != nil {
+		return err
+	}
+	if missing := missingShards(shards, count); len(missing) > 0 {
+		if err := Shard.CreateShards(ctx, n.registry, missing); err != nil {
+			return err
+		}
+		if shards, err = Shard.GetShards(ctx, n.registry); err != nil {
+			return err
+		}
+	}
+	members := n.shardMembers()
+	isMember := make(map[uint64]bool, len(members))
+	for _, member := range members {
+		isMember[member] = true
+	}
+	ring := NewShardRing(members, int(*n.env.GetShards().Replicas))
+	now := time.Now()
+	for i := range shards {
+		shard := &shards[i]
+		if shard.OwnerID != 0 && !isMember[shard.OwnerID] && !shard.IsLeased(now) {
+			owner := shard.OwnerID
+			ok, err := shard.Revoke(ctx, n.registry, now)
+			if err != nil {
+				return err
+			}
+			if ok {
+				n.logger().Info("shard revoked", "shard", shard.ID, "peer_id", owner)
+			}
+		}
+		target := uint64(0)
+		if shard.ID < count {
+			target = ring.Owner(shard.ID)
+		}
+		if shard.TargetID != target {
+			if _, err := shard.Retarget(ctx, n.registry, target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// missingShards shards 中缺少的、编号小于 count 的分片。shards 须按编号排列。
+func missingShards(shards []Shard.Shard, count uint32) []uint32 {
+	missing := make([]uint32, 0)
+	i := 0
+	for id := uint32(0); id < count; id++ {
+		for i < len(shards) && shards[i].ID < id {
+			i++
+		}
+		if i < len(shards) && shards[i].ID == id {
+			continue
+		}
+		missing = append(missing, id)
+	}
+	return missing
+}
+
+// syncShards 当前节点同步自己的分片。
+//
+// 1. 所有但目标不是自己的分片，先在本地释放，再在节点登记数据库中释放。
+//
+// 2. 所有且目标是自己的分片，续约后在本地记录新的租约。
+//
+// 3. 目标是自己且无人所有的分片，在节点登记数据库中取得后在本地记录。
+//
+// 4. 本地记录所有、但在节点登记数据库中已不属于自己的分片（已被主节点收回），在本地释放。
+//
+// 租约自写入节点登记数据库之前开始计算，因此本地记录的租约不会晚于数据库中的租约。
+func (n *Pool) syncShards(ctx context.Context) error {
+	self := n.Self.Node.ID
+	shards, err := Shard.GetShardsOf(ctx, n.registry, self)
+	if err != nil {
+		return err
+	}
+	until := time.Now().Add(n.env.GetShards().GetLease())
+	owned := make(map[uint32]bool, len(shards))
+	for i := range shards {
+		shard := &shards[i]
+		switch {
+		case shard.OwnerID == self && shard.TargetID != self:
+			if n.isShardRecorded(shard.ID) {
+				n.disown(shard.ID, ErrNodeShardMoved)
+			}
+			if _, err := shard.Release(ctx, n.registry); err != nil {
+				return err
+			}
+		case shard.OwnerID == self:
+			ok, err := shard.Renew(ctx, n.registry, until)
+			if err != nil {
+				return err
+			}
+			if ok {
+				owned[shard.ID] = true
+				n.own(shard.ID, until)
+			}
+		case shard.OwnerID == 0:
+			ok, err := shard.Acquire(ctx, n.registry, self, until)
+			if err != nil {
+				return err
+			}
+			if ok {
+				owned[shard.ID] = true
+				n.own(shard.ID, until)
+			}
+		}
+	}
+	for _, shard := range n.recordedShards() {
+		if !owned[shard] {
+			n.disown(shard, ErrNodeShardRevoked)
+		}
+	}
+	return nil
+}
+
+// isShardRecorded 当前节点是否记录了 shard，不论租约是否到期。
+func (n *Pool) isShardRecorded(shard uint32) bool {
+	n.shardsLock.RLock()
+	defer n.shardsLock.RUnlock()
+	_, ok := n.shards[shard]
+	return ok
+}
+
+// releaseShards 释放当前节点所有的全部分片：先在本地释放，再在节点登记数据库中释放。cause 为释放的原因。
+func (n *Pool) releaseShards(ctx context.Context, cause error) {
+	shards := n.recordedShards()
+	if len(shards) == 0 {
+		return
+	}
+	for _, shard := range shards {
+		n.disown(shard, cause)
+	}
+	if n.registry == nil || n.Self.Node == nil {
+		return
+	}
+	if _, err := Shard.ReleaseShardsOf(ctx, n.registry, n.Self.Node.ID); err != nil {
+		n.logger().Error("failed to release shards", "error", err)
+	}
+}
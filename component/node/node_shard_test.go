@@ -0,0 +1,118 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	Shard "github.com/rhosocial/go-rush-producer/models/shard"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardRing_Owner(t *testing.T) {
+	const shards = 256
+	t.Run("empty", func(t *testing.T) {
+		assert.Equal(t, uint64(0), NewShardRing(nil, 64).Owner(1))
+	})
+	t.Run("independent of member order", func(t *testing.T) {
+		a, b := NewShardRing([]uint64{1, 2, 3}, 64), NewShardRing([]uint64{3, 1, 2}, 64)
+		for shard := uint32(0); shard < shards; shard++ {
+			assert.Equal(t, a.Owner(shard), b.Owner(shard))
+		}
+	})
+	t.Run("every member owns some shards", func(t *testing.T) {
+		ring := NewShardRing([]uint64{1, 2, 3, 4}, 64)
+		counts := make(map[uint64]int)
+		for shard := uint32(0); shard < shards; shard++ {
+			counts[ring.Owner(shard)]++
+		}
+		assert.Len(t, counts, 4)
+	})
+	t.Run("joining member only takes shards", func(t *testing.T) {
+		before, after := NewShardRing([]uint64{1, 2, 3}, 64), NewShardRing([]uint64{1, 2, 3, 4}, 64)
+		moved := 0
+		for shard := uint32(0); shard < shards; shard++ {
+			if before.Owner(shard) != after.Owner(shard) {
+				assert.Equal(t, uint64(4), after.Owner(shard))
+				moved++
+			}
+		}
+		assert.Greater(t, moved, 0)
+		assert.Less(t, moved, shards/2)
+	})
+}
+
+func TestMissingShards(t *testing.T) {
+	assert.Equal(t, []uint32{0, 1, 2}, missingShards(nil, 3))
+	assert.Equal(t, []uint32{1, 3}, missingShards([]Shard.Shard{{ID: 0}, {ID: 2}, {ID: 5}}, 4))
+	assert.Empty(t, missingShards([]Shard.Shard{{ID: 0}, {ID: 1}}, 0))
+}
+
+func TestPool_releaseShards(t *testing.T) {
+	pool := Pool{Events: NewEventBus(), Self: PoolSelf{Node: &NodeInfo.NodeInfo{ID: 1}}}
+	subscription := pool.Events.Subscribe(0, EventShardAcquired, EventShardReleased)
+	defer subscription.Unsubscribe()
+	until := time.Now().Add(time.Minute)
+	pool.own(3, until)
+	pool.own(1, until)
+	pool.own(1, until.Add(time.Second))
+	assert.True(t, pool.Owns(3))
+	assert.False(t, pool.Owns(2))
+	assert.Equal(t, []uint32{1, 3}, pool.OwnedShards())
+
+	stopped := errors.New("stopped")
+	pool.releaseShards(context.Background(), stopped)
+	assert.Empty(t, pool.OwnedShards())
+	expected := []Event{&ShardAcquiredEvent{Shard: 3}, &ShardAcquiredEvent{Shard: 1}, &ShardReleasedEvent{Shard: 1, Cause: stopped}, &ShardReleasedEvent{Shard: 3, Cause: stopped}}
+	for _, e := range expected {
+		select {
+		case event := <-subscription.Events():
+			assert.Equal(t, e.Type(), event.Type())
+			switch e := e.(type) {
+			case *ShardAcquiredEvent:
+				assert.Equal(t, e.Shard, event.(*ShardAcquiredEvent).Shard)
+			case *ShardReleasedEvent:
+				assert.Equal(t, e.Shard, event.(*ShardReleasedEvent).Shard)
+				assert.ErrorIs(t, event.(*ShardReleasedEvent).Cause, stopped)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("event not delivered")
+		}
+	}
+}
+
+func TestPool_expireShards(t *testing.T) {
+	pool := Pool{Events: NewEventBus(), Self: PoolSelf{Node: &NodeInfo.NodeInfo{ID: 1}}}
+	now := time.Now()
+	pool.own(1, now.Add(-time.Second))
+	pool.own(2, now.Add(time.Minute))
+	assert.False(t, pool.Owns(1))
+	assert.Equal(t, []uint32{2}, pool.OwnedShards())
+	assert.Equal(t, []uint32{1, 2}, pool.recordedShards())
+	pool.expireShards(now)
+	assert.Equal(t, []uint32{2}, pool.recordedShards())
+}
+
+func TestPool_shardMembers(t *testing.T) {
+	legacy := &Protocol{Version: ProtocolVersion, Capabilities: []uint32{RequestSlaveNotify}}
+	pool := Pool{
+		Self: PoolSelf{Node: &NodeInfo.NodeInfo{ID: 1}},
+		Slaves: PoolSlaves{
+			Nodes:         map[uint64]NodeInfo.NodeInfo{2: {ID: 2}, 3: {ID: 3}, 4: {ID: 4}},
+			NodesProtocol: map[uint64]*Protocol{2: NewProtocol(), 3: legacy},
+		},
+	}
+	assert.ElementsMatch(t, []uint64{1, 2}, pool.shardMembers())
+}
+
+func TestPool_ShardOf(t *testing.T) {
+	count := uint32(8)
+	pool := Pool{env: &component.Env{Shards: &component.EnvShards{Count: &count}}}
+	assert.Equal(t, pool.ShardOf("source-1"), pool.ShardOf("source-1"))
+	assert.Less(t, pool.ShardOf("source-1"), count)
+	count = 0
+	assert.Equal(t, uint32(0), pool.ShardOf("source-1"))
+}
@@ -0,0 +1,88 @@
+package node
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSignedRequest(t *testing.T, body []byte, nodeID uint64, secret string) *http.Request {
+	req, err := http.NewRequest(http.MethodPut, "http://127.0.0.1:8080/server/master/notify?id=1", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if nodeID != 0 {
+		req.Header.Set(RequestHeaderXNodeIDKey, strconv.FormatUint(nodeID, 10))
+	}
+	if err := SignNodeRequest(req, body, nodeID, []byte(secret)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return req
+}
+
+func TestNodeRequestVerifier_Verify(t *testing.T) {
+	body := []byte("host=192.168.0.1&name=GO-RUSH-PRODUCER&node_version=1.0.0&port=38081")
+
+	t.Run("normal case", func(t *testing.T) {
+		verifier := NewNodeRequestVerifier("secret", 30*time.Second)
+		nodeID, err := verifier.Verify(newSignedRequest(t, body, 12, "secret"), body)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(12), nodeID)
+	})
+	t.Run("unregistered node", func(t *testing.T) {
+		verifier := NewNodeRequestVerifier("secret", 30*time.Second)
+		nodeID, err := verifier.Verify(newSignedRequest(t, nil, 0, "secret"), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(0), nodeID)
+	})
+	t.Run("secret not configured", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8080/server", nil)
+		assert.ErrorIs(t, SignNodeRequest(req, nil, 0, nil), ErrNodeRequestSecretNotConfigured)
+		_, err := NewNodeRequestVerifier("", 30*time.Second).Verify(req, nil)
+		assert.ErrorIs(t, err, ErrNodeRequestSecretNotConfigured)
+	})
+	t.Run("missing signature", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8080/server", nil)
+		_, err := NewNodeRequestVerifier("secret", 30*time.Second).Verify(req, nil)
+		assert.ErrorIs(t, err, ErrNodeRequestSignatureMissing)
+	})
+	t.Run("wrong secret", func(t *testing.T) {
+		verifier := NewNodeRequestVerifier("secret", 30*time.Second)
+		_, err := verifier.Verify(newSignedRequest(t, body, 12, "another"), body)
+		assert.ErrorIs(t, err, ErrNodeRequestSignatureInvalid)
+	})
+	t.Run("tampered body", func(t *testing.T) {
+		verifier := NewNodeRequestVerifier("secret", 30*time.Second)
+		_, err := verifier.Verify(newSignedRequest(t, body, 12, "secret"), []byte("host=10.0.0.1"))
+		assert.ErrorIs(t, err, ErrNodeRequestSignatureInvalid)
+	})
+	t.Run("tampered node id", func(t *testing.T) {
+		verifier := NewNodeRequestVerifier("secret", 30*time.Second)
+		req := newSignedRequest(t, body, 12, "secret")
+		req.Header.Set(RequestHeaderXNodeIDKey, "13")
+		_, err := verifier.Verify(req, body)
+		assert.ErrorIs(t, err, ErrNodeRequestSignatureInvalid)
+	})
+	t.Run("expired timestamp", func(t *testing.T) {
+		verifier := NewNodeRequestVerifier("secret", 30*time.Second)
+		req := newSignedRequest(t, body, 12, "secret")
+		timestamp := time.Now().Add(-time.Minute).Unix()
+		nonce := req.Header.Get(RequestHeaderXNodeNonceKey)
+		req.Header.Set(RequestHeaderXNodeTimestampKey, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(RequestHeaderXNodeSignatureKey, NodeRequestSignature([]byte("secret"), req.Method, req.URL.RequestURI(), body, 12, timestamp, nonce))
+		_, err := verifier.Verify(req, body)
+		assert.ErrorIs(t, err, ErrNodeRequestTimestampExpired)
+	})
+	t.Run("replayed", func(t *testing.T) {
+		verifier := NewNodeRequestVerifier("secret", 30*time.Second)
+		req := newSignedRequest(t, body, 12, "secret")
+		_, err := verifier.Verify(req, body)
+		assert.Nil(t, err)
+		_, err = verifier.Verify(req, body)
+		assert.ErrorIs(t, err, ErrNodeRequestReplayed)
+	})
+}
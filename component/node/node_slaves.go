@@ -4,9 +4,13 @@ import (
 	"context"
 	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/rhosocial/go-rush-producer/component/logging"
 	"github.com/rhosocial/go-rush-producer/models"
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"gorm.io/gorm"
 )
 
 type PoolSlaves struct {
@@ -15,15 +19,71 @@ type PoolSlaves struct {
 	NodesRetry  map[uint64]uint8
 	NextTurn    uint32
 
+	NodesProtocol       map[uint64]*Protocol // 从节点报告的协议版本和能力集。
+	NodesProtocolRWLock sync.RWMutex
+
+	revision uint64 // 从节点集合版本。从节点加入或移除时递增。
+
 	WorkerCancelFunc       context.CancelCauseFunc
 	WorkerCancelFuncRWLock sync.RWMutex
+	workerTickedAt         int64 // 从节点身份协程最近一轮开始的时间（UnixNano）。原子操作。
+
+	// 检测到从节点不活跃或重试次数达到移除上限时的回调。调用时不持有 NodesRWLock，slave 为从节点信息的副本。
+	DetectInactiveCallback   func(slave NodeInfo.NodeInfo, retry uint8)
+	RemoveRetriedOutCallback func(slave NodeInfo.NodeInfo)
+}
+
+// ---- Tick ---- //
+
+// Tick 记录从节点身份协程开始新一轮的时间，参见 Pool.Liveness。
+func (ps *PoolSlaves) Tick(at time.Time) {
+	atomic.StoreInt64(&ps.workerTickedAt, at.UnixNano())
+}
+
+// TickedAt 从节点身份协程最近一轮开始的时间。从未记录时为零值。
+func (ps *PoolSlaves) TickedAt() time.Time {
+	if at := atomic.LoadInt64(&ps.workerTickedAt); at > 0 {
+		return time.Unix(0, at)
+	}
+	return time.Time{}
+}
+
+// ---- Tick ---- //
+
+// Reset 清空所有从节点及其重试次数和协议，从节点集合版本递增。身份协程须已停止，取消句柄和回调保持不变。
+func (ps *PoolSlaves) Reset() {
+	ps.NodesRWLock.Lock()
+	ps.Nodes = make(map[uint64]NodeInfo.NodeInfo)
+	ps.NodesRetry = make(map[uint64]uint8)
+	ps.NextTurn = 0
+	ps.NodesProtocolRWLock.Lock()
+	ps.NodesProtocol = make(map[uint64]*Protocol)
+	ps.NodesProtocolRWLock.Unlock()
+	ps.NodesRWLock.Unlock()
+	ps.RevisionUp()
+	atomic.StoreInt64(&ps.workerTickedAt, 0)
+}
 
-	DetectInactiveCallback func(id uint64, retry uint8)
+// ---- Revision ---- //
+
+// RevisionUp 从节点集合版本递增。
+func (ps *PoolSlaves) RevisionUp() uint64 {
+	return atomic.AddUint64(&ps.revision, 1)
+}
+
+// GetRevision 获取从节点集合版本。
+func (ps *PoolSlaves) GetRevision() uint64 {
+	return atomic.LoadUint64(&ps.revision)
 }
 
+// ---- Revision ---- //
+
 // ---- Turn ---- //
 
+// Count 从节点数。
 func (ps *PoolSlaves) Count() int {
+	ps.NodesRWLock.RLock()
+	defer ps.NodesRWLock.RUnlock()
 	return len(ps.Nodes)
 }
 
@@ -37,12 +97,16 @@ func (ps *PoolSlaves) GetTurn() uint32 {
 }
 
 // GetTurnCandidate 获取候选接替顺序的节点ID。如果没有候选，则返回0。
+// 不支持接替通知（RequestSlaveNotify）的从节点不会成为候选。
 func (ps *PoolSlaves) GetTurnCandidate() uint64 {
 	ps.NodesRWLock.RLock()
 	defer ps.NodesRWLock.RUnlock()
 	turn := uint32(math.MaxUint32)
 	target := uint64(0)
 	for i, v := range ps.Nodes {
+		if !ps.Supports(i, RequestSlaveNotify) {
+			continue
+		}
 		if turn >= v.Turn {
 			turn = v.Turn
 			target = i
@@ -61,7 +125,15 @@ func (ps *PoolSlaves) IsWorking() bool {
 
 // ---- Worker ---- //
 
+// Get 获取指定从节点信息的副本。不存在时返回 nil。
 func (ps *PoolSlaves) Get(id uint64) *NodeInfo.NodeInfo {
+	ps.NodesRWLock.RLock()
+	defer ps.NodesRWLock.RUnlock()
+	return ps.get(id)
+}
+
+// get 同 Get。调用前须持有 NodesRWLock。
+func (ps *PoolSlaves) get(id uint64) *NodeInfo.NodeInfo {
 	node, exist := ps.Nodes[id]
 	if !exist {
 		return nil
@@ -100,11 +172,13 @@ func (ps *PoolSlaves) RetryDown(id uint64) uint8 {
 	return ps.NodesRetry[id]
 }
 
-// RetryClear 尝试次数清空。
+// RetryClear 尝试次数清空。未登记的节点不做任何动作。
 func (ps *PoolSlaves) RetryClear(id uint64) {
 	ps.NodesRWLock.Lock()
 	defer ps.NodesRWLock.Unlock()
-	ps.NodesRetry[id] = 0
+	if _, exist := ps.Nodes[id]; exist {
+		ps.NodesRetry[id] = 0
+	}
 }
 
 // GetRetry 获取重试次数。
@@ -119,33 +193,62 @@ func (ps *PoolSlaves) GetRetry(id uint64) uint8 {
 // 注意 limitInactive 须比 limitRemoved 小，否则可能产生意想不到的后果。
 //
 // 返回被删除的节点ID数组指针。
-func (ps *PoolSlaves) RetryUpAllAndRemoveIfRetriedOut(limitInactive uint8, limitRemoved uint8) *[]uint64 {
+func (ps *PoolSlaves) RetryUpAllAndRemoveIfRetriedOut(db *gorm.DB, limitInactive uint8, limitRemoved uint8) *[]uint64 {
 	if limitInactive >= limitRemoved {
-		logPrintf("Warning! the limit of inactive(%d) is greater than or equal to limit of removed(%d).\n", limitInactive, limitRemoved)
+		logging.Default.Warn("the limit of inactive is greater than or equal to the limit of removed", "limit_inactive", limitInactive, "limit_removed", limitRemoved)
 	}
 	ps.NodesRWLock.Lock()
 	defer ps.NodesRWLock.Unlock()
 	removed := make([]uint64, 0)
-	for i := range ps.Nodes {
+	for i, node := range ps.Nodes {
 		ps.NodesRetry[i] += 1
-		node := ps.Get(i)
-		if ps.NodesRetry[i] >= limitInactive && ps.NodesRetry[i] < limitRemoved && node != nil && ps.DetectInactiveCallback != nil {
-			go ps.DetectInactiveCallback(i, ps.NodesRetry[i])
+		if ps.NodesRetry[i] >= limitInactive && ps.NodesRetry[i] < limitRemoved && ps.DetectInactiveCallback != nil {
+			go ps.DetectInactiveCallback(node, ps.NodesRetry[i])
 		}
 		if ps.NodesRetry[i] >= limitRemoved {
-			if node != nil {
-				_, err := node.RemoveSelf()
-				if err != nil {
-					logPrintln(err)
-				}
+			_, err := node.RemoveSelf(db)
+			if err != nil {
+				logging.Default.Error("failed to remove retried-out slave", append(peer(&node), "error", err)...)
+			}
+			if ps.RemoveRetriedOutCallback != nil {
+				go ps.RemoveRetriedOutCallback(node)
 			}
-			delete(ps.Nodes, i)
+			ps.remove(i)
 			removed = append(removed, i)
 		}
 	}
 	return &removed
 }
 
+// remove 删除从节点及其重试次数和协议，从节点集合版本递增。调用前须持有 NodesRWLock。
+func (ps *PoolSlaves) remove(id uint64) {
+	delete(ps.Nodes, id)
+	delete(ps.NodesRetry, id)
+	ps.NodesProtocolRWLock.Lock()
+	delete(ps.NodesProtocol, id)
+	ps.NodesProtocolRWLock.Unlock()
+	ps.RevisionUp()
+}
+
+// SetProtocol 记录从节点报告的协议版本和能力集。
+func (ps *PoolSlaves) SetProtocol(id uint64, protocol *Protocol) {
+	ps.NodesProtocolRWLock.Lock()
+	defer ps.NodesProtocolRWLock.Unlock()
+	ps.NodesProtocol[id] = protocol
+}
+
+// GetProtocol 获取从节点报告的协议版本和能力集。若从未报告，则返回 nil。
+func (ps *PoolSlaves) GetProtocol(id uint64) *Protocol {
+	ps.NodesProtocolRWLock.RLock()
+	defer ps.NodesProtocolRWLock.RUnlock()
+	return ps.NodesProtocol[id]
+}
+
+// Supports 判断从节点是否支持指定请求。参见 Protocol.Supports。
+func (ps *PoolSlaves) Supports(id uint64, request uint32) bool {
+	return ps.GetProtocol(id).Supports(request)
+}
+
 // GetRegisteredNodeInfos 获取所有从节点信息。
 func (ps *PoolSlaves) GetRegisteredNodeInfos() *map[uint64]*models.RegisteredNodeInfo {
 	ps.NodesRWLock.RLock()
@@ -159,6 +262,23 @@ func (ps *PoolSlaves) GetRegisteredNodeInfos() *map[uint64]*models.RegisteredNod
 	return &slaves
 }
 
+// Select 获取满足选择条件的所有从节点信息。
+func (ps *PoolSlaves) Select(selector *models.NodeSelector) *map[uint64]*models.RegisteredNodeInfo {
+	ps.NodesRWLock.RLock()
+	defer ps.NodesRWLock.RUnlock()
+
+	slaves := make(map[uint64]*models.RegisteredNodeInfo)
+	for i, v := range ps.Nodes {
+		registered := v.ToRegisteredNodeInfo()
+		if !selector.Matches(&registered.FreshNodeInfo) {
+			continue
+		}
+		registered.Retry = ps.NodesRetry[i]
+		slaves[i] = registered
+	}
+	return &slaves
+}
+
 // AddSlaveNode 添加从节点信息。
 func (ps *PoolSlaves) AddSlaveNode(slave NodeInfo.NodeInfo) bool {
 	//if slave == nil {
@@ -167,12 +287,20 @@ func (ps *PoolSlaves) AddSlaveNode(slave NodeInfo.NodeInfo) bool {
 	ps.NodesRWLock.Lock()
 	defer ps.NodesRWLock.Unlock()
 	ps.Nodes[slave.ID] = slave
+	ps.RevisionUp()
 	return true
 }
 
 // Refresh 刷新节点。
 // 刷新后会重新确定下一个顺序。
 func (ps *PoolSlaves) Refresh(nodes *[]NodeInfo.NodeInfo) {
+	ps.NodesRWLock.Lock()
+	defer ps.NodesRWLock.Unlock()
+	ps.refresh(nodes)
+}
+
+// refresh 同 Refresh。调用前须持有 NodesRWLock。
+func (ps *PoolSlaves) refresh(nodes *[]NodeInfo.NodeInfo) {
 	result := make(map[uint64]NodeInfo.NodeInfo)
 	turnMax := uint32(0)
 	for _, node := range *nodes {
@@ -183,10 +311,8 @@ func (ps *PoolSlaves) Refresh(nodes *[]NodeInfo.NodeInfo) {
 			}
 		}
 	}
-	// TODO: 此处应该加锁，但加锁后会出现死锁，待排查。
-	//ps.NodesRWLock.Lock()
-	//defer ps.NodesRWLock.Unlock()
 	ps.Nodes = result
+	ps.RevisionUp()
 	ps.NextTurn = turnMax + 1
 	ps.NodesRetry = make(map[uint64]uint8)
 }
@@ -195,9 +321,16 @@ func (ps *PoolSlaves) Refresh(nodes *[]NodeInfo.NodeInfo) {
 //
 // 检查 models.FreshNodeInfo 是否与本节点维护一致。若不一致，则报 ErrNodeSlaveFreshNodeInfoInvalid。
 func (ps *PoolSlaves) Check(id uint64, fresh *models.FreshNodeInfo) (*NodeInfo.NodeInfo, error) {
+	ps.NodesRWLock.RLock()
+	defer ps.NodesRWLock.RUnlock()
+	return ps.check(id, fresh)
+}
+
+// check 同 Check。调用前须持有 NodesRWLock。
+func (ps *PoolSlaves) check(id uint64, fresh *models.FreshNodeInfo) (*NodeInfo.NodeInfo, error) {
 	// 检查指定ID是否存在，如果不是，则报错。
 	// slave, exist := n.Slaves[id]
-	slave := ps.Get(id)
+	slave := ps.get(id)
 	if slave == nil {
 		return nil, ErrNodeMasterDoesNotHaveSpecifiedSlave
 	}
@@ -214,9 +347,17 @@ func (ps *PoolSlaves) Check(id uint64, fresh *models.FreshNodeInfo) (*NodeInfo.N
 	return nil, ErrNodeSlaveFreshNodeInfoInvalid
 }
 
+// CheckIfExists 查找与 fresh 一致的从节点。不存在时返回 nil。
 func (ps *PoolSlaves) CheckIfExists(fresh *models.FreshNodeInfo) *NodeInfo.NodeInfo {
+	ps.NodesRWLock.RLock()
+	defer ps.NodesRWLock.RUnlock()
+	return ps.checkIfExists(fresh)
+}
+
+// checkIfExists 同 CheckIfExists。调用前须持有 NodesRWLock。
+func (ps *PoolSlaves) checkIfExists(fresh *models.FreshNodeInfo) *NodeInfo.NodeInfo {
 	for id := range ps.Nodes {
-		if slave, err := ps.Check(id, fresh); err == nil {
+		if slave, err := ps.check(id, fresh); err == nil {
 			return slave
 		}
 	}
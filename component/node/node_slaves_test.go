@@ -0,0 +1,91 @@
+package node
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/rhosocial/go-rush-producer/models"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolSlaves_RetryClear(t *testing.T) {
+	slaves := PoolSlaves{
+		Nodes:         map[uint64]NodeInfo.NodeInfo{2: {ID: 2}},
+		NodesRetry:    map[uint64]uint8{2: 3},
+		NodesProtocol: make(map[uint64]*Protocol),
+	}
+	t.Run("registered", func(t *testing.T) {
+		slaves.RetryClear(2)
+		assert.Equal(t, uint8(0), slaves.GetRetry(2))
+	})
+	t.Run("unregistered", func(t *testing.T) {
+		slaves.RetryClear(3)
+		assert.NotContains(t, slaves.NodesRetry, uint64(3))
+	})
+}
+
+func TestPoolSlaves_remove(t *testing.T) {
+	slaves := PoolSlaves{
+		Nodes:         map[uint64]NodeInfo.NodeInfo{2: {ID: 2}, 3: {ID: 3}},
+		NodesRetry:    map[uint64]uint8{2: 1, 3: 1},
+		NodesProtocol: map[uint64]*Protocol{2: NewProtocol(), 3: NewProtocol()},
+	}
+	revision := slaves.GetRevision()
+	slaves.NodesRWLock.Lock()
+	slaves.remove(2)
+	slaves.NodesRWLock.Unlock()
+	assert.Nil(t, slaves.Get(2))
+	assert.NotContains(t, slaves.NodesRetry, uint64(2))
+	assert.Nil(t, slaves.GetProtocol(2))
+	assert.NotNil(t, slaves.Get(3))
+	assert.Equal(t, revision+1, slaves.GetRevision())
+}
+
+func TestPoolSlaves_concurrent(t *testing.T) {
+	slaves := PoolSlaves{
+		Nodes:         map[uint64]NodeInfo.NodeInfo{2: {ID: 2}},
+		NodesRetry:    map[uint64]uint8{2: 0},
+		NodesProtocol: make(map[uint64]*Protocol),
+	}
+	// 回调中再次访问从节点不应死锁。
+	inactive := make(chan uint64, 1)
+	slaves.DetectInactiveCallback = func(slave NodeInfo.NodeInfo, retry uint8) {
+		slaves.Get(slave.ID)
+		select {
+		case inactive <- slave.ID:
+		default:
+		}
+	}
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := uint64(3); i < 103; i++ {
+			slaves.AddSlaveNode(NodeInfo.NodeInfo{ID: i})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			slaves.Refresh(&[]NodeInfo.NodeInfo{{ID: 2, Turn: 1}})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			slaves.RetryUpAllAndRemoveIfRetriedOut(nil, 1, 255)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := uint64(0); i < 100; i++ {
+			slaves.Get(2)
+			slaves.Count()
+			slaves.CheckIfExists(&models.FreshNodeInfo{})
+		}
+	}()
+	wg.Wait()
+	assert.NotNil(t, slaves.Get(2))
+	assert.Equal(t, uint64(2), <-inactive)
+}
@@ -0,0 +1,378 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+	Task "github.com/rhosocial/go-rush-producer/models/task"
+	"gorm.io/gorm"
+)
+
+// 任务分配：主节点登记任务，每轮分配给支持执行任务（RequestSlaveTask）的从节点，参见 assignTasks。
+// 从节点确认后在后台执行，完成后向主节点报告结果，参见 ReceiveTask 和 ReceiveTaskReport。
+// 任务保存在节点登记数据库中，主节点变更后由新的主节点继续分配；从节点失效后其任务被收回并重新分配，参见 releaseTasks。
+// 任务可能被执行多次，执行者应保证重复执行无害。
+
+// TaskHandler 从节点执行任务。返回值 result 为执行结果；若报错，则任务视为失败，错误信息报告给主节点。
+type TaskHandler interface {
+	HandleTask(ctx context.Context, task *Task.Task) (result string, err error)
+}
+
+// TaskHandlerFunc 以函数实现 TaskHandler。
+type TaskHandlerFunc func(ctx context.Context, task *Task.Task) (string, error)
+
+// HandleTask 实现 TaskHandler。
+func (f TaskHandlerFunc) HandleTask(ctx context.Context, task *Task.Task) (string, error) {
+	return f(ctx, task)
+}
+
+// TaskDefinition 提交任务的内容。
+type TaskDefinition struct {
+	Name    string `form:"name" json:"name" binding:"required,max=64"`
+	Payload string `form:"payload" json:"payload"`
+}
+
+// TaskReport 从节点报告的任务执行结果。Error 非空表示失败。
+type TaskReport struct {
+	ID     uint64 `json:"id"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+var ErrNodeTaskDefinitionInvalid = errors.New("invalid task definition")
+var ErrNodeTaskInvalid = errors.New("task is not assigned to this node")
+var ErrNodeTaskHandlerMissing = errors.New("no task handler")
+var ErrNodeTaskAttemptsExhausted = errors.New("task attempts exhausted")
+
+// SubmitTask 当前节点（主节点）登记任务，由工作协程分配给从节点。
+//
+// 1. 若当前节点不是主节点，则报 ErrNodeIsNotMaster。
+//
+// 2. 若任务名称为空或超过 64 个字符，则报 ErrNodeTaskDefinitionInvalid。
+func (n *Pool) SubmitTask(ctx context.Context, definition *TaskDefinition) (*Task.Task, error) {
+	if !n.IsIdentityMaster() {
+		return nil, ErrNodeIsNotMaster
+	}
+	if len(definition.Name) == 0 || len(definition.Name) > 64 {
+		return nil, ErrNodeTaskDefinitionInvalid
+	}
+	task := Task.Task{Name: definition.Name, Payload: definition.Payload}
+	if err := task.Create(ctx, n.registry); err != nil {
+		return nil, err
+	}
+	n.logger().Info("task submitted", "task_id", task.ID, "task", task.Name)
+	return &task, nil
+}
+
+// ---- Master ---- //
+
+// taskCandidates 可分配任务的从节点：支持执行任务且当前未重试，按ID升序排列。
+func (n *Pool) taskCandidates() []uint64 {
+	n.Slaves.NodesRWLock.RLock()
+	defer n.Slaves.NodesRWLock.RUnlock()
+	candidates := make([]uint64, 0, len(n.Slaves.Nodes))
+	for id := range n.Slaves.Nodes {
+		// 未报告协议的从节点不能确定可以执行任务，不分配。
+		if protocol := n.Slaves.GetProtocol(id); protocol == nil || !protocol.Supports(RequestSlaveTask) {
+			continue
+		}
+		if n.Slaves.NodesRetry[id] > 0 {
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+	return candidates
+}
+
+// selectTaskAssignee 从 candidates 中选择尚未结束的任务数最少的从节点，相同时选择靠前者。没有候选时返回 0。
+func selectTaskAssignee(candidates []uint64, loads map[uint64]int64) uint64 {
+	assignee := uint64(0)
+	for _, id := range candidates {
+		if assignee == 0 || loads[id] < loads[assignee] {
+			assignee = id
+		}
+	}
+	return assignee
+}
+
+// assignTasks 当前节点（主节点）按提交顺序分配待分配的任务，每轮至多 component.EnvTasks.BatchSize 个。
+// 已达分配次数上限的任务标记为失败。上一轮尚未结束时跳过本轮。
+func (n *Pool) assignTasks(ctx context.Context) {
+	if !n.taskAssigning.TryLock() {
+		return
+	}
+	defer n.taskAssigning.Unlock()
+	if n.registry == nil {
+		return
+	}
+	candidates := n.taskCandidates()
+	if len(candidates) == 0 {
+		return
+	}
+	tasks, err := Task.GetPendingTasks(ctx, n.registry, int(*n.env.GetTasks().BatchSize))
+	if err != nil || len(tasks) == 0 {
+		if err != nil {
+			n.logger().Error("failed to get pending tasks", "error", err)
+		}
+		return
+	}
+	loads, err := Task.CountActiveTasks(ctx, n.registry)
+	if err != nil {
+		n.logger().Error("failed to count active tasks", "error", err)
+		return
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Attempts >= *n.env.GetTasks().AttemptsMax {
+			if ok, err := task.Fail(ctx, n.registry, ErrNodeTaskAttemptsExhausted.Error()); err != nil {
+				n.logger().Error("failed to mark task failed", "task_id", task.ID, "error", err)
+			} else if ok {
+				n.logger().Warn("task failed", "task_id", task.ID, "task", task.Name, "attempts", task.Attempts, "error", task.Error)
+				metrics.TasksFinished.WithLabelValues("failure").Inc()
+				n.Events.Publish(&TaskFinishedEvent{Task: *task})
+			}
+			continue
+		}
+		assignee := selectTaskAssignee(candidates, loads)
+		if n.assignTask(ctx, task, assignee) {
+			loads[assignee]++
+		}
+	}
+}
+
+// assignTask 将任务分配给 assignee，并通知其执行。从节点确认后记录为已确认；通知失败则收回任务，待下一轮重新分配。
+func (n *Pool) assignTask(ctx context.Context, task *Task.Task, assignee uint64) bool {
+	slave := n.Slaves.Get(assignee)
+	if slave == nil {
+		return false
+	}
+	if ok, err := task.Assign(ctx, n.registry, assignee); !ok {
+		if err != nil {
+			n.logger().Error("failed to assign task", append(peer(slave), "task_id", task.ID, "error", err)...)
+		}
+		return false
+	}
+	if err := n.NotifySlaveTask(ctx, slave.Socket(), task); err != nil {
+		n.logger().Warn("slave refused task", append(peer(slave), "task_id", task.ID, "error", err)...)
+		if _, err := task.Release(ctx, n.registry); err != nil {
+			n.logger().Error("failed to release task", append(peer(slave), "task_id", task.ID, "error", err)...)
+		}
+		return false
+	}
+	if _, err := task.Acknowledge(ctx, n.registry); err != nil {
+		n.logger().Error("failed to acknowledge task", append(peer(slave), "task_id", task.ID, "error", err)...)
+	}
+	metrics.TasksAssigned.Inc()
+	n.logger().Info("task assigned", append(peer(slave), "task_id", task.ID, "task", task.Name, "attempts", task.Attempts)...)
+	return true
+}
+
+// SendRequestSlaveTask 向"从节点-任务"发送请求。
+func (n *Pool) SendRequestSlaveTask(ctx context.Context, socket string, task *Task.Task) (*http.Response, error) {
+	body, err := json.Marshal(task)
+	if err != nil {
+		return nil, ErrNodeRequestInvalid
+	}
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodSlaveTask, RequestURLFormatSlaveTask, socket, bytes.NewReader(body), "application/json")
+	if err != nil {
+		n.logger().Error("failed to prepare request", "error", err)
+		return nil, ErrNodeRequestInvalid
+	}
+	client := n.httpClient()
+	resp, err := client.Do(req)
+	return resp, err
+}
+
+// NotifySlaveTask 当前节点（主节点）通知从节点执行任务。状态码不是 200 OK 时报 ErrNodeRequestResponseError。
+func (n *Pool) NotifySlaveTask(ctx context.Context, socket string, task *Task.Task) error {
+	resp, err := n.SendRequestSlaveTask(ctx, socket, task)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		n.logger().Debug("task notification refused", "status", resp.StatusCode, "body", string(body))
+		return ErrNodeRequestResponseError
+	}
+	return nil
+}
+
+// ReceiveTaskReport 当前节点（主节点）记录从节点 slaveID 报告的执行结果。
+//
+// 1. 若当前节点不是主节点，则报 ErrNodeIsNotMaster。
+//
+// 2. 若任务不存在、已结束或已分配给其它节点，则报 ErrNodeTaskInvalid。
+func (n *Pool) ReceiveTaskReport(ctx context.Context, slaveID uint64, report *TaskReport) (*Task.Task, error) {
+	if !n.IsIdentityMaster() {
+		return nil, ErrNodeIsNotMaster
+	}
+	task, err := Task.GetTask(ctx, n.registry, report.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNodeTaskInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	task.Result, task.Error = report.Result, report.Error
+	ok, err := task.Finish(ctx, n.registry, slaveID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNodeTaskInvalid
+	}
+	result := "success"
+	if task.State == Task.TaskStateFailed {
+		result = "failure"
+	}
+	metrics.TasksFinished.WithLabelValues(result).Inc()
+	n.logger().Info("task finished", "peer_id", slaveID, "task_id", task.ID, "task", task.Name, "state", task.State)
+	n.Events.Publish(&TaskFinishedEvent{Task: *task})
+	return task, nil
+}
+
+// releaseTasks 收回指定节点尚未结束的任务，待重新分配。
+func (n *Pool) releaseTasks(ctx context.Context, ids ...uint64) {
+	if n.registry == nil {
+		return
+	}
+	released, err := Task.ReleaseTasksOf(ctx, n.registry, ids...)
+	if err != nil {
+		n.logger().Error("failed to release tasks", "peer_ids", ids, "error", err)
+		return
+	}
+	if released > 0 {
+		metrics.TasksReleased.Add(float64(released))
+		n.logger().Info("tasks released", "peer_ids", ids, "released", released)
+	}
+}
+
+// recoverTasks 成为主节点后，收回分配给自己的任务，以及不能确定从节点是否已收到的任务（已分配但尚未确认）。
+func (n *Pool) recoverTasks(ctx context.Context) {
+	if n.registry == nil {
+		return
+	}
+	n.releaseTasks(ctx, n.Self.Node.ID)
+	released, err := Task.ReleaseUnacknowledgedTasks(ctx, n.registry)
+	if err != nil {
+		n.logger().Error("failed to release unacknowledged tasks", "error", err)
+		return
+	}
+	if released > 0 {
+		metrics.TasksReleased.Add(float64(released))
+		n.logger().Info("unacknowledged tasks released", "released", released)
+	}
+}
+
+// ---- Master ---- //
+
+// ---- Slave ---- //
+
+// ReceiveTask 当前节点（从节点）接受主节点 masterID 分配的任务，在后台执行，参见 Options.TaskHandler。
+// 已在执行的任务不再重复执行。
+//
+// 1. 若未设置任务执行者，则报 ErrNodeTaskHandlerMissing。
+//
+// 2. 若当前节点不是从节点，或 masterID 不是当前接受的主节点，则报 ErrNodeMasterInvalid。
+func (n *Pool) ReceiveTask(masterID uint64, task *Task.Task) error {
+	if n.taskHandler == nil {
+		return ErrNodeTaskHandlerMissing
+	}
+	if !n.IsIdentitySlave() || n.Master.Node == nil || n.Master.Node.ID != masterID {
+		return ErrNodeMasterInvalid
+	}
+	n.tasksLock.Lock()
+	defer n.tasksLock.Unlock()
+	if n.tasks == nil {
+		n.tasks = make(map[uint64]bool)
+	}
+	if n.tasks[task.ID] {
+		return nil
+	}
+	n.tasks[task.ID] = true
+	go n.runTask(task)
+	return nil
+}
+
+// runTask 执行任务，并向主节点报告结果。报告失败时按从节点间隔重试，至多 component.EnvTiming.SlaveRetryMax 次。
+func (n *Pool) runTask(task *Task.Task) {
+	defer func() {
+		n.tasksLock.Lock()
+		defer n.tasksLock.Unlock()
+		delete(n.tasks, task.ID)
+	}()
+	ctx := n.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	started := time.Now()
+	report := TaskReport{ID: task.ID}
+	result, err := n.taskHandler.HandleTask(ctx, task)
+	report.Result = result
+	if err != nil {
+		report.Error = err.Error()
+	}
+	n.logger().Info("task executed", "task_id", task.ID, "task", task.Name, "duration_ms", time.Since(started).Milliseconds(), "error", report.Error)
+	for attempt := uint8(1); ; attempt++ {
+		err := n.NotifyMasterTaskReport(ctx, &report)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, ErrNodeTaskInvalid) || attempt >= *n.Timing().SlaveRetryMax {
+			n.logger().Error("failed to report task", append(peer(n.Master.Node), "task_id", task.ID, "attempt", attempt, "error", err)...)
+			return
+		}
+		time.Sleep(n.Timing().GetSlaveInterval())
+	}
+}
+
+// SendRequestMasterTaskReport 向"主节点-任务报告"发送请求。
+func (n *Pool) SendRequestMasterTaskReport(ctx context.Context, report *TaskReport) (*http.Response, error) {
+	master := n.Master.Node
+	if master == nil {
+		return nil, ErrNodeMasterInvalid
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return nil, ErrNodeRequestInvalid
+	}
+	req, err := n.PrepareNodeRequest(ctx, RequestMethodMasterTaskReport, RequestURLFormatMasterTaskReport, master.Socket(), bytes.NewReader(body), "application/json")
+	if err != nil {
+		n.logger().Error("failed to prepare request", "error", err)
+		return nil, ErrNodeRequestInvalid
+	}
+	client := n.httpClient()
+	resp, err := client.Do(req)
+	return resp, err
+}
+
+// NotifyMasterTaskReport 当前节点（从节点）向主节点报告执行结果。
+//
+// 若主节点回复 409 Conflict，表示任务已被收回，报 ErrNodeTaskInvalid；其它状态码不是 200 OK 时报 ErrNodeRequestResponseError。
+func (n *Pool) NotifyMasterTaskReport(ctx context.Context, report *TaskReport) error {
+	resp, err := n.SendRequestMasterTaskReport(ctx, report)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return ErrNodeTaskInvalid
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		n.logger().Debug("task report refused", "status", resp.StatusCode, "body", string(body))
+		return ErrNodeRequestResponseError
+	}
+	return nil
+}
+
+// ---- Slave ---- //
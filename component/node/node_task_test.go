@@ -0,0 +1,53 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	Task "github.com/rhosocial/go-rush-producer/models/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectTaskAssignee(t *testing.T) {
+	t.Run("no candidates", func(t *testing.T) {
+		assert.Equal(t, uint64(0), selectTaskAssignee(nil, map[uint64]int64{2: 1}))
+	})
+	t.Run("least loaded", func(t *testing.T) {
+		assert.Equal(t, uint64(4), selectTaskAssignee([]uint64{2, 3, 4}, map[uint64]int64{2: 2, 3: 1}))
+	})
+	t.Run("tie goes to the first", func(t *testing.T) {
+		assert.Equal(t, uint64(2), selectTaskAssignee([]uint64{2, 3}, map[uint64]int64{2: 1, 3: 1}))
+	})
+}
+
+func TestPool_taskCandidates(t *testing.T) {
+	pool := Pool{Slaves: PoolSlaves{
+		Nodes:         map[uint64]NodeInfo.NodeInfo{2: {ID: 2}, 3: {ID: 3}, 4: {ID: 4}, 5: {ID: 5}},
+		NodesRetry:    map[uint64]uint8{4: 1},
+		NodesProtocol: map[uint64]*Protocol{},
+	}}
+	worker := &Protocol{Version: ProtocolVersion, Capabilities: []uint32{RequestSlaveTask}}
+	pool.Slaves.SetProtocol(5, worker)
+	pool.Slaves.SetProtocol(3, worker)
+	pool.Slaves.SetProtocol(4, worker)
+	pool.Slaves.SetProtocol(2, NewProtocol())
+	// 2 不支持执行任务，4 正在重试。
+	assert.Equal(t, []uint64{3, 5}, pool.taskCandidates())
+}
+
+func TestPool_ReceiveTask(t *testing.T) {
+	handler := TaskHandlerFunc(func(ctx context.Context, task *Task.Task) (string, error) { return "", nil })
+	t.Run("without task handler", func(t *testing.T) {
+		pool := Pool{Self: PoolSelf{Identity: IdentitySlave}, Master: PoolMaster{Node: &NodeInfo.NodeInfo{ID: 1}}}
+		assert.ErrorIs(t, pool.ReceiveTask(1, &Task.Task{ID: 1}), ErrNodeTaskHandlerMissing)
+	})
+	t.Run("not from master", func(t *testing.T) {
+		pool := Pool{Self: PoolSelf{Identity: IdentitySlave}, Master: PoolMaster{Node: &NodeInfo.NodeInfo{ID: 1}}, taskHandler: handler}
+		assert.ErrorIs(t, pool.ReceiveTask(2, &Task.Task{ID: 1}), ErrNodeMasterInvalid)
+	})
+	t.Run("not slave", func(t *testing.T) {
+		pool := Pool{Self: PoolSelf{Identity: IdentityMaster}, taskHandler: handler}
+		assert.ErrorIs(t, pool.ReceiveTask(1, &Task.Task{ID: 1}), ErrNodeMasterInvalid)
+	})
+}
@@ -1 +1,168 @@
 package node
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// newTestEnv 仅含默认值的配置。
+func newTestEnv() *component.Env {
+	var env component.Env
+	_ = component.ApplyEnvDefaults(&env)
+	_ = env.Validate()
+	return &env
+}
+
+func TestNewPool(t *testing.T) {
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewPool(Options{Registry: &gorm.DB{}})
+		assert.ErrorIs(t, err, ErrPoolOptionsInvalid)
+		_, err = NewPool(Options{Env: newTestEnv()})
+		assert.ErrorIs(t, err, ErrPoolOptionsInvalid)
+	})
+	t.Run("independent pools", func(t *testing.T) {
+		envA, envB := newTestEnv(), newTestEnv()
+		envA.Net.AdvertisedHost, envB.Net.AdvertisedHost = "10.0.0.1", "10.0.0.2"
+		slaveInterval := uint16(100)
+		timing := *envB.Timing
+		timing.SlaveInterval = &slaveInterval
+		a, err := NewPool(Options{Env: envA, Registry: &gorm.DB{}})
+		assert.Nil(t, err)
+		b, err := NewPool(Options{Env: envB, Registry: &gorm.DB{}, Timing: &timing, Name: "EMBEDDED", Version: "1.2.3"})
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.1", a.Self.Node.Host)
+		assert.Equal(t, NodeName, a.Self.Node.Name)
+		assert.Equal(t, "10.0.0.2", b.Self.Node.Host)
+		assert.Equal(t, "EMBEDDED", b.Self.Node.Name)
+		assert.Equal(t, "1.2.3", b.Self.Node.NodeVersion)
+		assert.Equal(t, envA.Timing, a.Timing())
+		assert.Equal(t, &timing, b.Timing())
+		assert.NotSame(t, a.Events, b.Events)
+		assert.True(t, a.IsIdentityNotDetermined())
+	})
+}
+
+func TestPool_reset(t *testing.T) {
+	env := newTestEnv()
+	env.Net.AdvertisedHost = "10.0.0.1"
+	pool, err := NewPool(Options{Env: env, Registry: &gorm.DB{}})
+	assert.Nil(t, err)
+	pool.Self.Identity = IdentitySlave
+	pool.Master.Accept(&NodeInfo.NodeInfo{ID: 1})
+	pool.Master.SetProtocol(NewProtocol())
+	pool.Slaves.AddSlaveNode(NodeInfo.NodeInfo{ID: 2})
+	pool.Slaves.SetProtocol(2, NewProtocol())
+	revision := pool.Slaves.GetRevision()
+
+	// 重置期间其它协程仍在访问从节点。
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			pool.Slaves.RetryClear(2)
+			pool.Slaves.Supports(2, RequestSlaveNotify)
+			pool.Master.GetProtocol()
+		}
+	}()
+	assert.Nil(t, pool.reset())
+	<-done
+
+	assert.True(t, pool.IsIdentityNotDetermined())
+	assert.Equal(t, "10.0.0.1", pool.Self.Node.Host)
+	assert.Nil(t, pool.Master.Node)
+	assert.Nil(t, pool.Master.GetProtocol())
+	assert.Empty(t, pool.Slaves.Nodes)
+	assert.Empty(t, pool.Slaves.NodesRetry)
+	assert.Nil(t, pool.Slaves.GetProtocol(2))
+	assert.Greater(t, pool.Slaves.GetRevision(), revision)
+	assert.NotNil(t, pool.Slaves.DetectInactiveCallback)
+	assert.NotNil(t, pool.Slaves.RemoveRetriedOutCallback)
+}
+
+func TestPool_Reload(t *testing.T) {
+	envA, envB := newTestEnv(), newTestEnv()
+	a, err := NewPool(Options{Env: envA, Registry: &gorm.DB{}})
+	assert.Nil(t, err)
+	b, err := NewPool(Options{Env: envB, Registry: &gorm.DB{}})
+	assert.Nil(t, err)
+
+	// 未记录来源的配置须指定加载方式。
+	_, err = a.Reload(context.Background(), nil)
+	assert.ErrorIs(t, err, component.ErrEnvSourceUnknown)
+
+	result, err := a.Reload(context.Background(), func() (*component.Env, error) {
+		next := newTestEnv()
+		threshold := uint8(9)
+		next.Failover.LossThreshold = &threshold
+		next.Node.Labels = map[string]string{"tier": "gold"}
+		return next, nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, result.IsApplied("Failover"))
+	assert.True(t, result.IsApplied("Node.Labels"))
+	assert.Equal(t, uint8(9), *envA.GetFailover().LossThreshold)
+	assert.Equal(t, "gold", a.Self.Node.Labels["tier"])
+	assert.NotEqual(t, uint8(9), *envB.GetFailover().LossThreshold)
+	assert.Empty(t, b.Self.Node.Labels)
+}
+
+func TestAddressSelector_Select(t *testing.T) {
+	candidates := []net.IP{
+		net.ParseIP("2001:db8::10"),
+		net.ParseIP("192.168.0.10").To4(),
+		net.ParseIP("10.0.0.10").To4(),
+		net.ParseIP("fd00::10"),
+	}
+	t.Run("prefer ipv4", func(t *testing.T) {
+		selector, err := NewAddressSelector(&component.EnvNet{IPPreference: component.IPPreferenceIPv4})
+		assert.Nil(t, err)
+		assert.Equal(t, "192.168.0.10", selector.Select(candidates).String())
+	})
+	t.Run("prefer ipv6", func(t *testing.T) {
+		selector, err := NewAddressSelector(&component.EnvNet{IPPreference: component.IPPreferenceIPv6})
+		assert.Nil(t, err)
+		assert.Equal(t, "2001:db8::10", selector.Select(candidates).String())
+	})
+	t.Run("cidr", func(t *testing.T) {
+		selector, err := NewAddressSelector(&component.EnvNet{IPPreference: component.IPPreferenceIPv4, CIDR: "10.0.0.0/8"})
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.10", selector.Select(candidates).String())
+		selector, err = NewAddressSelector(&component.EnvNet{IPPreference: component.IPPreferenceIPv6, CIDR: "fd00::/8"})
+		assert.Nil(t, err)
+		assert.Equal(t, "fd00::10", selector.Select(candidates).String())
+	})
+	t.Run("fallback to the other family", func(t *testing.T) {
+		selector, err := NewAddressSelector(&component.EnvNet{IPPreference: component.IPPreferenceIPv4, CIDR: "2001:db8::/32"})
+		assert.Nil(t, err)
+		assert.Equal(t, "2001:db8::10", selector.Select(candidates).String())
+	})
+	t.Run("no match", func(t *testing.T) {
+		selector, err := NewAddressSelector(&component.EnvNet{CIDR: "172.16.0.0/12"})
+		assert.Nil(t, err)
+		assert.Nil(t, selector.Select(candidates))
+	})
+	t.Run("invalid cidr", func(t *testing.T) {
+		_, err := NewAddressSelector(&component.EnvNet{CIDR: "10.0.0.0"})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetIPFromAddr(t *testing.T) {
+	assert.Nil(t, getIPFromAddr(&net.IPNet{IP: net.ParseIP("127.0.0.1")}))
+	assert.Nil(t, getIPFromAddr(&net.IPNet{IP: net.ParseIP("::1")}))
+	assert.Nil(t, getIPFromAddr(&net.IPNet{IP: net.ParseIP("fe80::1")}))
+	assert.Equal(t, "10.0.0.1", getIPFromAddr(&net.IPNet{IP: net.ParseIP("10.0.0.1")}).String())
+	assert.Equal(t, "2001:db8::1", getIPFromAddr(&net.IPAddr{IP: net.ParseIP("2001:db8::1")}).String())
+}
+
+func TestIsAdvertisedHostObserved(t *testing.T) {
+	assert.True(t, IsAdvertisedHostObserved("2001:db8::1", "2001:DB8:0::1"))
+	assert.True(t, IsAdvertisedHostObserved("::ffff:10.0.0.1", "10.0.0.1"))
+	assert.False(t, IsAdvertisedHostObserved("203.0.113.10", "172.17.0.2"))
+}
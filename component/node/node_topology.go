@@ -0,0 +1,198 @@
+package node
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/models"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+)
+
+const (
+	TopologyEventJoined     = "joined"     // 从节点加入。
+	TopologyEventWithdrawn  = "withdrawn"  // 从节点主动退出。
+	TopologyEventModified   = "modified"   // 从节点修改了自身信息。
+	TopologyEventInactive   = "inactive"   // 主节点发现从节点不活跃。
+	TopologyEventRemoved    = "removed"    // 主节点因重试次数超限移除从节点。
+	TopologyEventHandover   = "handover"   // 主节点开始向候选节点交接。
+	TopologyEventSuperseded = "superseded" // 当前节点接替了主节点。事件涉及节点为自己。
+	TopologyEventSwitched   = "switched"   // 当前节点按通知切换到新的主节点。事件涉及节点为新的主节点。
+)
+
+const (
+	TopologyJournalCapacity   = 1024 // 拓扑事件日志保留的最大事件数。
+	TopologySubscriberBacklog = 64   // 每个订阅者最多可积压的事件数。超出后订阅将被关闭。
+)
+
+var ErrTopologyJournalTruncated = errors.New("the requested topology events have been truncated")
+var ErrTopologyCursorInvalid = errors.New("invalid topology cursor")
+
+// TopologyCursor 拓扑事件流中的位置。序号只在同一日志内有意义：日志随进程重建，序号从 1 重新开始，
+// 其它节点的日志也各自编号，因此位置须同时指明日志。
+type TopologyCursor struct {
+	Stream   string // 日志ID，参见 TopologyJournal.ID。
+	Sequence uint64 // 已收到的最后一个事件序号。
+}
+
+// String 格式为 "<日志ID>:<序号>"，用作事件流的事件ID。
+func (c TopologyCursor) String() string {
+	return c.Stream + ":" + strconv.FormatUint(c.Sequence, 10)
+}
+
+// ParseTopologyCursor 解析 TopologyCursor.String 的结果。格式不正确则报 ErrTopologyCursorInvalid。
+func ParseTopologyCursor(value string) (TopologyCursor, error) {
+	index := strings.LastIndex(value, ":")
+	if index <= 0 {
+		return TopologyCursor{}, fmt.Errorf("%w: %s", ErrTopologyCursorInvalid, value)
+	}
+	sequence, err := strconv.ParseUint(value[index+1:], 10, 64)
+	if err != nil {
+		return TopologyCursor{}, fmt.Errorf("%w: %s", ErrTopologyCursorInvalid, value)
+	}
+	return TopologyCursor{Stream: value[:index], Sequence: sequence}, nil
+}
+
+// TopologyEvent 拓扑事件。
+type TopologyEvent struct {
+	Stream    string                     `json:"stream"`         // 所属日志ID，参见 TopologyJournal.ID。
+	Sequence  uint64                     `json:"sequence"`       // 事件序号，在所属日志内从 1 开始递增。
+	Type      string                     `json:"type"`           // 事件类型，参见 TopologyEvent* 常量。
+	NodeID    uint64                     `json:"node_id"`        // 事件涉及节点ID。
+	Node      *models.RegisteredNodeInfo `json:"node,omitempty"` // 事件涉及节点信息。
+	Timestamp int64                      `json:"timestamp"`      // 事件发生时间（毫秒）。
+}
+
+// Cursor 该事件在事件流中的位置。
+func (e *TopologyEvent) Cursor() TopologyCursor {
+	return TopologyCursor{Stream: e.Stream, Sequence: e.Sequence}
+}
+
+// TopologyJournal 拓扑事件日志。保留最近的事件，供订阅者从指定位置之后恢复。
+type TopologyJournal struct {
+	id          string
+	events      []TopologyEvent
+	sequence    uint64
+	subscribers map[chan TopologyEvent]struct{}
+	lock        sync.RWMutex
+}
+
+// NewTopologyJournal 创建拓扑事件日志。日志ID由创建时间和随机数组成，各节点、各次启动均不相同。
+func NewTopologyJournal() *TopologyJournal {
+	random := make([]byte, 4)
+	_, _ = rand.Read(random)
+	return &TopologyJournal{
+		id:          strconv.FormatInt(time.Now().UnixMilli(), 36) + "-" + hex.EncodeToString(random),
+		events:      make([]TopologyEvent, 0, TopologyJournalCapacity),
+		subscribers: make(map[chan TopologyEvent]struct{}),
+	}
+}
+
+// ID 日志ID。
+func (j *TopologyJournal) ID() string {
+	return j.id
+}
+
+// Sequence 获取最新事件序号。尚无事件时为 0。
+func (j *TopologyJournal) Sequence() uint64 {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.sequence
+}
+
+// Cursor 获取最新事件的位置。从该位置订阅只会收到此后的事件。
+func (j *TopologyJournal) Cursor() TopologyCursor {
+	return TopologyCursor{Stream: j.id, Sequence: j.Sequence()}
+}
+
+// Append 追加事件，并分发给所有订阅者。积压已满的订阅者将被关闭，需要自行从最后收到的序号恢复。
+// 同时递增对应的运行指标，参见 observeTopologyEvent。
+func (j *TopologyJournal) Append(eventType string, node *NodeInfo.NodeInfo) TopologyEvent {
+	observeTopologyEvent(eventType)
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.sequence++
+	event := TopologyEvent{
+		Stream:    j.id,
+		Sequence:  j.sequence,
+		Type:      eventType,
+		Node:      node.ToRegisteredNodeInfo(),
+		Timestamp: time.Now().UnixMilli(),
+	}
+	if node != nil {
+		event.NodeID = node.ID
+	}
+	if len(j.events) == TopologyJournalCapacity {
+		j.events = append(j.events[:0], j.events[1:]...)
+	}
+	j.events = append(j.events, event)
+	for ch := range j.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(j.subscribers, ch)
+			close(ch)
+		}
+	}
+	return event
+}
+
+// since 获取 cursor 之后的事件。调用前必须持有锁。
+func (j *TopologyJournal) since(cursor TopologyCursor) ([]TopologyEvent, error) {
+	if cursor.Stream != j.id {
+		return nil, ErrTopologyJournalTruncated
+	}
+	sequence := cursor.Sequence
+	if sequence > j.sequence {
+		return nil, ErrTopologyJournalTruncated
+	}
+	if len(j.events) > 0 && sequence+1 < j.events[0].Sequence {
+		return nil, ErrTopologyJournalTruncated
+	}
+	result := make([]TopologyEvent, 0)
+	for _, event := range j.events {
+		if event.Sequence > sequence {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+// Since 获取 cursor 之后的事件。
+//
+// 若 cursor 属于其它日志（例如其它节点，或本节点重启前），所需事件已被清出日志，或序号大于最新序号，
+// 则报 ErrTopologyJournalTruncated。
+func (j *TopologyJournal) Since(cursor TopologyCursor) ([]TopologyEvent, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.since(cursor)
+}
+
+// Subscribe 订阅 cursor 之后的事件。返回已有的积压事件、后续事件通道和取消订阅函数。
+//
+// 积压事件与后续事件之间不会遗漏或重复。若无法从 cursor 恢复，则报 ErrTopologyJournalTruncated，参见 Since。
+// 事件通道被关闭表示订阅者处理过慢，已被取消订阅。
+func (j *TopologyJournal) Subscribe(cursor TopologyCursor) ([]TopologyEvent, <-chan TopologyEvent, func(), error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	backlog, err := j.since(cursor)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ch := make(chan TopologyEvent, TopologySubscriberBacklog)
+	j.subscribers[ch] = struct{}{}
+	cancel := func() {
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		if _, exist := j.subscribers[ch]; exist {
+			delete(j.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel, nil
+}
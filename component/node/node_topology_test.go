@@ -0,0 +1,85 @@
+package node
+
+import (
+	"testing"
+
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopologyJournal_Subscribe(t *testing.T) {
+	slave := NodeInfo.NodeInfo{ID: 2, Port: 8081, Level: 1, SuperiorID: 1, Turn: 1}
+
+	t.Run("resume from sequence", func(t *testing.T) {
+		journal := NewTopologyJournal()
+		journal.Append(TopologyEventJoined, &slave)
+		journal.Append(TopologyEventInactive, &slave)
+		backlog, events, cancel, err := journal.Subscribe(TopologyCursor{Stream: journal.ID(), Sequence: 1})
+		assert.Nil(t, err)
+		defer cancel()
+		assert.Len(t, backlog, 1)
+		assert.Equal(t, TopologyEventInactive, backlog[0].Type)
+		assert.Equal(t, uint64(2), backlog[0].NodeID)
+
+		journal.Append(TopologyEventRemoved, &slave)
+		event := <-events
+		assert.Equal(t, uint64(3), event.Sequence)
+		assert.Equal(t, TopologyEventRemoved, event.Type)
+		assert.Equal(t, journal.Cursor(), event.Cursor())
+	})
+	t.Run("other journal", func(t *testing.T) {
+		// 接替后的新主节点或重启后的本节点有各自的日志，序号虽在范围内也不能恢复。
+		previous := NewTopologyJournal()
+		previous.Append(TopologyEventJoined, &slave)
+		journal := NewTopologyJournal()
+		journal.Append(TopologyEventJoined, &slave)
+		journal.Append(TopologyEventInactive, &slave)
+		assert.NotEqual(t, previous.ID(), journal.ID())
+
+		_, _, _, err := journal.Subscribe(previous.Cursor())
+		assert.ErrorIs(t, err, ErrTopologyJournalTruncated)
+		_, err = journal.Since(TopologyCursor{Sequence: 1})
+		assert.ErrorIs(t, err, ErrTopologyJournalTruncated)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		journal := NewTopologyJournal()
+		for i := 0; i < TopologyJournalCapacity+1; i++ {
+			journal.Append(TopologyEventJoined, &slave)
+		}
+		_, _, _, err := journal.Subscribe(TopologyCursor{Stream: journal.ID()})
+		assert.ErrorIs(t, err, ErrTopologyJournalTruncated)
+		backlog, _, cancel, err := journal.Subscribe(TopologyCursor{Stream: journal.ID(), Sequence: 1})
+		assert.Nil(t, err)
+		assert.Len(t, backlog, TopologyJournalCapacity)
+		cancel()
+		_, _, _, err = journal.Subscribe(TopologyCursor{Stream: journal.ID(), Sequence: journal.Sequence() + 1})
+		assert.ErrorIs(t, err, ErrTopologyJournalTruncated)
+	})
+	t.Run("slow subscriber", func(t *testing.T) {
+		journal := NewTopologyJournal()
+		_, events, cancel, err := journal.Subscribe(journal.Cursor())
+		assert.Nil(t, err)
+		defer cancel()
+		for i := 0; i < TopologySubscriberBacklog+1; i++ {
+			journal.Append(TopologyEventJoined, &slave)
+		}
+		received := 0
+		for range events {
+			received++
+		}
+		assert.Equal(t, TopologySubscriberBacklog, received)
+	})
+}
+
+func TestParseTopologyCursor(t *testing.T) {
+	journal := NewTopologyJournal()
+	journal.Append(TopologyEventJoined, &NodeInfo.NodeInfo{ID: 2})
+	cursor, err := ParseTopologyCursor(journal.Cursor().String())
+	assert.Nil(t, err)
+	assert.Equal(t, journal.Cursor(), cursor)
+
+	for _, value := range []string{"", "1", ":1", "stream:", "stream:-1", "stream:x"} {
+		_, err := ParseTopologyCursor(value)
+		assert.ErrorIs(t, err, ErrTopologyCursorInvalid, value)
+	}
+}
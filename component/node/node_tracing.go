@@ -0,0 +1,33 @@
+package node
+
+import (
+	"context"
+
+	"github.com/rhosocial/go-rush-producer/component/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	attributeNodeID       = attribute.Key("node.id")       // 本节点ID。
+	attributeNodeIdentity = attribute.Key("node.identity") // 本节点身份，参见 IdentityName。
+	attributePeerID       = attribute.Key("peer.id")       // 对端节点ID。
+	attributeCause        = attribute.Key("node.cause")    // 停止或切换的原因。
+)
+
+// startSpan 创建节点操作的 span，名称为 "node." 加 operation，附带本节点ID和身份。调用方须以 tracing.End 结束返回的 span。
+func (n *Pool) startSpan(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attributes := append([]attribute.KeyValue{attributeNodeIdentity.String(IdentityName(n.Self.Identity))}, attrs...)
+	if n.Self.Node != nil {
+		attributes = append(attributes, attributeNodeID.Int64(int64(n.Self.Node.ID)))
+	}
+	return tracing.Start(ctx, "node."+operation, attributes...)
+}
+
+// causeAttribute 原因属性。cause 为空时记为空字符串。
+func causeAttribute(cause error) attribute.KeyValue {
+	if cause == nil {
+		return attributeCause.String("")
+	}
+	return attributeCause.String(cause.Error())
+}
@@ -5,28 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
-	"sync"
 	"time"
 
-	"github.com/rhosocial/go-rush-producer/component"
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
 )
 
-type WorkerSlaveIntervals struct {
-	Base uint16 `json:"base"`
-}
-
-func (n *Pool) AttachWorkerSlaveWorkerCallbacks(fn func(ctx context.Context, nodes *Pool)) {
-	n.Self.workerSlaveCallbacksRWLock.Lock()
-	defer n.Self.workerSlaveCallbacksRWLock.Unlock()
-	n.Self.workerSlaveCallbacks = append(n.Self.workerSlaveCallbacks, fn)
-}
-
-// worker 以"从节点"身份执行。
-func (ps *PoolSlaves) worker(ctx context.Context, interval WorkerSlaveIntervals, nodes *Pool) {
-	if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-		logPrintln("Worker Slave is working...")
-	}
+// worker 以"从节点"身份执行。每轮间隔取自当前配置，参见 component.EnvTiming.SlaveInterval。
+func (ps *PoolSlaves) worker(ctx context.Context, nodes *Pool) {
+	nodes.logger().Debug("slave worker is working")
 	if nodes.Self.Node == nil {
 		return
 	}
@@ -34,121 +20,145 @@ func (ps *PoolSlaves) worker(ctx context.Context, interval WorkerSlaveIntervals,
 		return
 	}
 	for {
-		time.Sleep(time.Duration(interval.Base) * time.Millisecond)
+		time.Sleep(nodes.Timing().GetSlaveInterval())
 		select {
 		case <-ctx.Done():
-			logPrintln("Worker Slave stopped, due to", context.Cause(ctx))
+			nodes.logger().Info("slave worker stopped", "cause", context.Cause(ctx))
 			return
 		default:
+			ps.Tick(time.Now())
 			if !workerSlaveCheckMaster(ctx, nodes) {
 				continue
 			}
-			fns := nodes.Self.workerSlaveCallbacks
-			for _, fn := range fns {
-				fn(ctx, nodes)
-			}
+			go nodes.tickShards(ctx)
+			nodes.Events.Publish(&WorkerTickedEvent{Identity: IdentitySlave})
 		}
 	}
 }
 
+// workerSlaveCheckMaster 检查主节点。
+//
+// 若已知主节点支持心跳（RequestMasterHeartbeat），则推送心跳，参见 NotifyMasterHeartbeat；
+// 否则请求主节点状态，参见 CheckMaster。首次检查时主节点协议未知，总是请求主节点状态。
+//
+// 若已重新加入主节点或已接替主节点，则返回 false。
 func workerSlaveCheckMaster(ctx context.Context, nodes *Pool) bool {
-	resp, err := nodes.CheckMaster(nodes.Master.Node)
-	if err != nil {
-		nodes.Master.RetryUp()
-		logPrintln(err, nodes.Master.Retry)
-	}
-	//if err == nil {
-	//	nodes.Master.RetryClear()
-	//} else {
-	//	nodes.Master.RetryUp()
-	//	logPrintln(err, nodes.Master.Retry)
-	//}
-	// 检查自己是否存在。
-	if resp != nil {
-		var respContent RequestMasterStatusResponse
-		var body = make([]byte, resp.ContentLength)
-		if _, err := resp.Body.Read(body); err != nil && err != io.EOF {
-			logPrintln(ErrNodeRequestResponseError)
-		}
-		err = json.Unmarshal(body, &respContent)
+	if protocol := nodes.Master.GetProtocol(); protocol != nil && protocol.Supports(RequestMasterHeartbeat) {
+		data, err := nodes.NotifyMasterHeartbeat(ctx)
 		if err != nil {
-			logPrintln("Worker Slave:", err)
-		}
-		if !respContent.Data.Attended {
-			// 如果发现自己不存在，则尝试重新加入。
-			nodes.Stop(ErrNodeSlaveInvalid)
-			self := NodeInfo.NewNodeInfo("GO-RUSH-PRODUCER", "0.0.1", *(*(*component.GlobalEnv).Net).ListenPort, 1)
-			Nodes = NewNodePool(self)
-			err := nodes.Start(context.Background(), IdentitySlave)
-			if err != nil {
-				logPrintln(err)
-			}
-		}
-		if respContent.Data.IsMasterWorking {
-			// 主节点正在工作，更新重试计数。
-			nodes.Master.RetryClear()
-		} else {
-			logPrintln(ErrNodeMasterWorkerStopped.Error())
-			nodes.Master.RetryUp()
+			retry := nodes.Master.RetryUp()
+			nodes.logger().Warn("master heartbeat failed", append(peer(nodes.Master.Node), "retry", retry, "error", err)...)
+		} else if !workerSlaveHandleMasterReport(ctx, nodes, data.Attended, data.IsMasterWorking) {
+			return false
 		}
+	} else if !workerSlavePollMasterStatus(ctx, nodes) {
+		return false
 	}
-	// TODO: <参数点> 从节点检查主节点最大重试次数。
-	if nodes.Master.Retry >= 3 {
+	// 从节点检查主节点最大重试次数，参见 component.EnvTiming.SlaveRetryMax。
+	if nodes.Master.Retry >= *nodes.Timing().SlaveRetryMax {
 		go func(master *NodeInfo.NodeInfo) {
-			_, err := nodes.Self.Node.LogReportExistedNodeSlaveReportMasterInactive(master)
+			_, err := nodes.Self.Node.LogReportExistedNodeSlaveReportMasterInactive(nodes.registry, master)
 			if err != nil {
-				logPrintln(err)
+				nodes.logger().Error("failed to log master inactive", append(peer(master), "error", err)...)
 			}
 		}(nodes.Master.Node)
 		// TODO: 重试次数过多，尝试主动接替。
-		logPrintln("retried out, try to supersede:")
-		err := nodes.TrySupersede()
+		// 按主节点报告的接替次序推迟接替，使首选接替者优先。
+		if delay := nodes.SupersedeDelay(time.Duration(*nodes.Env().GetFailover().SupersedeStep) * time.Millisecond); delay > 0 {
+			nodes.logger().Info("master retried out, waiting before superseding", append(peer(nodes.Master.Node), "delay_ms", delay.Milliseconds())...)
+			time.Sleep(delay)
+		}
+		nodes.logger().Info("master retried out, trying to supersede", peer(nodes.Master.Node)...)
+		err := nodes.TrySupersede(ctx)
 		if err != nil {
 			// 表示已经有其它主节点，刷新主节点。
-			logPrintln(err)
-			fresh, err := nodes.DiscoverMasterNode(false)
+			nodes.logger().Warn("failed to supersede", "error", err)
+			fresh, err := nodes.DiscoverMasterNode(ctx, false)
 			if err != nil {
 				return true
 			}
 			nodes.AcceptMaster(fresh)
 			return true
 		}
-		nodes.Supersede(nodes.Master.Node.ToRegisteredNodeInfo())
+		nodes.Supersede(ctx, nodes.Master.Node.ToRegisteredNodeInfo())
 		return false
 	}
 	return true
 }
 
-type WorkerMasterIntervals struct {
-	Base uint16 `json:"base"`
+// workerSlavePollMasterStatus 请求主节点状态，并记录主节点的协议、从节点集合版本和主从节点信息。
+// 若已重新加入主节点，则返回 false，参见 workerSlaveHandleMasterReport。
+func workerSlavePollMasterStatus(ctx context.Context, nodes *Pool) bool {
+	resp, err := nodes.CheckMaster(ctx, nodes.Master.Node)
+	if err != nil {
+		retry := nodes.Master.RetryUp()
+		nodes.logger().Warn("master status check failed", append(peer(nodes.Master.Node), "retry", retry, "error", err)...)
+	}
+	// 检查自己是否存在。
+	if resp != nil {
+		defer resp.Body.Close()
+		var respContent RequestMasterStatusResponse
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			nodes.logger().Warn("failed to read master status", append(peer(nodes.Master.Node), "error", err)...)
+		}
+		err = json.Unmarshal(body, &respContent)
+		if err != nil {
+			nodes.logger().Warn("failed to parse master status", append(peer(nodes.Master.Node), "error", err)...)
+		}
+		if protocol := respContent.Data.Protocol; protocol != nil {
+			nodes.Master.SetProtocol(protocol)
+			if err := protocol.IsCompatible(); err != nil {
+				nodes.logger().Warn("master protocol is incompatible", append(peer(nodes.Master.Node), "protocol_version", protocol.Version, "protocol_version_minimum", ProtocolVersionMinimum)...)
+			}
+		}
+		nodes.Master.Report(respContent.Data.Revision, &respContent.Extension)
+		return workerSlaveHandleMasterReport(ctx, nodes, respContent.Data.Attended, respContent.Data.IsMasterWorking)
+	}
+	return true
 }
 
-func (n *Pool) AttachWorkerMasterWorkerCallbacks(fn func(ctx context.Context, nodes *Pool)) {
-	n.Self.workerMasterCallbacksRWLock.Lock()
-	defer n.Self.workerMasterCallbacksRWLock.Unlock()
-	n.Self.workerMasterCallbacks = append(n.Self.workerMasterCallbacks, fn)
+// workerSlaveHandleMasterReport 处理主节点报告的状态。
+//
+// 1. 如果发现自己不存在，则尝试重新加入，并返回 false。重新加入后由新的工作协程继续，当前工作协程应退出。
+//
+// 2. 如果主节点正在工作，则清空重试次数，否则重试次数递增。
+func workerSlaveHandleMasterReport(ctx context.Context, nodes *Pool, attended bool, isMasterWorking bool) bool {
+	if !attended {
+		// 如果发现自己不存在，则尝试重新加入。
+		nodes.Stop(ctx, ErrNodeSlaveInvalid)
+		err := nodes.Restart(context.Background(), IdentitySlave)
+		if err != nil {
+			nodes.logger().Error("failed to rejoin master", "error", err)
+		}
+		return false
+	}
+	if isMasterWorking {
+		// 主节点正在工作，更新重试计数。
+		nodes.Master.RetryClear()
+	} else {
+		retry := nodes.Master.RetryUp()
+		nodes.logger().Warn("master worker stopped", append(peer(nodes.Master.Node), "retry", retry)...)
+	}
+	return true
 }
 
-// worker 以"主节点"身份执行。
-func (pm *PoolMaster) worker(ctx context.Context, interval WorkerMasterIntervals, nodes *Pool) {
+// worker 以"主节点"身份执行。每轮间隔取自当前配置，参见 component.EnvTiming.MasterInterval。
+func (pm *PoolMaster) worker(ctx context.Context, nodes *Pool) {
 	for {
-		time.Sleep(time.Duration(interval.Base) * time.Millisecond)
+		time.Sleep(nodes.Timing().GetMasterInterval())
 		select {
 		case <-ctx.Done():
-			logPrintln("Worker Master stopped, due to", context.Cause(ctx))
+			nodes.logger().Info("master worker stopped", "cause", context.Cause(ctx))
 			return
 		default:
+			pm.Tick(time.Now())
 			workerMaster(ctx, nodes)
-			fns := nodes.Self.workerMasterCallbacks
-			for _, fn := range fns {
-				fn(ctx, nodes)
-			}
+			nodes.Events.Publish(&WorkerTickedEvent{Identity: IdentityMaster})
 		}
 	}
 }
 
-var intervalCheckSelf = 0
-var intervalCheckSelfRWMutex sync.RWMutex
 var ErrNodeMasterRecordIsNotValid = errors.New("the record of master is not valid")
 
 // workerMaster 主节点任务。
@@ -157,32 +167,41 @@ var ErrNodeMasterRecordIsNotValid = errors.New("the record of master is not vali
 //
 // 2. 报告自己活跃。
 //
-// 3. 每十秒检查一次数据表自己的信息是否与自己相等。
+// 3. 每 component.EnvTiming.CheckSelfTicks 次检查一次数据表自己的信息是否与自己相等。
+//
+// 4. 分配待分配的任务，参见 Pool.assignTasks。
+//
+// 5. 重新计算分片归属并同步自己的分片，参见 Pool.tickShards。
+//
+// 6. 执行到期的定时任务，参见 Pool.runJobs。
 func workerMaster(ctx context.Context, nodes *Pool) {
-	if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
-		logPrintln("Worker Master is working...")
-	}
-	go nodes.Slaves.RetryUpAllAndRemoveIfRetriedOut(3, 4) // 1. 调增所有子节点重试次数。超过重试次数上限则直接删除，并不通知对方。TODO: <参数点> 超限次数，最小不应低于3。
+	nodes.logger().Debug("master worker is working")
+	timing := nodes.Timing()
+	go nodes.Slaves.RetryUpAllAndRemoveIfRetriedOut(nodes.registry, *timing.SlaveInactiveLimit, *timing.SlaveRemoveLimit) // 1. 调增所有子节点重试次数。超过重试次数上限则直接删除，并不通知对方。
 	go func() {
-		if nodes.Self.AliveUpAndClearIf(10) == 9 { // 2. 报告自己活跃。 TODO: <参数点> 报告活跃间隔。
-			if _, err := nodes.Self.Node.LogReportActive(); err != nil {
-				logPrintln(err)
+		if nodes.Self.AliveUpAndClearIf(*timing.ActiveReportTicks) == *timing.ActiveReportTicks-1 { // 2. 报告自己活跃。
+			if _, err := nodes.Self.Node.LogReportActive(nodes.registry); err != nil {
+				nodes.logger().Error("failed to log active", "error", err)
 			}
 		}
-		// 每十秒检查一次
+		// 每 CheckSelfTicks 次检查一次
 		// 1. 数据表自己的信息是否与自己相等；
 		// 2. 是否有失效节点记录。
-		intervalCheckSelfRWMutex.Lock()
-		defer intervalCheckSelfRWMutex.Unlock()
-		intervalCheckSelf++
-		if intervalCheckSelf%10 == 0 {
-			intervalCheckSelf = 0
-			if !nodes.Self.CheckSelf() {
-				err := nodes.stopMaster(ErrNodeMasterRecordIsNotValid)
+		nodes.checkSelfLock.Lock()
+		defer nodes.checkSelfLock.Unlock()
+		nodes.checkSelfCounter++
+		if nodes.checkSelfCounter%int(*timing.CheckSelfTicks) == 0 {
+			nodes.checkSelfCounter = 0
+			if !nodes.Self.CheckSelf(nodes.registry) {
+				nodes.logger().Error("master record is not valid, stopping")
+				err := nodes.stopMaster(ctx, ErrNodeMasterRecordIsNotValid)
 				if err != nil {
-					logPrintln(err)
+					nodes.logger().Error("failed to stop master", "error", err)
 				}
 			}
 		}
 	}()
+	go nodes.assignTasks(ctx) // 4. 分配任务。
+	go nodes.tickShards(ctx)  // 5. 分片。
+	go nodes.runJobs(ctx)     // 6. 定时任务。
 }
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RoundTripper 为节点间请求创建客户端 span，并将追踪上下文写入请求头，参见 Inject。父 span 取自请求的上下文。
+//
+// 仅当请求的上下文中已有 span 时才创建，原因同 GormPlugin；否则原样发送请求。
+type RoundTripper struct {
+	Next http.RoundTripper // 实际发送请求的 RoundTripper。为空时使用 http.DefaultTransport。
+}
+
+// RoundTrip 实现 http.RoundTripper。
+func (t *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if !trace.SpanContextFromContext(req.Context()).IsValid() {
+		return next.RoundTrip(req)
+	}
+	ctx, span := Tracer().Start(req.Context(), req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPMethod(req.Method), semconv.HTTPURL(req.URL.String()), semconv.NetPeerName(req.URL.Host)),
+	)
+	// RoundTripper 不应修改传入的请求，因此在副本上写入请求头。
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := next.RoundTrip(req)
+	if err == nil {
+		span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	End(span, err)
+	return resp, err
+}
+
+// Middleware 为收到的请求创建服务端 span。若请求头中带有追踪上下文，则以其为父 span。
+//
+// span 所在的上下文会替换请求的上下文，处理请求时应通过 c.Request.Context() 传递。
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := Extract(c.Request.Context(), c.Request.Header)
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = c.Request.URL.Path
+		}
+		ctx, span := Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(c.Request.Method), semconv.HTTPRoute(route), semconv.HTTPTarget(c.Request.URL.RequestURI())),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
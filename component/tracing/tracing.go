@@ -0,0 +1,159 @@
+// Package tracing 分布式追踪。基于 OpenTelemetry，追踪上下文以 W3C Trace Context 格式在节点间请求头中传递，
+// 从而将跨越多个节点的操作（例如交接主节点）串联为同一条追踪链路。
+//
+// 未调用 Setup 或导出方式为 ExporterNone 时不记录 span，但仍会传递收到的追踪上下文。
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone = "none" // 不导出。
+	ExporterOTLP = "otlp" // 以 OTLP/HTTP 导出到收集器。
+	ExporterFile = "file" // 以逐行 JSON 追加到文件。
+)
+
+// InstrumentationName 本服务创建 span 所用 Tracer 的名称。
+const InstrumentationName = "github.com/rhosocial/go-rush-producer"
+
+var ErrExporterInvalid = errors.New("invalid trace exporter")
+
+// ValidateExporter 校验导出方式。
+func ValidateExporter(exporter string) error {
+	if exporter != ExporterNone && exporter != ExporterOTLP && exporter != ExporterFile {
+		return fmt.Errorf("%w: %s", ErrExporterInvalid, exporter)
+	}
+	return nil
+}
+
+// Options 追踪设置。
+type Options struct {
+	Exporter       string               // 导出方式，参见 ExporterNone、ExporterOTLP 和 ExporterFile。
+	Endpoint       string               // OTLP/HTTP 收集器地址，形如 localhost:4318。
+	TLS            bool                 // 是否以 HTTPS 连接收集器。
+	File           string               // 导出文件路径。
+	SampleRatio    float64              // 根 span 的采样比例，取值 0 至 1。从属 span 跟随上游的采样决定。
+	ServiceName    string               // 服务名称。
+	ServiceVersion string               // 服务版本。
+	Attributes     []attribute.KeyValue // 附加到所有 span 的资源属性，例如节点所在可用区。
+}
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Setup 按 options 设置全局 TracerProvider，返回关闭函数。退出前应调用关闭函数，以导出尚未导出的 span。
+//
+// 若导出方式为 ExporterNone，则不作任何设置，关闭函数什么也不做。
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	if err := ValidateExporter(options.Exporter); err != nil {
+		return nil, err
+	}
+	if options.Exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch options.Exporter {
+	case ExporterOTLP:
+		clientOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(options.Endpoint)}
+		if !options.TLS {
+			clientOptions = append(clientOptions, otlptracehttp.WithInsecure())
+		}
+		otlp, err := otlptracehttp.New(ctx, clientOptions...)
+		if err != nil {
+			return nil, err
+		}
+		exporter = otlp
+	case ExporterFile:
+		file, err := os.OpenFile(options.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		exporter, closeFile = stdout, file.Close
+	}
+	attributes := append([]attribute.KeyValue{
+		semconv.ServiceName(options.ServiceName),
+		semconv.ServiceVersion(options.ServiceVersion),
+	}, options.Attributes...)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, attributes...)),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			if closeErr := closeFile(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Tracer 本服务的 Tracer。每次调用时从全局 TracerProvider 获取，因此 Setup 前后均可使用。
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// Start 以 ctx 中的 span 为父 span 创建新的 span。调用方须以 End 结束返回的 span。
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束 span。若 err 非空，则记录错误并将状态置为 codes.Error。
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject 将 ctx 中的追踪上下文写入请求头。
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Extract 从请求头中读取追踪上下文，返回以其为父 span 的上下文。
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceID 取得 ctx 中 span 的追踪ID，便于与日志对应。若没有有效的 span，则返回空。
+func TraceID(ctx context.Context) string {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		return spanContext.TraceID().String()
+	}
+	return ""
+}
+
+// Detach 返回仅保留 ctx 中 span 的上下文，不随 ctx 取消，也不继承其截止时间。
+//
+// 适用于可能比发起方存活更久的操作，例如收到的请求结束后仍在进行的节点间通知；这些操作的超时由自身控制。
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func newTracedServer(t *testing.T) (*httptest.Server, *string) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	var received string
+	r.GET("/server/slave", func(c *gin.Context) {
+		received = TraceID(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server, &received
+}
+
+func TestRoundTripper(t *testing.T) {
+	recorder := setupRecorder(t)
+	server, received := newTracedServer(t)
+	client := http.Client{Transport: &RoundTripper{}}
+
+	t.Run("propagated", func(t *testing.T) {
+		ctx, span := Start(context.Background(), "node.Handover")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/server/slave", nil)
+		assert.Nil(t, err)
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		End(span, nil)
+		assert.Equal(t, TraceID(ctx), *received)
+		assert.Empty(t, req.Header.Get("traceparent"), "the original request should not be modified")
+
+		spans := recorder.Ended()
+		assert.Len(t, spans, 3)
+		spanOf := make(map[trace.SpanKind]sdktrace.ReadOnlySpan)
+		for _, s := range spans {
+			spanOf[s.SpanKind()] = s
+		}
+		opSpan, clientSpan, serverSpan := spanOf[trace.SpanKindInternal], spanOf[trace.SpanKindClient], spanOf[trace.SpanKindServer]
+		assert.Equal(t, "node.Handover", opSpan.Name())
+		assert.Equal(t, "GET /server/slave", serverSpan.Name())
+		assert.Equal(t, opSpan.SpanContext().SpanID(), clientSpan.Parent().SpanID())
+		assert.Equal(t, clientSpan.SpanContext().SpanID(), serverSpan.Parent().SpanID())
+		assert.True(t, serverSpan.Parent().IsRemote())
+	})
+	t.Run("without parent", func(t *testing.T) {
+		before := len(recorder.Ended())
+		resp, err := client.Get(server.URL + "/server/slave")
+		assert.Nil(t, err)
+		resp.Body.Close()
+		spans := recorder.Ended()[before:]
+		// 仅有服务端 span，且为根 span。
+		assert.Len(t, spans, 1)
+		assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+		assert.False(t, spans[0].Parent().IsValid())
+	})
+}
+
+func TestDetach(t *testing.T) {
+	setupRecorder(t)
+	ctx, span := Start(context.Background(), "node.StepDown")
+	defer span.End()
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	detached := Detach(ctx)
+	assert.NotNil(t, ctx.Err())
+	assert.Nil(t, detached.Err())
+	assert.Equal(t, TraceID(ctx), TraceID(detached))
+}
+
+func TestValidateExporter(t *testing.T) {
+	assert.Nil(t, ValidateExporter(ExporterNone))
+	assert.Nil(t, ValidateExporter(ExporterOTLP))
+	assert.Nil(t, ValidateExporter(ExporterFile))
+	assert.ErrorIs(t, ValidateExporter("zipkin"), ErrExporterInvalid)
+}
@@ -0,0 +1,317 @@
+// Package webhook 事件通知。订阅节点池事件，将主节点变化、从节点不活跃或被移除、交接失败等事件以签名的 JSON 发送到配置的目标，
+// 失败时按指数退避重试，并记录每次投递尝试，参见 component.EnvWebhooks。
+//
+// 请求头 X-Rush-Signature 为以目标密钥对"时间戳.请求体"计算的 HMAC-SHA256（十六进制），时间戳取自请求头 X-Rush-Timestamp（秒）。
+// 接收方应校验签名，并可按请求头 X-Rush-Delivery 去重：同一事件的重试使用相同的投递ID。
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/logging"
+	"github.com/rhosocial/go-rush-producer/component/metrics"
+	"github.com/rhosocial/go-rush-producer/component/node"
+	"github.com/rhosocial/go-rush-producer/models"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	WebhookDelivery "github.com/rhosocial/go-rush-producer/models/webhook_delivery"
+	"gorm.io/gorm"
+)
+
+const (
+	HeaderEvent     = "X-Rush-Event"
+	HeaderDelivery  = "X-Rush-Delivery"
+	HeaderTimestamp = "X-Rush-Timestamp"
+	HeaderSignature = "X-Rush-Signature"
+)
+
+// QueueCapacity 每个目标最多可排队的通知数。超出时丢弃新的通知并记录日志。
+const QueueCapacity = 64
+
+// retryBackoffMaximum 重试等待的上限。
+const retryBackoffMaximum = 5 * time.Minute
+
+var ErrDeliveryRejected = errors.New("webhook delivery rejected")
+
+// Payload 通知内容。
+type Payload struct {
+	ID        string                     `json:"id"`        // 投递ID。
+	Event     string                     `json:"event"`     // 事件类型，参见 component.WebhookEventMasterChanged 等。
+	Timestamp int64                      `json:"timestamp"` // 事件发生时间（毫秒）。
+	Node      *models.RegisteredNodeInfo `json:"node"`      // 发送通知的节点。
+	Data      interface{}                `json:"data"`      // 事件内容，参见 MasterChangedData、SlaveData 和 HandoverFailedData。
+}
+
+// MasterChangedData 主节点变化。Previous 为原主节点，Master 为新的主节点，即发送通知的节点。
+type MasterChangedData struct {
+	Previous *models.RegisteredNodeInfo `json:"previous"`
+	Master   *models.RegisteredNodeInfo `json:"master"`
+}
+
+// SlaveData 从节点不活跃或被移除。
+type SlaveData struct {
+	Slave *models.RegisteredNodeInfo `json:"slave"`
+	Retry uint8                      `json:"retry,omitempty"` // 当前重试次数。仅用于不活跃。
+	Cause string                     `json:"cause,omitempty"` // 移除原因。
+}
+
+// HandoverFailedData 交接失败。
+type HandoverFailedData struct {
+	CandidateID uint64 `json:"candidate_id"`
+	Error       string `json:"error"`
+}
+
+// Signature 以 secret 对"时间戳.请求体"计算 HMAC-SHA256，以十六进制表示。
+func Signature(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewPayload 将节点池事件转换为通知内容。self 为当前节点。无须通知的事件返回空：
+//
+// 1. node.SupersededEvent 仅当新的主节点为自己时通知。
+//
+// 2. node.SlaveRemovedEvent 仅当因重试次数超限移除时通知。
+//
+// 3. node.HandoverFinishedEvent 仅当交接失败时通知。
+func NewPayload(event node.Event, self *NodeInfo.NodeInfo) *Payload {
+	payload := Payload{Timestamp: event.OccurredAt().UnixMilli()}
+	if self != nil {
+		payload.Node = self.ToRegisteredNodeInfo()
+	}
+	switch e := event.(type) {
+	case *node.SupersededEvent:
+		if self == nil || e.Master.ID != self.ID {
+			return nil
+		}
+		payload.Event = component.WebhookEventMasterChanged
+		payload.Data = MasterChangedData{Previous: e.Previous, Master: e.Master.ToRegisteredNodeInfo()}
+	case *node.SlaveInactiveEvent:
+		payload.Event = component.WebhookEventSlaveInactive
+		payload.Data = SlaveData{Slave: e.Slave.ToRegisteredNodeInfo(), Retry: e.Retry}
+	case *node.SlaveRemovedEvent:
+		if !errors.Is(e.Cause, node.ErrNodeSlaveRetriedOut) {
+			return nil
+		}
+		payload.Event = component.WebhookEventSlaveRemoved
+		payload.Data = SlaveData{Slave: e.Slave.ToRegisteredNodeInfo(), Cause: e.Cause.Error()}
+	case *node.HandoverFinishedEvent:
+		if e.Err == nil {
+			return nil
+		}
+		payload.Event = component.WebhookEventHandoverFailed
+		payload.Data = HandoverFailedData{CandidateID: e.CandidateID, Error: e.Err.Error()}
+	default:
+		return nil
+	}
+	var random = make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil
+	}
+	payload.ID = hex.EncodeToString(random)
+	return &payload
+}
+
+// target 通知目标及其队列。
+type target struct {
+	component.EnvWebhook
+	secret []byte
+	queue  chan *Payload
+}
+
+// Dispatcher 通知分发器。每个目标有独立的队列和投递协程，某个目标缓慢或不可用不影响其它目标。
+type Dispatcher struct {
+	targets      []*target
+	client       *http.Client
+	retryMax     uint8
+	retryBackoff time.Duration
+	self         func() *NodeInfo.NodeInfo
+	record       func(ctx context.Context, delivery *WebhookDelivery.WebhookDelivery) error
+	done         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewDispatcher 按配置创建分发器。每个目标以各自的 Secret 签名，参见 component.EnvWebhook。
+// registry 为记录投递尝试的节点登记数据库，为空时不记录。self 返回当前节点，用于填写通知的发送节点。
+func NewDispatcher(env *component.EnvWebhooks, registry *gorm.DB, self func() *NodeInfo.NodeInfo) *Dispatcher {
+	d := Dispatcher{
+		targets:      make([]*target, 0, len(env.Targets)),
+		client:       &http.Client{Timeout: env.GetTimeout()},
+		retryMax:     *env.RetryMax,
+		retryBackoff: env.GetRetryBackoff(),
+		self:         self,
+		record:       recordDelivery(registry),
+		done:         make(chan struct{}),
+	}
+	for _, webhook := range env.Targets {
+		d.targets = append(d.targets, &target{EnvWebhook: webhook, secret: []byte(webhook.Secret), queue: make(chan *Payload, QueueCapacity)})
+	}
+	return &d
+}
+
+// recordDelivery 将投递尝试记录到 registry。registry 为空时不记录。
+func recordDelivery(registry *gorm.DB) func(ctx context.Context, delivery *WebhookDelivery.WebhookDelivery) error {
+	return func(ctx context.Context, delivery *WebhookDelivery.WebhookDelivery) error {
+		if registry == nil {
+			return nil
+		}
+		return delivery.Record(ctx, registry)
+	}
+}
+
+// Start 订阅 events，并启动各目标的投递协程。返回停止函数：取消订阅，放弃排队和等待重试的通知，并等待进行中的投递结束。
+//
+// 没有通知目标时不订阅。
+func (d *Dispatcher) Start(events *node.EventBus) func() {
+	if len(d.targets) == 0 {
+		return func() {}
+	}
+	for _, t := range d.targets {
+		d.wg.Add(1)
+		go d.run(t)
+	}
+	unsubscribe := events.SubscribeFunc(func(event node.Event) {
+		if payload := NewPayload(event, d.self()); payload != nil {
+			d.Dispatch(payload)
+		}
+	}, node.EventSuperseded, node.EventSlaveInactive, node.EventSlaveRemoved, node.EventHandoverFinished)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			unsubscribe()
+			close(d.done)
+			d.wg.Wait()
+		})
+	}
+}
+
+// Dispatch 将通知加入订阅了该事件的各目标的队列。队列已满时丢弃。
+func (d *Dispatcher) Dispatch(payload *Payload) {
+	for _, t := range d.targets {
+		if !t.Subscribes(payload.Event) {
+			continue
+		}
+		select {
+		case t.queue <- payload:
+		default:
+			logging.Default.Warn("webhook queue full, dropping", "webhook", t.Name, "event", payload.Event, "delivery_id", payload.ID)
+		}
+	}
+}
+
+func (d *Dispatcher) run(t *target) {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case payload := <-t.queue:
+			d.deliver(t, payload)
+		}
+	}
+}
+
+// backoff 第 attempt 次尝试失败后、下次尝试前的等待。首次为 retryBackoff，此后每次加倍，不超过 retryBackoffMaximum。
+func (d *Dispatcher) backoff(attempt uint8) time.Duration {
+	wait := d.retryBackoff
+	for i := uint8(1); i < attempt && wait < retryBackoffMaximum; i++ {
+		wait *= 2
+	}
+	if wait > retryBackoffMaximum {
+		wait = retryBackoffMaximum
+	}
+	return wait
+}
+
+// deliver 投递通知，失败时按退避重试，至多重试 retryMax 次。目标拒绝（4xx，429 除外）时不再重试。返回是否成功。
+func (d *Dispatcher) deliver(t *target, payload *Payload) bool {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logging.Default.Error("failed to encode webhook payload", "webhook", t.Name, "event", payload.Event, "error", err)
+		return false
+	}
+	for attempt := uint8(1); ; attempt++ {
+		started := time.Now()
+		statusCode, err := d.attempt(t, payload, body)
+		delivery := WebhookDelivery.WebhookDelivery{
+			DeliveryID: payload.ID,
+			Target:     t.Name,
+			Event:      payload.Event,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Succeeded:  err == nil,
+			Duration:   time.Since(started).Milliseconds(),
+			Payload:    string(body),
+		}
+		if payload.Node != nil {
+			delivery.NodeID = payload.Node.ID
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if recordErr := d.record(context.Background(), &delivery); recordErr != nil {
+			logging.Default.Warn("failed to record webhook delivery", "webhook", t.Name, "delivery_id", payload.ID, "error", recordErr)
+		}
+		if err == nil {
+			metrics.WebhookDeliveries.WithLabelValues(t.Name, "success").Inc()
+			logging.Default.Debug("webhook delivered", "webhook", t.Name, "event", payload.Event, "delivery_id", payload.ID, "attempt", attempt)
+			return true
+		}
+		metrics.WebhookDeliveries.WithLabelValues(t.Name, "failure").Inc()
+		if errors.Is(err, ErrDeliveryRejected) || attempt > d.retryMax {
+			logging.Default.Error("webhook delivery failed", "webhook", t.Name, "event", payload.Event, "delivery_id", payload.ID, "attempt", attempt, "error", err)
+			return false
+		}
+		wait := d.backoff(attempt)
+		logging.Default.Warn("webhook delivery failed, retrying", "webhook", t.Name, "event", payload.Event, "delivery_id", payload.ID, "attempt", attempt, "retry_in_ms", wait.Milliseconds(), "error", err)
+		select {
+		case <-d.done:
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// attempt 投递一次。2xx 视为成功；429 和 5xx 可重试；其它状态码报 ErrDeliveryRejected。
+func (d *Dispatcher) attempt(t *target, payload *Payload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, payload.Event)
+	req.Header.Set(HeaderDelivery, payload.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Signature(t.secret, timestamp, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		err = fmt.Errorf("%w: %s", ErrDeliveryRejected, resp.Status)
+	}
+	return resp.StatusCode, err
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/node"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	WebhookDelivery "github.com/rhosocial/go-rush-producer/models/webhook_delivery"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder 收集投递记录，代替数据库。
+type recorder struct {
+	deliveries []WebhookDelivery.WebhookDelivery
+	lock       sync.Mutex
+}
+
+func (r *recorder) record(_ context.Context, delivery *WebhookDelivery.WebhookDelivery) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.deliveries = append(r.deliveries, *delivery)
+	return nil
+}
+
+func newTestDispatcher(url string, events ...string) (*Dispatcher, *recorder) {
+	retryMax, backoff := uint8(2), uint16(1)
+	env := component.EnvWebhooks{
+		Targets:      []component.EnvWebhook{{Name: "pager", URL: url, Secret: "s3cret", Events: events}},
+		RetryMax:     &retryMax,
+		RetryBackoff: &backoff,
+	}
+	_ = env.Validate()
+	self := &NodeInfo.NodeInfo{ID: 1, Host: "10.0.0.1", Port: 8080}
+	d := NewDispatcher(&env, nil, func() *NodeInfo.NodeInfo { return self })
+	r := recorder{}
+	d.record = r.record
+	return d, &r
+}
+
+func TestNewPayload(t *testing.T) {
+	self := &NodeInfo.NodeInfo{ID: 1}
+	slave := NodeInfo.NodeInfo{ID: 2, Level: 1, SuperiorID: 1, Turn: 1}
+	t.Run("master changed", func(t *testing.T) {
+		payload := NewPayload(&node.SupersededEvent{Previous: slave.ToRegisteredNodeInfo(), Master: *self}, self)
+		assert.Equal(t, component.WebhookEventMasterChanged, payload.Event)
+		assert.Len(t, payload.ID, 32)
+		assert.Equal(t, uint64(2), payload.Data.(MasterChangedData).Previous.ID)
+		assert.Nil(t, NewPayload(&node.SupersededEvent{Master: slave}, self))
+	})
+	t.Run("slave removed", func(t *testing.T) {
+		payload := NewPayload(&node.SlaveRemovedEvent{Slave: slave, Cause: node.ErrNodeSlaveRetriedOut}, self)
+		assert.Equal(t, component.WebhookEventSlaveRemoved, payload.Event)
+		assert.Nil(t, NewPayload(&node.SlaveRemovedEvent{Slave: slave, Cause: node.ErrNodeSlaveWithdrawn}, self))
+	})
+	t.Run("handover", func(t *testing.T) {
+		payload := NewPayload(&node.HandoverFinishedEvent{CandidateID: 2, Err: errors.New("conflict")}, self)
+		assert.Equal(t, component.WebhookEventHandoverFailed, payload.Event)
+		assert.Nil(t, NewPayload(&node.HandoverFinishedEvent{CandidateID: 2}, self))
+	})
+	t.Run("not notified", func(t *testing.T) {
+		assert.Nil(t, NewPayload(&node.WorkerTickedEvent{Identity: node.IdentityMaster}, self))
+	})
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	payload := &Payload{ID: "d1", Event: component.WebhookEventSlaveInactive, Data: SlaveData{Retry: 3}}
+	t.Run("signed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+			assert.Equal(t, Signature([]byte("s3cret"), timestamp, body), r.Header.Get(HeaderSignature))
+			assert.Equal(t, "d1", r.Header.Get(HeaderDelivery))
+			assert.Equal(t, component.WebhookEventSlaveInactive, r.Header.Get(HeaderEvent))
+			var received Payload
+			assert.Nil(t, json.Unmarshal(body, &received))
+			assert.Equal(t, "d1", received.ID)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		d, r := newTestDispatcher(server.URL)
+		assert.True(t, d.deliver(d.targets[0], payload))
+		assert.Len(t, r.deliveries, 1)
+		assert.True(t, r.deliveries[0].Succeeded)
+		assert.Equal(t, "pager", r.deliveries[0].Target)
+	})
+	t.Run("retry with backoff", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		d, r := newTestDispatcher(server.URL)
+		assert.True(t, d.deliver(d.targets[0], payload))
+		assert.Len(t, r.deliveries, 3)
+		assert.Equal(t, http.StatusServiceUnavailable, r.deliveries[0].StatusCode)
+		assert.False(t, r.deliveries[0].Succeeded)
+		assert.Equal(t, uint8(3), r.deliveries[2].Attempt)
+	})
+	t.Run("retried out", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+		d, r := newTestDispatcher(server.URL)
+		assert.False(t, d.deliver(d.targets[0], payload))
+		assert.Len(t, r.deliveries, 3)
+	})
+	t.Run("rejected", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+		d, r := newTestDispatcher(server.URL)
+		assert.False(t, d.deliver(d.targets[0], payload))
+		assert.Len(t, r.deliveries, 1)
+	})
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := Dispatcher{retryBackoff: time.Second}
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, retryBackoffMaximum, d.backoff(20))
+}
+
+func TestDispatcher_Start(t *testing.T) {
+	received := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(HeaderEvent)
+	}))
+	defer server.Close()
+	d, _ := newTestDispatcher(server.URL, component.WebhookEventSlaveInactive)
+	bus := node.NewEventBus()
+	stop := d.Start(bus)
+	defer stop()
+	bus.Publish(&node.SlaveRemovedEvent{Slave: NodeInfo.NodeInfo{ID: 2}, Cause: node.ErrNodeSlaveRetriedOut})
+	bus.Publish(&node.SlaveInactiveEvent{Slave: NodeInfo.NodeInfo{ID: 2}, Retry: 3})
+	select {
+	case event := <-received:
+		assert.Equal(t, component.WebhookEventSlaveInactive, event)
+	case <-time.After(time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	assert.Len(t, received, 0)
+}
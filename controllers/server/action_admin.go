@@ -0,0 +1,248 @@
+package controllerServer
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	base "github.com/rhosocial/go-rush-producer/models"
+	CronJob "github.com/rhosocial/go-rush-producer/models/cron_job"
+	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	NodeInfoLegacy "github.com/rhosocial/go-rush-producer/models/node_info_legacy"
+	NodeLog "github.com/rhosocial/go-rush-producer/models/node_log"
+	Shard "github.com/rhosocial/go-rush-producer/models/shard"
+	Task "github.com/rhosocial/go-rush-producer/models/task"
+	WebhookDelivery "github.com/rhosocial/go-rush-producer/models/webhook_delivery"
+)
+
+// 管理接口直接读取节点登记数据库，任一已加入集群的节点均可响应，供运维人员在没有数据库凭据时查看整个集群。
+// 与其它接口一样须以集群密钥签名，参见 VerifyNodeRequest。
+
+// bindNodeSelector 从查询参数 zone、rack 和 label 读取节点选择条件。label 可重复，每项形如 k1=v1,k2=v2。
+func bindNodeSelector(r *gin.Context) (*base.NodeSelector, error) {
+	labels, err := base.ParseNodeLabels(strings.Join(r.QueryArray("label"), ","))
+	if err != nil {
+		return nil, err
+	}
+	return &base.NodeSelector{Zone: r.Query("zone"), Rack: r.Query("rack"), Labels: labels}, nil
+}
+
+// bindPagination 从查询参数 page 和 page_size 读取分页参数。
+func bindPagination(r *gin.Context) (base.Pagination, error) {
+	var pagination base.Pagination
+	err := r.ShouldBindQuery(&pagination)
+	pagination.Normalize()
+	return pagination, err
+}
+
+// registryAvailable 节点登记数据库是否可用。单机模式不连接数据库。
+func (c *ControllerServer) registryAvailable(r *gin.Context) bool {
+	if c.Pool == nil || c.Pool.Registry() == nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return false
+	}
+	return true
+}
+
+// ActionAdminTopology 节点登记树，参见 NodeInfo.GetNodeTree。
+//
+// 方法必须为 GET。查询参数均为可选项：
+//
+// 1. zone: 可用区。
+//
+// 2. rack: 机架。
+//
+// 3. label: 标签，形如 k1=v1,k2=v2，可重复。须全部满足。
+//
+// 数据部分为根节点列表。每个节点包含登记信息、最近一次报告活跃的时间 last_active_at 及按接替顺序排列的下级节点 subordinates。
+// 筛选后上级被排除的节点作为根节点。
+func (c *ControllerServer) ActionAdminTopology(r *gin.Context) {
+	if !c.registryAvailable(r) {
+		return
+	}
+	selector, err := bindNodeSelector(r)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `label`", err.Error(), nil))
+		return
+	}
+	tree, err := NodeInfo.GetNodeTree(r.Request.Context(), c.Pool.Registry(), selector)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to get topology", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", tree, nil))
+}
+
+// ActionAdminLogs 分页查询节点日志，最近更新的在前，参见 NodeLog.GetNodeLogs。
+//
+// 方法必须为 GET。查询参数均为可选项：
+//
+// 1. node_id: 记录日志的节点ID。
+//
+// 2. target_node_id: 日志涉及的节点ID。
+//
+// 3. type: 日志类型，可重复，参见 NodeLog.NodeLogTypeReportActive 等。
+//
+// 4. since、until: 更新时间范围，格式为 RFC 3339，含 since 不含 until。
+//
+// 5. page、page_size: 页码（从 1 开始）和每页条数，参见 base.Pagination。
+func (c *ControllerServer) ActionAdminLogs(r *gin.Context) {
+	if !c.registryAvailable(r) {
+		return
+	}
+	var filter NodeLog.NodeLogFilter
+	if err := r.ShouldBindQuery(&filter); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind filter", err.Error(), nil))
+		return
+	}
+	pagination, err := bindPagination(r)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind pagination", err.Error(), nil))
+		return
+	}
+	page, err := NodeLog.GetNodeLogs(r.Request.Context(), c.Pool.Registry(), &filter, pagination)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to get logs", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", page, nil))
+}
+
+// ActionAdminLegacy 分页查询已删除节点的记录，最近更新的在前，参见 NodeInfoLegacy.GetNodeInfoLegacies。
+//
+// 方法必须为 GET。查询参数均为可选项：
+//
+// 1. id、name、host、port: 节点ID、名称、主机地址和端口号。
+//
+// 2. zone、rack、label: 节点元数据，参见 ActionAdminTopology。
+//
+// 3. since、until: 删除前最后一次更新的时间范围，格式为 RFC 3339，含 since 不含 until。
+//
+// 4. page、page_size: 页码（从 1 开始）和每页条数，参见 base.Pagination。
+func (c *ControllerServer) ActionAdminLegacy(r *gin.Context) {
+	if !c.registryAvailable(r) {
+		return
+	}
+	var filter NodeInfoLegacy.NodeInfoLegacyFilter
+	if err := r.ShouldBindQuery(&filter); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind filter", err.Error(), nil))
+		return
+	}
+	selector, err := bindNodeSelector(r)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `label`", err.Error(), nil))
+		return
+	}
+	filter.NodeSelector = *selector
+	pagination, err := bindPagination(r)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind pagination", err.Error(), nil))
+		return
+	}
+	page, err := NodeInfoLegacy.GetNodeInfoLegacies(r.Request.Context(), c.Pool.Registry(), &filter, pagination)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to get legacy nodes", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", page, nil))
+}
+
+// ActionAdminWebhooks 分页查询事件通知的投递记录，最近的在前，参见 WebhookDelivery.GetWebhookDeliveries。
+//
+// 方法必须为 GET。查询参数均为可选项：
+//
+// 1. delivery_id: 投递ID。同一事件的所有投递尝试共用投递ID。
+//
+// 2. target、event: 通知目标名称和事件类型。
+//
+// 3. succeeded: 为 true 时只查询成功的尝试，为 false 时只查询失败的尝试。
+//
+// 4. since、until: 尝试时间范围，格式为 RFC 3339，含 since 不含 until。
+//
+// 5. page、page_size: 页码（从 1 开始）和每页条数，参见 base.Pagination。
+func (c *ControllerServer) ActionAdminWebhooks(r *gin.Context) {
+	if !c.registryAvailable(r) {
+		return
+	}
+	var filter WebhookDelivery.WebhookDeliveryFilter
+	if err := r.ShouldBindQuery(&filter); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind filter", err.Error(), nil))
+		return
+	}
+	pagination, err := bindPagination(r)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind pagination", err.Error(), nil))
+		return
+	}
+	page, err := WebhookDelivery.GetWebhookDeliveries(r.Request.Context(), c.Pool.Registry(), &filter, pagination)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to get webhook deliveries", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", page, nil))
+}
+
+// ActionAdminTasks 分页查询任务，最近更新的在前，参见 Task.GetTasks。
+//
+// 方法必须为 GET。查询参数均为可选项：
+//
+// 1. name: 任务名称。
+//
+// 2. state: 任务状态，参见 Task.TaskStatePending 等。
+//
+// 3. assignee_id: 执行任务的从节点ID。
+//
+// 4. since、until: 更新时间范围，格式为 RFC 3339，含 since 不含 until。
+//
+// 5. page、page_size: 页码（从 1 开始）和每页条数，参见 base.Pagination。
+func (c *ControllerServer) ActionAdminTasks(r *gin.Context) {
+	if !c.registryAvailable(r) {
+		return
+	}
+	var filter Task.TaskFilter
+	if err := r.ShouldBindQuery(&filter); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind filter", err.Error(), nil))
+		return
+	}
+	pagination, err := bindPagination(r)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind pagination", err.Error(), nil))
+		return
+	}
+	page, err := Task.GetTasks(r.Request.Context(), c.Pool.Registry(), &filter, pagination)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to get tasks", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", page, nil))
+}
+
+// ActionAdminShards 各分片的所有者和目标节点，按编号排列，参见 Shard.Shard。
+//
+// 方法必须为 GET。分片数较少，不分页。
+func (c *ControllerServer) ActionAdminShards(r *gin.Context) {
+	if !c.registryAvailable(r) {
+		return
+	}
+	shards, err := Shard.GetShards(r.Request.Context(), c.Pool.Registry())
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to get shards", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", shards, nil))
+}
+
+// ActionAdminJobs 定时任务的调度记录：下次执行时间、正在执行的节点和上次执行结果，按名称排列，参见 CronJob.CronJob。
+//
+// 方法必须为 GET。定时任务较少，不分页。
+func (c *ControllerServer) ActionAdminJobs(r *gin.Context) {
+	if !c.registryAvailable(r) {
+		return
+	}
+	jobs, err := CronJob.GetCronJobs(r.Request.Context(), c.Pool.Registry())
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to get jobs", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", jobs, nil))
+}
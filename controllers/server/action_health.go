@@ -0,0 +1,44 @@
+package controllerServer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rhosocial/go-rush-producer/component/node"
+)
+
+// standaloneHealthReport 单机模式（ControllerServer.Pool 为空）不加入集群，总是健康。
+func standaloneHealthReport() *node.HealthReport {
+	return &node.HealthReport{Healthy: true, Identity: "standalone", Checks: make([]node.HealthCheck, 0)}
+}
+
+func (c *ControllerServer) respondHealth(r *gin.Context, report *node.HealthReport) {
+	if report.Healthy {
+		r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", report, nil))
+		return
+	}
+	r.JSON(http.StatusServiceUnavailable, c.NewResponseGeneric(r, 1, "unhealthy", report, nil))
+}
+
+// ActionHealthz 存活检查，参见 node.Pool.Liveness。通过返回 200，否则返回 503，数据部分为 node.HealthReport。
+//
+// 供编排系统探测，无须签名。
+func (c *ControllerServer) ActionHealthz(r *gin.Context) {
+	if c.Pool == nil {
+		c.respondHealth(r, standaloneHealthReport())
+		return
+	}
+	c.respondHealth(r, c.Pool.Liveness(time.Now()))
+}
+
+// ActionReadyz 就绪检查，参见 node.Pool.Readiness。通过返回 200，否则返回 503，数据部分为 node.HealthReport。
+//
+// 供编排系统探测，无须签名。节点正在接替或切换主节点时不就绪，此时不应向其分发业务流量。
+func (c *ControllerServer) ActionReadyz(r *gin.Context) {
+	if c.Pool == nil {
+		c.respondHealth(r, standaloneHealthReport())
+		return
+	}
+	c.respondHealth(r, c.Pool.Readiness(r.Request.Context(), time.Now()))
+}
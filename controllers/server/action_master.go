@@ -2,12 +2,14 @@ package controllerServer
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/rhosocial/go-rush-producer/component/node"
 	base "github.com/rhosocial/go-rush-producer/models"
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
@@ -15,19 +17,21 @@ import (
 
 // ActionSlaveGetMasterStatus 从节点发起获取主节点（自己）状态的请求。
 // 应当返回请求节点的 r.Request.Host、r.ClientIP() 和 r.Request.RemoteAddr 供远程节点校验。
+// 请求节点ID取自签名校验结果，参见 VerifyNodeRequest。
 func (c *ControllerServer) ActionSlaveGetMasterStatus(r *gin.Context) {
-	if (*component.GlobalEnv).Identity == 0 {
+	if c.Pool == nil {
 		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
 		return
 	}
 	attended := false
-	if nodeID, err := strconv.ParseUint(r.GetHeader(node.RequestHeaderXNodeIDKey), 10, 64); err == nil {
-		// 解析 nodeID 成功，则更新其重试次数。
-		node.Nodes.Slaves.RetryClear(nodeID)
-		if n := node.Nodes.Slaves.Get(nodeID); n != nil {
+	if nodeID := r.GetUint64(ContextNodeID); nodeID != 0 {
+		// 已登记节点，则更新其重试次数。
+		c.Pool.Slaves.RetryClear(nodeID)
+		if n := c.Pool.Slaves.Get(nodeID); n != nil {
 			port, err := strconv.ParseUint(r.GetHeader(node.RequestHeaderXNodePortKey), 10, 16)
 			if err == nil && uint16(port) == n.Port {
 				attended = true
+				c.Pool.Slaves.SetProtocol(nodeID, node.ParseProtocol(r.Request.Header))
 			}
 		}
 	}
@@ -38,15 +42,46 @@ func (c *ControllerServer) ActionSlaveGetMasterStatus(r *gin.Context) {
 			ClientIP:        r.ClientIP(),
 			RemoteAddr:      r.Request.RemoteAddr,
 			Attended:        attended,
-			IsMasterWorking: node.Nodes.Master.IsWorking(),
-			IsSlaveWorking:  node.Nodes.Slaves.IsWorking(),
+			IsMasterWorking: c.Pool.Master.IsWorking(),
+			IsSlaveWorking:  c.Pool.Slaves.IsWorking(),
+			Protocol:        c.Pool.Protocol(),
+			Revision:        c.Pool.Slaves.GetRevision(),
 		}, node.RequestMasterStatusResponseExtension{
-			Master: node.Nodes.Master.Node.ToRegisteredNodeInfo(),
-			Slaves: node.Nodes.Slaves.GetRegisteredNodeInfos(),
+			Master:     c.Pool.Master.Node.ToRegisteredNodeInfo(),
+			Slaves:     c.Pool.Slaves.GetRegisteredNodeInfos(),
+			Succession: c.Pool.Succession(),
 		},
 	))
 }
 
+// ActionSlaveSendMasterHeartbeat 从节点向主节点（自己）推送心跳。
+//
+// 方法必须为 POST，Header 的 Content-Type 必须为 application/json，请求体格式参见 node.Heartbeat。
+// 心跳中的节点ID必须与签名校验得到的节点ID一致，否则返回 403 Forbidden。
+//
+// 响应体格式参见 node.HeartbeatResponse。仅当从节点已知的主节点或从节点集合过时，响应才包含完整的主从节点信息。
+func (c *ControllerServer) ActionSlaveSendMasterHeartbeat(r *gin.Context) {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	var heartbeat node.Heartbeat
+	if err := r.ShouldBindJSON(&heartbeat); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind heartbeat", err.Error(), nil))
+		return
+	}
+	if r.GetUint64(ContextNodeID) != heartbeat.ID {
+		r.AbortWithStatusJSON(http.StatusForbidden, c.NewResponseGeneric(r, 1, "failed to receive heartbeat", node.ErrNodeHeartbeatInvalid.Error(), nil))
+		return
+	}
+	data, ext := c.Pool.ReceiveHeartbeat(&heartbeat, node.ParseProtocol(r.Request.Header))
+	if ext == nil {
+		r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", data, nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", data, ext))
+}
+
 // ActionSlaveNotifyMasterAddSelf 从节点通知主节点（自己）添加其为从节点。
 // 从节点应当发来 models.FreshNodeInfo 信息。
 // TODO: 校验从节点发来的 models.FreshNodeInfo 信息。
@@ -57,16 +92,19 @@ func (c *ControllerServer) ActionSlaveGetMasterStatus(r *gin.Context) {
 //
 // 1. port: 请求加入从节点的端口号。
 //
-// 2. host: 请求加入从节点的域（IP地址）。可以是IPv4或IPv6。该信息仅供判断是否与本机收到的客户端IP一致，并不会登记为实际 host 。
+// 2. host: 请求加入从节点对外登记的地址，可以是IPv4、IPv6或主机名。校验格式后登记为实际 host；
+// 若未提供，则登记本机收到的客户端IP。与客户端IP不一致时输出诊断信息，响应体扩展部分为是否一致。
 //
 // 3. name: 请求加入从节点的名称。
 //
 // 4. node_version: 请求加入从节点的版本号。
 //
+// 从节点的协议版本和能力集取自请求头，参见 node.ParseProtocol。若协议版本不兼容，响应码为 426 Upgrade Required。
+//
 // 当接受了从节点等级请求后，响应码为 200 OK。响应体为 JSON 字符串，格式和说明参见 node.NotifyMasterToAddSelfAsSlaveResponseData。
 // 若请求有误，则返回具体错误信息。
 func (c *ControllerServer) ActionSlaveNotifyMasterAddSelf(r *gin.Context) {
-	if (*component.GlobalEnv).Identity == 0 {
+	if c.Pool == nil {
 		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
 		return
 	}
@@ -75,14 +113,26 @@ func (c *ControllerServer) ActionSlaveNotifyMasterAddSelf(r *gin.Context) {
 		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, err.Error(), nil, nil))
 		return
 	}
-	host := r.PostForm("host")
+	host, err := advertisedHost(r, r.PostForm("host"))
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `host`", err.Error(), nil))
+		return
+	}
 	fresh := base.FreshNodeInfo{
 		Name:        r.PostForm("name"),
 		NodeVersion: r.PostForm("node_version"),
-		Host:        r.ClientIP(),
+		Host:        host,
 		Port:        uint16(port),
 	}
-	slave, err := node.Nodes.AcceptSlave(&fresh)
+	if err := bindNodeMetadata(r, &fresh); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind metadata", err.Error(), nil))
+		return
+	}
+	slave, err := c.Pool.AcceptSlave(r.Request.Context(), &fresh, node.ParseProtocol(r.Request.Header))
+	if errors.Is(err, node.ErrNodeProtocolIncompatible) {
+		r.AbortWithStatusJSON(http.StatusUpgradeRequired, c.NewResponseGeneric(r, 1, "failed to accept slave", err.Error(), c.Pool.Protocol()))
+		return
+	}
 	if err != nil {
 		r.Error(err)
 		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to accept slave", err.Error(), nil))
@@ -96,17 +146,153 @@ func (c *ControllerServer) ActionSlaveNotifyMasterAddSelf(r *gin.Context) {
 		Port:        slave.Port,
 		Turn:        slave.Turn,
 	}
-	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", respData, host == r.ClientIP()))
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", respData, node.IsAdvertisedHostObserved(host, r.ClientIP())))
 }
 
 // ActionSlaveNotifyMasterModifySelf 从节点通知主节点（自己）修改自身信息。
-// TODO:可以修改的项待定。
+//
+// 方法必须为 PATCH，Header 的 Content-Type 必须为 application/x-www-form-urlencoded。
+//
+// 参数必须包含以下用于校验身份的项，必须与实际一致才能修改：
+//
+// 1. id: 请求修改从节点的ID。必须与签名校验得到的节点ID一致。
+//
+// 2. port: 请求修改从节点的端口号。
+//
+// 3. name: 请求修改从节点的名称。
+//
+// 4. node_version: 请求修改从节点的版本。
+//
+// 可修改的项参见 base.ModifiableNodeInfo，至少须包含一项：new_name、new_node_version、new_host、new_port、
+// new_zone、new_rack、new_weight、new_labels。其中 new_labels 为 JSON 对象，将替换全部标签。
+// 接替顺序保持不变。
+//
+// 修改成功后，响应体数据部分为修改后的节点信息，格式参见 node.NotifyMasterToAddSelfAsSlaveResponseData。
 func (c *ControllerServer) ActionSlaveNotifyMasterModifySelf(r *gin.Context) {
-	if (*component.GlobalEnv).Identity == 0 {
+	if c.Pool == nil {
 		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
 		return
 	}
-	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", nil, nil))
+	slaveID, err := strconv.ParseUint(r.PostForm("id"), 10, 64)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `id`", err.Error(), nil))
+		return
+	}
+	if r.GetUint64(ContextNodeID) != slaveID {
+		r.AbortWithStatusJSON(http.StatusForbidden, c.NewResponseGeneric(r, 1, "failed to modify slave", node.ErrNodeSlaveFreshNodeInfoInvalid.Error(), nil))
+		return
+	}
+	port, err := strconv.ParseUint(r.PostForm("port"), 10, 16)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `port`", err.Error(), nil))
+		return
+	}
+	var modified base.ModifiableNodeInfo
+	if err := r.ShouldBindWith(&modified, binding.Form); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind modification", err.Error(), nil))
+		return
+	}
+	if len(modified.Host) > 0 {
+		if err := base.ValidateHost(modified.Host); err != nil {
+			r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `new_host`", err.Error(), nil))
+			return
+		}
+	}
+	if err := modified.Labels.Validate(); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `new_labels`", err.Error(), nil))
+		return
+	}
+	host, err := advertisedHost(r, r.PostForm("host"))
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `host`", err.Error(), nil))
+		return
+	}
+	fresh := base.FreshNodeInfo{
+		Host:        host,
+		Port:        uint16(port),
+		Name:        r.PostForm("name"),
+		NodeVersion: r.PostForm("node_version"),
+	}
+	slave, err := c.Pool.ModifySlave(slaveID, &fresh, &modified)
+	if errors.Is(err, node.ErrNodeSlaveModificationEmpty) {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to modify slave", err.Error(), nil))
+		return
+	}
+	if errors.Is(err, node.ErrNodeSlaveFreshNodeInfoInvalid) || errors.Is(err, node.ErrNodeMasterDoesNotHaveSpecifiedSlave) {
+		r.AbortWithStatusJSON(http.StatusForbidden, c.NewResponseGeneric(r, 1, "failed to modify slave", err.Error(), nil))
+		return
+	}
+	if errors.Is(err, node.ErrNodeExisted) || errors.Is(err, NodeInfo.ErrModelConflict) {
+		r.AbortWithStatusJSON(http.StatusConflict, c.NewResponseGeneric(r, 1, "failed to modify slave", err.Error(), nil))
+		return
+	}
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to modify slave", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", node.NotifyMasterToAddSelfAsSlaveResponseData{
+		ID:          slave.ID,
+		Name:        slave.Name,
+		NodeVersion: slave.NodeVersion,
+		Host:        slave.Host,
+		Port:        slave.Port,
+		Turn:        slave.Turn,
+	}, nil))
+}
+
+// advertisedHost 取得请求节点对外登记的地址。
+// 若请求节点未提供，则以请求来源地址代替；若已提供，则校验其格式后原样采用，不以请求来源地址覆盖。
+func advertisedHost(r *gin.Context, host string) (string, error) {
+	if len(host) == 0 {
+		return r.ClientIP(), nil
+	}
+	if err := base.ValidateHost(host); err != nil {
+		return "", err
+	}
+	return base.NormalizeHost(host), nil
+}
+
+// bindNodeMetadata 从表单中读取节点元数据：zone、rack、weight 和 labels。均为可选项，其中 labels 为 JSON 对象，键名须合法，参见 base.ValidateLabelKey。
+func bindNodeMetadata(r *gin.Context, fresh *base.FreshNodeInfo) error {
+	fresh.Zone = r.PostForm("zone")
+	fresh.Rack = r.PostForm("rack")
+	if value := r.PostForm("weight"); len(value) > 0 {
+		weight, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		fresh.Weight = uint32(weight)
+	}
+	if value := r.PostForm("labels"); len(value) > 0 {
+		if err := json.Unmarshal([]byte(value), &fresh.Labels); err != nil {
+			return err
+		}
+	}
+	return fresh.Labels.Validate()
+}
+
+// ActionSlaveListSlaves 按节点元数据查询从节点。
+//
+// 方法必须为 GET。查询参数均为可选项：
+//
+// 1. zone: 可用区。
+//
+// 2. rack: 机架。
+//
+// 3. label: 标签，形如 key=value。可出现多次，须全部满足。
+//
+// 响应体数据部分为满足条件的从节点信息，以节点ID为键。
+func (c *ControllerServer) ActionSlaveListSlaves(r *gin.Context) {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	selector, err := bindNodeSelector(r)
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `label`", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", c.Pool.Slaves.Select(selector), nil))
 }
 
 // ActionSlaveNotifyMasterRemoveSelf 从节点通知主节点（自己）退出。
@@ -125,7 +311,7 @@ func (c *ControllerServer) ActionSlaveNotifyMasterModifySelf(r *gin.Context) {
 //
 // 以上四个参数必须与实际一直才能删除。
 func (c *ControllerServer) ActionSlaveNotifyMasterRemoveSelf(r *gin.Context) {
-	if (*component.GlobalEnv).Identity == 0 {
+	if c.Pool == nil {
 		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
 		return
 	}
@@ -143,13 +329,18 @@ func (c *ControllerServer) ActionSlaveNotifyMasterRemoveSelf(r *gin.Context) {
 		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `port`", err.Error(), nil))
 		return
 	}
+	host, err := advertisedHost(r, r.Query("host"))
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `host`", err.Error(), nil))
+		return
+	}
 	fresh := base.FreshNodeInfo{
-		Host:        r.ClientIP(),
+		Host:        host,
 		Port:        uint16(port),
 		Name:        r.Query("name"),
 		NodeVersion: r.Query("node_version"),
 	}
-	if _, err := node.Nodes.RemoveSlave(slaveID, &fresh); err != nil {
+	if _, err := c.Pool.RemoveSlave(slaveID, &fresh); err != nil {
 		if errors.Is(err, node.ErrNodeSlaveFreshNodeInfoInvalid) {
 			r.AbortWithStatusJSON(http.StatusForbidden, c.NewResponseGeneric(r, 1, "failed to remove slave", err.Error(), nil))
 			return
@@ -161,13 +352,15 @@ func (c *ControllerServer) ActionSlaveNotifyMasterRemoveSelf(r *gin.Context) {
 }
 
 func (c *ControllerServer) ActionStart(r *gin.Context) {
-	if node.Nodes.Master.IsWorking() {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	if c.Pool.Master.IsWorking() {
 		r.AbortWithStatusJSON(http.StatusConflict, c.NewResponseGeneric(r, 1, "master worker is working", nil, nil))
 		return
 	}
-	self := NodeInfo.NewNodeInfo("GO-RUSH-PRODUCER", "0.0.1", *(*(*component.GlobalEnv).Net).ListenPort, 1)
-	node.Nodes = node.NewNodePool(self)
-	err := node.Nodes.Start(context.Background(), node.IdentityMaster)
+	err := c.Pool.Restart(context.Background(), node.IdentityMaster)
 	if err != nil {
 		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to start master worker", err.Error(), nil))
 		return
@@ -176,10 +369,128 @@ func (c *ControllerServer) ActionStart(r *gin.Context) {
 }
 
 func (c *ControllerServer) ActionStop(r *gin.Context) {
-	if !node.Nodes.Master.IsWorking() {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	if !c.Pool.Master.IsWorking() {
 		r.AbortWithStatusJSON(http.StatusConflict, c.NewResponseGeneric(r, 1, "master worker is not working", nil, nil))
 		return
 	}
-	node.Nodes.Stop(node.ErrNodeEndpointStopped)
-	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", node.Nodes.Master.IsWorking(), nil))
+	c.Pool.Stop(r.Request.Context(), node.ErrNodeEndpointStopped)
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", c.Pool.Master.IsWorking(), nil))
+}
+
+// ActionHandover 主节点（自己）向从节点交出主节点身份。
+//
+// 方法必须为 POST。参数 candidate 为可选项，指定接替者ID；未指定时按接替策略选择，参见 node.Pool.StepDown。
+//
+// 交接成功后，若当前节点允许作为从节点（component.Env.Identity 包含 node.IdentitySlave），则以从节点身份重新加入。
+func (c *ControllerServer) ActionHandover(r *gin.Context) {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	candidateID := uint64(0)
+	if value := r.PostForm("candidate"); len(value) > 0 {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `candidate`", err.Error(), nil))
+			return
+		}
+		candidateID = id
+	}
+	if candidateID == 0 {
+		candidateID = c.Pool.GetSuccessionCandidate()
+	}
+	err := c.Pool.StepDown(r.Request.Context(), candidateID)
+	if errors.Is(err, node.ErrNodeIsNotMaster) {
+		r.AbortWithStatusJSON(http.StatusConflict, c.NewResponseGeneric(r, 1, "failed to hand over", err.Error(), nil))
+		return
+	}
+	if errors.Is(err, node.ErrNodeSlaveInvalid) {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to hand over", err.Error(), nil))
+		return
+	}
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to hand over", err.Error(), nil))
+		return
+	}
+	if c.Pool.Env().Identity&node.IdentitySlave > 0 {
+		go func() {
+			time.Sleep(c.Pool.Timing().GetSlaveInterval())
+			if err := c.Pool.Restart(context.Background(), node.IdentitySlave); err != nil {
+				requestLogger(r).Error("failed to rejoin as slave after handover", "error", err)
+			}
+		}()
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", candidateID, nil))
+}
+
+// ActionSubmitTask 向主节点（自己）提交任务，由主节点分配给从节点执行，参见 node.Pool.SubmitTask。
+//
+// 方法必须为 POST。参数格式参见 node.TaskDefinition，可以是表单或 JSON：
+//
+// 1. name: 任务名称，必填，不超过 64 个字符。
+//
+// 2. payload: 任务内容，格式由提交者与执行者约定。
+//
+// 提交成功后，响应体数据部分为登记的任务。若当前节点不是主节点，响应码为 409 Conflict。
+func (c *ControllerServer) ActionSubmitTask(r *gin.Context) {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	var definition node.TaskDefinition
+	if err := r.ShouldBind(&definition); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind task", err.Error(), nil))
+		return
+	}
+	task, err := c.Pool.SubmitTask(r.Request.Context(), &definition)
+	if errors.Is(err, node.ErrNodeIsNotMaster) {
+		r.AbortWithStatusJSON(http.StatusConflict, c.NewResponseGeneric(r, 1, "failed to submit task", err.Error(), nil))
+		return
+	}
+	if errors.Is(err, node.ErrNodeTaskDefinitionInvalid) {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to submit task", err.Error(), nil))
+		return
+	}
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to submit task", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", task, nil))
+}
+
+// ActionSlaveReportMasterTask 从节点向主节点（自己）报告任务执行结果，参见 node.Pool.ReceiveTaskReport。
+//
+// 方法必须为 POST，Header 的 Content-Type 必须为 application/json，请求体格式参见 node.TaskReport。
+// 从节点ID取自签名校验结果，参见 VerifyNodeRequest。
+//
+// 若任务已被收回或不属于该从节点，响应码为 409 Conflict，从节点不应再重试。
+func (c *ControllerServer) ActionSlaveReportMasterTask(r *gin.Context) {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	var report node.TaskReport
+	if err := r.ShouldBindJSON(&report); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind task report", err.Error(), nil))
+		return
+	}
+	slaveID := r.GetUint64(ContextNodeID)
+	if slaveID == 0 {
+		r.AbortWithStatusJSON(http.StatusForbidden, c.NewResponseGeneric(r, 1, "failed to receive task report", node.ErrNodeTaskInvalid.Error(), nil))
+		return
+	}
+	_, err := c.Pool.ReceiveTaskReport(r.Request.Context(), slaveID, &report)
+	if errors.Is(err, node.ErrNodeTaskInvalid) || errors.Is(err, node.ErrNodeIsNotMaster) {
+		r.AbortWithStatusJSON(http.StatusConflict, c.NewResponseGeneric(r, 1, "failed to receive task report", err.Error(), nil))
+		return
+	}
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusInternalServerError, c.NewResponseGeneric(r, 1, "failed to receive task report", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", nil, nil))
 }
@@ -3,13 +3,12 @@ package controllerServer
 import (
 	"errors"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
-	"github.com/rhosocial/go-rush-producer/component"
 	"github.com/rhosocial/go-rush-producer/component/node"
 	"github.com/rhosocial/go-rush-producer/models"
+	Task "github.com/rhosocial/go-rush-producer/models/task"
 )
 
 type ActionMasterGetSlaveStatusResponseData struct {
@@ -19,17 +18,17 @@ type ActionMasterGetSlaveStatusResponseData struct {
 
 // ActionMasterGetSlaveStatus 当前节点（从节点）收到主节点获取本节点（从节点）状态请求。（仅对等网络有效）
 func (c *ControllerServer) ActionMasterGetSlaveStatus(r *gin.Context) {
-	if (*component.GlobalEnv).Identity == 0 {
+	if c.Pool == nil {
 		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
 		return
 	}
-	remaining, removed := node.Nodes.RefreshSlavesStatus()
+	remaining, removed := c.Pool.RefreshSlavesStatus(r.Request.Context())
 	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", ActionMasterGetSlaveStatusResponseData{remaining, removed}, nil))
 }
 
 // ActionMasterNotifySlaveToTakeover 当前节点（从节点）收到主节点发起接替自己主节点身份请求。（仅对等网络有效）
 func (c *ControllerServer) ActionMasterNotifySlaveToTakeover(r *gin.Context) {
-	if (*component.GlobalEnv).Identity == 0 {
+	if c.Pool == nil {
 		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
 		return
 	}
@@ -39,16 +38,17 @@ func (c *ControllerServer) ActionMasterNotifySlaveToTakeover(r *gin.Context) {
 		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind post body", err.Error(), nil))
 		return
 	}
-	if id, err := strconv.ParseUint(r.GetHeader("X-Node-ID"), 10, 64); err != nil && id != existed.ID {
+	if r.GetUint64(ContextNodeID) != existed.ID {
 		r.AbortWithStatusJSON(http.StatusForbidden, c.NewResponseGeneric(r, 1, "invalid master node id", nil, nil))
+		return
 	}
-	node.Nodes.Supersede(&existed)
+	c.Pool.Supersede(r.Request.Context(), &existed)
 	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", nil, nil))
 }
 
 // ActionMasterNotifySlaveToSwitchSuperior 当前节点（从节点）收到主节点发起向另一节点切换主节点身份请求。（仅对等网络有效）
 func (c *ControllerServer) ActionMasterNotifySlaveToSwitchSuperior(r *gin.Context) {
-	if (*component.GlobalEnv).Identity == 0 {
+	if c.Pool == nil {
 		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
 		return
 	}
@@ -61,7 +61,7 @@ func (c *ControllerServer) ActionMasterNotifySlaveToSwitchSuperior(r *gin.Contex
 	// 2. 在 m 时询问新 master。
 	// 3. 若新 master 准备好，且有自己。恢复原有容忍时长 n。
 	// 4. 若新 master 未准备好，等待 1 次。若再次未准备好。尝试接替。
-	err := node.Nodes.SwitchSuperior(&superseded)
+	err := c.Pool.SwitchSuperior(r.Request.Context(), &superseded)
 	if errors.Is(err, node.ErrNodeMasterInvalid) {
 		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to switch superior", err.Error(), nil))
 		return
@@ -72,3 +72,30 @@ func (c *ControllerServer) ActionMasterNotifySlaveToSwitchSuperior(r *gin.Contex
 	}
 	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", nil, nil))
 }
+
+// ActionMasterAssignSlaveTask 当前节点（从节点）收到主节点分配的任务，确认后在后台执行，参见 node.Pool.ReceiveTask。
+//
+// 方法必须为 POST，Header 的 Content-Type 必须为 application/json，请求体为任务。请求者必须是当前接受的主节点。
+//
+// 若未设置任务执行者，响应码为 501 Not Implemented；若请求者不是当前接受的主节点，响应码为 403 Forbidden。
+func (c *ControllerServer) ActionMasterAssignSlaveTask(r *gin.Context) {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	var task Task.Task
+	if err := r.ShouldBindJSON(&task); err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to bind task", err.Error(), nil))
+		return
+	}
+	err := c.Pool.ReceiveTask(r.GetUint64(ContextNodeID), &task)
+	if errors.Is(err, node.ErrNodeTaskHandlerMissing) {
+		r.AbortWithStatusJSON(http.StatusNotImplemented, c.NewResponseGeneric(r, 1, "failed to receive task", err.Error(), nil))
+		return
+	}
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusForbidden, c.NewResponseGeneric(r, 1, "failed to receive task", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", nil, nil))
+}
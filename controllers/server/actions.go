@@ -1,25 +1,41 @@
 package controllerServer
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"github.com/rhosocial/go-rush-common/component/controller"
+	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/logging"
+	"github.com/rhosocial/go-rush-producer/component/node"
 )
 
 type ControllerServer struct {
 	controller.GenericController
+	Env  *component.Env // 配置。
+	Pool *node.Pool     // 节点池。单机模式（component.Env.Identity 为 0）为空。
 }
 
 func (c *ControllerServer) RegisterActions(r *gin.Engine) {
+	// 存活和就绪检查，无须签名。
+	r.GET("/healthz", c.ActionHealthz)
+	r.GET("/readyz", c.ActionReadyz)
 	// 服务器组
-	group := r.Group("/server")
+	group := r.Group("/server", c.VerifyNodeRequest())
 	{
 		// 主节点
 		controllerMaster := group.Group("/master")
 		{
 			// 从节点获取从节点信息
 			controllerMaster.GET("", c.ActionSlaveGetMasterStatus)
+			// 按节点元数据查询从节点
+			controllerMaster.GET("/slaves", c.ActionSlaveListSlaves)
+			// 从节点推送心跳
+			controllerMaster.POST("/heartbeat", c.ActionSlaveSendMasterHeartbeat)
 			// 从节点通知主节点
 			controllerSlaveNotifyMaster := controllerMaster.Group("/notify")
 			{
@@ -30,10 +46,19 @@ func (c *ControllerServer) RegisterActions(r *gin.Engine) {
 				// 删除
 				controllerSlaveNotifyMaster.DELETE("", c.ActionSlaveNotifyMasterRemoveSelf)
 			}
+			// 任务
+			controllerMasterTasks := controllerMaster.Group("/tasks")
+			{
+				// 提交任务
+				controllerMasterTasks.POST("", c.ActionSubmitTask)
+				// 从节点报告执行结果
+				controllerMasterTasks.POST("/report", c.ActionSlaveReportMasterTask)
+			}
 			controllerAction := controllerMaster.Group("/action")
 			{
 				controllerAction.POST("/start", c.ActionStart)
 				controllerAction.POST("/stop", c.ActionStop)
+				controllerAction.POST("/handover", c.ActionHandover)
 			}
 		}
 		// 从节点
@@ -49,13 +74,146 @@ func (c *ControllerServer) RegisterActions(r *gin.Engine) {
 				// 主节点切换
 				controllerMasterNotifySlave.POST("/switch_superior", c.ActionMasterNotifySlaveToSwitchSuperior)
 			}
+			// 主节点分配任务
+			controllerSlave.POST("/tasks", c.ActionMasterAssignSlaveTask)
 		}
 		// 服务器状态。用于未知节点获取当前节点信息。
 		group.GET("", c.ActionStatus)
+		// 拓扑事件流。
+		group.GET("/watch", c.ActionWatch)
+		// 当前生效的配置。
+		group.GET("/config", c.ActionConfig)
+		// 重新加载配置。
+		group.POST("/config/reload", c.ActionConfigReload)
+	}
+	// 管理接口。只读，查看整个集群的节点登记情况。以管理密钥而非集群密钥签名。
+	controllerAdmin := r.Group("/server/admin", c.VerifyAdminRequest())
+	{
+		// 节点登记树
+		controllerAdmin.GET("/topology", c.ActionAdminTopology)
+		// 节点日志
+		controllerAdmin.GET("/logs", c.ActionAdminLogs)
+		// 已删除节点
+		controllerAdmin.GET("/legacy", c.ActionAdminLegacy)
+		// 事件通知投递记录
+		controllerAdmin.GET("/webhooks", c.ActionAdminWebhooks)
+		// 任务
+		controllerAdmin.GET("/tasks", c.ActionAdminTasks)
+		// 分片归属
+		controllerAdmin.GET("/shards", c.ActionAdminShards)
+		// 定时任务调度记录
+		controllerAdmin.GET("/jobs", c.ActionAdminJobs)
 	}
 }
 
 // ActionStatus 服务器状态。仅用于未知节点获取当前节点信息。
+// 响应包含当前节点的协议版本和能力集，供对方判断兼容性，参见 node.RequestStatusResponseData。
 func (c *ControllerServer) ActionStatus(r *gin.Context) {
-	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", nil, nil))
+	protocol := node.NewProtocol()
+	if c.Pool != nil {
+		protocol = c.Pool.Protocol()
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", node.RequestStatusResponseData{
+		Protocol:               protocol,
+		ProtocolVersionMinimum: node.ProtocolVersionMinimum,
+	}, nil))
+}
+
+// ConfigResponseData 当前生效的配置。
+type ConfigResponseData struct {
+	Timing   *component.EnvTiming   `json:"timing"`
+	Failover *component.EnvFailover `json:"failover"`
+}
+
+// ActionConfig 获取当前生效的时间间隔、重试阈值和接替策略，参见 component.EnvTiming 和 component.EnvFailover。
+func (c *ControllerServer) ActionConfig(r *gin.Context) {
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", ConfigResponseData{
+		Timing:   c.Env.GetTiming(),
+		Failover: c.Env.GetFailover(),
+	}, nil))
+}
+
+// ActionConfigReload 重新加载节点池的配置文件和环境变量，参见 node.Pool.Reload；单机模式下重新加载 Env，参见 component.Env.Reload。
+// 响应包含已生效和须重启才能生效的配置项。若新配置无效，则返回 400，当前配置保持不变。
+func (c *ControllerServer) ActionConfigReload(r *gin.Context) {
+	var result *component.EnvReloadResult
+	var err error
+	if c.Pool != nil {
+		result, err = c.Pool.Reload(r.Request.Context(), nil)
+	} else if result, err = c.Env.Reload(nil); err == nil {
+		c.Env.ApplyLogging(logging.Default)
+	}
+	if err != nil {
+		r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to reload configuration", err.Error(), nil))
+		return
+	}
+	r.JSON(http.StatusOK, c.NewResponseGeneric(r, 0, "success", result, nil))
+}
+
+// WatchKeepaliveInterval 拓扑事件流无事件时发送保活注释的间隔。
+const WatchKeepaliveInterval = 15 * time.Second
+
+// ActionWatch 拓扑事件流。以 Server-Sent Events 形式推送当前节点观察到的拓扑事件，参见 node.TopologyEvent。
+//
+// 每个事件的 id 为事件位置（"<日志ID>:<序号>"，参见 node.TopologyCursor），event 为事件类型，data 为事件内容。
+//
+// 可通过查询参数 since 或请求头 Last-Event-ID 指定从某位置之后恢复，缺省则只推送此后发生的事件。
+// 若所需事件已不再保留，或该位置属于其它日志（例如接替后的新主节点），则返回 410 Gone，扩展部分为当前最新位置，
+// 调用方应重新获取完整状态后再从该位置订阅。
+func (c *ControllerServer) ActionWatch(r *gin.Context) {
+	if c.Pool == nil {
+		r.JSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "not supported", nil, nil))
+		return
+	}
+	journal := c.Pool.Topology
+	since := journal.Cursor()
+	value := r.Query("since")
+	if len(value) == 0 {
+		value = r.GetHeader("Last-Event-ID")
+	}
+	if len(value) > 0 {
+		var err error
+		if since, err = node.ParseTopologyCursor(value); err != nil {
+			r.AbortWithStatusJSON(http.StatusBadRequest, c.NewResponseGeneric(r, 1, "failed to parse `since`", err.Error(), nil))
+			return
+		}
+	}
+	backlog, events, cancel, err := journal.Subscribe(since)
+	if errors.Is(err, node.ErrTopologyJournalTruncated) {
+		r.AbortWithStatusJSON(http.StatusGone, c.NewResponseGeneric(r, 1, "failed to watch", err.Error(), journal.Cursor().String()))
+		return
+	}
+	defer cancel()
+	keepalive := time.NewTicker(WatchKeepaliveInterval)
+	defer keepalive.Stop()
+	r.Stream(func(w io.Writer) bool {
+		if len(backlog) > 0 {
+			for _, event := range backlog {
+				renderTopologyEvent(r, event)
+			}
+			backlog = nil
+			return true
+		}
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			renderTopologyEvent(r, event)
+			return true
+		case <-keepalive.C:
+			_, err := io.WriteString(w, ":keepalive\n\n")
+			return err == nil
+		case <-r.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func renderTopologyEvent(r *gin.Context, event node.TopologyEvent) {
+	r.Render(-1, sse.Event{
+		Id:    event.Cursor().String(),
+		Event: event.Type,
+		Data:  event,
+	})
 }
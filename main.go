@@ -2,22 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rhosocial/go-rush-common/component/auth"
 	error2 "github.com/rhosocial/go-rush-common/component/error"
 	"github.com/rhosocial/go-rush-common/component/logger"
 	"github.com/rhosocial/go-rush-producer/component"
+	"github.com/rhosocial/go-rush-producer/component/hook"
+	"github.com/rhosocial/go-rush-producer/component/logging"
+	"github.com/rhosocial/go-rush-producer/component/metrics"
 	"github.com/rhosocial/go-rush-producer/component/node"
+	"github.com/rhosocial/go-rush-producer/component/tracing"
+	"github.com/rhosocial/go-rush-producer/component/webhook"
 	controllerSystem "github.com/rhosocial/go-rush-producer/controllers/server"
-	"github.com/rhosocial/go-rush-producer/models"
 	NodeInfo "github.com/rhosocial/go-rush-producer/models/node_info"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	loggerGorm "gorm.io/gorm/logger"
@@ -26,6 +31,15 @@ import (
 var r *gin.Engine
 var db *gorm.DB
 
+// shutdownTracing 导出尚未导出的 span，退出前调用，参见 tracing.Setup。
+var shutdownTracing = func(context.Context) error { return nil }
+
+// pool 节点池。仅在加入集群时设置，参见 configCluster。
+var pool *node.Pool
+
+// hooks 生命周期脚本执行者。仅在加入集群时设置，参见 configCluster。
+var hooks *hook.Runner
+
 func tryBindListenPort(addr string) error {
 	if listen, err := net.Listen("tcp", addr); err != nil {
 		return err
@@ -36,23 +50,41 @@ func tryBindListenPort(addr string) error {
 }
 
 func main() {
-	log.Println("Hello, World!")
+	if err := runCommand(os.Args[1:]); err != nil {
+		logging.Default.Fatal("command failed", "error", err)
+	}
+}
+
+// loadConfig 依次加载默认值、配置文件和环境变量，参见 component.LoadEnv。若配置文件为默认路径且不存在，则忽略。
+func loadConfig(path string) error {
+	return component.LoadEnv(path, path == defaultConfigPath)
+}
+
+// serve 启动节点服务。identity 和 port 若非零，则覆盖配置。
+func serve(config string, identity int, port uint) error {
+	logging.Default.Info("Hello, World!")
 	SetupCloseHandler()
-	// 最初初始化所有配置参数为默认值。
-	if err := component.LoadEnvDefault(); err != nil {
-		log.Println(err.Error())
+	if err := loadConfig(config); err != nil {
+		return err
+	}
+	if identity >= 0 {
+		component.GlobalEnv.Override(func(env *component.Env) { env.Identity = identity })
 	}
-	if err := component.LoadEnvFromYaml("default.yaml"); err != nil {
-		log.Println(err.Error())
+	if port > 0 {
+		listenPort := uint16(port)
+		component.GlobalEnv.Override(func(env *component.Env) { env.Net.ListenPort = &listenPort })
 	}
-	// 再从环境变量中加载配置信息。
-	if err := component.LoadEnvFromSystemEnvVar(); err != nil {
-		log.Println(err.Error())
+	if err := setupTracing(); err != nil {
+		return err
+	}
+	if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
+		if effective, err := component.GlobalEnv.MaskedYaml(); err == nil {
+			logging.Default.Debug("effective configuration", "config", string(effective))
+		}
 	}
 	// 尝试监听端口。
-	if tryBindListenPort(fmt.Sprintf(":%d", *(*(*component.GlobalEnv).Net).ListenPort)) != nil {
-		log.Fatalf("Cannot bind the listening port: %d\n", *(*(*component.GlobalEnv).Net).ListenPort)
-		return
+	if tryBindListenPort((*component.GlobalEnv).Net.GetListenAddress()) != nil {
+		return fmt.Errorf("cannot bind the listening address: %s", (*component.GlobalEnv).Net.GetListenAddress())
 	}
 	configCluster((*component.GlobalEnv).Identity)
 	if (*component.GlobalEnv).RunningMode == component.RunningModeDebug {
@@ -62,62 +94,116 @@ func main() {
 	}
 	r = gin.New()
 	if !configEngine(r) {
-		return
+		return nil
 	}
-	r.Run(fmt.Sprintf(":%d", *(*(*component.GlobalEnv).Net).ListenPort))
+	return r.Run((*component.GlobalEnv).Net.GetListenAddress())
+}
+
+// openDatabase 连接配置中的首个 MySQL 服务器。
+func openDatabase() (*gorm.DB, error) {
+	if component.GlobalEnv.MySQLServers == nil || len(*(component.GlobalEnv).MySQLServers) == 0 {
+		return nil, errors.New("cannot find MySQL connection")
+	}
+	config := gorm.Config{}
+	if (*component.GlobalEnv).RunningMode == component.RunningModeRelease {
+		config.Logger = loggerGorm.Default.LogMode(loggerGorm.Error)
+	}
+	db, err := gorm.Open(mysql.Open((*(*component.GlobalEnv).MySQLServers)[0].GetDSN()), &config)
+	if err != nil {
+		return nil, err
+	}
+	// 记录数据库操作耗时。
+	if err := db.Use(&metrics.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	// 追踪作为节点操作一部分的数据库操作。
+	if err := db.Use(&tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// setupTracing 按配置设置分布式追踪，参见 component.EnvTracing。
+func setupTracing() error {
+	env := (*component.GlobalEnv).Tracing
+	options := tracing.Options{
+		Exporter:       env.Exporter,
+		Endpoint:       env.Endpoint,
+		TLS:            env.TLS,
+		File:           env.File,
+		SampleRatio:    *env.SampleRatio,
+		ServiceName:    "go-rush-producer",
+		ServiceVersion: node.NodeVersion,
+	}
+	if meta := (*component.GlobalEnv).Node; meta != nil {
+		options.Attributes = append(options.Attributes, attribute.String("node.zone", meta.Zone), attribute.String("node.rack", meta.Rack))
+	}
+	shutdown, err := tracing.Setup(context.Background(), options)
+	if err != nil {
+		return err
+	}
+	shutdownTracing = shutdown
+	return nil
 }
 
 func configCluster(identity int) {
 	if identity == 0 {
 		return
 	}
-	if component.GlobalEnv.MySQLServers == nil || len(*(component.GlobalEnv).MySQLServers) == 0 {
-		log.Fatalln("Cannot find MySQL connection.")
+	if len((*(*component.GlobalEnv).Cluster).Secret) == 0 {
+		logging.Default.Fatal("cannot find cluster secret")
 		return
 	}
-	config := gorm.Config{}
-	if (*component.GlobalEnv).RunningMode == component.RunningModeRelease {
-		config.Logger = loggerGorm.Default.LogMode(loggerGorm.Error)
+	db, err := openDatabase()
+	if err != nil {
+		logging.Default.Fatal("failed to open database", "error", err)
 	}
-	db, err := gorm.Open(mysql.Open((*(*component.GlobalEnv).MySQLServers)[0].GetDSN()), &gorm.Config{})
+	pool, err = node.NewPool(node.Options{Env: component.GlobalEnv, Registry: db, Logger: logging.Default})
 	if err != nil {
-		log.Fatalln(err)
+		logging.Default.Fatal("failed to create node pool", "error", err)
 	}
-	models.NodeInfoDB = db
-	self := NodeInfo.NewNodeInfo("GO-RUSH-PRODUCER", "0.0.1", *(*(*component.GlobalEnv).Net).ListenPort, 1)
-	node.Nodes = node.NewNodePool(self)
-	err = node.Nodes.Start(context.Background(), identity)
+	metrics.Registry.MustRegister(pool.Collector())
+	// 事件通知和生命周期脚本须在启动前订阅，以免错过启动时的事件。
+	webhook.NewDispatcher(component.GlobalEnv.Webhooks, db, func() *NodeInfo.NodeInfo {
+		return pool.Self.Node
+	}).Start(pool.Events)
+	hooks = hook.NewRunner(component.GlobalEnv.Hooks, func() *NodeInfo.NodeInfo {
+		return pool.Self.Node
+	})
+	hooks.Start(pool.Events)
+	err = pool.Start(context.Background(), identity)
 	if err != nil {
-		log.Println(err)
+		logging.Default.Error("failed to start node", "error", err)
 	}
-	// defer node.Nodes.Stop(context.Background(), node.ErrNodeWorkerStopped)
+	// defer pool.Stop(context.Background(), node.ErrNodeWorkerStopped)
 	// For-loop
-	if node.Nodes.Self.Identity == node.IdentityNotDetermined {
+	if pool.Self.Identity == node.IdentityNotDetermined {
 		// Wait for a minute, and retry to determine the identity.
-		log.Println("Identity: Not determined.")
+		logging.Default.Warn("identity not determined")
 	}
-	if node.Nodes.Self.Identity == node.IdentityMaster {
+	if pool.Self.Identity == node.IdentityMaster {
 		// Start a goroutine to monitor its master.
 		// log.Println("Identity: Master")
-		log.Printf("Self  : %s\n", node.Nodes.Self.Node.Log())
+		logging.Default.Info("started as master", "self", pool.Self.Node.Log())
 	}
-	if node.Nodes.Self.Identity == node.IdentitySlave {
+	if pool.Self.Identity == node.IdentitySlave {
 		// Start a goroutine to monitor its slaves.
 		// log.Println("Identity: Slave.")
-		log.Printf("Master: %s", node.Nodes.Master.Node.Log())
-		log.Printf("Self  : %s", node.Nodes.Self.Node.Log())
+		logging.Default.Info("started as slave", "master", pool.Master.Node.Log(), "self", pool.Self.Node.Log())
 	}
 }
 
 func configEngine(r *gin.Engine) bool {
 	r.Use(
 		logger.AppendRequestID(),
-		gin.LoggerWithFormatter(logger.LogFormatter),
-		auth.AuthRequired(),
+		tracing.Middleware(),
+		logging.AccessLog(logging.Default, logger.ContextRequestID),
 		gin.Recovery(),
 		error2.ErrorHandler(),
 	)
-	var ca controllerSystem.ControllerServer
+	// 运行指标。
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	ca := controllerSystem.ControllerServer{Env: component.GlobalEnv, Pool: pool}
 	ca.RegisterActions(r)
 	return true
 }
@@ -125,15 +211,45 @@ func configEngine(r *gin.Engine) bool {
 // SetupCloseHandler creates a 'listener' on a new goroutine which will notify the
 // program if it receives an interrupt from the OS. We then handle this by calling
 // our cleaning-up procedure and exiting the program.
+//
+// SIGHUP reloads the configuration instead, see reloadConfig.
 func SetupCloseHandler() {
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM, syscall.SIGKILL)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM, syscall.SIGKILL, syscall.SIGHUP)
 	go func() {
-		<-c
-		log.Println("\r- Ctrl+C pressed in Terminal")
-		if (*component.GlobalEnv).Identity > 0 {
-			node.Nodes.Stop(node.ErrNodeSystemSignalStopped)
+		for sig := range c {
+			if sig == syscall.SIGHUP {
+				reloadConfig(context.Background())
+				continue
+			}
+			logging.Default.Info("stopping on signal", "signal", sig.String())
+			if pool != nil {
+				pool.Stop(context.Background(), node.ErrNodeSystemSignalStopped)
+			}
+			if hooks != nil {
+				_ = hooks.Shutdown(context.Background(), node.ErrNodeSystemSignalStopped)
+			}
+			if err := shutdownTracing(context.Background()); err != nil {
+				logging.Default.Error("failed to flush traces", "error", err)
+			}
+			os.Exit(0)
 		}
-		os.Exit(0)
 	}()
 }
+
+// reloadConfig 重新加载节点池的配置，参见 node.Pool.Reload；单机模式下重新加载 component.GlobalEnv。
+func reloadConfig(ctx context.Context) {
+	if pool != nil {
+		if _, err := pool.Reload(ctx, nil); err != nil {
+			logging.Default.Error("failed to reload configuration", "error", err)
+		}
+		return
+	}
+	result, err := component.GlobalEnv.Reload(nil)
+	if err != nil {
+		logging.Default.Error("failed to reload configuration", "error", err)
+		return
+	}
+	component.GlobalEnv.ApplyLogging(logging.Default)
+	logging.Default.Info("configuration reloaded", "applied", strings.Join(result.Applied, ","), "restart_required", strings.Join(result.RestartRequired, ","))
+}
@@ -1,21 +1,214 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 
 	"gorm.io/gorm"
 )
 
-var NodeInfoDB *gorm.DB
+// NodeLabels 节点标签。以 JSON 对象形式存储。
+type NodeLabels map[string]string
+
+// Scan 实现 sql.Scanner。
+func (l *NodeLabels) Scan(value interface{}) error {
+	var content []byte
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		content = v
+	case string:
+		content = []byte(v)
+	default:
+		return errors.New("unsupported node labels type")
+	}
+	if len(content) == 0 {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal(content, l)
+}
+
+// Value 实现 driver.Valuer。没有标签时存储为 NULL。
+func (l NodeLabels) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	content, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(content), nil
+}
+
+// GormDataType 数据库字段类型。
+func (NodeLabels) GormDataType() string {
+	return "json"
+}
+
+// String 按键名排序输出，形如 k1=v1,k2=v2。
+func (l NodeLabels) String() string {
+	keys := make([]string, 0, len(l))
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + l[key]
+	}
+	return strings.Join(pairs, ",")
+}
+
+var ErrLabelKeyInvalid = errors.New("invalid label key")
+
+// ValidateLabelKey 校验标签键名。键名不能为空，只能由字母、数字及 . _ / - 组成，否则报 ErrLabelKeyInvalid。
+//
+// 按标签选择节点时，键名将用于 JSON 路径，因此不允许引号、反斜杠等字符。
+func ValidateLabelKey(key string) error {
+	if len(key) == 0 {
+		return fmt.Errorf("%w: empty", ErrLabelKeyInvalid)
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '/' || c == '-') {
+			return fmt.Errorf("%w: %s", ErrLabelKeyInvalid, key)
+		}
+	}
+	return nil
+}
+
+// Validate 校验全部标签的键名，参见 ValidateLabelKey。
+func (l NodeLabels) Validate() error {
+	for key := range l {
+		if err := ValidateLabelKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseNodeLabels 解析形如 k1=v1,k2=v2 的标签。缺少等号的项报错，键名不合法时报 ErrLabelKeyInvalid。
+func ParseNodeLabels(value string) (NodeLabels, error) {
+	labels := make(NodeLabels)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		key, val, found := strings.Cut(pair, "=")
+		if !found || len(strings.TrimSpace(key)) == 0 {
+			return nil, fmt.Errorf("invalid label: %s", pair)
+		}
+		key = strings.TrimSpace(key)
+		if err := ValidateLabelKey(key); err != nil {
+			return nil, err
+		}
+		labels[key] = strings.TrimSpace(val)
+	}
+	return labels, nil
+}
+
+// NormalizeHost 规范化主机地址。
+//
+// IP 地址去掉方括号后转为标准形式，例如 IPv6 地址压缩表示、IPv4 映射地址转为 IPv4；
+// 主机名转为小写。
+func NormalizeHost(host string) string {
+	host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(host), "["), "]")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(host)
+}
+
+var ErrHostInvalid = errors.New("invalid host")
+
+// ValidateHost 校验主机地址。必须为 IP 地址或符合 RFC 1123 的主机名，否则报 ErrHostInvalid。
+func ValidateHost(host string) error {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if len(host) == 0 || len(host) > 253 {
+		return ErrHostInvalid
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return ErrHostInvalid
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return ErrHostInvalid
+			}
+		}
+	}
+	return nil
+}
+
+// IsHostEqual 判断两个主机地址是否相同。IP 地址按语义比较，例如 "::ffff:10.0.0.1" 与 "10.0.0.1" 相同。
+func IsHostEqual(a string, b string) bool {
+	return NormalizeHost(a) == NormalizeHost(b)
+}
+
+// IsSocketEqual 判断两个套接字是否相同。若两者均为回环地址，则只比较端口。
+func IsSocketEqual(hostA string, portA uint16, hostB string, portB uint16) bool {
+	ipA := net.ParseIP(NormalizeHost(hostA))
+	ipB := net.ParseIP(NormalizeHost(hostB))
+	if ipA.IsLoopback() && ipB.IsLoopback() {
+		return portA == portB
+	}
+	return IsHostEqual(hostA, hostB) && portA == portB
+}
 
 // FreshNodeInfo 新节点信息。
+//
+// Zone、Rack、Weight 和 Labels 为节点元数据，均为可选项。
 type FreshNodeInfo struct {
-	Name        string `form:"name" json:"name" binding:"required"`
-	NodeVersion string `form:"node_version" json:"node_version" binding:"required"`
-	Host        string `form:"host" json:"host" binding:"required"`
-	Port        uint16 `form:"port" json:"port" binding:"required"`
+	Name        string     `form:"name" json:"name" binding:"required"`
+	NodeVersion string     `form:"node_version" json:"node_version" binding:"required"`
+	Host        string     `form:"host" json:"host" binding:"required"`
+	Port        uint16     `form:"port" json:"port" binding:"required"`
+	Zone        string     `form:"zone" json:"zone,omitempty"`
+	Rack        string     `form:"rack" json:"rack,omitempty"`
+	Weight      uint32     `form:"weight" json:"weight,omitempty"`
+	Labels      NodeLabels `form:"labels" json:"labels,omitempty"`
+}
+
+// NodeSelector 节点选择条件。空值表示不限制该项。
+type NodeSelector struct {
+	Zone   string     `form:"zone" json:"zone,omitempty"`
+	Rack   string     `form:"rack" json:"rack,omitempty"`
+	Labels NodeLabels `form:"-" json:"labels,omitempty"`
+}
+
+// Matches 判断节点是否满足选择条件。标签须全部满足。
+func (s *NodeSelector) Matches(n *FreshNodeInfo) bool {
+	if s == nil {
+		return true
+	}
+	if n == nil {
+		return false
+	}
+	if len(s.Zone) > 0 && s.Zone != n.Zone {
+		return false
+	}
+	if len(s.Rack) > 0 && s.Rack != n.Rack {
+		return false
+	}
+	for key, value := range s.Labels {
+		if actual, exist := n.Labels[key]; !exist || actual != value {
+			return false
+		}
+	}
+	return true
 }
 
 // RegisteredNodeInfo 已登记节点信息。
@@ -28,19 +221,55 @@ type RegisteredNodeInfo struct {
 	Retry      uint8  `form:"retry" json:"retry"`
 }
 
+// ModifiableNodeInfo 节点可修改的信息。空值表示不修改该项。
+// Labels 若不为空，则替换全部标签。
+type ModifiableNodeInfo struct {
+	Name        string     `form:"new_name" json:"new_name"`
+	NodeVersion string     `form:"new_node_version" json:"new_node_version"`
+	Host        string     `form:"new_host" json:"new_host"`
+	Port        uint16     `form:"new_port" json:"new_port"`
+	Zone        string     `form:"new_zone" json:"new_zone"`
+	Rack        string     `form:"new_rack" json:"new_rack"`
+	Weight      uint32     `form:"new_weight" json:"new_weight"`
+	Labels      NodeLabels `form:"new_labels" json:"new_labels"`
+}
+
 func (n *FreshNodeInfo) Encode() string {
 	params := make(url.Values)
 	params.Add("name", n.Name)
 	params.Add("node_version", n.NodeVersion)
 	params.Add("host", n.Host)
 	params.Add("port", strconv.Itoa(int(n.Port)))
+	n.encodeMetadata(params)
 	return params.Encode()
 }
 
+// encodeMetadata 附加非空的节点元数据。标签以 JSON 对象形式编码。
+func (n *FreshNodeInfo) encodeMetadata(params url.Values) {
+	if len(n.Zone) > 0 {
+		params.Add("zone", n.Zone)
+	}
+	if len(n.Rack) > 0 {
+		params.Add("rack", n.Rack)
+	}
+	if n.Weight > 0 {
+		params.Add("weight", strconv.FormatUint(uint64(n.Weight), 10))
+	}
+	if len(n.Labels) > 0 {
+		if labels, err := json.Marshal(n.Labels); err == nil {
+			params.Add("labels", string(labels))
+		}
+	}
+}
+
 func (n *FreshNodeInfo) Log() string {
-	return fmt.Sprintf("Fresh Node: %39s:%-5d | %s @ %s", n.Host, n.Port, n.Name, n.NodeVersion)
+	return fmt.Sprintf("Fresh Node: %39s:%-5d | %s @ %s | Zone: %s | Rack: %s | Weight: %d | Labels: %s",
+		n.Host, n.Port, n.Name, n.NodeVersion,
+		n.Zone, n.Rack, n.Weight, n.Labels.String(),
+	)
 }
 
+// IsEqual 判断两者名称、版本和套接字是否相同。节点元数据不参与比较。
 func (n *FreshNodeInfo) IsEqual(target *FreshNodeInfo) bool {
 	if n == nil && target == nil {
 		return true
@@ -48,7 +277,7 @@ func (n *FreshNodeInfo) IsEqual(target *FreshNodeInfo) bool {
 	if n != nil && target == nil || n == nil && target != nil {
 		return false
 	}
-	return n.Name == target.Name && n.NodeVersion == target.NodeVersion && n.Host == target.Host && n.Port == target.Port
+	return n.Name == target.Name && n.NodeVersion == target.NodeVersion && IsHostEqual(n.Host, target.Host) && n.Port == target.Port
 }
 
 // Log 输出信息。
@@ -69,5 +298,143 @@ func (n *RegisteredNodeInfo) Encode() string {
 	params.Add("level", strconv.Itoa(int(n.Level)))
 	params.Add("superior_id", strconv.FormatUint(n.SuperiorID, 10))
 	params.Add("turn", strconv.FormatUint(uint64(n.Turn), 10))
+	n.encodeMetadata(params)
 	return params.Encode()
 }
+
+func (n *ModifiableNodeInfo) Encode() string {
+	params := make(url.Values)
+	if len(n.Name) > 0 {
+		params.Add("new_name", n.Name)
+	}
+	if len(n.NodeVersion) > 0 {
+		params.Add("new_node_version", n.NodeVersion)
+	}
+	if len(n.Host) > 0 {
+		params.Add("new_host", n.Host)
+	}
+	if n.Port > 0 {
+		params.Add("new_port", strconv.Itoa(int(n.Port)))
+	}
+	if len(n.Zone) > 0 {
+		params.Add("new_zone", n.Zone)
+	}
+	if len(n.Rack) > 0 {
+		params.Add("new_rack", n.Rack)
+	}
+	if n.Weight > 0 {
+		params.Add("new_weight", strconv.FormatUint(uint64(n.Weight), 10))
+	}
+	if len(n.Labels) > 0 {
+		if labels, err := json.Marshal(n.Labels); err == nil {
+			params.Add("new_labels", string(labels))
+		}
+	}
+	return params.Encode()
+}
+
+// IsEmpty 是否没有任何修改项。
+func (n *ModifiableNodeInfo) IsEmpty() bool {
+	return n == nil || len(n.Name) == 0 && len(n.NodeVersion) == 0 && len(n.Host) == 0 && n.Port == 0 &&
+		len(n.Zone) == 0 && len(n.Rack) == 0 && n.Weight == 0 && len(n.Labels) == 0
+}
+
+// Apply 将修改项应用到 fresh 上，返回修改后的新节点信息。fresh 本身不会被修改。
+func (n *ModifiableNodeInfo) Apply(fresh *FreshNodeInfo) *FreshNodeInfo {
+	result := *fresh
+	if n == nil {
+		return &result
+	}
+	if len(n.Name) > 0 {
+		result.Name = n.Name
+	}
+	if len(n.NodeVersion) > 0 {
+		result.NodeVersion = n.NodeVersion
+	}
+	if len(n.Host) > 0 {
+		result.Host = NormalizeHost(n.Host)
+	}
+	if n.Port > 0 {
+		result.Port = n.Port
+	}
+	if len(n.Zone) > 0 {
+		result.Zone = n.Zone
+	}
+	if len(n.Rack) > 0 {
+		result.Rack = n.Rack
+	}
+	if n.Weight > 0 {
+		result.Weight = n.Weight
+	}
+	if len(n.Labels) > 0 {
+		result.Labels = n.Labels
+	}
+	return &result
+}
+
+// ScopeNodeSelector 附加节点选择条件。标签条件须全部满足。适用于 node_info 及 node_info_legacy。
+//
+// 标签键名须已通过 ValidateLabelKey 校验，例如由 ParseNodeLabels 解析而来。
+func ScopeNodeSelector(selector *NodeSelector) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if selector == nil {
+			return db
+		}
+		if len(selector.Zone) > 0 {
+			db = db.Where("zone = ?", selector.Zone)
+		}
+		if len(selector.Rack) > 0 {
+			db = db.Where("rack = ?", selector.Rack)
+		}
+		for key, value := range selector.Labels {
+			db = db.Where("JSON_UNQUOTE(JSON_EXTRACT(labels, ?)) = ?", fmt.Sprintf("$.\"%s\"", key), value)
+		}
+		return db
+	}
+}
+
+// ---- Pagination ---- //
+
+const (
+	PaginationPageSizeDefault = 20  // 默认每页条数。
+	PaginationPageSizeMaximum = 100 // 每页条数上限。
+)
+
+// Pagination 分页参数。页码从 1 开始。
+type Pagination struct {
+	Page     int `form:"page" json:"page"`
+	PageSize int `form:"page_size" json:"page_size"`
+}
+
+// Normalize 规范化分页参数：页码小于 1 时取 1；每页条数小于 1 时取默认值，超过上限时取上限。
+func (p *Pagination) Normalize() {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 {
+		p.PageSize = PaginationPageSizeDefault
+	}
+	if p.PageSize > PaginationPageSizeMaximum {
+		p.PageSize = PaginationPageSizeMaximum
+	}
+}
+
+// Offset 当前页之前的条数。调用前应先调用 Normalize。
+func (p *Pagination) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// ScopePagination 附加分页条件。会先规范化 p。
+func ScopePagination(p *Pagination) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		p.Normalize()
+		return db.Offset(p.Offset()).Limit(p.PageSize)
+	}
+}
+
+// Page 分页查询结果。Total 为满足条件的总条数。
+type Page[T any] struct {
+	Pagination
+	Total int64 `json:"total"`
+	Items []T   `json:"items"`
+}
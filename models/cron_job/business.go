@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 调度状态的变更均以读取时的状态为条件，以免两个节点同时执行同一任务。返回值表示是否变更成功。
+
+// GetCronJobs 获取所有定时任务的调度记录，按名称排列。
+func GetCronJobs(ctx context.Context, db *gorm.DB) ([]CronJob, error) {
+	jobs := make([]CronJob, 0)
+	if tx := db.WithContext(ctx).Order("name").Find(&jobs); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return jobs, nil
+}
+
+// Create 登记定时任务。已存在时保持不变，以免覆盖其它节点的调度进度。
+func (m *CronJob) Create(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(m).Error
+}
+
+// Reschedule 调度规则变更后，记录新的规则和下次执行时间。
+func (m *CronJob) Reschedule(ctx context.Context, db *gorm.DB, spec string, next time.Time) (bool, error) {
+	tx := db.WithContext(ctx).Model(&CronJob{}).Where("name = ? AND spec = ?", m.Name, m.Spec).
+		Updates(map[string]interface{}{"spec": spec, "next_run_at": next})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.Spec, m.NextRunAt = spec, next
+	return true, nil
+}
+
+// Claim 由 runner 认领本次执行：记录开始时间和下次执行时间，锁定至 lockedUntil。
+// 仅当下次执行时间未被其它节点推进、且没有节点正在执行（或锁定已过期）时成功。
+func (m *CronJob) Claim(ctx context.Context, db *gorm.DB, runner uint64, startedAt time.Time, next time.Time, lockedUntil time.Time) (bool, error) {
+	tx := db.WithContext(ctx).Model(&CronJob{}).
+		Where("name = ? AND next_run_at = ?", m.Name, m.NextRunAt).
+		Where("runner_id = 0 OR locked_until IS NULL OR locked_until < ?", startedAt).
+		Updates(map[string]interface{}{
+			"runner_id":       runner,
+			"locked_until":    lockedUntil,
+			"last_started_at": startedAt,
+			"next_run_at":     next,
+		})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.RunnerID, m.LockedUntil, m.LastStartedAt, m.NextRunAt = runner, &lockedUntil, &startedAt, next
+	return true, nil
+}
+
+// Extend runner 执行期间续期锁定至 lockedUntil。若锁定已过期且被其它节点认领，则不续期。
+func (m *CronJob) Extend(ctx context.Context, db *gorm.DB, runner uint64, lockedUntil time.Time) (bool, error) {
+	tx := db.WithContext(ctx).Model(&CronJob{}).
+		Where("name = ? AND runner_id = ? AND last_started_at = ?", m.Name, runner, m.LastStartedAt).
+		Update("locked_until", lockedUntil)
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.LockedUntil = &lockedUntil
+	return true, nil
+}
+
+// Finish 记录 runner 的执行结果并解除锁定。若锁定已过期且被其它节点认领，则不记录。
+func (m *CronJob) Finish(ctx context.Context, db *gorm.DB, runner uint64, finishedAt time.Time, duration time.Duration, cause string) (bool, error) {
+	tx := db.WithContext(ctx).Model(&CronJob{}).
+		Where("name = ? AND runner_id = ? AND last_started_at = ?", m.Name, runner, m.LastStartedAt).
+		Updates(map[string]interface{}{
+			"runner_id":        0,
+			"locked_until":     nil,
+			"last_finished_at": finishedAt,
+			"last_error":       cause,
+			"last_duration":    duration.Milliseconds(),
+		})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.RunnerID, m.LockedUntil, m.LastFinishedAt, m.LastError, m.LastDuration = 0, nil, &finishedAt, cause, duration.Milliseconds()
+	return true, nil
+}
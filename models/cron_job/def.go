@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// CronJob 定时任务的调度记录。任务本身由各节点在代码中注册，参见 node.Pool.Schedule；此处只记录调度状态，
+// 以便新的主节点从上次的进度继续调度。
+//
+// RunnerID 非 0 表示该节点正在执行，直至 LockedUntil。执行期间该节点持续续期，其它节点不能再次执行该任务；
+// 执行节点失联后锁定过期，其它节点才能再次执行。
+type CronJob struct {
+	Name           string     `gorm:"column:name;type:varchar(64);primaryKey" json:"name"`
+	Spec           string     `gorm:"column:spec;type:varchar(128)" json:"spec"`
+	NextRunAt      time.Time  `gorm:"column:next_run_at;index" json:"next_run_at"`
+	RunnerID       uint64     `gorm:"column:runner_id;default:0" json:"runner_id"`
+	LockedUntil    *time.Time `gorm:"column:locked_until" json:"locked_until"`
+	LastStartedAt  *time.Time `gorm:"column:last_started_at" json:"last_started_at"`
+	LastFinishedAt *time.Time `gorm:"column:last_finished_at" json:"last_finished_at"`
+	LastError      string     `gorm:"column:last_error;type:text" json:"last_error"`
+	LastDuration   int64      `gorm:"column:last_duration" json:"last_duration"` // 上次执行的耗时（毫秒）。
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime:milli" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;autoUpdateTime:milli" json:"updated_at"`
+}
+
+func (m *CronJob) TableName() string {
+	return "cron_job"
+}
+
+// IsLocked 在 at 时是否有节点正在执行。
+func (m *CronJob) IsLocked(at time.Time) bool {
+	return m.RunnerID != 0 && m.LockedUntil != nil && m.LockedUntil.After(at)
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/tests/database"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// registry 测试所用的数据库，每个测试在事务中进行，结束时回滚。
+var registry *gorm.DB
+
+// getCronJob 读取定时任务的当前调度记录。
+func getCronJob(t *testing.T, name string) *CronJob {
+	var job CronJob
+	if err := registry.Take(&job, "name = ?", name).Error; err != nil {
+		t.Fatalf(err.Error())
+	}
+	return &job
+}
+
+// prepareCronJob 重新登记定时任务 name，下次执行时间为 next。
+func prepareCronJob(t *testing.T, name string, next time.Time) *CronJob {
+	if err := registry.Delete(&CronJob{}, "name = ?", name).Error; err != nil {
+		t.Fatalf(err.Error())
+	}
+	job := CronJob{Name: name, Spec: "@every 1m", NextRunAt: next}
+	if err := job.Create(context.Background(), registry); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return getCronJob(t, name)
+}
+
+func TestCronJob_Lifecycle(t *testing.T) {
+	registry = database.Begin(t)
+	ctx := context.Background()
+	// 数据库中的时间精确到毫秒，比较前须截断。
+	now := time.Now().Truncate(time.Millisecond)
+
+	job := prepareCronJob(t, "test-lifecycle", now)
+	assert.False(t, job.IsLocked(now))
+
+	// 已登记的任务再次登记时保持不变。
+	again := CronJob{Name: "test-lifecycle", Spec: "@every 1h", NextRunAt: now.Add(time.Hour)}
+	assert.Nil(t, again.Create(ctx, registry))
+	assert.Equal(t, "@every 1m", getCronJob(t, "test-lifecycle").Spec)
+
+	ok, err := job.Claim(ctx, registry, 1, now, now.Add(time.Minute), now.Add(10*time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	record := getCronJob(t, "test-lifecycle")
+	assert.True(t, record.IsLocked(now))
+	assert.Equal(t, uint64(1), record.RunnerID)
+	assert.True(t, record.NextRunAt.Equal(now.Add(time.Minute)))
+
+	ok, err = job.Extend(ctx, registry, 1, now.Add(20*time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, getCronJob(t, "test-lifecycle").IsLocked(now.Add(15*time.Second)))
+
+	ok, err = job.Finish(ctx, registry, 1, now.Add(time.Second), time.Second, "")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	record = getCronJob(t, "test-lifecycle")
+	assert.False(t, record.IsLocked(now))
+	assert.Equal(t, uint64(0), record.RunnerID)
+	assert.Nil(t, record.LockedUntil)
+	assert.Equal(t, int64(1000), record.LastDuration)
+	assert.True(t, record.LastFinishedAt.Equal(now.Add(time.Second)))
+
+	ok, err = record.Reschedule(ctx, registry, "@every 1h", now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	record = getCronJob(t, "test-lifecycle")
+	assert.Equal(t, "@every 1h", record.Spec)
+	assert.True(t, record.NextRunAt.Equal(now.Add(time.Hour)))
+}
+
+func TestCronJob_LostRace(t *testing.T) {
+	registry = database.Begin(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	t.Run("claim twice", func(t *testing.T) {
+		job := prepareCronJob(t, "test-claim-twice", now)
+		stale := *job
+		ok, err := job.Claim(ctx, registry, 1, now, now.Add(time.Minute), now.Add(10*time.Second))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		_, _ = job.Finish(ctx, registry, 1, now.Add(time.Millisecond), time.Millisecond, "")
+
+		// 另一节点以认领前读取的记录认领，此时下次执行时间已被推进。
+		ok, err = stale.Claim(ctx, registry, 2, now.Add(time.Second), now.Add(time.Minute), now.Add(10*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(0), getCronJob(t, "test-claim-twice").RunnerID)
+	})
+	t.Run("claim while locked", func(t *testing.T) {
+		job := prepareCronJob(t, "test-claim-while-locked", now)
+		_, _ = job.Claim(ctx, registry, 1, now, now, now.Add(10*time.Second))
+		record := getCronJob(t, "test-claim-while-locked")
+
+		ok, err := record.Claim(ctx, registry, 2, now.Add(5*time.Second), now.Add(time.Minute), now.Add(15*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(1), getCronJob(t, "test-claim-while-locked").RunnerID)
+
+		// 锁定过期后可由其它节点认领。
+		ok, err = record.Claim(ctx, registry, 2, now.Add(11*time.Second), now.Add(time.Minute), now.Add(21*time.Second))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(2), getCronJob(t, "test-claim-while-locked").RunnerID)
+	})
+	t.Run("finish after lock expired", func(t *testing.T) {
+		job := prepareCronJob(t, "test-finish-after-expired", now)
+		_, _ = job.Claim(ctx, registry, 1, now, now, now.Add(10*time.Second))
+		stale := *job
+		ok, err := getCronJob(t, "test-finish-after-expired").Claim(ctx, registry, 2, now.Add(11*time.Second), now.Add(time.Minute), now.Add(21*time.Second))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+
+		ok, err = stale.Extend(ctx, registry, 1, now.Add(20*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		ok, err = stale.Finish(ctx, registry, 1, now.Add(12*time.Second), 12*time.Second, "")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		record := getCronJob(t, "test-finish-after-expired")
+		assert.Equal(t, uint64(2), record.RunnerID)
+		assert.True(t, record.LockedUntil.Equal(now.Add(21*time.Second)))
+		assert.Nil(t, record.LastFinishedAt)
+	})
+	t.Run("finish by same runner after re-claimed", func(t *testing.T) {
+		// 同一节点再次认领后，上次执行的结果不应解除本次执行的锁定。
+		job := prepareCronJob(t, "test-finish-same-runner", now)
+		_, _ = job.Claim(ctx, registry, 1, now, now, now.Add(10*time.Second))
+		stale := *job
+		_, _ = getCronJob(t, "test-finish-same-runner").Claim(ctx, registry, 1, now.Add(11*time.Second), now.Add(time.Minute), now.Add(21*time.Second))
+
+		ok, err := stale.Finish(ctx, registry, 1, now.Add(12*time.Second), 12*time.Second, "")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.True(t, getCronJob(t, "test-finish-same-runner").IsLocked(now.Add(12*time.Second)))
+	})
+	t.Run("reschedule with stale spec", func(t *testing.T) {
+		job := prepareCronJob(t, "test-reschedule", now)
+		stale := *job
+		ok, err := job.Reschedule(ctx, registry, "@every 1h", now.Add(time.Hour))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+
+		ok, err = stale.Reschedule(ctx, registry, "@every 2h", now.Add(2*time.Hour))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, "@every 1h", getCronJob(t, "test-reschedule").Spec)
+	})
+}
@@ -1,14 +1,18 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/rhosocial/go-rush-producer/component/logging"
+	"github.com/rhosocial/go-rush-producer/component/tracing"
 	"github.com/rhosocial/go-rush-producer/models"
 	NodeLog "github.com/rhosocial/go-rush-producer/models/node_log"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 )
 
@@ -28,34 +32,23 @@ func (m *NodeInfo) IsSocketEqual(target *NodeInfo) bool {
 	if m == nil || target == nil {
 		return false
 	}
-	ipM := net.ParseIP(m.Host)
-	ipT := net.ParseIP(target.Host)
 	// If it is a loopback address, the ports are considered the same if they are the same.
-	if ipM.IsLoopback() && ipT.IsLoopback() {
-		return m.Port == target.Port
-	}
-	return m.Host == target.Host && m.Port == target.Port
+	// IP addresses are compared semantically, so that IPv6 addresses in different notations are equal.
+	return models.IsSocketEqual(m.Host, m.Port, target.Host, target.Port)
 }
 
 func (m *NodeInfo) IsSocketEqualToRegistered(target *models.RegisteredNodeInfo) bool {
 	if m == nil || target == nil {
 		return false
 	}
-	ipM := net.ParseIP(m.Host)
-	ipT := net.ParseIP(target.Host)
 	// If it is a loopback address, the ports are considered the same if they are the same.
-	if ipM.IsLoopback() && ipT.IsLoopback() {
-		return m.Port == target.Port
-	}
-	return m.Host == target.Host && m.Port == target.Port
+	// IP addresses are compared semantically, so that IPv6 addresses in different notations are equal.
+	return models.IsSocketEqual(m.Host, m.Port, target.Host, target.Port)
 }
 
+// Socket 返回套接字。IPv6 地址（包括带区域标识的链路本地地址）以方括号括起。
 func (m *NodeInfo) Socket() string {
-	ip := net.ParseIP(m.Host)
-	if ip != nil && strings.Contains(m.Host, ":") { // IPv6
-		return fmt.Sprintf("[%s]:%d", m.Host, m.Port)
-	}
-	return fmt.Sprintf("%s:%d", m.Host, m.Port)
+	return net.JoinHostPort(m.Host, strconv.Itoa(int(m.Port)))
 }
 
 func (m *NodeInfo) Log() string {
@@ -73,7 +66,7 @@ var ErrNodeDatabaseError = errors.New("node database error") // TODO: 具体错
 // 如果为发现上级阶段，则不指定上级。如果为检查上级，则需要指定。
 // 如果已经是最高级，则报 ErrNodeLevelAlreadyHighest。
 // 如果查询数据库不存在上级节点，则报 ErrNodeSuperiorNotExist。其它数据库错误则报 ErrNodeDatabaseError。
-func (m *NodeInfo) GetSuperiorNode(specifySuperior bool) (*NodeInfo, error) {
+func (m *NodeInfo) GetSuperiorNode(db *gorm.DB, specifySuperior bool) (*NodeInfo, error) {
 	var node NodeInfo
 	var condition = map[string]interface{}{
 		"level": m.Level - 1,
@@ -81,29 +74,38 @@ func (m *NodeInfo) GetSuperiorNode(specifySuperior bool) (*NodeInfo, error) {
 	if specifySuperior {
 		condition["id"] = m.SuperiorID
 	}
-	if tx := models.NodeInfoDB.Where(condition).First(&node); tx.Error == gorm.ErrRecordNotFound {
+	if tx := db.Where(condition).First(&node); tx.Error == gorm.ErrRecordNotFound {
 		return nil, ErrNodeSuperiorNotExist
 	} else if tx.Error != nil {
-		log.Println(tx.Error)
+		logging.Default.Error("failed to query superior node", "node_id", m.ID, "error", tx.Error)
 		return nil, ErrNodeDatabaseError
 	}
 	return &node, nil
 }
 
 // GetAllSlaveNodes 获取当前节点的所有从节点。
-func (m *NodeInfo) GetAllSlaveNodes() (*[]NodeInfo, error) {
+func (m *NodeInfo) GetAllSlaveNodes(db *gorm.DB) (*[]NodeInfo, error) {
 	var slaveNodes []NodeInfo
-	if tx := models.NodeInfoDB.Scopes(m.Subordinate()).Find(&slaveNodes); tx.Error != nil {
+	if tx := db.Scopes(m.Subordinate()).Find(&slaveNodes); tx.Error != nil {
 		return nil, tx.Error
 	}
 	return &slaveNodes, nil
 }
 
+// GetNodesBySelector 获取满足选择条件的所有节点，按级别和接替顺序排序。
+func GetNodesBySelector(db *gorm.DB, selector *models.NodeSelector) (*[]NodeInfo, error) {
+	var nodes []NodeInfo
+	if tx := db.Scopes(ScopeSelector(selector)).Order("level asc, turn asc").Find(&nodes); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &nodes, nil
+}
+
 // GetNodeInfo 根据指定ID获取NodeInfo记录。若指定ID的记录不存在，则报 gorm.ErrRecordNotFound。
-func GetNodeInfo(id uint64) (*NodeInfo, error) {
+func GetNodeInfo(db *gorm.DB, id uint64) (*NodeInfo, error) {
 	var record NodeInfo
-	if tx := models.NodeInfoDB.Take(&record, id); tx.Error != nil {
-		log.Println(tx.Error)
+	if tx := db.Take(&record, id); tx.Error != nil {
+		logging.Default.Debug("failed to get node", "node_id", id, "error", tx.Error)
 		return nil, tx.Error
 	}
 	return &record, nil
@@ -119,7 +121,7 @@ func (m *NodeInfo) IsEqual(target *NodeInfo) error {
 		return ErrNodeIsNotEqualBecauseOfNil
 	}
 	if m.ID != target.ID {
-		log.Println(m.ID, target.ID)
+		logging.Default.Debug("nodes are not equal", "node_id", m.ID, "target_id", target.ID)
 		return ErrNodeIsNotEqualBecauseOfDifferentID
 	}
 	if !m.IsSocketEqual(target) {
@@ -151,25 +153,25 @@ func (m *NodeInfo) IsEqualToRegistered(target *models.RegisteredNodeInfo) error
 // 从节点的上级节点为当前节点。
 // 从节点的 Level 为当前节点 + 1。
 // 从节点的 Turn 为当前所有节点最大 Turn + 1。如果没有从节点，则默认为 1。
-func (m *NodeInfo) AddSlaveNode(n *NodeInfo) (bool, error) {
+func (m *NodeInfo) AddSlaveNode(db *gorm.DB, n *NodeInfo) (bool, error) {
 	n.SuperiorID = m.ID
 	n.Level = m.Level + 1
-	if tx := models.NodeInfoDB.Create(n); tx.Error != nil {
+	if tx := db.Create(n); tx.Error != nil {
 		return false, tx.Error
 	}
 	return true, nil
 }
 
-func (m *NodeInfo) CommitSelfAsMasterNode() (bool, error) {
-	if tx := models.NodeInfoDB.Create(m); tx.Error != nil {
+func (m *NodeInfo) CommitSelfAsMasterNode(db *gorm.DB) (bool, error) {
+	if tx := db.Create(m); tx.Error != nil {
 		return false, tx.Error
 	}
 	return true, nil
 }
 
-func (m *NodeInfo) GetNodeBySocket() (*NodeInfo, error) {
+func (m *NodeInfo) GetNodeBySocket(db *gorm.DB) (*NodeInfo, error) {
 	var node NodeInfo
-	if tx := models.NodeInfoDB.Scopes(m.ScopeSocket()).Take(&node); tx.Error != nil {
+	if tx := db.Scopes(m.ScopeSocket()).Take(&node); tx.Error != nil {
 		return nil, tx.Error
 	}
 	return &node, nil
@@ -199,16 +201,20 @@ func (m *NodeInfo) IsSubordinate(slave *NodeInfo) bool {
 // 3. 修改自己的记录：level -=1，m.SuperiorID = master.SuperiorID，m.Turn = master.Turn。
 //
 // 4. 修改其它节点的 SuperiorID 为自己。
-func (m *NodeInfo) SupersedeMasterNode(master *NodeInfo) error {
-	return models.NodeInfoDB.Transaction(func(tx *gorm.DB) error {
+//
+// ctx 用于追踪，事务不随 ctx 取消，参见 tracing.Detach。
+func (m *NodeInfo) SupersedeMasterNode(ctx context.Context, db *gorm.DB, master *NodeInfo) (err error) {
+	ctx, span := tracing.Start(ctx, "registry.SupersedeMasterNode",
+		attribute.Int64("node.id", int64(m.ID)), attribute.Int64("peer.id", int64(master.ID)))
+	defer func() { tracing.End(span, err) }()
+	return db.WithContext(tracing.Detach(ctx)).Transaction(func(tx *gorm.DB) error {
 		// 1. 判断提供的 master 是否与数据库对应，以及是否为我的上级。
 		var realMaster NodeInfo
 		if err := tx.Scopes(master.ScopeSocket()).Where("level = ?", master.Level).Take(&realMaster, master.ID).Error; err != nil {
 			return err
 		}
 		if !m.IsSuperior(&realMaster) {
-			log.Println(m)
-			log.Println(realMaster)
+			logging.Default.Warn("master is not superior", "node_id", m.ID, "superior_id", m.SuperiorID, "master_id", realMaster.ID, "master_level", realMaster.Level)
 			return ErrMasterNodeIsNotSuperior
 		}
 		// 2. 记录上级ID和接替顺序，然后删除。
@@ -246,15 +252,20 @@ func (m *NodeInfo) SupersedeMasterNode(master *NodeInfo) error {
 // 3. 修改 candidate 的记录：level -=1，candidate.SuperiorID = master.SuperiorID，candidate.Turn = master.Turn。
 //
 // 4. 修改其它节点的 SuperiorID 为自己。
-func (m *NodeInfo) HandoverMasterNode(candidate *NodeInfo) error {
-	return models.NodeInfoDB.Transaction(func(tx *gorm.DB) error {
+//
+// ctx 用于追踪，事务不随 ctx 取消，参见 tracing.Detach。
+func (m *NodeInfo) HandoverMasterNode(ctx context.Context, db *gorm.DB, candidate *NodeInfo) (err error) {
+	ctx, span := tracing.Start(ctx, "registry.HandoverMasterNode",
+		attribute.Int64("node.id", int64(m.ID)), attribute.Int64("peer.id", int64(candidate.ID)))
+	defer func() { tracing.End(span, err) }()
+	return db.WithContext(tracing.Detach(ctx)).Transaction(func(tx *gorm.DB) error {
 		// 1. 判断提供的 candidate 是否与数据库对应，以及是否为我的下级。
 		var realSlave NodeInfo
 		if err := tx.Scopes(candidate.ScopeSocket()).Where("level = ?", candidate.Level).Take(&realSlave, candidate.ID).Error; err != nil {
 			return err
 		}
 		if !m.IsSubordinate(candidate) {
-			log.Printf("Master: [%d], Candidate: [%d]\n", m.ID, candidate.ID)
+			logging.Default.Warn("candidate is not subordinate", "node_id", m.ID, "candidate_id", candidate.ID)
 			return ErrSlaveNodeIsNotSubordinate
 		}
 		// 2. 记录自己的ID和接替顺序，然后删除。删除不存在的记录不会报错。
@@ -305,21 +316,80 @@ func (m *NodeInfo) HandoverMasterNode(candidate *NodeInfo) error {
 // TODO: 此为暂定名。
 var ErrModelInvalid = errors.New("slave not invalid")
 
-func (m *NodeInfo) RemoveSlaveNode(slave *NodeInfo) (bool, error) {
+func (m *NodeInfo) RemoveSlaveNode(db *gorm.DB, slave *NodeInfo) (bool, error) {
+	if slave.Level != m.Level+1 || slave.SuperiorID != m.ID {
+		return false, ErrModelInvalid
+	}
+	if tx := db.Delete(&slave); tx.Error != nil {
+		return false, tx.Error
+	}
+	return true, nil
+}
+
+// ErrModelConflict 表示记录已被其它操作修改。
+var ErrModelConflict = errors.New("the record has been modified by others")
+
+// ModifySlaveNode 修改从节点信息。仅修改 modified 中的非空项，接替顺序等其它信息保持不变。
+//
+// 修改前会从数据库刷新 slave，以取得最新的记录版本。若修改时记录版本已变化，则报 ErrModelConflict。
+// 修改成功后，slave 为修改后的最新记录。
+func (m *NodeInfo) ModifySlaveNode(db *gorm.DB, slave *NodeInfo, modified *models.ModifiableNodeInfo) (bool, error) {
 	if slave.Level != m.Level+1 || slave.SuperiorID != m.ID {
 		return false, ErrModelInvalid
 	}
-	if tx := models.NodeInfoDB.Delete(&slave); tx.Error != nil {
+	if err := slave.Refresh(db); err != nil {
+		return false, err
+	}
+	fresh := modified.Apply(slave.ToFreshNodeInfo())
+	tx := db.Model(slave).Updates(map[string]interface{}{
+		"name":         fresh.Name,
+		"node_version": fresh.NodeVersion,
+		"host":         fresh.Host,
+		"port":         fresh.Port,
+		"zone":         fresh.Zone,
+		"rack":         fresh.Rack,
+		"weight":       fresh.Weight,
+		"labels":       fresh.Labels,
+	})
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return false, ErrModelConflict
+	}
+	if err := slave.Refresh(db); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ModifySelfLabels 修改自己的标签。labels 为空表示清空标签。
+//
+// 修改前会从数据库刷新自己，以取得最新的记录版本。若修改时记录版本已变化，则报 ErrModelConflict。
+func (m *NodeInfo) ModifySelfLabels(db *gorm.DB, labels models.NodeLabels) (bool, error) {
+	if err := m.Refresh(db); err != nil {
+		return false, err
+	}
+	tx := db.Model(m).Updates(map[string]interface{}{
+		"labels": labels,
+	})
+	if tx.Error != nil {
 		return false, tx.Error
 	}
+	if tx.RowsAffected == 0 {
+		return false, ErrModelConflict
+	}
+	if err := m.Refresh(db); err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
 // RemoveSelf 删除自己。
 //
 // 需要先判断数据库中是否存在，以避免重复删除问题。
-func (m *NodeInfo) RemoveSelf() (bool, error) {
-	if tx := models.NodeInfoDB.Delete(m); tx.Error != nil {
+func (m *NodeInfo) RemoveSelf(db *gorm.DB) (bool, error) {
+	if tx := db.Delete(m); tx.Error != nil {
 		return false, tx.Error
 	}
 	return true, nil
@@ -327,48 +397,52 @@ func (m *NodeInfo) RemoveSelf() (bool, error) {
 
 // ---- Log ---- //
 
-func (m *NodeInfo) LogReportActive() (int64, error) {
-	nodeLog, err := m.GetLogActiveLatest()
+func (m *NodeInfo) LogReportActive(db *gorm.DB) (int64, error) {
+	nodeLog, err := m.GetLogActiveLatest(db)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return m.NewNodeLog(NodeLog.NodeLogTypeReportActive, 0).Record()
+		return m.NewNodeLog(NodeLog.NodeLogTypeReportActive, 0).Record(db)
 	}
-	return nodeLog.VersionUp()
+	return nodeLog.VersionUp(db)
 }
 
-func (m *NodeInfo) LogReportExistedNodeMasterDetectedSlaveInactive(id uint64, retry uint8) (int64, error) {
-	return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeMasterReportSlaveInactive, id).Record()
+func (m *NodeInfo) LogReportExistedNodeMasterDetectedSlaveInactive(db *gorm.DB, id uint64, retry uint8) (int64, error) {
+	return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeMasterReportSlaveInactive, id).Record(db)
 }
 
-func (m *NodeInfo) LogReportFreshSlaveJoined(fresh *NodeInfo) (int64, error) {
-	return m.NewNodeLog(NodeLog.NodeLogTypeFreshNodeSlaveJoined, fresh.ID).Record()
+func (m *NodeInfo) LogReportFreshSlaveJoined(db *gorm.DB, fresh *NodeInfo) (int64, error) {
+	return m.NewNodeLog(NodeLog.NodeLogTypeFreshNodeSlaveJoined, fresh.ID).Record(db)
 }
 
-func (m *NodeInfo) LogReportExistedSlaveWithdrawn(existed *NodeInfo) (int64, error) {
-	return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeSlaveWithdrawn, existed.ID).Record()
+func (m *NodeInfo) LogReportExistedSlaveWithdrawn(db *gorm.DB, existed *NodeInfo) (int64, error) {
+	return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeSlaveWithdrawn, existed.ID).Record(db)
 }
 
-func (m *NodeInfo) LogReportFreshMasterJoined() (int64, error) {
-	return m.NewNodeLog(NodeLog.NodeLogTypeFreshNodeMasterJoined, 0).Record()
+func (m *NodeInfo) LogReportExistedSlaveModified(db *gorm.DB, existed *NodeInfo) (int64, error) {
+	return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeSlaveModified, existed.ID).Record(db)
 }
 
-func (m *NodeInfo) LogReportExistedMasterWithdrawn() (int64, error) {
-	return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeMasterWithdrawn, 0).Record()
+func (m *NodeInfo) LogReportFreshMasterJoined(db *gorm.DB) (int64, error) {
+	return m.NewNodeLog(NodeLog.NodeLogTypeFreshNodeMasterJoined, 0).Record(db)
 }
 
-func (m *NodeInfo) LogReportExistedNodeSlaveReportMasterInactive(master *NodeInfo) (int64, error) {
-	nodeLog, err := m.GetLogSlaveReportMasterInactive(master.ID)
+func (m *NodeInfo) LogReportExistedMasterWithdrawn(db *gorm.DB) (int64, error) {
+	return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeMasterWithdrawn, 0).Record(db)
+}
+
+func (m *NodeInfo) LogReportExistedNodeSlaveReportMasterInactive(db *gorm.DB, master *NodeInfo) (int64, error) {
+	nodeLog, err := m.GetLogSlaveReportMasterInactive(db, master.ID)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeSlaveReportMasterInactive, master.ID).Record()
+		return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeSlaveReportMasterInactive, master.ID).Record(db)
 	}
-	return nodeLog.VersionUp()
+	return nodeLog.VersionUp(db)
 }
 
-func (m *NodeInfo) LogReportExistedNodeMasterReportSlaveInactive(slave *NodeInfo) (int64, error) {
-	nodeLog, err := m.GetLogMasterReportSlaveInactive(slave.ID)
+func (m *NodeInfo) LogReportExistedNodeMasterReportSlaveInactive(db *gorm.DB, slave *NodeInfo) (int64, error) {
+	nodeLog, err := m.GetLogMasterReportSlaveInactive(db, slave.ID)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeMasterReportSlaveInactive, slave.ID).Record()
+		return m.NewNodeLog(NodeLog.NodeLogTypeExistedNodeMasterReportSlaveInactive, slave.ID).Record(db)
 	}
-	return nodeLog.VersionUp()
+	return nodeLog.VersionUp(db)
 }
 
 func (m *NodeInfo) NewNodeLog(logType uint8, target uint64) *NodeLog.NodeLog {
@@ -391,6 +465,10 @@ func (m *NodeInfo) ToFreshNodeInfo() *models.FreshNodeInfo {
 		NodeVersion: m.NodeVersion,
 		Host:        m.Host,
 		Port:        m.Port,
+		Zone:        m.Zone,
+		Rack:        m.Rack,
+		Weight:      m.Weight,
+		Labels:      m.Labels,
 	}
 	return &fresh
 }
@@ -410,33 +488,107 @@ func (m *NodeInfo) ToRegisteredNodeInfo() *models.RegisteredNodeInfo {
 	return &registered
 }
 
-func (m *NodeInfo) Refresh() error {
-	if err := models.NodeInfoDB.Take(m, m.ID).Error; err != nil {
+func (m *NodeInfo) Refresh(db *gorm.DB) error {
+	if err := db.Take(m, m.ID).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
-func (m *NodeInfo) GetLogActiveLatest() (*NodeLog.NodeLog, error) {
+func (m *NodeInfo) GetLogActiveLatest(db *gorm.DB) (*NodeLog.NodeLog, error) {
 	var nodeLog NodeLog.NodeLog
-	if tx := models.NodeInfoDB.Scopes(m.LogActiveLatest()).First(&nodeLog); tx.Error != nil {
+	if tx := db.Scopes(m.LogActiveLatest()).First(&nodeLog); tx.Error != nil {
 		return nil, tx.Error
 	}
 	return &nodeLog, nil
 }
 
-func (m *NodeInfo) GetLogSlaveReportMasterInactive(targetID uint64) (*NodeLog.NodeLog, error) {
+func (m *NodeInfo) GetLogSlaveReportMasterInactive(db *gorm.DB, targetID uint64) (*NodeLog.NodeLog, error) {
 	var nodeLog NodeLog.NodeLog
-	if tx := models.NodeInfoDB.Scopes(m.LogSlaveReportMasterInactiveLatest(targetID)).First(&nodeLog); tx.Error != nil {
+	if tx := db.Scopes(m.LogSlaveReportMasterInactiveLatest(targetID)).First(&nodeLog); tx.Error != nil {
 		return nil, tx.Error
 	}
 	return &nodeLog, nil
 }
 
-func (m *NodeInfo) GetLogMasterReportSlaveInactive(targetID uint64) (*NodeLog.NodeLog, error) {
+func (m *NodeInfo) GetLogMasterReportSlaveInactive(db *gorm.DB, targetID uint64) (*NodeLog.NodeLog, error) {
 	var nodeLog NodeLog.NodeLog
-	if tx := models.NodeInfoDB.Scopes(m.LogMasterReportSlaveInactiveLatest(targetID)).First(&nodeLog); tx.Error != nil {
+	if tx := db.Scopes(m.LogMasterReportSlaveInactiveLatest(targetID)).First(&nodeLog); tx.Error != nil {
 		return nil, tx.Error
 	}
 	return &nodeLog, nil
 }
+
+// BuildNodeTree 按上级关系将节点组织为树，返回各根节点。nodes 应已按级别和接替顺序排序，下级节点保持该顺序。
+//
+// 上级为空、为自身或不在 nodes 中的节点（例如按条件筛选后上级被排除）均作为根节点。
+// 未能挂到任何根节点之下的节点（例如上级关系成环）也作为根节点，并与其上级断开，以免遗漏或循环引用。
+//
+// lastActive 为各节点最近一次报告活跃的时间，可以为空。
+func BuildNodeTree(nodes []NodeInfo, lastActive map[uint64]time.Time) []*NodeTree {
+	trees := make(map[uint64]*NodeTree, len(nodes))
+	for i := range nodes {
+		tree := NodeTree{NodeInfo: nodes[i], Subordinates: make([]*NodeTree, 0)}
+		if at, exist := lastActive[nodes[i].ID]; exist {
+			tree.LastActiveAt = &at
+		}
+		trees[nodes[i].ID] = &tree
+	}
+	roots := make([]*NodeTree, 0)
+	attached := make(map[uint64]bool, len(nodes))
+	for i := range nodes {
+		tree := trees[nodes[i].ID]
+		superior, exist := trees[nodes[i].SuperiorID]
+		if !exist || nodes[i].SuperiorID == nodes[i].ID {
+			roots = append(roots, tree)
+			continue
+		}
+		superior.Subordinates = append(superior.Subordinates, tree)
+	}
+	var mark func(tree *NodeTree)
+	mark = func(tree *NodeTree) {
+		if attached[tree.ID] {
+			return
+		}
+		attached[tree.ID] = true
+		for _, subordinate := range tree.Subordinates {
+			mark(subordinate)
+		}
+	}
+	for _, root := range roots {
+		mark(root)
+	}
+	for i := range nodes {
+		if !attached[nodes[i].ID] {
+			root := trees[nodes[i].ID]
+			// 从上级的下级节点中移除，以断开环。
+			superior := trees[nodes[i].SuperiorID]
+			for j, subordinate := range superior.Subordinates {
+				if subordinate == root {
+					superior.Subordinates = append(superior.Subordinates[:j], superior.Subordinates[j+1:]...)
+					break
+				}
+			}
+			roots = append(roots, root)
+			mark(root)
+		}
+	}
+	return roots
+}
+
+// GetNodeTree 获取满足选择条件的节点登记树及各节点最近一次报告活跃的时间，参见 BuildNodeTree。
+func GetNodeTree(ctx context.Context, db *gorm.DB, selector *models.NodeSelector) ([]*NodeTree, error) {
+	var nodes []NodeInfo
+	if tx := db.WithContext(ctx).Scopes(ScopeSelector(selector)).Order("level asc, turn asc").Find(&nodes); tx.Error != nil {
+		return nil, tx.Error
+	}
+	ids := make([]uint64, len(nodes))
+	for i := range nodes {
+		ids[i] = nodes[i].ID
+	}
+	lastActive, err := NodeLog.GetLatestActiveReports(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	return BuildNodeTree(nodes, lastActive), nil
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	base "github.com/rhosocial/go-rush-producer/models"
 	models "github.com/rhosocial/go-rush-producer/models/node_info_legacy"
 	NodeLog "github.com/rhosocial/go-rush-producer/models/node_log"
 	"gorm.io/gorm"
@@ -12,12 +13,16 @@ import (
 type NodeInfo struct {
 	ID          uint64                 `gorm:"column:id;primaryKey;autoIncrement;<-:false" json:"id"`
 	Name        string                 `gorm:"column:name;default:''" json:"name"`
-	NodeVersion string                 `gorm:"column:node_version;default:'';<-:create" json:"node_version"`
-	Host        string                 `gorm:"column:host;<-:create" json:"Host"`
-	Port        uint16                 `gorm:"column:port;<-:create" json:"Port"`
+	NodeVersion string                 `gorm:"column:node_version;default:''" json:"node_version"`
+	Host        string                 `gorm:"column:host" json:"Host"`
+	Port        uint16                 `gorm:"column:port" json:"Port"`
 	Level       uint8                  `gorm:"column:level" json:"Level"`
 	SuperiorID  uint64                 `gorm:"column:superior_id" json:"superior_id"`
 	Turn        uint32                 `gorm:"column:turn" json:"turn"`
+	Zone        string                 `gorm:"column:zone;default:''" json:"zone"`
+	Rack        string                 `gorm:"column:rack;default:''" json:"rack"`
+	Weight      uint32                 `gorm:"column:weight;default:0" json:"weight"`
+	Labels      base.NodeLabels        `gorm:"column:labels" json:"labels"`
 	CreatedAt   time.Time              `gorm:"column:created_at;autoCreateTime:milli" json:"created_at"`
 	UpdatedAt   time.Time              `gorm:"column:updated_at;autoUpdateTime:milli" json:"updated_at"`
 	Version     optimisticlock.Version `gorm:"column:version;default:0" json:"version"`
@@ -40,6 +45,10 @@ func (m *NodeInfo) AfterDelete(tx *gorm.DB) (err error) {
 		Level:       m.Level,
 		SuperiorID:  m.SuperiorID,
 		Turn:        m.Turn,
+		Zone:        m.Zone,
+		Rack:        m.Rack,
+		Weight:      m.Weight,
+		Labels:      m.Labels,
 		CreatedAt:   m.CreatedAt,
 		UpdatedAt:   m.UpdatedAt,
 		Version:     m.Version,
@@ -83,8 +92,20 @@ func (m *NodeInfo) LogMasterReportSlaveInactiveLatest(targetID uint64) func(db *
 	}
 }
 
+// ScopeSelector 附加节点选择条件，参见 base.ScopeNodeSelector。
+func ScopeSelector(selector *base.NodeSelector) func(db *gorm.DB) *gorm.DB {
+	return base.ScopeNodeSelector(selector)
+}
+
 func (m *NodeInfo) ScopeSocket() func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		return db.Where("host = ? AND port = ?", m.Host, m.Port)
 	}
 }
+
+// NodeTree 节点登记树的一个节点。Subordinates 为其下级节点，按级别和接替顺序排序。
+type NodeTree struct {
+	NodeInfo
+	LastActiveAt *time.Time  `json:"last_active_at"` // 最近一次报告活跃的时间。从未报告时为空。
+	Subordinates []*NodeTree `json:"subordinates"`
+}
@@ -2,13 +2,13 @@ package models
 
 import (
 	"testing"
+	"time"
 
-	mysqlConfig "github.com/rhosocial/go-rush-common/component/mysql"
 	"github.com/rhosocial/go-rush-producer/models"
 	NodeInfoLegacy "github.com/rhosocial/go-rush-producer/models/node_info_legacy"
 	NodeLog "github.com/rhosocial/go-rush-producer/models/node_log"
+	"github.com/rhosocial/go-rush-producer/tests/database"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
@@ -28,6 +28,64 @@ func TestFreshNodeInfo_Encode(t *testing.T) {
 	})
 }
 
+func TestFreshNodeInfo_EncodeMetadata(t *testing.T) {
+	node := models.FreshNodeInfo{
+		Host:        "192.168.0.1",
+		Port:        uint16(38081),
+		NodeVersion: "1.0.0",
+		Name:        "GO-RUSH-PRODUCER",
+		Zone:        "cn-east-1a",
+		Weight:      2,
+		Labels:      models.NodeLabels{"tier": "gold"},
+	}
+	assert.Equal(t, "host=192.168.0.1&labels=%7B%22tier%22%3A%22gold%22%7D&name=GO-RUSH-PRODUCER&node_version=1.0.0&port=38081&weight=2&zone=cn-east-1a", node.Encode())
+}
+
+func TestNodeLabels(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		labels, err := models.ParseNodeLabels(" tier = gold ,disk=ssd,")
+		assert.Nil(t, err)
+		assert.Equal(t, models.NodeLabels{"tier": "gold", "disk": "ssd"}, labels)
+		assert.Equal(t, "disk=ssd,tier=gold", labels.String())
+		_, err = models.ParseNodeLabels("tier")
+		assert.NotNil(t, err)
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		labels, err := models.ParseNodeLabels("example.com/tier_1-a=gold")
+		assert.Nil(t, err)
+		assert.Equal(t, models.NodeLabels{"example.com/tier_1-a": "gold"}, labels)
+		for _, value := range []string{`ti"er=gold`, `tier\=gold`, "ti er=gold", "$.tier=gold", "层=gold"} {
+			_, err := models.ParseNodeLabels(value)
+			assert.ErrorIs(t, err, models.ErrLabelKeyInvalid, value)
+		}
+		assert.ErrorIs(t, models.NodeLabels{`a"b`: "c"}.Validate(), models.ErrLabelKeyInvalid)
+	})
+	t.Run("scan and value", func(t *testing.T) {
+		value, err := models.NodeLabels{"tier": "gold"}.Value()
+		assert.Nil(t, err)
+		var labels models.NodeLabels
+		assert.Nil(t, labels.Scan([]byte(value.(string))))
+		assert.Equal(t, models.NodeLabels{"tier": "gold"}, labels)
+		value, err = models.NodeLabels{}.Value()
+		assert.Nil(t, err)
+		assert.Nil(t, value)
+		assert.Nil(t, labels.Scan(nil))
+		assert.Nil(t, labels)
+	})
+}
+
+func TestNodeSelector_Matches(t *testing.T) {
+	node := models.FreshNodeInfo{Zone: "a", Rack: "r1", Labels: models.NodeLabels{"tier": "gold", "disk": "ssd"}}
+	var empty *models.NodeSelector
+	assert.True(t, empty.Matches(&node))
+	assert.True(t, (&models.NodeSelector{Zone: "a", Labels: models.NodeLabels{"tier": "gold"}}).Matches(&node))
+	assert.False(t, (&models.NodeSelector{Zone: "b"}).Matches(&node))
+	assert.False(t, (&models.NodeSelector{Rack: "r2"}).Matches(&node))
+	assert.False(t, (&models.NodeSelector{Labels: models.NodeLabels{"tier": "silver"}}).Matches(&node))
+	assert.False(t, (&models.NodeSelector{Labels: models.NodeLabels{"gpu": "true"}}).Matches(&node))
+	assert.False(t, (&models.NodeSelector{}).Matches(nil))
+}
+
 func TestFreshNodeInfo_IsEqual(t *testing.T) {
 	t.Run("nil origin and target", func(t *testing.T) {
 		var origin *models.FreshNodeInfo
@@ -58,6 +116,41 @@ func TestFreshNodeInfo_IsEqual(t *testing.T) {
 	})
 }
 
+func TestModifiableNodeInfo_Encode(t *testing.T) {
+	t.Run("Empty content", func(t *testing.T) {
+		modified := models.ModifiableNodeInfo{}
+		assert.True(t, modified.IsEmpty())
+		assert.Equal(t, "", modified.Encode())
+	})
+	t.Run("Partial content", func(t *testing.T) {
+		modified := models.ModifiableNodeInfo{NodeVersion: "1.0.1", Port: 38082}
+		assert.False(t, modified.IsEmpty())
+		assert.Equal(t, "new_node_version=1.0.1&new_port=38082", modified.Encode())
+	})
+}
+
+func TestModifiableNodeInfo_Apply(t *testing.T) {
+	fresh := models.FreshNodeInfo{
+		Host:        "192.168.0.1",
+		Port:        uint16(38081),
+		NodeVersion: "1.0.0",
+		Name:        "GO-RUSH-PRODUCER",
+	}
+	t.Run("nil modification", func(t *testing.T) {
+		var modified *models.ModifiableNodeInfo
+		assert.True(t, modified.Apply(&fresh).IsEqual(&fresh))
+	})
+	t.Run("partial modification", func(t *testing.T) {
+		modified := models.ModifiableNodeInfo{NodeVersion: "1.0.1", Host: "192.168.0.2"}
+		result := modified.Apply(&fresh)
+		assert.Equal(t, "1.0.1", result.NodeVersion)
+		assert.Equal(t, "192.168.0.2", result.Host)
+		assert.Equal(t, fresh.Name, result.Name)
+		assert.Equal(t, fresh.Port, result.Port)
+		assert.Equal(t, "1.0.0", fresh.NodeVersion)
+	})
+}
+
 func TestNewNodeInfo(t *testing.T) {
 	t.Run("normal case", func(t *testing.T) {
 		node := NewNodeInfo("node_name_test_case", "1.0.0-test", 38081, 1)
@@ -87,6 +180,10 @@ func TestNodeInfo_Socket(t *testing.T) {
 	t.Run("IPv6 loopback", func(t *testing.T) {
 		assert.Equal(t, "[::1]:38081", nodeIPv6.Socket())
 	})
+	t.Run("IPv6 link-local with zone", func(t *testing.T) {
+		nodeIPv6.Host = "fe80::1%eth0"
+		assert.Equal(t, "[fe80::1%eth0]:38081", nodeIPv6.Socket())
+	})
 }
 
 func TestNodeInfo_IsSocketEqual(t *testing.T) {
@@ -134,41 +231,35 @@ func TestNodeInfo_IsSocketEqual(t *testing.T) {
 		assert.True(t, nodeIPv6.IsSocketEqual(node))
 		assert.True(t, nodeIPv6.IsSocketEqual(targetLoopback1))
 	})
-}
 
-func teardownNodeInfo(t *testing.T) {
-	if models.NodeInfoDB != nil {
-		if err := models.NodeInfoDB.Rollback().Error; err != nil {
-			t.Fatalf(err.Error())
-		}
-	}
-}
+	t.Run("IPv6 notations", func(t *testing.T) {
+		a := NewNodeInfo("node_name_test_case", "1.0.0-test", 38081, 1)
+		a.Host = "2001:db8:0:0:0:0:0:1"
+		b := NewNodeInfo("node_name_test_case", "1.0.0-test", 38081, 1)
+		b.Host = "[2001:DB8::1]"
+		assert.True(t, a.IsSocketEqual(b))
+		b.Port = 38082
+		assert.False(t, a.IsSocketEqual(b))
+	})
 
-func setupGorm(t *testing.T) {
-	var config = mysqlConfig.EnvMySQLServer{
-		Host:     "localhost",
-		Port:     3306,
-		Username: "root",
-		Password: "12345678",
-		DB:       "go-rush-producer",
-		Charset:  "utf8mb4",
-		Location: "Local",
-	}
-	db, err := gorm.Open(mysql.Open(config.GetDSN()), &gorm.Config{})
-	if err != nil {
-		t.Fatalf(err.Error())
-		return
-	}
-	models.NodeInfoDB = db.Begin()
+	t.Run("IPv4-mapped IPv6", func(t *testing.T) {
+		a := NewNodeInfo("node_name_test_case", "1.0.0-test", 38081, 1)
+		a.Host = "::ffff:192.168.0.1"
+		a.Port = target3.Port
+		assert.True(t, a.IsSocketEqual(target3))
+	})
 }
 
+// registry 测试所用的节点登记数据库，每个测试在事务中进行，结束时回滚。
+var registry *gorm.DB
+
 var root *NodeInfo
 var sub1 *NodeInfo
 var sub2 *NodeInfo
 var subN *NodeInfo
 
 func prepareNodeInfo(t *testing.T) {
-	tx := models.NodeInfoDB
+	tx := registry
 
 	// root
 	root = NewNodeInfo("root", "1.0.0", 38081, 0)
@@ -213,12 +304,11 @@ func prepareNodeInfo(t *testing.T) {
 }
 
 func TestNodeInfo_GetAllSlaveNodes(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
 	t.Run("normal case", func(t *testing.T) {
-		nodes, err := root.GetAllSlaveNodes()
+		nodes, err := root.GetAllSlaveNodes(registry)
 		if err != nil {
 			t.Fatalf(err.Error())
 			return
@@ -231,12 +321,11 @@ func TestNodeInfo_GetAllSlaveNodes(t *testing.T) {
 }
 
 func TestNodeInfo_GetSuperiorNode(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
 	t.Run("root is the superior of sub1", func(t *testing.T) {
-		node, err := sub1.GetSuperiorNode(true)
+		node, err := sub1.GetSuperiorNode(registry, true)
 		if err != nil {
 			t.Fatalf(err.Error())
 			return
@@ -247,15 +336,14 @@ func TestNodeInfo_GetSuperiorNode(t *testing.T) {
 		assert.Equal(t, root.ID, sub1.SuperiorID)
 	})
 	t.Run("root is not the superior of subN", func(t *testing.T) {
-		_, err := subN.GetSuperiorNode(true)
+		_, err := subN.GetSuperiorNode(registry, true)
 		assert.ErrorIs(t, ErrNodeSuperiorNotExist, err)
 	})
 }
 
 func TestNodeInfo_IsSubordinate(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
 	t.Run("sub1 is the subordinate of root", func(t *testing.T) {
 		assert.True(t, root.IsSubordinate(sub1))
@@ -269,9 +357,8 @@ func TestNodeInfo_IsSubordinate(t *testing.T) {
 }
 
 func TestNodeInfo_IsSuperior(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
 	t.Run("root is the superior of sub1", func(t *testing.T) {
 		assert.True(t, sub1.IsSuperior(root))
@@ -285,17 +372,16 @@ func TestNodeInfo_IsSuperior(t *testing.T) {
 //
 // 删除自己时，会将自己插入到 node_info_legacy 表中。
 func TestNodeInfo_RemoveSelf(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
-	tx := models.NodeInfoDB
+	tx := registry
 
 	t.Run("normal case", func(t *testing.T) {
 		var legacy NodeInfoLegacy.NodeInfoLegacy
 		assert.ErrorIs(t, tx.Model(&NodeInfoLegacy.NodeInfoLegacy{}).Where("id = ?", sub1.ID).Take(&legacy).Error, gorm.ErrRecordNotFound)
 
-		result, err := sub1.RemoveSelf()
+		result, err := sub1.RemoveSelf(registry)
 		assert.True(t, result)
 		assert.Nil(t, err, sub1.ID)
 
@@ -305,41 +391,39 @@ func TestNodeInfo_RemoveSelf(t *testing.T) {
 }
 
 func TestNodeInfo_LogReportActive(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
-	tx := models.NodeInfoDB
+	tx := registry
 
 	t.Run("normal case", func(t *testing.T) {
 		var log NodeLog.NodeLog
 		assert.ErrorIs(t, tx.Model(&NodeLog.NodeLog{}).Where("node_id = ?", sub1.ID).Take(&log).Error, gorm.ErrRecordNotFound)
 
-		active, err := sub1.LogReportActive()
+		active, err := sub1.LogReportActive(registry)
 		assert.Equal(t, int64(1), active)
 		assert.Nil(t, err)
 
 		tx.Model(&NodeLog.NodeLog{}).Where("node_id = ?", sub1.ID).Take(&log)
 		assert.Equal(t, int64(1), log.Version.Int64)
 
-		active, err = sub1.LogReportActive()
+		active, err = sub1.LogReportActive(registry)
 		tx.Model(&NodeLog.NodeLog{}).Where("node_id = ?", sub1.ID).Take(&log)
 		assert.Equal(t, int64(2), log.Version.Int64)
 	})
 }
 
 func TestNodeInfo_RemoveSlaveNode(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
-	tx := models.NodeInfoDB
+	tx := registry
 
 	t.Run("normal case", func(t *testing.T) {
 		var legacy NodeInfoLegacy.NodeInfoLegacy
 		assert.ErrorIs(t, tx.Model(&NodeInfoLegacy.NodeInfoLegacy{}).Where("id = ?", sub1.ID).Take(&legacy).Error, gorm.ErrRecordNotFound)
 
-		result, err := root.RemoveSlaveNode(sub1)
+		result, err := root.RemoveSlaveNode(registry, sub1)
 		assert.True(t, result)
 		assert.Nil(t, err)
 
@@ -349,11 +433,10 @@ func TestNodeInfo_RemoveSlaveNode(t *testing.T) {
 }
 
 func TestNodeInfo_Refresh(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
-	tx := models.NodeInfoDB
+	tx := registry
 
 	t.Run("change the name of sub1", func(t *testing.T) {
 		newName := sub1.Name + sub1.NodeVersion
@@ -363,17 +446,16 @@ func TestNodeInfo_Refresh(t *testing.T) {
 		}
 
 		assert.NotEqual(t, newName, sub1.Name)
-		sub1.Refresh()
+		sub1.Refresh(registry)
 		assert.Equal(t, newName, sub1.Name)
 	})
 }
 
 func TestNodeInfo_IsEqual(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
-	tx := models.NodeInfoDB
+	tx := registry
 
 	t.Run("equal", func(t *testing.T) {
 		var node NodeInfo
@@ -416,11 +498,10 @@ func TestNodeInfo_IsEqual(t *testing.T) {
 }
 
 func TestNodeInfo_IsEqualToRegistered(t *testing.T) {
-	setupGorm(t)
+	registry = database.Begin(t)
 	prepareNodeInfo(t)
-	defer teardownNodeInfo(t)
 
-	tx := models.NodeInfoDB
+	tx := registry
 
 	t.Run("equal", func(t *testing.T) {
 		var node NodeInfo
@@ -463,3 +544,66 @@ func TestNodeInfo_IsEqualToRegistered(t *testing.T) {
 		assert.ErrorIs(t, subN.IsEqualToRegistered(node.ToRegisteredNodeInfo()), ErrNodeIsNotEqualBecauseOfLevelAndTurn)
 	})
 }
+
+func TestValidateHost(t *testing.T) {
+	for _, host := range []string{"10.0.0.1", "2001:db8::1", "[2001:db8::1]", "localhost", "producer-1.example.com", "producer-1.example.com."} {
+		assert.Nil(t, models.ValidateHost(host), host)
+	}
+	for _, host := range []string{"", "-producer", "producer_1", "a..b", "host:8080", "10.0.0.1/24"} {
+		assert.ErrorIs(t, models.ValidateHost(host), models.ErrHostInvalid, host)
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	assert.Equal(t, "2001:db8::1", models.NormalizeHost("[2001:DB8:0::1]"))
+	assert.Equal(t, "192.168.0.1", models.NormalizeHost("::ffff:192.168.0.1"))
+	assert.Equal(t, "producer-1.example.com", models.NormalizeHost("Producer-1.Example.com"))
+}
+
+func TestPagination_Normalize(t *testing.T) {
+	p := models.Pagination{}
+	p.Normalize()
+	assert.Equal(t, models.Pagination{Page: 1, PageSize: models.PaginationPageSizeDefault}, p)
+	assert.Equal(t, 0, p.Offset())
+	p = models.Pagination{Page: 3, PageSize: 1000}
+	p.Normalize()
+	assert.Equal(t, models.PaginationPageSizeMaximum, p.PageSize)
+	assert.Equal(t, 200, p.Offset())
+}
+
+func TestBuildNodeTree(t *testing.T) {
+	ids := func(trees []*NodeTree) []uint64 {
+		result := make([]uint64, len(trees))
+		for i, tree := range trees {
+			result[i] = tree.ID
+		}
+		return result
+	}
+	t.Run("Master and slaves", func(t *testing.T) {
+		nodes := []NodeInfo{
+			{ID: 1, Level: 0},
+			{ID: 3, Level: 1, SuperiorID: 1, Turn: 1},
+			{ID: 2, Level: 1, SuperiorID: 1, Turn: 2},
+		}
+		at := time.Now()
+		roots := BuildNodeTree(nodes, map[uint64]time.Time{3: at})
+		assert.Equal(t, []uint64{1}, ids(roots))
+		assert.Equal(t, []uint64{3, 2}, ids(roots[0].Subordinates))
+		assert.Nil(t, roots[0].LastActiveAt)
+		assert.Equal(t, at, *roots[0].Subordinates[0].LastActiveAt)
+	})
+	t.Run("Superior excluded", func(t *testing.T) {
+		nodes := []NodeInfo{{ID: 2, Level: 1, SuperiorID: 1, Turn: 1}, {ID: 3, Level: 1, SuperiorID: 1, Turn: 2}}
+		assert.Equal(t, []uint64{2, 3}, ids(BuildNodeTree(nodes, nil)))
+	})
+	t.Run("Cycle", func(t *testing.T) {
+		nodes := []NodeInfo{{ID: 1, SuperiorID: 2}, {ID: 2, SuperiorID: 1}}
+		roots := BuildNodeTree(nodes, nil)
+		assert.Equal(t, []uint64{1}, ids(roots))
+		assert.Equal(t, []uint64{2}, ids(roots[0].Subordinates))
+		assert.Empty(t, roots[0].Subordinates[0].Subordinates)
+	})
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, BuildNodeTree(nil, nil))
+	})
+}
@@ -1 +1,23 @@
 package models
+
+import (
+	"context"
+
+	base "github.com/rhosocial/go-rush-producer/models"
+	"gorm.io/gorm"
+)
+
+// GetNodeInfoLegacies 按条件分页查询已删除节点的记录，最近更新的在前。
+func GetNodeInfoLegacies(ctx context.Context, db *gorm.DB, filter *NodeInfoLegacyFilter, pagination base.Pagination) (*base.Page[NodeInfoLegacy], error) {
+	page := base.Page[NodeInfoLegacy]{Pagination: pagination, Items: make([]NodeInfoLegacy, 0)}
+	query := func() *gorm.DB {
+		return db.WithContext(ctx).Model(&NodeInfoLegacy{}).Scopes(ScopeFilter(filter))
+	}
+	if tx := query().Count(&page.Total); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx := query().Scopes(base.ScopePagination(&page.Pagination)).Order("updated_at desc, id desc").Find(&page.Items); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &page, nil
+}
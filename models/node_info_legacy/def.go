@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	base "github.com/rhosocial/go-rush-producer/models"
+	"gorm.io/gorm"
 	"gorm.io/plugin/optimisticlock"
 )
 
@@ -15,6 +17,10 @@ type NodeInfoLegacy struct {
 	Level       uint8                  `gorm:"column:level;<-:create" json:"Level"`
 	SuperiorID  uint64                 `gorm:"column:superior_id;<-create" json:"superior_id"`
 	Turn        uint32                 `gorm:"column:turn;<-:create" json:"order"`
+	Zone        string                 `gorm:"column:zone;<-:create" json:"zone"`
+	Rack        string                 `gorm:"column:rack;<-:create" json:"rack"`
+	Weight      uint32                 `gorm:"column:weight;<-:create" json:"weight"`
+	Labels      base.NodeLabels        `gorm:"column:labels;<-:create" json:"labels"`
 	CreatedAt   time.Time              `gorm:"column:created_at;<-:create" json:"created_at"`
 	UpdatedAt   time.Time              `gorm:"column:updated_at;<-:create" json:"updated_at"`
 	Version     optimisticlock.Version `gorm:"column:version;<-:create" json:"version"`
@@ -23,3 +29,44 @@ type NodeInfoLegacy struct {
 func (m *NodeInfoLegacy) TableName() string {
 	return "node_info_legacy"
 }
+
+// NodeInfoLegacyFilter 已删除节点记录的查询条件。零值表示不限制该项。
+// 时间条件作用于 updated_at，即删除前最后一次更新的时间，格式为 RFC 3339。
+type NodeInfoLegacyFilter struct {
+	base.NodeSelector
+	ID    uint64    `form:"id" json:"id,omitempty"`
+	Name  string    `form:"name" json:"name,omitempty"`
+	Host  string    `form:"host" json:"host,omitempty"`
+	Port  uint16    `form:"port" json:"port,omitempty"`
+	Since time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" json:"since"`
+	Until time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00" json:"until"`
+}
+
+// ScopeFilter 附加查询条件。
+func ScopeFilter(filter *NodeInfoLegacyFilter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter == nil {
+			return db
+		}
+		db = db.Scopes(base.ScopeNodeSelector(&filter.NodeSelector))
+		if filter.ID > 0 {
+			db = db.Where("id = ?", filter.ID)
+		}
+		if len(filter.Name) > 0 {
+			db = db.Where("name = ?", filter.Name)
+		}
+		if len(filter.Host) > 0 {
+			db = db.Where("host = ?", base.NormalizeHost(filter.Host))
+		}
+		if filter.Port > 0 {
+			db = db.Where("port = ?", filter.Port)
+		}
+		if !filter.Since.IsZero() {
+			db = db.Where("updated_at >= ?", filter.Since)
+		}
+		if !filter.Until.IsZero() {
+			db = db.Where("updated_at < ?", filter.Until)
+		}
+		return db
+	}
+}
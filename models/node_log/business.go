@@ -1,23 +1,63 @@
 package models
 
 import (
+	"context"
 	"time"
 
 	"github.com/rhosocial/go-rush-producer/models"
+	"gorm.io/gorm"
 )
 
-func (m *NodeLog) Record() (int64, error) {
-	tx := models.NodeInfoDB.Create(m)
+func (m *NodeLog) Record(db *gorm.DB) (int64, error) {
+	tx := db.Create(m)
 	if tx.Error == nil {
 		return tx.RowsAffected, nil
 	}
 	return 0, tx.Error
 }
 
-func (m *NodeLog) VersionUp() (int64, error) {
-	tx := models.NodeInfoDB.Model(m).Update("updated_at", time.Now())
+func (m *NodeLog) VersionUp(db *gorm.DB) (int64, error) {
+	tx := db.Model(m).Update("updated_at", time.Now())
 	if tx.Error == nil {
 		return tx.RowsAffected, nil
 	}
 	return 0, tx.Error
 }
+
+// GetNodeLogs 按条件分页查询节点日志，最近更新的在前。
+func GetNodeLogs(ctx context.Context, db *gorm.DB, filter *NodeLogFilter, pagination models.Pagination) (*models.Page[NodeLog], error) {
+	page := models.Page[NodeLog]{Pagination: pagination, Items: make([]NodeLog, 0)}
+	query := func() *gorm.DB {
+		return db.WithContext(ctx).Model(&NodeLog{}).Scopes(ScopeFilter(filter))
+	}
+	if tx := query().Count(&page.Total); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx := query().Scopes(models.ScopePagination(&page.Pagination)).Order("updated_at desc, id desc").Find(&page.Items); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &page, nil
+}
+
+// GetLatestActiveReports 获取各节点最近一次报告活跃的时间。从未报告的节点不在结果中。
+func GetLatestActiveReports(ctx context.Context, db *gorm.DB, nodeIDs []uint64) (map[uint64]time.Time, error) {
+	reports := make(map[uint64]time.Time, len(nodeIDs))
+	if len(nodeIDs) == 0 {
+		return reports, nil
+	}
+	var rows []struct {
+		NodeID    uint64
+		UpdatedAt time.Time
+	}
+	tx := db.WithContext(ctx).Model(&NodeLog{}).
+		Select("node_id, MAX(updated_at) AS updated_at").
+		Where("type = ?", NodeLogTypeReportActive).Where("node_id IN ?", nodeIDs).
+		Group("node_id").Scan(&rows)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	for _, row := range rows {
+		reports[row.NodeID] = row.UpdatedAt
+	}
+	return reports, nil
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"gorm.io/gorm"
 	"gorm.io/plugin/optimisticlock"
 )
 
@@ -14,6 +15,7 @@ const (
 	NodeLogTypeExistedNodeSlaveWithdrawn            = 4 // The existed slave node report withdrawn
 	NodeLogTypeExistedNodeSlaveReportMasterInactive = 5 // The existed slave report master as inactive
 	NodeLogTypeExistedNodeMasterReportSlaveInactive = 6 // The existed master report slave as inactive
+	NodeLogTypeExistedNodeSlaveModified             = 7 // The existed slave node report modified
 )
 
 type NodeLog struct {
@@ -29,3 +31,37 @@ type NodeLog struct {
 func (m *NodeLog) TableName() string {
 	return "node_log"
 }
+
+// NodeLogFilter 节点日志查询条件。零值表示不限制该项。时间条件作用于 updated_at，格式为 RFC 3339。
+type NodeLogFilter struct {
+	NodeID       uint64    `form:"node_id" json:"node_id,omitempty"`
+	TargetNodeID uint64    `form:"target_node_id" json:"target_node_id,omitempty"`
+	Types        []uint8   `form:"type" json:"type,omitempty"`
+	Since        time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" json:"since"`
+	Until        time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00" json:"until"`
+}
+
+// ScopeFilter 附加查询条件。
+func ScopeFilter(filter *NodeLogFilter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter == nil {
+			return db
+		}
+		if filter.NodeID > 0 {
+			db = db.Where("node_id = ?", filter.NodeID)
+		}
+		if filter.TargetNodeID > 0 {
+			db = db.Where("target_node_id = ?", filter.TargetNodeID)
+		}
+		if len(filter.Types) > 0 {
+			db = db.Where("type IN ?", filter.Types)
+		}
+		if !filter.Since.IsZero() {
+			db = db.Where("updated_at >= ?", filter.Since)
+		}
+		if !filter.Until.IsZero() {
+			db = db.Where("updated_at < ?", filter.Until)
+		}
+		return db
+	}
+}
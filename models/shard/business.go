@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 归属变更均以当前所有者或目标节点为条件，以免覆盖其它节点同时作出的变更。返回值表示是否变更成功。
+
+// GetShards 获取所有分片，按编号排列。
+func GetShards(ctx context.Context, db *gorm.DB) ([]Shard, error) {
+	shards := make([]Shard, 0)
+	if tx := db.WithContext(ctx).Order("id").Find(&shards); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return shards, nil
+}
+
+// GetShardsOf 获取 id 所有或应当所有的分片，按编号排列。
+func GetShardsOf(ctx context.Context, db *gorm.DB, id uint64) ([]Shard, error) {
+	shards := make([]Shard, 0)
+	if tx := db.WithContext(ctx).Where("owner_id = ? OR target_id = ?", id, id).Order("id").Find(&shards); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return shards, nil
+}
+
+// CreateShards 登记指定编号的分片，已存在的分片保持不变。
+func CreateShards(ctx context.Context, db *gorm.DB, ids []uint32) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	shards := make([]Shard, len(ids))
+	for i, id := range ids {
+		shards[i].ID = id
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&shards).Error
+}
+
+// Retarget 将目标节点改为 target。
+func (m *Shard) Retarget(ctx context.Context, db *gorm.DB, target uint64) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Shard{}).Where("id = ? AND target_id = ?", m.ID, m.TargetID).Update("target_id", target)
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.TargetID = target
+	return true, nil
+}
+
+// Release 当前所有者释放分片。
+func (m *Shard) Release(ctx context.Context, db *gorm.DB) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Shard{}).Where("id = ? AND owner_id = ?", m.ID, m.OwnerID).
+		Updates(map[string]interface{}{"owner_id": 0, "lease_until": nil})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.OwnerID = 0
+	m.LeaseUntil = nil
+	return true, nil
+}
+
+// Revoke 主节点收回已不在集群中的节点所有的分片。仅当其租约在 at 时已到期才能收回。
+func (m *Shard) Revoke(ctx context.Context, db *gorm.DB, at time.Time) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Shard{}).Where("id = ? AND owner_id = ? AND (lease_until IS NULL OR lease_until < ?)", m.ID, m.OwnerID, at).
+		Updates(map[string]interface{}{"owner_id": 0, "lease_until": nil})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.OwnerID = 0
+	m.LeaseUntil = nil
+	return true, nil
+}
+
+// Acquire 目标节点 owner 取得无人所有的分片，租约至 until。
+func (m *Shard) Acquire(ctx context.Context, db *gorm.DB, owner uint64, until time.Time) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Shard{}).Where("id = ? AND owner_id = 0 AND target_id = ?", m.ID, owner).
+		Updates(map[string]interface{}{"owner_id": owner, "lease_until": until})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.OwnerID = owner
+	m.LeaseUntil = &until
+	return true, nil
+}
+
+// Renew 当前所有者将租约延长至 until。目标已不是当前所有者时不能续约。
+func (m *Shard) Renew(ctx context.Context, db *gorm.DB, until time.Time) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Shard{}).Where("id = ? AND owner_id = ? AND target_id = owner_id", m.ID, m.OwnerID).
+		Update("lease_until", until)
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.LeaseUntil = &until
+	return true, nil
+}
+
+// ReleaseShardsOf 释放 owner 所有的全部分片，返回释放的分片数。
+func ReleaseShardsOf(ctx context.Context, db *gorm.DB, owner uint64) (int64, error) {
+	tx := db.WithContext(ctx).Model(&Shard{}).Where("owner_id = ?", owner).
+		Updates(map[string]interface{}{"owner_id": 0, "lease_until": nil})
+	return tx.RowsAffected, tx.Error
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Shard 分片的归属。ID 为分片编号，从 0 开始。
+//
+// 主节点按当前成员计算每个分片的目标节点，记录为 TargetID；当前所有者发现目标不是自己后释放（OwnerID 置 0），
+// 目标节点此后才能取得（OwnerID 置为自己）。因此同一分片在任一时刻至多有一个所有者。
+//
+// 所有者每轮续约，租约到期（LeaseUntil）前其它节点不能收回该分片；目标已不是自己的所有者不能续约。
+// 因此失联或已被移除的所有者至多在租约到期前仍认为自己所有该分片，此后才会被收回。
+type Shard struct {
+	ID         uint32     `gorm:"column:id;primaryKey;autoIncrement:false" json:"id"`
+	OwnerID    uint64     `gorm:"column:owner_id;index;default:0" json:"owner_id"`   // 当前所有者。为 0 表示无人所有。
+	TargetID   uint64     `gorm:"column:target_id;index;default:0" json:"target_id"` // 应当所有的节点。为 0 表示该分片已停用。
+	LeaseUntil *time.Time `gorm:"column:lease_until" json:"lease_until"`             // 当前所有者的租约到期时间。无人所有时为空。
+	CreatedAt  time.Time  `gorm:"column:created_at;autoCreateTime:milli" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at;autoUpdateTime:milli" json:"updated_at"`
+}
+
+func (m *Shard) TableName() string {
+	return "shard"
+}
+
+// IsSettled 分片是否已由目标节点所有。
+func (m *Shard) IsSettled() bool {
+	return m.OwnerID != 0 && m.OwnerID == m.TargetID
+}
+
+// IsLeased 在 at 时当前所有者的租约是否仍有效。
+func (m *Shard) IsLeased(at time.Time) bool {
+	return m.OwnerID != 0 && m.LeaseUntil != nil && m.LeaseUntil.After(at)
+}
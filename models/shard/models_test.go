@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rhosocial/go-rush-producer/tests/database"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// registry 测试所用的数据库，每个测试在事务中进行，结束时回滚。
+var registry *gorm.DB
+
+// getShard 读取分片的当前记录。
+func getShard(t *testing.T, id uint32) *Shard {
+	var shard Shard
+	if err := registry.Take(&shard, id).Error; err != nil {
+		t.Fatalf(err.Error())
+	}
+	return &shard
+}
+
+// prepareShard 重新登记分片 id，目标节点为 target。
+func prepareShard(t *testing.T, id uint32, target uint64) *Shard {
+	ctx := context.Background()
+	if err := registry.Delete(&Shard{}, id).Error; err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := CreateShards(ctx, registry, []uint32{id}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	shard := getShard(t, id)
+	ok, err := shard.Retarget(ctx, registry, target)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	return shard
+}
+
+func TestShard_Lifecycle(t *testing.T) {
+	registry = database.Begin(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	shard := prepareShard(t, 0, 1)
+	ok, err := shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, getShard(t, 0).IsSettled())
+	assert.True(t, getShard(t, 0).IsLeased(now))
+
+	ok, err = shard.Renew(ctx, registry, now.Add(20*time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, getShard(t, 0).IsLeased(now.Add(15*time.Second)))
+
+	// 主节点改变目标后，所有者释放，新的目标节点取得。
+	ok, err = shard.Retarget(ctx, registry, 2)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = shard.Release(ctx, registry)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	record := getShard(t, 0)
+	assert.Equal(t, uint64(0), record.OwnerID)
+	assert.Nil(t, record.LeaseUntil)
+
+	ok, err = record.Acquire(ctx, registry, 2, now.Add(10*time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), getShard(t, 0).OwnerID)
+}
+
+func TestShard_LostRace(t *testing.T) {
+	registry = database.Begin(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	t.Run("acquire while owned", func(t *testing.T) {
+		shard := prepareShard(t, 1, 1)
+		stale := *shard
+		_, _ = shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+		// 另一节点在主节点改变目标后，以改变前读取的记录取得。
+		_, _ = shard.Retarget(ctx, registry, 2)
+		ok, err := stale.Acquire(ctx, registry, 2, now.Add(10*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(1), getShard(t, 1).OwnerID)
+	})
+	t.Run("acquire by non-target", func(t *testing.T) {
+		shard := prepareShard(t, 2, 1)
+		ok, err := shard.Acquire(ctx, registry, 2, now.Add(10*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(0), getShard(t, 2).OwnerID)
+	})
+	t.Run("acquire twice", func(t *testing.T) {
+		shard := prepareShard(t, 3, 1)
+		stale := *shard
+		ok, err := shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = stale.Acquire(ctx, registry, 1, now.Add(20*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+	t.Run("release by former owner", func(t *testing.T) {
+		shard := prepareShard(t, 4, 1)
+		_, _ = shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+		stale := *shard
+		_, _ = shard.Retarget(ctx, registry, 2)
+		_, _ = shard.Release(ctx, registry)
+		_, _ = shard.Acquire(ctx, registry, 2, now.Add(10*time.Second))
+
+		ok, err := stale.Release(ctx, registry)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(2), getShard(t, 4).OwnerID)
+	})
+	t.Run("retarget with stale target", func(t *testing.T) {
+		shard := prepareShard(t, 5, 1)
+		stale := *shard
+		_, _ = shard.Retarget(ctx, registry, 2)
+		ok, err := stale.Retarget(ctx, registry, 3)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(2), getShard(t, 5).TargetID)
+	})
+	t.Run("revoke while leased", func(t *testing.T) {
+		shard := prepareShard(t, 6, 1)
+		_, _ = shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+		ok, err := shard.Revoke(ctx, registry, now)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(1), getShard(t, 6).OwnerID)
+
+		ok, err = shard.Revoke(ctx, registry, now.Add(11*time.Second))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		record := getShard(t, 6)
+		assert.Equal(t, uint64(0), record.OwnerID)
+		assert.Nil(t, record.LeaseUntil)
+	})
+	t.Run("revoke after renewed", func(t *testing.T) {
+		shard := prepareShard(t, 7, 1)
+		_, _ = shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+		stale := *shard
+		_, _ = shard.Renew(ctx, registry, now.Add(30*time.Second))
+		// 主节点以续约前读取的记录判断租约已到期，但续约已生效。
+		ok, err := stale.Revoke(ctx, registry, now.Add(20*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(1), getShard(t, 7).OwnerID)
+	})
+	t.Run("renew after retargeted", func(t *testing.T) {
+		shard := prepareShard(t, 8, 1)
+		_, _ = shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+		_, _ = shard.Retarget(ctx, registry, 2)
+		ok, err := shard.Renew(ctx, registry, now.Add(20*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.True(t, getShard(t, 8).LeaseUntil.Equal(now.Add(10*time.Second)))
+	})
+	t.Run("renew after revoked", func(t *testing.T) {
+		shard := prepareShard(t, 9, 1)
+		_, _ = shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+		stale := *shard
+		_, _ = shard.Revoke(ctx, registry, now.Add(11*time.Second))
+		ok, err := stale.Renew(ctx, registry, now.Add(20*time.Second))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, uint64(0), getShard(t, 9).OwnerID)
+	})
+}
+
+func TestReleaseShardsOf(t *testing.T) {
+	registry = database.Begin(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+	if err := registry.Where("1 = 1").Delete(&Shard{}).Error; err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for id := uint32(0); id < 3; id++ {
+		shard := prepareShard(t, id, 1)
+		_, _ = shard.Acquire(ctx, registry, 1, now.Add(10*time.Second))
+	}
+	other := prepareShard(t, 3, 2)
+	_, _ = other.Acquire(ctx, registry, 2, now.Add(10*time.Second))
+
+	count, err := ReleaseShardsOf(ctx, registry, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	shards, err := GetShardsOf(ctx, registry, 1)
+	assert.Nil(t, err)
+	assert.Len(t, shards, 3)
+	for _, shard := range shards {
+		assert.Equal(t, uint64(0), shard.OwnerID)
+		assert.Nil(t, shard.LeaseUntil)
+	}
+	assert.Equal(t, uint64(2), getShard(t, 3).OwnerID)
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+
+	"github.com/rhosocial/go-rush-producer/models"
+	"gorm.io/gorm"
+)
+
+// 状态变更均以当前状态和执行者为条件，以免覆盖其它节点同时作出的变更。返回值表示是否变更成功。
+
+// Create 登记待分配的任务。
+func (m *Task) Create(ctx context.Context, db *gorm.DB) error {
+	m.State = TaskStatePending
+	m.AssigneeID = 0
+	return db.WithContext(ctx).Create(m).Error
+}
+
+// GetTask 获取指定ID的任务。
+func GetTask(ctx context.Context, db *gorm.DB, id uint64) (*Task, error) {
+	var task Task
+	if tx := db.WithContext(ctx).Take(&task, id); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &task, nil
+}
+
+// GetTasks 按条件分页查询任务，最近更新的在前。
+func GetTasks(ctx context.Context, db *gorm.DB, filter *TaskFilter, pagination models.Pagination) (*models.Page[Task], error) {
+	page := models.Page[Task]{Pagination: pagination, Items: make([]Task, 0)}
+	query := func() *gorm.DB {
+		return db.WithContext(ctx).Model(&Task{}).Scopes(ScopeFilter(filter))
+	}
+	if tx := query().Count(&page.Total); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx := query().Scopes(models.ScopePagination(&page.Pagination)).Order("updated_at desc, id desc").Find(&page.Items); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &page, nil
+}
+
+// GetPendingTasks 按提交顺序获取至多 limit 个待分配的任务。
+func GetPendingTasks(ctx context.Context, db *gorm.DB, limit int) ([]Task, error) {
+	tasks := make([]Task, 0)
+	if tx := db.WithContext(ctx).Where("state = ?", TaskStatePending).Order("id").Limit(limit).Find(&tasks); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return tasks, nil
+}
+
+// CountActiveTasks 统计各从节点尚未结束的任务数。没有任务的从节点不出现在结果中。
+func CountActiveTasks(ctx context.Context, db *gorm.DB) (map[uint64]int64, error) {
+	var rows []struct {
+		AssigneeID uint64
+		Count      int64
+	}
+	tx := db.WithContext(ctx).Model(&Task{}).Select("assignee_id, count(*) as count").
+		Where("state IN ?", TaskStatesActive).Group("assignee_id").Scan(&rows)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	counts := make(map[uint64]int64, len(rows))
+	for _, row := range rows {
+		counts[row.AssigneeID] = row.Count
+	}
+	return counts, nil
+}
+
+// Assign 将待分配的任务分配给指定从节点，分配次数加一。
+func (m *Task) Assign(ctx context.Context, db *gorm.DB, assignee uint64) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Task{}).Where("id = ? AND state = ?", m.ID, TaskStatePending).Updates(map[string]interface{}{
+		"state":       TaskStateAssigned,
+		"assignee_id": assignee,
+		"attempts":    gorm.Expr("attempts + 1"),
+	})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.State, m.AssigneeID, m.Attempts = TaskStateAssigned, assignee, m.Attempts+1
+	return true, nil
+}
+
+// Acknowledge 记录从节点已确认任务。
+func (m *Task) Acknowledge(ctx context.Context, db *gorm.DB) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Task{}).Where("id = ? AND assignee_id = ? AND state = ?", m.ID, m.AssigneeID, TaskStateAssigned).
+		Update("state", TaskStateAcknowledged)
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.State = TaskStateAcknowledged
+	return true, nil
+}
+
+// Release 收回尚未结束的任务，使其重新待分配。
+func (m *Task) Release(ctx context.Context, db *gorm.DB) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Task{}).Where("id = ? AND assignee_id = ? AND state IN ?", m.ID, m.AssigneeID, TaskStatesActive).
+		Updates(map[string]interface{}{"state": TaskStatePending, "assignee_id": 0})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.State, m.AssigneeID = TaskStatePending, 0
+	return true, nil
+}
+
+// Finish 记录 assignee 报告的执行结果。Error 非空视为失败，否则视为成功。
+func (m *Task) Finish(ctx context.Context, db *gorm.DB, assignee uint64) (bool, error) {
+	state := TaskStateCompleted
+	if len(m.Error) > 0 {
+		state = TaskStateFailed
+	}
+	tx := db.WithContext(ctx).Model(&Task{}).Where("id = ? AND assignee_id = ? AND state IN ?", m.ID, assignee, TaskStatesActive).
+		Updates(map[string]interface{}{"state": state, "result": m.Result, "error": m.Error})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.State, m.AssigneeID = state, assignee
+	return true, nil
+}
+
+// Fail 将待分配的任务标记为失败，不再分配。reason 为失败原因。
+func (m *Task) Fail(ctx context.Context, db *gorm.DB, reason string) (bool, error) {
+	tx := db.WithContext(ctx).Model(&Task{}).Where("id = ? AND state = ?", m.ID, TaskStatePending).
+		Updates(map[string]interface{}{"state": TaskStateFailed, "error": reason})
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return false, tx.Error
+	}
+	m.State, m.Error = TaskStateFailed, reason
+	return true, nil
+}
+
+// ReleaseTasksOf 收回指定节点尚未结束的任务，返回收回的任务数。
+func ReleaseTasksOf(ctx context.Context, db *gorm.DB, assignees ...uint64) (int64, error) {
+	if len(assignees) == 0 {
+		return 0, nil
+	}
+	tx := db.WithContext(ctx).Model(&Task{}).Where("assignee_id IN ? AND state IN ?", assignees, TaskStatesActive).
+		Updates(map[string]interface{}{"state": TaskStatePending, "assignee_id": 0})
+	return tx.RowsAffected, tx.Error
+}
+
+// ReleaseUnacknowledgedTasks 收回已分配但尚未确认的任务，返回收回的任务数。
+func ReleaseUnacknowledgedTasks(ctx context.Context, db *gorm.DB) (int64, error) {
+	tx := db.WithContext(ctx).Model(&Task{}).Where("state = ?", TaskStateAssigned).
+		Updates(map[string]interface{}{"state": TaskStatePending, "assignee_id": 0})
+	return tx.RowsAffected, tx.Error
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 任务状态。
+const (
+	TaskStatePending      = "pending"      // 待分配。
+	TaskStateAssigned     = "assigned"     // 已分配，等待从节点确认。
+	TaskStateAcknowledged = "acknowledged" // 从节点已确认，正在执行。
+	TaskStateCompleted    = "completed"    // 执行成功。
+	TaskStateFailed       = "failed"       // 执行失败，或分配次数已达上限。
+)
+
+// TaskStatesActive 已分配给从节点、尚未结束的状态。
+var TaskStatesActive = []string{TaskStateAssigned, TaskStateAcknowledged}
+
+// Task 由主节点分配给从节点执行的任务。Payload 和 Result 的格式由提交者与执行者约定。
+type Task struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement;<-:false" json:"id"`
+	Name       string    `gorm:"column:name;type:varchar(64);index;<-:create" json:"name"`
+	Payload    string    `gorm:"column:payload;type:text;<-:create" json:"payload"`
+	State      string    `gorm:"column:state;type:varchar(16);index;default:pending" json:"state"`
+	AssigneeID uint64    `gorm:"column:assignee_id;index;default:0" json:"assignee_id"` // 执行任务的从节点ID。待分配时为 0。
+	Attempts   uint8     `gorm:"column:attempts;default:0" json:"attempts"`             // 已分配次数。
+	Result     string    `gorm:"column:result;type:text" json:"result"`
+	Error      string    `gorm:"column:error;type:text" json:"error"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime:milli" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at;autoUpdateTime:milli" json:"updated_at"`
+}
+
+func (m *Task) TableName() string {
+	return "task"
+}
+
+// IsFinished 任务是否已结束。
+func (m *Task) IsFinished() bool {
+	return m.State == TaskStateCompleted || m.State == TaskStateFailed
+}
+
+// TaskFilter 任务查询条件。零值表示不限制该项。时间条件作用于 updated_at，格式为 RFC 3339。
+type TaskFilter struct {
+	Name       string    `form:"name" json:"name,omitempty"`
+	State      string    `form:"state" json:"state,omitempty"`
+	AssigneeID uint64    `form:"assignee_id" json:"assignee_id,omitempty"`
+	Since      time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" json:"since"`
+	Until      time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00" json:"until"`
+}
+
+// ScopeFilter 附加查询条件。
+func ScopeFilter(filter *TaskFilter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter == nil {
+			return db
+		}
+		if len(filter.Name) > 0 {
+			db = db.Where("name = ?", filter.Name)
+		}
+		if len(filter.State) > 0 {
+			db = db.Where("state = ?", filter.State)
+		}
+		if filter.AssigneeID > 0 {
+			db = db.Where("assignee_id = ?", filter.AssigneeID)
+		}
+		if !filter.Since.IsZero() {
+			db = db.Where("updated_at >= ?", filter.Since)
+		}
+		if !filter.Until.IsZero() {
+			db = db.Where("updated_at < ?", filter.Until)
+		}
+		return db
+	}
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rhosocial/go-rush-producer/tests/database"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// registry 测试所用的数据库，每个测试在事务中进行，结束时回滚。
+var registry *gorm.DB
+
+func prepareTask(t *testing.T, name string) *Task {
+	task := Task{Name: name, Payload: "{}"}
+	if err := task.Create(context.Background(), registry); err != nil {
+		t.Fatalf(err.Error())
+	}
+	assert.Greater(t, task.ID, uint64(0))
+	assert.Equal(t, TaskStatePending, task.State)
+	return &task
+}
+
+func TestTask_Lifecycle(t *testing.T) {
+	registry = database.Begin(t)
+	ctx := context.Background()
+
+	task := prepareTask(t, "lifecycle")
+	ok, err := task.Assign(ctx, registry, 1)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(1), task.Attempts)
+
+	ok, err = task.Acknowledge(ctx, registry)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	task.Result = "done"
+	ok, err = task.Finish(ctx, registry, 1)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	record, err := GetTask(ctx, registry, task.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TaskStateCompleted, record.State)
+	assert.Equal(t, uint64(1), record.AssigneeID)
+	assert.Equal(t, uint8(1), record.Attempts)
+	assert.Equal(t, "done", record.Result)
+	assert.True(t, record.IsFinished())
+}
+
+func TestTask_LostRace(t *testing.T) {
+	registry = database.Begin(t)
+	ctx := context.Background()
+
+	t.Run("assign twice", func(t *testing.T) {
+		task := prepareTask(t, "assign twice")
+		stale := *task
+		ok, err := task.Assign(ctx, registry, 1)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+
+		// 另一主节点持有分配前读取的记录。
+		ok, err = stale.Assign(ctx, registry, 2)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		record, err := GetTask(ctx, registry, task.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), record.AssigneeID)
+		assert.Equal(t, uint8(1), record.Attempts)
+	})
+	t.Run("acknowledge by former assignee", func(t *testing.T) {
+		task := prepareTask(t, "acknowledge by former assignee")
+		_, _ = task.Assign(ctx, registry, 1)
+		stale := *task
+		ok, err := task.Release(ctx, registry)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		_, _ = task.Assign(ctx, registry, 2)
+
+		ok, err = stale.Acknowledge(ctx, registry)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+	t.Run("finish after release", func(t *testing.T) {
+		task := prepareTask(t, "finish after release")
+		_, _ = task.Assign(ctx, registry, 1)
+		_, _ = task.Acknowledge(ctx, registry)
+		ok, err := task.Release(ctx, registry)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+
+		report := Task{ID: task.ID, Result: "late"}
+		ok, err = report.Finish(ctx, registry, 1)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		record, err := GetTask(ctx, registry, task.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, TaskStatePending, record.State)
+		assert.Equal(t, uint64(0), record.AssigneeID)
+		assert.Empty(t, record.Result)
+	})
+	t.Run("finish twice", func(t *testing.T) {
+		task := prepareTask(t, "finish twice")
+		_, _ = task.Assign(ctx, registry, 1)
+		ok, err := (&Task{ID: task.ID}).Finish(ctx, registry, 1)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+
+		ok, err = (&Task{ID: task.ID, Error: "late"}).Finish(ctx, registry, 1)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		record, err := GetTask(ctx, registry, task.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, TaskStateCompleted, record.State)
+	})
+	t.Run("release finished", func(t *testing.T) {
+		task := prepareTask(t, "release finished")
+		_, _ = task.Assign(ctx, registry, 1)
+		stale := *task
+		_, _ = task.Finish(ctx, registry, 1)
+
+		ok, err := stale.Release(ctx, registry)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestReleaseTasksOf(t *testing.T) {
+	registry = database.Begin(t)
+	ctx := context.Background()
+
+	assigned := prepareTask(t, "assigned")
+	_, _ = assigned.Assign(ctx, registry, 1)
+	acknowledged := prepareTask(t, "acknowledged")
+	_, _ = acknowledged.Assign(ctx, registry, 1)
+	_, _ = acknowledged.Acknowledge(ctx, registry)
+	finished := prepareTask(t, "finished")
+	_, _ = finished.Assign(ctx, registry, 1)
+	_, _ = finished.Finish(ctx, registry, 1)
+	other := prepareTask(t, "other")
+	_, _ = other.Assign(ctx, registry, 2)
+
+	count, err := ReleaseTasksOf(ctx, registry)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	count, err = ReleaseTasksOf(ctx, registry, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	for _, task := range []*Task{assigned, acknowledged} {
+		record, err := GetTask(ctx, registry, task.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, TaskStatePending, record.State)
+		assert.Equal(t, uint64(0), record.AssigneeID)
+	}
+	record, err := GetTask(ctx, registry, finished.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TaskStateCompleted, record.State)
+	record, err = GetTask(ctx, registry, other.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, TaskStateAssigned, record.State)
+	assert.Equal(t, uint64(2), record.AssigneeID)
+
+	// 收回后的任务可再次分配，分配次数累加。
+	ok, err := assigned.Assign(ctx, registry, 2)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	record, err = GetTask(ctx, registry, assigned.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(2), record.Attempts)
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"context"
+
+	"github.com/rhosocial/go-rush-producer/models"
+	"gorm.io/gorm"
+)
+
+// Record 记录投递尝试。
+func (m *WebhookDelivery) Record(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Create(m).Error
+}
+
+// GetWebhookDeliveries 按条件分页查询投递记录，最近的在前。
+func GetWebhookDeliveries(ctx context.Context, db *gorm.DB, filter *WebhookDeliveryFilter, pagination models.Pagination) (*models.Page[WebhookDelivery], error) {
+	page := models.Page[WebhookDelivery]{Pagination: pagination, Items: make([]WebhookDelivery, 0)}
+	query := func() *gorm.DB {
+		return db.WithContext(ctx).Model(&WebhookDelivery{}).Scopes(ScopeFilter(filter))
+	}
+	if tx := query().Count(&page.Total); tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx := query().Scopes(models.ScopePagination(&page.Pagination)).Order("id desc").Find(&page.Items); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &page, nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookDelivery 事件通知的一次投递尝试。同一事件的所有投递尝试共用 DeliveryID，以 Target 区分目标。
+type WebhookDelivery struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement;<-:false" json:"id"`
+	DeliveryID string    `gorm:"column:delivery_id;type:varchar(32);index;<-:create" json:"delivery_id"`
+	NodeID     uint64    `gorm:"column:node_id;<-:create" json:"node_id"`                       // 发送通知的节点ID。
+	Target     string    `gorm:"column:target;type:varchar(255);index;<-:create" json:"target"` // 通知目标名称。不记录地址，以免泄露其中的凭据。
+	Event      string    `gorm:"column:event;type:varchar(32);<-:create" json:"event"`
+	Attempt    uint8     `gorm:"column:attempt;<-:create" json:"attempt"`         // 第几次尝试，从 1 开始。
+	StatusCode int       `gorm:"column:status_code;<-:create" json:"status_code"` // 响应状态码。未收到响应时为 0。
+	Succeeded  bool      `gorm:"column:succeeded;<-:create" json:"succeeded"`
+	Error      string    `gorm:"column:error;type:text;<-:create" json:"error"`
+	Duration   int64     `gorm:"column:duration;<-:create" json:"duration"` // 耗时（毫秒）。
+	Payload    string    `gorm:"column:payload;type:text;<-:create" json:"payload"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime:milli" json:"created_at"`
+}
+
+func (m *WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// WebhookDeliveryFilter 投递记录查询条件。零值表示不限制该项。时间条件作用于 created_at，格式为 RFC 3339。
+type WebhookDeliveryFilter struct {
+	DeliveryID string    `form:"delivery_id" json:"delivery_id,omitempty"`
+	Target     string    `form:"target" json:"target,omitempty"`
+	Event      string    `form:"event" json:"event,omitempty"`
+	Succeeded  *bool     `form:"succeeded" json:"succeeded,omitempty"`
+	Since      time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" json:"since"`
+	Until      time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00" json:"until"`
+}
+
+// ScopeFilter 附加查询条件。
+func ScopeFilter(filter *WebhookDeliveryFilter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter == nil {
+			return db
+		}
+		if len(filter.DeliveryID) > 0 {
+			db = db.Where("delivery_id = ?", filter.DeliveryID)
+		}
+		if len(filter.Target) > 0 {
+			db = db.Where("target = ?", filter.Target)
+		}
+		if len(filter.Event) > 0 {
+			db = db.Where("event = ?", filter.Event)
+		}
+		if filter.Succeeded != nil {
+			db = db.Where("succeeded = ?", *filter.Succeeded)
+		}
+		if !filter.Since.IsZero() {
+			db = db.Where("created_at >= ?", filter.Since)
+		}
+		if !filter.Until.IsZero() {
+			db = db.Where("created_at < ?", filter.Until)
+		}
+		return db
+	}
+}
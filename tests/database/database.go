@@ -0,0 +1,42 @@
+// Package database 为模型测试提供节点登记数据库。
+//
+// 测试数据库由环境变量 DSNVariable 指定，表结构参见 mysql/go_rush_producer.sql，
+// 也可使用 tests/environments 中的 docker-compose.yml 启动。未指定或无法连接时，依赖数据库的测试将被跳过。
+package database
+
+import (
+	"os"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// DSNVariable 测试数据库 DSN 所在的环境变量，格式参见 mysql.EnvMySQLServer.GetDSN，例如
+// user:password@tcp(localhost:3306)/go-rush-producer?charset=utf8mb4&parseTime=true&loc=Local
+const DSNVariable = "Producer_Test_MySQL_DSN"
+
+// Begin 连接测试数据库并开始事务，测试结束时回滚。每个测试因此互不影响，也不会在数据库中留下数据。
+//
+// 未指定测试数据库或无法连接时跳过测试。
+func Begin(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(DSNVariable)
+	if len(dsn) == 0 {
+		t.Skipf("%s is not set", DSNVariable)
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Skipf("test database is unreachable: %v", err)
+	}
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Skipf("test database is unreachable: %v", tx.Error)
+	}
+	t.Cleanup(func() {
+		if err := tx.Rollback().Error; err != nil {
+			t.Error(err)
+		}
+	})
+	return tx
+}
@@ -9,6 +9,10 @@ create table `go-rush-producer`.node_info
     level        tinyint unsigned                               not null comment '节点级别（0-master，1-slave）',
     superior_id  bigint unsigned   default '0'                  not null comment '上级ID。0表示没有上级。',
     turn         int unsigned      default '0'                  not null comment '上级主节点失效后的接替顺序（数值越小优先级越高）',
+    zone         varchar(255)      default ''                   not null comment '可用区',
+    rack         varchar(255)      default ''                   not null comment '机架',
+    weight       int unsigned      default '0'                  not null comment '权重（容量）',
+    labels       json                                           null comment '标签（JSON对象）',
     created_at   timestamp(3)      default CURRENT_TIMESTAMP(3) not null comment '创建时间',
     updated_at   timestamp(3)      default CURRENT_TIMESTAMP(3) not null on update CURRENT_TIMESTAMP(3) comment '最后更新时间',
     version      bigint unsigned   default '0'                  not null comment '本条记录版本。从0开始。',
@@ -33,6 +37,10 @@ create table `go-rush-producer`.node_info_legacy
     level        tinyint unsigned                               not null comment '（删除前最后一刻）节点级别（0-master，1-slave）',
     superior_id  bigint unsigned   default '0'                  not null comment '（删除前最后一刻）上级ID。0表示没有上级。',
     turn         int unsigned      default '0'                  not null comment '（删除前最后一刻）上级主节点失效后的接替顺序（数值越小优先级越高）',
+    zone         varchar(255)      default ''                   not null comment '（删除前最后一刻）可用区',
+    rack         varchar(255)      default ''                   not null comment '（删除前最后一刻）机架',
+    weight       int unsigned      default '0'                  not null comment '（删除前最后一刻）权重（容量）',
+    labels       json                                           null comment '（删除前最后一刻）标签（JSON对象）',
     created_at   timestamp(3)      default CURRENT_TIMESTAMP(3) not null comment '本条记录在node_info表的创建时间，而非本条记录在该表的创建时间',
     updated_at   timestamp(3)      default CURRENT_TIMESTAMP(3) not null on update CURRENT_TIMESTAMP(3) comment '最后更新时间，也即插入该表的时间',
     version      bigint unsigned   default '0'                  not null comment '本条记录版本。从0开始。'
@@ -71,3 +79,90 @@ create index node_log_relation_index
 create index node_log_type_index
     on `go-rush-producer`.node_log (type);
 
+
+create table `go-rush-producer`.webhook_delivery
+(
+    id          bigint unsigned auto_increment comment '投递记录ID'
+        primary key,
+    delivery_id varchar(32)       default ''                   not null comment '投递ID。同一事件的所有投递尝试共用',
+    node_id     bigint unsigned   default '0'                  not null comment '发送通知的节点ID',
+    target      varchar(255)      default ''                   not null comment '通知目标名称',
+    event       varchar(32)       default ''                   not null comment '事件类型',
+    attempt     tinyint unsigned  default '0'                  not null comment '第几次尝试，从1开始',
+    status_code smallint unsigned default '0'                  not null comment '响应状态码。未收到响应时为0',
+    succeeded   tinyint(1)        default '0'                  not null comment '是否投递成功',
+    error       text                                           null comment '错误信息',
+    duration    bigint            default '0'                  not null comment '耗时（毫秒）',
+    payload     text                                           null comment '通知内容',
+    created_at  timestamp(3)      default CURRENT_TIMESTAMP(3) not null comment '投递时间'
+)
+    comment '事件通知投递记录';
+
+create index webhook_delivery_delivery_id_index
+    on `go-rush-producer`.webhook_delivery (delivery_id);
+
+create index webhook_delivery_target_index
+    on `go-rush-producer`.webhook_delivery (target);
+
+create table `go-rush-producer`.task
+(
+    id          bigint unsigned auto_increment comment '任务ID'
+        primary key,
+    name        varchar(64)      default ''                   not null comment '任务名称',
+    payload     text                                          null comment '任务内容（由提交者与执行者约定）',
+    state       varchar(16)      default 'pending'            not null comment '状态（pending、assigned、acknowledged、completed、failed）',
+    assignee_id bigint unsigned  default '0'                  not null comment '执行任务的从节点ID。待分配时为0',
+    attempts    tinyint unsigned default '0'                  not null comment '已分配次数',
+    result      text                                          null comment '执行结果',
+    error       text                                          null comment '错误信息',
+    created_at  timestamp(3)     default CURRENT_TIMESTAMP(3) not null comment '提交时间',
+    updated_at  timestamp(3)     default CURRENT_TIMESTAMP(3) not null on update CURRENT_TIMESTAMP(3) comment '最后更新时间'
+)
+    comment '任务';
+
+create index task_name_index
+    on `go-rush-producer`.task (name);
+
+create index task_state_index
+    on `go-rush-producer`.task (state);
+
+create index task_assignee_id_index
+    on `go-rush-producer`.task (assignee_id);
+
+create table `go-rush-producer`.shard
+(
+    id          int unsigned                                 not null comment '分片编号，从0开始'
+        primary key,
+    owner_id    bigint unsigned default '0'                  not null comment '当前所有者。0表示无人所有',
+    target_id   bigint unsigned default '0'                  not null comment '应当所有的节点。0表示该分片已停用',
+    lease_until timestamp(3)                                 null comment '当前所有者的租约到期时间。无人所有时为空',
+    created_at  timestamp(3)    default CURRENT_TIMESTAMP(3) not null comment '创建时间',
+    updated_at  timestamp(3)    default CURRENT_TIMESTAMP(3) not null on update CURRENT_TIMESTAMP(3) comment '最后更新时间'
+)
+    comment '分片归属';
+
+create index shard_owner_id_index
+    on `go-rush-producer`.shard (owner_id);
+
+create index shard_target_id_index
+    on `go-rush-producer`.shard (target_id);
+
+create table `go-rush-producer`.cron_job
+(
+    name             varchar(64)                                  not null comment '定时任务名称'
+        primary key,
+    spec             varchar(128)    default ''                   not null comment 'cron 表达式',
+    next_run_at      timestamp(3)                                 not null comment '下次执行时间',
+    runner_id        bigint unsigned default '0'                  not null comment '正在执行的节点ID。0表示未在执行',
+    locked_until     timestamp(3)                                 null comment '执行锁到期时间',
+    last_started_at  timestamp(3)                                 null comment '上次开始执行时间',
+    last_finished_at timestamp(3)                                 null comment '上次执行结束时间',
+    last_error       text                                         null comment '上次执行的错误信息',
+    last_duration    bigint          default '0'                  not null comment '上次执行的耗时（毫秒）',
+    created_at       timestamp(3)    default CURRENT_TIMESTAMP(3) not null comment '创建时间',
+    updated_at       timestamp(3)    default CURRENT_TIMESTAMP(3) not null on update CURRENT_TIMESTAMP(3) comment '最后更新时间'
+)
+    comment '定时任务调度记录';
+
+create index cron_job_next_run_at_index
+    on `go-rush-producer`.cron_job (next_run_at);